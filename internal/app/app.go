@@ -1,8 +1,10 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"strings"
 
 	"github.com/talyguryn/konta/internal/cmd"
@@ -23,6 +25,26 @@ func (a *App) Run(args []string) int {
 		return 0
 	}
 
+	// validate runs in CI: it needs no root, config or writable log directory.
+	if strings.ToLower(args[0]) == "validate" {
+		path, strict := parseValidateArgs(args[1:])
+		if err := cmd.Validate(path, strict); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	// config validate checks a file before it is deployed; like validate it
+	// needs no root or log directory.
+	if len(args) > 1 && strings.ToLower(args[0]) == "config" && args[1] == "validate" {
+		if err := cmd.ValidateConfig(parseConfigValidateArgs(args[2:])); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
 	if err := logger.Init(""); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
 		return 1
@@ -59,6 +81,14 @@ func (a *App) Run(args []string) int {
 		}
 		return 0
 
+	case "update-watchdog":
+		// Started by a self-update; not meant to be run by hand.
+		if err := cmd.WatchSelfUpdate(); err != nil {
+			logger.Error("Self-update watchdog failed: %v", err)
+			return 1
+		}
+		return 0
+
 	case "run", "-r":
 		dryRun, watch := parseRunArgs(args[1:])
 		if err := cmd.Run(dryRun, watch, a.version); err != nil {
@@ -74,67 +104,104 @@ func (a *App) Run(args []string) int {
 		return 0
 
 	case "-d":
-		if err := cmd.ManageDaemon("enable"); err != nil {
+		if err := cmd.ManageDaemon("enable", hasUserFlag(args[1:])); err != nil {
 			logger.Fatal("Daemon management failed: %v", err)
 		}
 		return 0
 
 	case "daemon":
 		if len(args) < 2 {
-			fmt.Println("Usage: konta daemon [enable|disable|restart|status]")
+			fmt.Println("Usage: konta daemon [enable|disable|restart|status] [--user]")
 			return 1
 		}
-		if err := cmd.ManageDaemon(args[1]); err != nil {
+		if err := cmd.ManageDaemon(args[1], hasUserFlag(args[2:])); err != nil {
 			logger.Fatal("Daemon management failed: %v", err)
 		}
 		return 0
 
 	case "start":
 		logger.Warn("Command 'start' is deprecated. Use 'enable' instead.")
-		if err := cmd.ManageDaemon("enable"); err != nil {
+		if err := cmd.ManageDaemon("enable", hasUserFlag(args[1:])); err != nil {
 			logger.Fatal("Enable failed: %v", err)
 		}
 		return 0
 
 	case "stop":
 		logger.Warn("Command 'stop' is deprecated. Use 'disable' instead.")
-		if err := cmd.ManageDaemon("disable"); err != nil {
+		if err := cmd.ManageDaemon("disable", hasUserFlag(args[1:])); err != nil {
 			logger.Fatal("Disable failed: %v", err)
 		}
 		return 0
 
 	case "enable":
-		if err := cmd.ManageDaemon("enable"); err != nil {
+		if err := cmd.ManageDaemon("enable", hasUserFlag(args[1:])); err != nil {
 			logger.Fatal("Enable failed: %v", err)
 		}
 		return 0
 
 	case "disable":
-		if err := cmd.ManageDaemon("disable"); err != nil {
+		if err := cmd.ManageDaemon("disable", hasUserFlag(args[1:])); err != nil {
 			logger.Fatal("Disable failed: %v", err)
 		}
 		return 0
 
 	case "restart":
-		if err := cmd.ManageDaemon("restart"); err != nil {
+		if err := cmd.ManageDaemon("restart", hasUserFlag(args[1:])); err != nil {
 			logger.Fatal("Restart failed: %v", err)
 		}
 		return 0
 
 	case "status", "-s":
-		if err := cmd.Status(a.version); err != nil {
+		jsonOutput, appFilter := parseStatusArgs(args[1:])
+		if err := cmd.Status(a.version, jsonOutput, appFilter); err != nil {
 			logger.Fatal("Status failed: %v", err)
 		}
 		return 0
 
+	case "diff":
+		if err := cmd.Diff(parseDiffArgs(args[1:])); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		return 0
+
+	case "plan":
+		if err := cmd.Plan(parsePlanArgs(args[1:])); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		return 0
+
+	case "logs":
+		app, follow, service := parseLogsArgs(args[1:])
+		return composeExitCode(cmd.Logs(app, follow, service))
+
+	case "compose":
+		app, composeArgs := parseComposeArgs(args[1:])
+		return composeExitCode(cmd.Compose(app, composeArgs))
+
+	case "app":
+		action, app, services := parseAppArgs(args[1:])
+		if err := cmd.App(action, app, services); err != nil {
+			logger.Fatal("App %s failed: %v", action, err)
+		}
+		return 0
+
 	case "journal", "-j", "-J":
-		if err := cmd.Journal(); err != nil {
+		if err := cmd.Journal(hasUserFlag(args[1:])); err != nil {
 			logger.Fatal("Journal failed: %v", err)
 		}
 		return 0
 
 	case "config":
-		if err := cmd.Config(parseConfigArgs(args[1:])); err != nil {
+		edit, effective, app := parseConfigArgs(args[1:])
+		if effective {
+			if err := cmd.EffectiveConfig(app); err != nil {
+				logger.Fatal("Config failed: %v", err)
+			}
+			return 0
+		}
+		if err := cmd.Config(edit); err != nil {
 			logger.Fatal("Config failed: %v", err)
 		}
 		return 0
@@ -146,6 +213,16 @@ func (a *App) Run(args []string) int {
 	}
 }
 
+// hasUserFlag reports whether --user selects the systemd user unit.
+func hasUserFlag(args []string) bool {
+	for _, arg := range args {
+		if arg == "--user" {
+			return true
+		}
+	}
+	return false
+}
+
 func parseUpdateArgs(args []string) (bool, string) {
 	forceYes := false
 	releaseChannel := ""
@@ -186,11 +263,144 @@ func parseDeployArgs(args []string) bool {
 	return false
 }
 
-func parseConfigArgs(args []string) bool {
+func parseStatusArgs(args []string) (bool, string) {
+	jsonOutput := false
+	appFilter := ""
+	for index := 0; index < len(args); index++ {
+		switch {
+		case args[index] == "--json":
+			jsonOutput = true
+		case args[index] == "--app" && index+1 < len(args):
+			appFilter = args[index+1]
+			index++
+		case strings.HasPrefix(args[index], "--app="):
+			appFilter = strings.TrimPrefix(args[index], "--app=")
+		}
+	}
+	return jsonOutput, appFilter
+}
+
+func parseDiffArgs(args []string) string {
+	for index := 0; index < len(args); index++ {
+		switch {
+		case args[index] == "--commit" && index+1 < len(args):
+			return args[index+1]
+		case strings.HasPrefix(args[index], "--commit="):
+			return strings.TrimPrefix(args[index], "--commit=")
+		}
+	}
+	return ""
+}
+
+func parseValidateArgs(args []string) (string, bool) {
+	path := ""
+	strict := false
+	for _, arg := range args {
+		if arg == "--strict" {
+			strict = true
+		} else if !strings.HasPrefix(arg, "-") && path == "" {
+			path = arg
+		}
+	}
+	return path, strict
+}
+
+func parseLogsArgs(args []string) (string, bool, string) {
+	app := ""
+	follow := false
+	service := ""
+	for _, arg := range args {
+		switch {
+		case arg == "-f" || arg == "--follow":
+			follow = true
+		case app == "":
+			app = arg
+		case service == "":
+			service = arg
+		}
+	}
+	return app, follow, service
+}
+
+// parseAppArgs splits `konta app <action> <app> [service...]`.
+func parseAppArgs(args []string) (string, string, []string) {
+	action, app := "", ""
+	if len(args) > 0 {
+		action = args[0]
+	}
+	if len(args) > 1 {
+		app = args[1]
+	}
+	var services []string
+	if len(args) > 2 {
+		services = args[2:]
+	}
+	return action, app, services
+}
+
+// parseComposeArgs splits `konta compose <app> -- <args>`. The "--" separator
+// is optional.
+func parseComposeArgs(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	rest := args[1:]
+	if len(rest) > 0 && rest[0] == "--" {
+		rest = rest[1:]
+	}
+	return args[0], rest
+}
+
+// composeExitCode passes the exit status of docker compose through, so
+// scripts see the same code as with docker compose itself.
+func composeExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	fmt.Printf("Error: %v\n", err)
+	return 1
+}
+
+func parsePlanArgs(args []string) bool {
 	for _, arg := range args {
-		if arg == "-e" || arg == "--edit" {
+		if arg == "--json" {
 			return true
 		}
 	}
 	return false
 }
+
+// parseConfigValidateArgs returns the file to check; empty means the
+// active config.
+func parseConfigValidateArgs(args []string) string {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+	return ""
+}
+
+func parseConfigArgs(args []string) (bool, bool, string) {
+	edit := false
+	effective := false
+	app := ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-e" || args[i] == "--edit":
+			edit = true
+		case args[i] == "--effective":
+			effective = true
+		case args[i] == "--app" && i+1 < len(args):
+			app = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--app="):
+			app = strings.TrimPrefix(args[i], "--app=")
+		}
+	}
+	return edit, effective, app
+}
@@ -2,21 +2,30 @@ package cmd
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
-	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
+	"gopkg.in/yaml.v3"
+
 	"github.com/talyguryn/konta/internal/config"
+	"github.com/talyguryn/konta/internal/forge"
 	"github.com/talyguryn/konta/internal/git"
-	"github.com/talyguryn/konta/internal/githubdeploy"
 	"github.com/talyguryn/konta/internal/hooks"
 	"github.com/talyguryn/konta/internal/lock"
 	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/metrics"
+	"github.com/talyguryn/konta/internal/notify"
+	platformservice "github.com/talyguryn/konta/internal/platform/service"
 	"github.com/talyguryn/konta/internal/reconcile"
 	"github.com/talyguryn/konta/internal/state"
 	"github.com/talyguryn/konta/internal/types"
@@ -34,10 +43,18 @@ Usage:
 	konta uninstall
 	konta run [--dry-run] [--watch]
 	konta deploy [--dry-run]
-	konta daemon [enable|disable|restart|status]
-	konta enable | konta disable | konta restart | konta status
+	konta diff [--commit SHA]
+	konta plan [--json]
+	konta validate [PATH] [--strict]
+	konta logs APP [-f] [SERVICE]
+	konta compose APP -- ARGS...
+	konta app restart|stop|start|redeploy APP
+	konta daemon [enable|disable|restart|status] [--user]
+	konta enable | konta disable | konta restart
+	konta status [--json] [--app NAME]
 	konta journal
-	konta config [-e]
+	konta config [-e] [--effective [--app NAME]]
+	konta config validate [FILE]
 	konta update [-y]
 	konta version (-v)
 	konta help (-h)
@@ -49,6 +66,8 @@ Bootstrap Options:
   --interval SECONDS                Polling interval (default: 120)
   --token TOKEN                     GitHub token (or set KONTA_TOKEN env)
 	--release_channel stable|next     Konta release channel for updates (default: stable)
+  --runtime docker|podman           Container runtime (default: docker)
+  --user                            Rootless setup: config in ~/.konta, systemd user unit
 
 Short flags:
   -h, --help                        Show this help
@@ -58,6 +77,10 @@ Short flags:
   -s                                Show daemon status
   -j                                Show live logs (same as 'journal')
 
+Status flags:
+  --json                            Print status as JSON (daemon, last deployment, per-app containers)
+  --app NAME                        Show only one application
+
 Update flags:
 	-y                                Skip confirmation and auto-update
 	--channel stable|next             Override release channel for this update command
@@ -70,10 +93,22 @@ Examples:
   konta run --watch                 # Watch mode (poll every N seconds)
   konta run --dry-run               # Show what would change
 	konta deploy                      # Force full redeploy for latest commit
+  konta diff                        # Show what the next deploy would change
+  konta diff --commit 1a2b3c4d      # Compare deployed apps with a specific commit
+  konta plan                        # Show the actions of the next cycle
+  konta plan --json                 # Same plan as JSON for scripts and CI
+  konta validate ./infra            # Lint a local checkout (no Docker or root needed)
+  konta config validate new.yaml    # Check a config file before installing it
+  konta config --effective --app web  # Deploy settings of one app after repo overrides
+  konta logs web -f                 # Follow logs of the active stack of app 'web'
+  konta compose web -- exec app sh  # Run docker compose against the active stack
+  konta app stop web                # Stop app 'web'; self-heal leaves it down
+  konta app redeploy web            # Redeploy 'web' and reset its self-heal counter
   konta start                       # Start the daemon
   konta stop                        # Stop the daemon
   konta restart                     # Restart the daemon
-  konta status                      # Check daemon status
+  konta status                      # Daemon status and live per-app container view
+  konta status --json --app web     # Machine-readable status for one app
   konta journal                     # View live logs
   konta journal -f                  # Same as 'konta journal'
   konta update                      # Update to latest version (interactive)
@@ -82,6 +117,14 @@ Examples:
 
 Environment:
   KONTA_TOKEN                       GitHub token (alternative to --token)
+  KONTA_RUNTIME                     Container runtime: docker or podman (overrides config)
+  DOCKER_HOST                       Docker or Podman API socket (unix://...)
+  KONTA_DOCKER_API=off              Use the CLI instead of the Engine API
+
+Signals (konta run --watch):
+  SIGHUP                            Reload config, restart metrics and events watcher (systemctl reload konta)
+  SIGUSR1                           Reconcile now (systemctl kill -s USR1 konta)
+  SIGTERM, SIGINT                   Finish the current cycle, then stop; send twice to abort it
 
 More info: https://github.com/talyguryn/konta
 `, version)
@@ -120,16 +163,138 @@ func Config(edit bool) error {
 	return nil
 }
 
+// effectiveConfig is the output of `konta config --effective`: the host
+// config with the repository settings merged in.
+type effectiveConfig struct {
+	types.Config `yaml:",inline"`
+	Apps         map[string]types.DeployConf `yaml:"apps,omitempty"`
+}
+
+// redactConfig masks every credential of cfg for display: the repository
+// token, the GitHub App key, credentials in URLs and the secrets of the
+// notifications (see notify.Redacted).
+func redactConfig(cfg types.Config) types.Config {
+	if cfg.Repository.Token != "" {
+		cfg.Repository.Token = "***"
+	}
+	if cfg.Repository.GitHubApp.PrivateKey != "" {
+		cfg.Repository.GitHubApp.PrivateKey = "***"
+	}
+	cfg.Repository.URL = redactURLCredentials(cfg.Repository.URL)
+	cfg.Repository.APIURL = redactURLCredentials(cfg.Repository.APIURL)
+	cfg.KontaUpdates.Mirror = redactURLCredentials(cfg.KontaUpdates.Mirror)
+
+	notifications := make([]types.NotificationConf, 0, len(cfg.Notifications))
+	for _, conf := range cfg.Notifications {
+		notifications = append(notifications, notify.Redacted(conf))
+	}
+	cfg.Notifications = notifications
+	return cfg
+}
+
+// redactURLCredentials masks the user info of a URL, e.g. the token of
+// https://oauth2:<token>@gitlab.com/acme/infra.
+func redactURLCredentials(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.User == nil {
+		return raw
+	}
+	parsed.User = url.User("***")
+	return parsed.String()
+}
+
+// EffectiveConfig prints the config the deploy cycle uses: the host config
+// with the settings file of the current release merged over it. With app
+// set, only that app's deploy settings are printed.
+func EffectiveConfig(app string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	releaseDir, err := filepath.EvalSymlinks(state.GetCurrentLink())
+	if err != nil {
+		return fmt.Errorf("no deployed release yet, run konta run first: %w", err)
+	}
+
+	var report config.RepoSettingsReport
+	settingsPath := config.RepoSettingsPath(releaseDir, cfg.Repository.Path)
+	if config.RepoSettingsEnabled(cfg) {
+		settings, err := config.LoadRepoSettings(releaseDir, cfg.Repository.Path)
+		if err != nil {
+			return err
+		}
+		if settings != nil {
+			cfg, report = config.MergeRepoSettings(cfg, settings)
+		}
+	}
+
+	var out interface{}
+	if app != "" {
+		deploy, ok := cfg.AppDeploy[app]
+		if !ok {
+			deploy = cfg.Deploy
+		}
+		out = map[string]types.DeployConf{"deploy": deploy}
+	} else {
+		out = effectiveConfig{Config: redactConfig(*cfg), Apps: cfg.AppDeploy}
+	}
+
+	data, err := yaml.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	switch {
+	case !config.RepoSettingsEnabled(cfg):
+		fmt.Println("# Repository settings are disabled (repo_settings.enable: false)")
+	case len(report.Applied) == 0 && len(report.Locked) == 0:
+		fmt.Printf("# No repository settings in %s\n", settingsPath)
+	default:
+		fmt.Printf("# Repository settings: %s\n", settingsPath)
+	}
+	for _, key := range report.Applied {
+		if app == "" || strings.HasPrefix(key, "deploy.") || strings.HasPrefix(key, "apps."+app+".") {
+			fmt.Printf("#   from repository: %s\n", key)
+		}
+	}
+	for _, key := range report.Locked {
+		fmt.Printf("#   locked by host config, ignored: %s\n", key)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// ValidateConfig checks a config file, the active one when path is empty,
+// and lists every problem found.
+func ValidateConfig(path string) error {
+	if path == "" {
+		var err error
+		if path, err = config.FindConfigPath(); err != nil {
+			return err
+		}
+	}
+
+	if err := config.ValidateFile(path); err != nil {
+		return err
+	}
+	fmt.Printf("✓ %s is valid\n", path)
+	return nil
+}
+
 // Bootstrap, installInteractive, validateInstallParams, testRepositoryConnection,
 // Uninstall → moved to cmd_bootstrap.go
 
-// Journal shows live logs
-func Journal() error {
+// Journal shows live logs, of the systemd user unit with user set or when
+// it is the installed daemon.
+func Journal(user bool) error {
 	var cmd *exec.Cmd
 	fmt.Println("Showing live logs (Ctrl+C to exit)...")
 	fmt.Println()
 	if runtime.GOOS == "darwin" {
 		cmd = exec.Command("tail", "-f", "/var/log/konta/konta.log")
+	} else if user || daemonManager(false).FilePath() == platformservice.UserServiceFile() {
+		cmd = exec.Command("journalctl", "--user", "-u", "konta", "-f")
 	} else {
 		cmd = exec.Command("journalctl", "-u", "konta", "-f")
 	}
@@ -141,12 +306,24 @@ func Journal() error {
 
 // Run executes reconciliation once or in watch mode
 func Run(dryRun bool, watch bool, version string) error {
+	metrics.SetVersion(version)
+	// Notifications and forge reports are delivered in the background; let
+	// them finish before a one-shot run or a stopping daemon exits.
+	defer notify.Wait(notify.DeliveryTimeout)
+	defer forge.Wait(forge.DeliveryTimeout)
+
 	// Load config to get hook paths
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		return err
 	}
 
+	if !dryRun {
+		if err := state.MarkSelfUpdateRunning(version); err != nil {
+			logger.Warn("Failed to record self-update start: %v", err)
+		}
+	}
+
 	// Run started hook when konta daemon starts
 	if watch {
 		// Get current state to determine repo directory
@@ -158,109 +335,95 @@ func Run(dryRun bool, watch bool, version string) error {
 			logger.Debug("No previous deployment, skipping started hook")
 		} else {
 			currentLink := state.GetCurrentLink()
-			startedHookRunner := hooks.New(currentLink, cfg.Hooks.StartedAbs, cfg.Hooks.PreAbs, cfg.Hooks.SuccessAbs, cfg.Hooks.FailureAbs, cfg.Hooks.PostUpdateAbs)
+			startedHookRunner := hooks.New(currentLink, cfg.Hooks)
+			startedHookRunner.SetContext(hooks.Context{Commit: currentState.LastCommit})
 			if err := startedHookRunner.RunStarted(); err != nil {
 				logger.Warn("Started hook failed: %v", err)
 			}
 		}
 	}
 
-	// Execute reconciliation once
-	if err := reconcileOnce(dryRun, version, true, false); err != nil && !watch {
-		// Only return error if not in watch mode
-		// In watch mode, we log error and continue
-		return err
-	}
-
-	// If watch mode, enter polling loop
 	if watch {
-		cfg, err := config.Load()
-		if err != nil {
-			return err
-		}
-
-		logger.Info("Watch mode enabled. Polling every %d seconds (Ctrl+C to stop)", cfg.Repository.Interval)
-
-		// Check for updates on first run
-		if cfg.KontaUpdates != "" && cfg.KontaUpdates != "false" {
-			_ = CheckForUpdates(version, cfg.KontaUpdates, cfg.ReleaseChannel)
-		}
-
-		// First reconciliation already done above, now enter polling loop
-		var ticker *time.Ticker
-		ticker = time.NewTicker(time.Duration(cfg.Repository.Interval) * time.Second)
-		defer ticker.Stop()
-
-		checkCounter := 0
-		checkInterval := 10 // Check for updates every 10 cycles
+		return watchLoop(cfg, dryRun, version)
+	}
 
-		// Infinite loop - exit only on signal (Ctrl+C) or systemd stop
-		for range ticker.C {
-			// Reload config on each iteration to pick up interval changes
-			newCfg, err := config.Load()
-			if err != nil {
-				logger.Error("Failed to reload config: %v", err)
-				// Continue with previous config
-			} else if newCfg.Repository.Interval != cfg.Repository.Interval {
-				// Interval changed, reset ticker
-				logger.Info("Config updated: polling interval changed from %d to %d seconds",
-					cfg.Repository.Interval, newCfg.Repository.Interval)
-				ticker.Stop()
-				ticker = time.NewTicker(time.Duration(newCfg.Repository.Interval) * time.Second)
-				cfg = newCfg
-			} else {
-				cfg = newCfg
-			}
+	// Execute reconciliation once
+	// Only the daemon confirms a self-update: a one-shot run says nothing
+	// about whether the daemon on the new binary works.
+	return reconcileOnce(context.Background(), dryRun, version, true, false)
+}
 
-			// Check for updates periodically (every 10 cycles)
-			checkCounter++
-			if checkCounter >= checkInterval && cfg.KontaUpdates != "" && cfg.KontaUpdates != "false" {
-				checkCounter = 0
-				_ = CheckForUpdates(version, cfg.KontaUpdates, cfg.ReleaseChannel)
-			}
+// Deploy performs a forced full redeploy on the latest commit.
+// Unlike Run, it does not rely on changed project detection and reconciles all projects.
+func Deploy(dryRun bool, version string) error {
+	defer notify.Wait(notify.DeliveryTimeout)
+	defer forge.Wait(forge.DeliveryTimeout)
+	return reconcileOnce(context.Background(), dryRun, version, true, true)
+}
 
-			if err := reconcileOnce(false, version, false, false); err != nil {
-				logger.Error("Deployment error: %v", err)
-				// Continue on error, don't exit
-			}
+var (
+	configMu       sync.Mutex
+	lastGoodConfig *types.Config
+	rejectedConfig string
+)
 
-			// Aggressive garbage collection for low-memory environments
-			// Multiple GC passes help release more memory from go-git objects
-			var ms runtime.MemStats
-			runtime.ReadMemStats(&ms)
-			allocBefore := ms.Alloc
-
-			// First GC pass
-			runtime.GC()
-			debug.FreeOSMemory()
-
-			// Second pass if memory is still high
-			runtime.ReadMemStats(&ms)
-			if ms.Alloc > 50*1024*1024 { // If over 50MB
-				runtime.GC()
-				debug.FreeOSMemory()
-				runtime.GC() // Third pass for stubborn memory
-			}
+// loadConfig loads the config file and applies its logging section. Once a
+// config has been loaded, an invalid file is rejected and the previous
+// config stays in effect, so a typo cannot take down a running daemon.
+func loadConfig() (*types.Config, error) {
+	configMu.Lock()
+	defer configMu.Unlock()
 
-			// Log memory stats for debugging
-			runtime.ReadMemStats(&ms)
-			if allocBefore > 30*1024*1024 {
-				logger.Debug("Memory optimization: %d MB → %d MB", allocBefore/1024/1024, ms.Alloc/1024/1024)
-			}
+	cfg, err := config.Load()
+	if err != nil {
+		if lastGoodConfig == nil {
+			return nil, err
+		}
+		if err.Error() != rejectedConfig {
+			rejectedConfig = err.Error()
+			logger.Error("Config reload rejected, keeping the previous config: %v", err)
 		}
+		return lastGoodConfig, nil
 	}
-
-	return nil
+	if rejectedConfig != "" {
+		rejectedConfig = ""
+		logger.Info("Config is valid again, applying it")
+	}
+	lastGoodConfig = cfg
+	if err := logger.Configure(cfg.Logging); err != nil {
+		logger.Warn("Failed to apply logging config: %v", err)
+	}
+	return cfg, nil
 }
 
-// Deploy performs a forced full redeploy on the latest commit.
-// Unlike Run, it does not rely on changed project detection and reconciles all projects.
-func Deploy(dryRun bool, version string) error {
-	return reconcileOnce(dryRun, version, true, true)
+// newCycleID returns a short random ID used to correlate log lines of one cycle.
+func newCycleID() string {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(buf)
 }
 
-// reconcileOnce performs a single reconciliation cycle
-func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedeploy bool) error {
+// reconcileOnce performs a single reconciliation cycle. Once ctx is done the
+// cycle stops at the next safe point: before the deploy starts or between
+// apps, never in the middle of one.
+func reconcileOnce(ctx context.Context, dryRun bool, version string, isFirstRun bool, forceFullRedeploy bool) (err error) {
+	cycleMu.Lock()
+	defer cycleMu.Unlock()
+
+	logger.SetCycleID(newCycleID())
+	defer logger.SetCycleID("")
+
+	cycleStart := time.Now()
+	cycleOutcome := "success"
+	defer func() {
+		if err != nil {
+			cycleOutcome = "failure"
+		}
+		metrics.ObserveCycle(cycleOutcome, time.Since(cycleStart))
+	}()
+
 	l, err := lock.Acquire()
 	if err != nil {
 		return err
@@ -268,14 +431,18 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 	defer func() { _ = l.Release() }()
 
 	logger.Info("Konta v%s", version)
-	cfg, err := config.Load()
+	cfg, err := loadConfig()
 	if err != nil {
 		return err
 	}
+	cfg = authorizeRepository(cfg)
 
 	if err := state.Init(); err != nil {
 		return err
 	}
+	if !dryRun {
+		deliverForgeOutbox(cfg)
+	}
 
 	// Get current state
 	currentState, err := state.Load()
@@ -301,7 +468,9 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 	// Clone the repository into a temp directory, then immediately promote to stable versioned path.
 	// Resolve latest commit hash upfront (no clone needed yet).
 	// This allows us to skip cloning entirely when the release dir already exists.
+	resolveStart := time.Now()
 	newCommit, err := git.ResolveLatestCommit(&cfg.Repository)
+	metrics.ObserveGitResolve(time.Since(resolveStart), err)
 	if err != nil {
 		return fmt.Errorf("failed to resolve latest commit: %w", err)
 	}
@@ -356,15 +525,25 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 		}
 
 		if !forceFullRedeploy {
-			// Even without changes, perform health check to ensure containers are running
-			logger.Info("Performing container health check")
-			if !dryRun {
+			cycleOutcome = "no_changes"
+
+			// Even without changes, perform health check to ensure containers are running.
+			// In dry-run the health plan is only logged. While Docker events drive
+			// self-heal, the polled check is only a periodic safety net.
+			if polledHealthCheckDue(cfg) {
+				logger.Info("Performing container health check")
 				reconciler := reconcile.New(cfg, releaseDir, dryRun, newCommit)
+				reconciler.SetContext(ctx)
 				reconciler.SetChangedProjects(nil) // nil means check all projects
-				if _, err := reconciler.HealthCheck(); err != nil {
+				if _, err := reconciler.HealthCheck(); errors.Is(err, reconcile.ErrInterrupted) {
+					logger.Info("Health check stopped early: %v", err)
+				} else if err != nil {
 					logger.Warn("Health check encountered issues: %v", err)
 					// Don't return error, just warn
 				}
+				lastPolledHealthCheck = time.Now()
+			} else {
+				logger.Debug("Skipping polled health check: Docker events stream is connected")
 			}
 
 			// Ensure current symlink points to the latest known commit even without changes.
@@ -394,6 +573,7 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 
 	if !forceFullRedeploy && !dryRun && !isFirstRun && strings.TrimSpace(currentState.LastAttemptedCommit) == newCommit && currentState.LastAttemptStatus == "failure" {
 		logger.Warn("Skipping automatic redeploy for previously failed commit %s", newCommit[:8])
+		cycleOutcome = "skipped"
 		return nil
 	}
 
@@ -407,26 +587,7 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 		changedProjects = nil // nil means reconcile all
 		logger.Info("Force full redeploy: reconciling all projects")
 	} else {
-		// Detect which projects have changed
-		changedProjects, err = git.GetChangedProjects(releaseDir, cfg.Repository.Path, currentState.LastCommit, newCommit)
-		if err != nil {
-			logger.Warn("Failed to detect changed projects via git diff: %v", err)
-
-			currentReleaseDir, currentReleaseErr := filepath.EvalSymlinks(state.GetCurrentLink())
-			if currentReleaseErr != nil {
-				logger.Warn("Snapshot diff fallback unavailable (cannot resolve current release): %v (will reconcile all)", currentReleaseErr)
-				changedProjects = nil // nil means reconcile all
-			} else {
-				snapshotChangedProjects, snapshotErr := detectChangedProjectsBySnapshot(currentReleaseDir, releaseDir, cfg.Repository.Path)
-				if snapshotErr != nil {
-					logger.Warn("Snapshot diff fallback failed: %v (will reconcile all)", snapshotErr)
-					changedProjects = nil // nil means reconcile all
-				} else {
-					changedProjects = snapshotChangedProjects
-					logger.Info("Snapshot diff fallback detected %d changed project(s): %v", len(changedProjects), changedProjects)
-				}
-			}
-		}
+		changedProjects = detectChangedProjects(cfg, releaseDir, currentState.LastCommit, newCommit)
 	}
 
 	if changedProjects != nil && len(changedProjects) == 0 {
@@ -434,12 +595,10 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 
 		// Even with no project changes, we should clean up orphan containers
 		// that may have been moved out of the apps directory
-		if !dryRun {
-			reconciler := reconcile.New(cfg, releaseDir, dryRun, newCommit)
-			if err := reconciler.CleanupOrphans(); err != nil {
-				logger.Warn("Failed to cleanup orphans: %v", err)
-				// Don't fail on orphan cleanup, just warn
-			}
+		reconciler := reconcile.New(cfg, releaseDir, dryRun, newCommit)
+		if err := reconciler.CleanupOrphans(); err != nil {
+			logger.Warn("Failed to cleanup orphans: %v", err)
+			// Don't fail on orphan cleanup, just warn
 		}
 
 		if !dryRun {
@@ -452,7 +611,7 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 				logger.Error("Failed to update state for no-change commit: %v", err)
 				return err
 			}
-			reportNoProjectChangesGitHubSuccess(cfg, lastSuccessfulCommit, newCommit)
+			reportNoProjectChangesSuccess(cfg, lastSuccessfulCommit, newCommit)
 			activeCommitForCleanup = newCommit
 			logger.Info("State updated to new commit (no app changes)")
 		} else {
@@ -461,44 +620,53 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 		return nil
 	}
 
+	if ctx.Err() != nil {
+		logger.Info("Stopping before deploying %s; the next start deploys it", newCommit[:8])
+		cycleOutcome = "interrupted"
+		return nil
+	}
+
 	if changedProjects != nil {
 		logger.Info("Will reconcile %d changed project(s): %v", len(changedProjects), changedProjects)
 	} else {
 		logger.Info("Reconciling all projects (first deployment or change detection unavailable)")
 	}
 
-	var ghDeployClient *githubdeploy.Client
-	var ghDeploymentID int64
-	githubCompareURL := ""
+	var forgeOutbox *forge.Outbox
+	var perAppDeployments *appDeployments
+	var reconciledResult *types.ReconcileResult
+	forgeEnvironment := strings.TrimSpace(cfg.Deploy.ForgeReporting.Environment)
+	if forgeEnvironment == "" {
+		forgeEnvironment = "production"
+	}
+	forgeCompareURL := ""
 	stableCommitURL := ""
 	reportedFailure := false
-	if !dryRun && cfg.Deploy.GitHubDeployments.Enable {
-		githubEnvironment := strings.TrimSpace(cfg.Deploy.GitHubDeployments.Environment)
-		if githubEnvironment == "" {
-			githubEnvironment = "production"
-		}
-
-		ghDeployClient, err = githubdeploy.New(cfg.Repository.URL, cfg.Repository.Token)
+	if !dryRun && cfg.Deploy.ForgeReporting.Enabled() {
+		forgeOutbox, err = forge.NewOutbox(state.GetForgeOutboxPath(), cfg.Repository)
 		if err != nil {
-			logger.Warn("GitHub deployment status disabled: %v", err)
+			logger.Warn("Forge reporting disabled: %v", err)
 		} else {
-			githubCompareURL = ghDeployClient.CompareURL(lastSuccessfulCommit, newCommit)
-			stableCommitURL = ghDeployClient.CommitURL(stableRollbackCommit)
-			if err := ghDeployClient.CreateCommitStatus(context.Background(), newCommit, "pending", "Konta deployment in progress", githubCompareURL); err != nil {
-				logger.Warn("Failed to create GitHub commit status (pending): %v", err)
+			forgeCompareURL = forgeOutbox.Reporter().CompareURL(lastSuccessfulCommit, newCommit)
+			stableCommitURL = forgeOutbox.Reporter().CommitURL(stableRollbackCommit)
+			forgeOutbox.CommitStatus(newCommit, forge.DefaultStatusContext, "pending", "Konta deployment in progress", forgeCompareURL)
+			forgeOutbox.Deployment(newCommit, forgeEnvironment, "in_progress", "Konta deployment in progress")
+			if cfg.Deploy.ForgeReporting.PerApp {
+				perAppDeployments = newAppDeployments(forgeOutbox, newCommit, forgeEnvironment, forgeCompareURL)
 			}
+		}
+	}
 
-			ghDeploymentID, err = ghDeployClient.CreateDeploymentAndMarkInProgress(context.Background(), newCommit, githubEnvironment)
-			if err != nil {
-				logger.Warn("Failed to create GitHub deployment status: %v", err)
-				ghDeploymentID = 0
-			} else {
-				logger.Info("GitHub deployment started (id=%d, environment=%s)", ghDeploymentID, githubEnvironment)
-			}
+	var notifier *notify.Dispatcher
+	notifyCompareURL := forgeCompareURL
+	if !dryRun {
+		notifier = notify.New(cfg)
+		if notifyCompareURL == "" {
+			notifyCompareURL = forge.CompareURL(cfg.Repository, lastSuccessfulCommit, newCommit)
 		}
 	}
 
-	reportGitHubFailure := func(reason string, rollbackNote string, rollbackCompleted bool) {
+	reportFailure := func(reason string, rollbackNote string, rollbackCompleted bool) {
 		if reportedFailure {
 			return
 		}
@@ -508,7 +676,15 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 				logger.Warn("Failed to persist failed deployment attempt: %v", err)
 			}
 		}
-		if ghDeployClient == nil {
+		notifier.Send(notify.Event{
+			Type:           notify.EventDeployFailure,
+			Commit:         newCommit,
+			PreviousCommit: lastSuccessfulCommit,
+			CompareURL:     notifyCompareURL,
+			Apps:           uniqueSortedProjects(changedProjects),
+			Reason:         strings.TrimSpace(strings.TrimSpace(reason) + " " + strings.TrimSpace(rollbackNote)),
+		})
+		if forgeOutbox == nil {
 			return
 		}
 
@@ -524,15 +700,9 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 		if len(lastSuccessfulCommitShort) > 8 {
 			lastSuccessfulCommitShort = lastSuccessfulCommitShort[:8]
 		}
-		if ghDeploymentID != 0 {
-			if err := ghDeployClient.CreateDeploymentStatus(context.Background(), ghDeploymentID, "failure", "konta: "+reason); err != nil {
-				logger.Warn("Failed to report GitHub deployment failure status: %v", err)
-			}
-		}
-
-		if err := ghDeployClient.CreateCommitStatus(context.Background(), newCommit, "failure", "konta: "+reason, githubCompareURL); err != nil {
-			logger.Warn("Failed to report GitHub commit status (failure): %v", err)
-		}
+		perAppDeployments.fail(reconciledResult, reason, rollbackCompleted)
+		forgeOutbox.Deployment(newCommit, forgeEnvironment, "failure", "konta: "+reason)
+		forgeOutbox.CommitStatus(newCommit, forge.DefaultStatusContext, "failure", "konta: "+reason, forgeCompareURL)
 
 		commentLines := []string{
 			"## Konta deployment failed",
@@ -557,30 +727,60 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 		} else if strings.TrimSpace(rollbackNote) != "" {
 			commentLines = append(commentLines, fmt.Sprintf("- %s", rollbackNote))
 		}
-		if githubCompareURL != "" {
-			commentLines = append(commentLines, "", fmt.Sprintf("See not applied edits: [view diff](%s).", githubCompareURL))
+		if forgeCompareURL != "" {
+			commentLines = append(commentLines, "", fmt.Sprintf("See not applied edits: [view diff](%s).", forgeCompareURL))
 		}
 
-		if err := ghDeployClient.CreateCommitComment(context.Background(), newCommit, strings.Join(commentLines, "\n")); err != nil {
-			logger.Warn("Failed to publish GitHub failure comment: %v", err)
-		}
+		forgeOutbox.CommitComment(newCommit, strings.Join(commentLines, "\n"))
 	}
 
-	var reconciledResult *types.ReconcileResult
 	allAffectedProjects := make([]string, 0)
 
+	// Create hook runner
+	hookRunner := hooks.New(releaseDir, cfg.Hooks)
+	hookRunner.SetContext(hooks.Context{Commit: newCommit, PreviousCommit: lastSuccessfulCommit})
+
 	attemptRollback := func(rollbackProjects []string) (string, bool) {
 		if dryRun {
 			return "", false
 		}
+		rollbackEvent := notify.Event{
+			Type:           notify.EventRollback,
+			Commit:         stableRollbackCommit,
+			PreviousCommit: newCommit,
+			Apps:           rollbackProjects,
+		}
 		if stableRollbackCommit == "" {
 			logger.Warn("Automatic rollback skipped: no stable successful release commit found")
+			metrics.ObserveRollback("skipped")
+			rollbackEvent.Status = "skipped"
+			rollbackEvent.Reason = "no stable successful release commit found"
+			notifier.Send(rollbackEvent)
 			return "Rollback skipped: no stable successful release commit found.", false
 		}
+		hookEvent := hooks.Event{
+			Type:           hooks.EventRollbackStarted,
+			Commit:         stableRollbackCommit,
+			PreviousCommit: newCommit,
+			Apps:           rollbackProjects,
+		}
+		hookRunner.RunEvent(hookEvent)
+		hookEvent.Type = hooks.EventRollbackCompleted
 		if err := rollbackToStable(cfg, stableRollbackCommit, rollbackProjects); err != nil {
 			logger.Error("Rollback failed: %v", err)
+			metrics.ObserveRollback("failure")
+			rollbackEvent.Status = "failed"
+			rollbackEvent.Reason = err.Error()
+			notifier.Send(rollbackEvent)
+			hookEvent.Status, hookEvent.Error = "failed", err.Error()
+			hookRunner.RunEvent(hookEvent)
 			return fmt.Sprintf("Rollback failed: %v", err), false
 		}
+		metrics.ObserveRollback("success")
+		rollbackEvent.Status = "completed"
+		notifier.Send(rollbackEvent)
+		hookEvent.Status = "completed"
+		hookRunner.RunEvent(hookEvent)
 		return fmt.Sprintf("Rollback completed to stable commit `%s`.", stableRollbackCommit), true
 	}
 
@@ -590,46 +790,40 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 		}
 	}
 
-	// Create hook runner
-	hookRunner := hooks.New(releaseDir, cfg.Hooks.StartedAbs, cfg.Hooks.PreAbs, cfg.Hooks.SuccessAbs, cfg.Hooks.FailureAbs, cfg.Hooks.PostUpdateAbs)
-
 	// Run pre-hook
 	if err := hookRunner.RunPre(); err != nil {
 		logger.Error("Pre-hook failed: %v", err)
 		_ = hookRunner.RunFailure(fmt.Sprintf("Pre-hook failed: %v", err))
-		reportGitHubFailure(fmt.Sprintf("Pre-hook failed: %v", err), "", false)
+		reportFailure(fmt.Sprintf("Pre-hook failed: %v", err), "", false)
 		return err
 	}
 
 	// Perform reconciliation
 	reconciler := reconcile.New(cfg, releaseDir, dryRun, newCommit)
 
-	// Optionally ensure projects marked with konta.recreate=true are always reconciled.
-	// This is a manual override for projects that need guaranteed cleanup on each cycle.
-	if changedProjects != nil {
-		recreateProjects, err := findProjectsMarkedForRecreate(filepath.Join(releaseDir, cfg.Repository.Path))
-		if err != nil {
-			logger.Debug("Failed to find konta.recreate projects: %v", err)
-		} else if len(recreateProjects) > 0 {
-			for _, project := range recreateProjects {
-				if !contains(changedProjects, project) {
-					changedProjects = append(changedProjects, project)
-				}
-			}
-			changedProjects = uniqueSortedProjects(changedProjects)
-			logger.Debug("Added %d konta.recreate project(s) to reconcile list: %v", len(recreateProjects), recreateProjects)
-		}
-	}
+	changedProjects = addRecreateProjects(cfg, releaseDir, changedProjects)
 
+	// Reconcile builds the plan, logs it and applies it; the plan is kept in
+	// the result for the success hook and the commit comment.
 	reconciler.SetChangedProjects(changedProjects)
+	reconciler.SetPlanCallback(perAppDeployments.start)
+	reconciler.SetContext(ctx)
 	result, err := reconciler.Reconcile()
 	reconciledResult = result
+	if errors.Is(err, reconcile.ErrInterrupted) {
+		// The apps deployed so far run the new commit, the rest the old one.
+		// The state still names the old commit, so the next start deploys
+		// the changed apps again instead of rolling back.
+		logger.Warn("Deployment of %s stopped between apps (%v); the next start completes it", newCommit[:8], err)
+		cycleOutcome = "interrupted"
+		return nil
+	}
 	if err != nil {
 		logger.Error("Reconciliation failed: %v", err)
 		_ = hookRunner.RunFailure(fmt.Sprintf("Reconciliation failed: %v", err))
 		rollbackProjects := rollbackProjectsForFailure(changedProjects, reconciledResult)
 		rollbackNote, rollbackCompleted := attemptRollback(rollbackProjects)
-		reportGitHubFailure(fmt.Sprintf("Reconciliation failed: %v", err), rollbackNote, rollbackCompleted)
+		reportFailure(fmt.Sprintf("Reconciliation failed: %v", err), rollbackNote, rollbackCompleted)
 		return err
 	}
 
@@ -645,7 +839,7 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 			logger.Error("Atomic switch failed: %v", err)
 			_ = hookRunner.RunFailure(fmt.Sprintf("Atomic switch failed: %v", err))
 			rollbackNote, rollbackCompleted := attemptRollback(allAffectedProjects)
-			reportGitHubFailure(fmt.Sprintf("Atomic switch failed: %v", err), rollbackNote, rollbackCompleted)
+			reportFailure(fmt.Sprintf("Atomic switch failed: %v", err), rollbackNote, rollbackCompleted)
 			return err
 		}
 
@@ -653,7 +847,7 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 		if err := state.UpdateWithProjects(newCommit, allAffectedProjects); err != nil {
 			logger.Error("Failed to update state: %v", err)
 			rollbackNote, rollbackCompleted := attemptRollback(allAffectedProjects)
-			reportGitHubFailure(fmt.Sprintf("Failed to update state: %v", err), rollbackNote, rollbackCompleted)
+			reportFailure(fmt.Sprintf("Failed to update state: %v", err), rollbackNote, rollbackCompleted)
 			return err
 		}
 		activeCommitForCleanup = newCommit
@@ -664,7 +858,8 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 	// Run success hook using current symlink (temp directory can now be cleaned)
 	if !dryRun {
 		currentLink := state.GetCurrentLink()
-		successHookRunner := hooks.New(currentLink, cfg.Hooks.StartedAbs, cfg.Hooks.PreAbs, cfg.Hooks.SuccessAbs, cfg.Hooks.FailureAbs, cfg.Hooks.PostUpdateAbs)
+		successHookRunner := hooks.New(currentLink, cfg.Hooks)
+		successHookRunner.SetContext(hooks.Context{Commit: newCommit, PreviousCommit: lastSuccessfulCommit})
 		if err := successHookRunner.RunSuccess(result); err != nil {
 			logger.Error("Success hook failed: %v", err)
 		}
@@ -672,21 +867,22 @@ func reconcileOnce(dryRun bool, version string, isFirstRun bool, forceFullRedepl
 		logger.Error("Success hook failed: %v", err)
 	}
 
-	if ghDeployClient != nil && ghDeploymentID != 0 {
-		if err := ghDeployClient.CreateDeploymentStatus(context.Background(), ghDeploymentID, "success", "Konta deployment succeeded"); err != nil {
-			logger.Warn("Failed to report GitHub deployment success status: %v", err)
-		}
+	perAppDeployments.succeed()
+	if forgeOutbox != nil {
+		forgeOutbox.Deployment(newCommit, forgeEnvironment, "success", "Konta deployment succeeded")
+		forgeOutbox.CommitStatus(newCommit, forge.DefaultStatusContext, "success", "Konta deployment succeeded", forgeCompareURL)
+		forgeOutbox.CommitComment(newCommit, buildSuccessComment(newCommit, lastSuccessfulCommit, forgeCompareURL, result))
 	}
-	if ghDeployClient != nil {
-		if err := ghDeployClient.CreateCommitStatus(context.Background(), newCommit, "success", "Konta deployment succeeded", githubCompareURL); err != nil {
-			logger.Warn("Failed to report GitHub commit status (success): %v", err)
-		}
 
-		successComment := buildSuccessComment(newCommit, lastSuccessfulCommit, githubCompareURL, result)
-		if err := ghDeployClient.CreateCommitComment(context.Background(), newCommit, successComment); err != nil {
-			logger.Warn("Failed to publish GitHub success comment: %v", err)
-		}
-	}
+	deployedApps := append([]string{}, allAffectedProjects...)
+	deployedApps = append(deployedApps, result.Removed...)
+	notifier.Send(notify.Event{
+		Type:           notify.EventDeploySuccess,
+		Commit:         newCommit,
+		PreviousCommit: lastSuccessfulCommit,
+		CompareURL:     notifyCompareURL,
+		Apps:           uniqueSortedProjects(deployedApps),
+	})
 
 	logger.Info("Deployment complete")
 	return nil
@@ -732,4 +928,3 @@ func atomicSwitch(commit string, releaseDir string) error {
 	logger.Info("Atomic switch completed: %s", commit[:8])
 	return nil
 }
-
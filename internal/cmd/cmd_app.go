@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/talyguryn/konta/internal/lock"
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/reconcile"
+	"github.com/talyguryn/konta/internal/state"
+)
+
+// App runs a manual lifecycle action (restart, stop, start, redeploy) on one
+// app. It holds the global lock, so it never races a reconcile cycle, and
+// records the action in state so the health check respects it.
+func App(action string, app string, services []string) error {
+	app = strings.TrimSpace(app)
+	switch action {
+	case "restart", "stop", "start", "redeploy":
+	case "":
+		return fmt.Errorf("action is required: konta app restart|stop|start|redeploy <app>")
+	default:
+		return fmt.Errorf("unknown app action %q (use restart, stop, start or redeploy)", action)
+	}
+	if app == "" {
+		return fmt.Errorf("app name is required: konta app %s <app>", action)
+	}
+	if len(services) > 0 && action != "restart" {
+		return fmt.Errorf("services can only be given to konta app restart")
+	}
+
+	l, err := lock.Acquire()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = l.Release() }()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	commit, err := state.GetCurrentReleaseCommit()
+	if err != nil {
+		return fmt.Errorf("no release is deployed yet, run konta run first: %w", err)
+	}
+	releaseDir := filepath.Join(state.GetReleasesDir(), commit)
+	reconciler := reconcile.New(cfg, releaseDir, false, commit)
+
+	switch action {
+	case "restart":
+		return reconciler.RestartApp(app, services...)
+	case "stop":
+		return reconciler.StopApp(app)
+	case "redeploy":
+		return reconciler.RedeployApp(app)
+	}
+
+	// Deploys skip stopped apps, so an app may have changed while it was down.
+	// Bring it to the current release instead of starting the old one.
+	lastCommit, err := state.GetProjectLastCommit(app)
+	if err != nil {
+		logger.Warn("Failed to read deployed commit of app %s: %v", app, err)
+	}
+	if lastCommit != commit {
+		var changed []string
+		if lastCommit != "" {
+			changed = detectChangedProjects(cfg, releaseDir, lastCommit, commit)
+		}
+		if changed == nil || contains(changed, app) {
+			logger.Info("App %s changed since %s, redeploying at %s", app, orDash(shortCommitHash(lastCommit)), shortCommitHash(commit))
+			return reconciler.RedeployApp(app)
+		}
+	}
+	return reconciler.StartApp(app)
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/talyguryn/konta/internal/forge"
+	"github.com/talyguryn/konta/internal/reconcile"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// appDeployments reports every app a deploy cycle deploys as its own commit
+// status (konta/<host>/<app>) and deployment (<environment>/<app>), next to
+// the status and deployment of the whole cycle. It is enabled with
+// deploy.forge_reporting.per_app.
+type appDeployments struct {
+	outbox      *forge.Outbox
+	commit      string
+	environment string
+	targetURL   string
+	host        string
+
+	actions []types.PlanAction
+}
+
+func newAppDeployments(outbox *forge.Outbox, commit string, environment string, targetURL string) *appDeployments {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "konta"
+	}
+	return &appDeployments{
+		outbox:      outbox,
+		commit:      commit,
+		environment: environment,
+		targetURL:   targetURL,
+		host:        host,
+	}
+}
+
+func (a *appDeployments) statusContext(app string) string {
+	return fmt.Sprintf("konta/%s/%s", a.host, app)
+}
+
+// start marks the apps the plan deploys as pending and in progress.
+func (a *appDeployments) start(plan *types.Plan) {
+	if a == nil || plan == nil {
+		return
+	}
+	for _, action := range plan.Actions {
+		if action.Type != reconcile.ActionDeploy {
+			continue
+		}
+		a.actions = append(a.actions, action)
+		a.outbox.CommitStatus(a.commit, a.statusContext(action.App), "pending", "Konta deployment in progress", a.targetURL)
+		a.outbox.Deployment(a.commit, a.environment+"/"+action.App, "in_progress", "Konta deployment in progress")
+	}
+}
+
+// succeed reports every started app as deployed.
+func (a *appDeployments) succeed() {
+	if a == nil {
+		return
+	}
+	for _, action := range a.actions {
+		description := "Deployed"
+		if action.Strategy != "" {
+			description += " with " + strings.ReplaceAll(action.Strategy, "_", " ") + " strategy"
+		}
+		if action.Reason != "" {
+			description += ": " + action.Reason
+		}
+		a.report(action.App, "success", description)
+	}
+}
+
+// fail reports the app that failed with the error and the others with what
+// happened to them: deployed before the failure, or not deployed at all.
+func (a *appDeployments) fail(result *types.ReconcileResult, reason string, rollbackCompleted bool) {
+	if a == nil {
+		return
+	}
+	failedApp := ""
+	deployed := make(map[string]bool)
+	if result != nil {
+		failedApp = result.Failed
+		for _, app := range append(append([]string{}, result.Updated...), result.Added...) {
+			deployed[app] = true
+		}
+	}
+
+	for _, action := range a.actions {
+		var description string
+		switch {
+		case action.App == failedApp:
+			description = "konta: " + reason
+		case deployed[action.App] && rollbackCompleted:
+			description = "konta: deployed, then rolled back because the cycle failed"
+		case deployed[action.App]:
+			description = "konta: deployed, but the cycle failed"
+		case failedApp != "":
+			description = fmt.Sprintf("konta: not deployed, %s failed first", failedApp)
+		default:
+			description = "konta: not deployed, " + reason
+		}
+		a.report(action.App, "failure", description)
+	}
+}
+
+func (a *appDeployments) report(app string, state string, description string) {
+	a.outbox.Deployment(a.commit, a.environment+"/"+app, state, description)
+	a.outbox.CommitStatus(a.commit, a.statusContext(app), state, description, a.targetURL)
+}
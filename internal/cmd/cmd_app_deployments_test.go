@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/talyguryn/konta/internal/forge"
+	"github.com/talyguryn/konta/internal/reconcile"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// fakeGitHub records the last commit status per context and the last
+// deployment status per environment.
+type fakeGitHub struct {
+	mu           sync.Mutex
+	statuses     map[string]string // context -> state: description
+	deployments  map[string]string // environment -> state: description
+	environments map[int64]string
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var body struct {
+		Environment string `json:"environment"`
+		State       string `json:"state"`
+		Context     string `json:"context"`
+		Description string `json:"description"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	var id int64
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/deployments"):
+		id = int64(len(f.environments) + 1)
+		f.environments[id] = body.Environment
+		fmt.Fprintf(w, `{"id": %d}`, id)
+	case strings.Contains(r.URL.Path, "/deployments/"):
+		_, _ = fmt.Sscanf(r.URL.Path[strings.Index(r.URL.Path, "/deployments/"):], "/deployments/%d/statuses", &id)
+		f.deployments[f.environments[id]] = body.State + ": " + body.Description
+		fmt.Fprint(w, `{}`)
+	case strings.Contains(r.URL.Path, "/statuses/"):
+		f.statuses[body.Context] = body.State + ": " + body.Description
+		fmt.Fprint(w, `{}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestAppDeployments(t *testing.T) (*appDeployments, *fakeGitHub) {
+	t.Helper()
+	github := &fakeGitHub{statuses: map[string]string{}, deployments: map[string]string{}, environments: map[int64]string{}}
+	server := httptest.NewServer(github)
+	t.Cleanup(server.Close)
+
+	outbox, err := forge.NewOutbox(filepath.Join(t.TempDir(), "outbox.json"), types.RepositoryConf{
+		URL:    "https://github.com/acme/infra",
+		Token:  "test-token",
+		Forge:  "github",
+		APIURL: server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployments := newAppDeployments(outbox, "0123456789abcdef0123456789abcdef01234567", "production", "https://example.com/compare")
+	deployments.host = "web-1"
+	return deployments, github
+}
+
+func waitForReports(t *testing.T) {
+	t.Helper()
+	if !forge.Wait(5 * time.Second) {
+		t.Fatal("reports not delivered")
+	}
+}
+
+func testDeployPlan() *types.Plan {
+	return &types.Plan{Actions: []types.PlanAction{
+		{App: "web", Type: reconcile.ActionDeploy, Strategy: "rolling", Reason: "image changed"},
+		{App: "api", Type: reconcile.ActionDeploy},
+		{App: "db", Type: reconcile.ActionDeploy},
+		{App: "cache", Type: reconcile.ActionNone},
+	}}
+}
+
+func TestAppDeploymentsReportEachApp(t *testing.T) {
+	deployments, github := newTestAppDeployments(t)
+
+	deployments.start(testDeployPlan())
+	waitForReports(t)
+	if got := github.statuses["konta/web-1/api"]; got != "pending: Konta deployment in progress" {
+		t.Errorf("api status after start = %q", got)
+	}
+	if _, ok := github.statuses["konta/web-1/cache"]; ok {
+		t.Error("unchanged app reported")
+	}
+
+	deployments.succeed()
+	waitForReports(t)
+	want := map[string]string{
+		"web": "success: Deployed with rolling strategy: image changed",
+		"api": "success: Deployed",
+		"db":  "success: Deployed",
+	}
+	for app, state := range want {
+		if got := github.statuses["konta/web-1/"+app]; got != state {
+			t.Errorf("%s status = %q, want %q", app, got, state)
+		}
+		if got := github.deployments["production/"+app]; got != state {
+			t.Errorf("%s deployment = %q, want %q", app, got, state)
+		}
+	}
+}
+
+func TestAppDeploymentsReportWhatFailed(t *testing.T) {
+	deployments, github := newTestAppDeployments(t)
+	deployments.start(testDeployPlan())
+
+	deployments.fail(&types.ReconcileResult{Updated: []string{"web"}, Failed: "api"}, "health check failed", true)
+	waitForReports(t)
+	want := map[string]string{
+		"web": "failure: konta: deployed, then rolled back because the cycle failed",
+		"api": "failure: konta: health check failed",
+		"db":  "failure: konta: not deployed, api failed first",
+	}
+	for app, state := range want {
+		if got := github.statuses["konta/web-1/"+app]; got != state {
+			t.Errorf("%s status = %q, want %q", app, got, state)
+		}
+	}
+
+	// Without a result, e.g. when the release could not be prepared.
+	deployments, github = newTestAppDeployments(t)
+	deployments.start(testDeployPlan())
+	deployments.fail(nil, "pre-hook failed", false)
+	waitForReports(t)
+	if got := github.deployments["production/db"]; got != "failure: konta: not deployed, pre-hook failed" {
+		t.Errorf("db deployment = %q", got)
+	}
+
+	var disabled *appDeployments
+	disabled.start(testDeployPlan())
+	disabled.succeed()
+	disabled.fail(nil, "ignored", false)
+}
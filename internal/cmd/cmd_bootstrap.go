@@ -13,16 +13,19 @@ import (
 	"github.com/talyguryn/konta/internal/config"
 	"github.com/talyguryn/konta/internal/dockerutil"
 	"github.com/talyguryn/konta/internal/git"
+	"github.com/talyguryn/konta/internal/lock"
 	"github.com/talyguryn/konta/internal/logger"
+	platformservice "github.com/talyguryn/konta/internal/platform/service"
 	"github.com/talyguryn/konta/internal/state"
 	"github.com/talyguryn/konta/internal/types"
 )
 
 // Bootstrap performs first-time setup with optional CLI parameters
-// Usage: konta bootstrap [--repo URL] [--path PATH] [--branch BRANCH] [--interval SECONDS] [--token TOKEN] [--konta_updates auto|notify|false] [--release_channel stable|next]
+// Usage: konta bootstrap [--repo URL] [--path PATH] [--branch BRANCH] [--interval SECONDS] [--token TOKEN] [--konta_updates auto|notify|false] [--release_channel stable|next] [--runtime docker|podman] [--user]
 func Bootstrap(args []string) error {
-	if os.Getuid() != 0 {
-		return fmt.Errorf("bootstrap requires root privileges. Please run: sudo konta bootstrap")
+	user := contains(args, "--user")
+	if os.Getuid() != 0 && !user {
+		return fmt.Errorf("bootstrap requires root privileges. Please run: sudo konta bootstrap (or konta bootstrap --user for rootless Docker or Podman)")
 	}
 	logger.Info("Starting Konta bootstrap")
 
@@ -35,6 +38,7 @@ func Bootstrap(args []string) error {
 		token          string
 		kontaUpdates   string
 		releaseChannel string
+		runtimeName    string
 	)
 
 	// Parse flags
@@ -77,12 +81,21 @@ func Bootstrap(args []string) error {
 				releaseChannel = args[i+1]
 				i++
 			}
+		case "--runtime":
+			if i+1 < len(args) {
+				runtimeName = strings.ToLower(strings.TrimSpace(args[i+1]))
+				i++
+			}
 		}
 	}
 
+	if err := dockerutil.SetRuntime(runtimeName); err != nil {
+		return err
+	}
+
 	// If no args provided, use interactive mode
 	if repoURL == "" {
-		return installInteractive()
+		return installInteractive(user, runtimeName)
 	}
 
 	// Set defaults for missing values
@@ -126,6 +139,7 @@ func Bootstrap(args []string) error {
 
 	// Create configuration
 	autoCreateExternalNetworks := true
+	forgeReporting := true
 	cfg := &types.Config{
 		Version: "v1",
 		Repository: types.RepositoryConf{
@@ -144,16 +158,19 @@ func Bootstrap(args []string) error {
 				Enable:   true,
 				MaxRetry: 0,
 			},
-			GitHubDeployments: types.GitHubDeploymentsConf{
-				Enable:      true,
+			ForgeReporting: types.ForgeReportingConf{
+				Enable:      &forgeReporting,
 				Environment: "production",
 			},
 		},
 		Logging: types.LoggingConf{
 			Level: "info",
 		},
-		ReleaseChannel: releaseChannel,
-		KontaUpdates:   kontaUpdates,
+		KontaUpdates: types.UpdatePolicy{
+			Mode:    kontaUpdates,
+			Channel: releaseChannel,
+		},
+		Runtime: runtimeName,
 	}
 
 	// Initialize directories
@@ -168,7 +185,7 @@ func Bootstrap(args []string) error {
 	if err := config.Save(cfg); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
-	logger.Info("✓ Configuration saved to /etc/konta/config.yaml")
+	logger.Info("✓ Configuration saved to %s", config.DefaultPath())
 
 	// Display summary
 	fmt.Println()
@@ -184,17 +201,30 @@ func Bootstrap(args []string) error {
 
 	fmt.Println()
 	fmt.Println("Starting daemon...")
-	if err := daemonEnable(daemonManager()); err != nil {
+	if err := daemonEnable(daemonManager(user)); err != nil {
 		logger.Warn("Failed to auto-enable daemon: %v", err)
 		fmt.Printf("\n⚠  Could not auto-start daemon. To enable it manually, run:\n")
-		fmt.Printf("    sudo konta daemon enable\n")
+		fmt.Printf("    %s\n", daemonEnableHint(user))
 	}
 
 	return nil
 }
 
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// daemonEnableHint is the command that enables the daemon by hand.
+func daemonEnableHint(user bool) string {
+	if user {
+		return "konta daemon enable --user"
+	}
+	return "sudo konta daemon enable"
+}
+
 // installInteractive performs installation in interactive mode
-func installInteractive() error {
+func installInteractive(user bool, runtimeName string) error {
 	reader := bufio.NewReader(os.Stdin)
 
 	fmt.Print("Repository URL (e.g., https://github.com/user/infra): ")
@@ -255,6 +285,7 @@ func installInteractive() error {
 
 	// Create configuration
 	autoCreateExternalNetworks := true
+	forgeReporting := true
 	cfg := &types.Config{
 		Version: "v1",
 		Repository: types.RepositoryConf{
@@ -273,16 +304,19 @@ func installInteractive() error {
 				Enable:   true,
 				MaxRetry: 0,
 			},
-			GitHubDeployments: types.GitHubDeploymentsConf{
-				Enable:      true,
+			ForgeReporting: types.ForgeReportingConf{
+				Enable:      &forgeReporting,
 				Environment: "production",
 			},
 		},
 		Logging: types.LoggingConf{
 			Level: "info",
 		},
-		ReleaseChannel: releaseChannel,
-		KontaUpdates:   kontaUpdates,
+		KontaUpdates: types.UpdatePolicy{
+			Mode:    kontaUpdates,
+			Channel: releaseChannel,
+		},
+		Runtime: runtimeName,
 	}
 
 	// Initialize directories
@@ -300,10 +334,10 @@ func installInteractive() error {
 	fmt.Println("\nStarting daemon...")
 
 	// Automatically enable and start daemon
-	if err := daemonEnable(daemonManager()); err != nil {
+	if err := daemonEnable(daemonManager(user)); err != nil {
 		logger.Warn("Failed to auto-enable daemon: %v", err)
 		fmt.Printf("\n⚠  Could not auto-start daemon. To enable it manually, run:\n")
-		fmt.Printf("    sudo konta daemon enable\n")
+		fmt.Printf("    %s\n", daemonEnableHint(user))
 	}
 
 	return nil
@@ -393,6 +427,12 @@ func Uninstall() error {
 		} else {
 			fmt.Println("   (daemon not installed)")
 		}
+	} else if userUnit := platformservice.UserServiceFile(); os.Geteuid() != 0 && pathExists(userUnit) {
+		if err := daemonManager(true).Disable(); err != nil {
+			logger.Warn("Failed to remove systemd user unit: %v", err)
+		} else {
+			fmt.Printf("   ✓ Removed systemd user unit\n")
+		}
 	} else {
 		_ = exec.Command("systemctl", "stop", "konta").Run()
 		_ = exec.Command("systemctl", "disable", "konta").Run()
@@ -412,25 +452,24 @@ func Uninstall() error {
 
 	// 2. Stop and remove all Konta-managed containers
 	fmt.Println("2. Stopping Konta-managed containers...")
-	cmd := dockerutil.Command("ps", "-aq", "--filter", "label=konta.managed=true")
-	output, err := cmd.Output()
-	if err == nil && len(output) > 0 {
-		containerIDs := strings.Fields(string(output))
-		if len(containerIDs) > 0 {
-			fmt.Printf("   Found %d containers\n", len(containerIDs))
-			stopCmd := dockerutil.Command("stop")
-			stopCmd.Args = append(stopCmd.Args, containerIDs...)
-			_ = stopCmd.Run()
-
-			rmCmd := dockerutil.Command("rm")
-			rmCmd.Args = append(rmCmd.Args, containerIDs...)
-			if err := rmCmd.Run(); err != nil {
-				logger.Warn("Failed to remove containers: %v", err)
-			} else {
-				fmt.Printf("   ✓ All containers stopped and removed\n")
+	docker := dockerutil.NewClient()
+	containers, err := docker.Containers()
+	containerIDs := make([]string, 0)
+	if err == nil {
+		for _, container := range containers {
+			if container.Managed() {
+				containerIDs = append(containerIDs, container.ID)
 			}
+		}
+	}
+	if len(containerIDs) > 0 {
+		fmt.Printf("   Found %d containers\n", len(containerIDs))
+		_ = docker.Stop(containerIDs...)
+
+		if err := docker.Remove(containerIDs...); err != nil {
+			logger.Warn("Failed to remove containers: %v", err)
 		} else {
-			fmt.Println("   (no Konta containers found)")
+			fmt.Printf("   ✓ All containers stopped and removed\n")
 		}
 	} else {
 		fmt.Println("   (no Konta containers found)")
@@ -443,7 +482,7 @@ func Uninstall() error {
 		"/etc/konta",
 		"/var/lib/konta",
 		"/var/log/konta",
-		"/var/run/konta.lock",
+		lock.Path(),
 	}
 
 	homeDir, _ := os.UserHomeDir()
@@ -477,7 +516,7 @@ func Uninstall() error {
 	fmt.Println("  - State: removed")
 	fmt.Println("  - Binary: preserved at /usr/local/bin/konta")
 	fmt.Println()
-	fmt.Println("To remove the binary: sudo rm /usr/local/bin/konta")
+	fmt.Println("To remove the binary: sudo rm -f /usr/local/bin/konta /usr/local/bin/konta.backup")
 
 	return nil
 }
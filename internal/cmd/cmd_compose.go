@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/talyguryn/konta/internal/config"
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/reconcile"
+	"github.com/talyguryn/konta/internal/state"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// Logs shows the logs of an app's active stack, optionally of one service.
+func Logs(app string, follow bool, service string) error {
+	args := []string{"logs"}
+	if follow {
+		args = append(args, "--follow")
+	}
+	if service != "" {
+		args = append(args, service)
+	}
+	return Compose(app, args)
+}
+
+// Compose runs docker compose against an app's active stack with the right
+// project name (-p), compose file (-f) and working dir, so rolling stacks
+// (<app>-<8hex>) in commit-specific release dirs need no lookup by hand.
+func Compose(app string, args []string) error {
+	app = strings.TrimSpace(app)
+	if app == "" {
+		return fmt.Errorf("app name is required")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no docker compose arguments given, e.g. konta compose %s -- ps", app)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	reconciler := currentReleaseReconciler(cfg)
+	target, err := reconciler.ComposeTarget(app)
+	if err != nil {
+		return err
+	}
+	logger.Debug("Running docker compose for app %s: stack=%s commit=%s source=%s", app, target.Stack, shortCommitHash(target.Commit), target.Source)
+
+	cmd := reconciler.ComposeCommandFor(target, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// currentReleaseReconciler returns a read-only reconciler for the release the
+// current symlink points to.
+func currentReleaseReconciler(cfg *types.Config) *reconcile.Reconciler {
+	deployCommit := ""
+	if currentState, err := state.Load(); err == nil && currentState != nil {
+		deployCommit = currentState.LastCommit
+	}
+	if commit, err := state.GetCurrentReleaseCommit(); err == nil {
+		deployCommit = commit
+	}
+	return reconcile.New(cfg, state.GetCurrentLink(), true, deployCommit)
+}
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/talyguryn/konta/internal/forge"
 	"github.com/talyguryn/konta/internal/githubdeploy"
 	"github.com/talyguryn/konta/internal/logger"
 	"github.com/talyguryn/konta/internal/reconcile"
@@ -88,51 +89,96 @@ func buildSuccessComment(newCommit string, previousCommit string, compareURL str
 		lines = append(lines, "- No app-level changes were reported.")
 	}
 
+	lines = appendPlanTable(lines, result.Plan)
+
 	return strings.Join(lines, "\n")
 }
 
-func reportNoProjectChangesGitHubSuccess(cfg *types.Config, previousCommit string, newCommit string) {
-	if cfg == nil || !cfg.Deploy.GitHubDeployments.Enable {
-		return
+// appendPlanTable lists the executed plan actions, skipping apps without changes.
+func appendPlanTable(lines []string, plan *types.Plan) []string {
+	if plan == nil {
+		return lines
 	}
 
-	githubEnvironment := strings.TrimSpace(cfg.Deploy.GitHubDeployments.Environment)
-	if githubEnvironment == "" {
-		githubEnvironment = "production"
+	rows := make([]string, 0, len(plan.Actions))
+	for _, action := range plan.Actions {
+		if action.Type == reconcile.ActionNone {
+			continue
+		}
+		actionType := action.Type
+		if action.Destructive {
+			actionType += " (stops containers)"
+		}
+		strategy := action.Strategy
+		if strategy == "" {
+			strategy = "-"
+		}
+		rows = append(rows, fmt.Sprintf("| %s | %s | %s | %s |", action.App, actionType, strategy, action.Reason))
 	}
+	if len(rows) == 0 {
+		return lines
+	}
+
+	lines = append(lines, "", "## Plan", "", "| App | Action | Strategy | Reason |", "| --- | --- | --- | --- |")
+	return append(lines, rows...)
+}
 
-	ghDeployClient, err := githubdeploy.New(cfg.Repository.URL, cfg.Repository.Token)
+// authorizeRepository returns a copy of cfg whose repository token is an
+// installation token when repository.github_app is configured. Without one
+// the configured token is kept, so public repositories still deploy.
+func authorizeRepository(cfg *types.Config) *types.Config {
+	if !cfg.Repository.GitHubApp.Enabled() {
+		return cfg
+	}
+	token, err := githubdeploy.InstallationToken(context.Background(), cfg.Repository)
 	if err != nil {
-		logger.Warn("GitHub deployment status disabled: %v", err)
-		return
+		logger.Warn("GitHub App authentication failed, using repository.token: %v", err)
+		return cfg
 	}
+	authorized := *cfg
+	authorized.Repository.Token = token
+	return &authorized
+}
 
-	compareURL := ghDeployClient.CompareURL(previousCommit, newCommit)
-	if err := ghDeployClient.CreateCommitStatus(context.Background(), newCommit, "pending", "Konta deployment in progress", compareURL); err != nil {
-		logger.Warn("Failed to create GitHub commit status (pending): %v", err)
+func reportNoProjectChangesSuccess(cfg *types.Config, previousCommit string, newCommit string) {
+	if cfg == nil || !cfg.Deploy.ForgeReporting.Enabled() {
+		return
 	}
 
-	deploymentID, err := ghDeployClient.CreateDeploymentAndMarkInProgress(context.Background(), newCommit, githubEnvironment)
-	if err != nil {
-		logger.Warn("Failed to create GitHub deployment status: %v", err)
-		deploymentID = 0
+	environment := strings.TrimSpace(cfg.Deploy.ForgeReporting.Environment)
+	if environment == "" {
+		environment = "production"
 	}
 
-	if deploymentID != 0 {
-		if err := ghDeployClient.CreateDeploymentStatus(context.Background(), deploymentID, "success", "Konta deployment succeeded (no app changes)"); err != nil {
-			logger.Warn("Failed to report GitHub deployment success status: %v", err)
-		}
+	forgeOutbox, err := forge.NewOutbox(state.GetForgeOutboxPath(), cfg.Repository)
+	if err != nil {
+		logger.Warn("Forge reporting disabled: %v", err)
+		return
 	}
 
-	if err := ghDeployClient.CreateCommitStatus(context.Background(), newCommit, "success", "Konta deployment succeeded (no app changes)", compareURL); err != nil {
-		logger.Warn("Failed to report GitHub commit status (success): %v", err)
-	}
+	compareURL := forgeOutbox.Reporter().CompareURL(previousCommit, newCommit)
+	forgeOutbox.CommitStatus(newCommit, forge.DefaultStatusContext, "pending", "Konta deployment in progress", compareURL)
+	forgeOutbox.Deployment(newCommit, environment, "in_progress", "Konta deployment in progress")
+	forgeOutbox.Deployment(newCommit, environment, "success", "Konta deployment succeeded (no app changes)")
+	forgeOutbox.CommitStatus(newCommit, forge.DefaultStatusContext, "success", "Konta deployment succeeded (no app changes)", compareURL)
 
 	result := &types.ReconcileResult{}
-	successComment := buildSuccessComment(newCommit, previousCommit, compareURL, result)
-	if err := ghDeployClient.CreateCommitComment(context.Background(), newCommit, successComment); err != nil {
-		logger.Warn("Failed to publish GitHub success comment: %v", err)
+	forgeOutbox.CommitComment(newCommit, buildSuccessComment(newCommit, previousCommit, compareURL, result))
+}
+
+// deliverForgeOutbox retries the forge reports of earlier cycles that could
+// not be delivered, e.g. while the forge was down or rate limiting.
+func deliverForgeOutbox(cfg *types.Config) {
+	path := state.GetForgeOutboxPath()
+	if !cfg.Deploy.ForgeReporting.Enabled() || forge.PendingReports(path) == 0 {
+		return
+	}
+	forgeOutbox, err := forge.NewOutbox(path, cfg.Repository)
+	if err != nil {
+		logger.Warn("Forge reporting disabled: %v", err)
+		return
 	}
+	forgeOutbox.Flush()
 }
 
 func rollbackToStable(cfg *types.Config, stableCommit string, changedProjects []string) error {
@@ -213,4 +259,4 @@ func uniqueSortedProjects(projects []string) []string {
 
 	sort.Strings(unique)
 	return unique
-}
\ No newline at end of file
+}
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/talyguryn/konta/internal/compose"
+	"github.com/talyguryn/konta/internal/config"
+	"github.com/talyguryn/konta/internal/git"
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/state"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// appDiff is the difference of one app between its deployed release and the target commit.
+type appDiff struct {
+	App          string
+	Status       string // added, removed, changed, unchanged
+	FromCommit   string
+	Strategy     string
+	Services     []compose.ServiceDiff
+	ChangedFiles []string
+}
+
+// Diff shows what the next deploy would change on this server. Each app's
+// deployed release (its active commit from state) is compared with the branch
+// head, or with targetCommit when it is set.
+func Diff(targetCommit string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	cfg = authorizeRepository(cfg)
+
+	currentState, err := state.Load()
+	if err != nil || currentState == nil {
+		currentState = &types.State{}
+	}
+
+	targetDir, resolvedCommit, cleanup, err := checkoutCommit(cfg, strings.TrimSpace(targetCommit))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	targetAppsDir := filepath.Join(targetDir, cfg.Repository.Path)
+	targetApps, err := listDesiredProjectsForStatePrune(targetAppsDir)
+	if err != nil {
+		return fmt.Errorf("failed to read apps directory at %s: %w", shortCommitHash(resolvedCommit), err)
+	}
+
+	apps := append([]string{}, targetApps...)
+	for app := range currentState.Projects {
+		apps = append(apps, app)
+	}
+	apps = uniqueSortedProjects(apps)
+
+	fmt.Printf("Deployed: %s\n", orDash(shortCommitHash(currentState.LastCommit)))
+	if targetCommit == "" {
+		fmt.Printf("Target:   %s (head of %s)\n\n", shortCommitHash(resolvedCommit), cfg.Repository.Branch)
+	} else {
+		fmt.Printf("Target:   %s\n\n", shortCommitHash(resolvedCommit))
+	}
+
+	unchanged := make([]string, 0)
+	changes := 0
+	for _, app := range apps {
+		diff := diffApp(cfg, currentState, app, targetAppsDir, contains(targetApps, app))
+		if diff.Status == "unchanged" {
+			unchanged = append(unchanged, app)
+			continue
+		}
+		changes++
+		printAppDiff(diff)
+	}
+
+	if changes == 0 {
+		fmt.Println("No changes: the target commit matches what is deployed.")
+	}
+	if len(unchanged) > 0 {
+		fmt.Printf("Unchanged: %s\n", strings.Join(unchanged, ", "))
+	}
+
+	return nil
+}
+
+// checkoutCommit returns a directory with the target commit (or the branch
+// head when it is empty) checked out.
+// Existing release directories are reused; otherwise the repository is
+// cloned into a temporary directory that cleanup removes.
+func checkoutCommit(cfg *types.Config, targetCommit string) (string, string, func(), error) {
+	noop := func() {}
+
+	if targetCommit == "" {
+		head, err := git.ResolveLatestCommit(&cfg.Repository)
+		if err != nil {
+			return "", "", noop, fmt.Errorf("failed to resolve latest commit: %w", err)
+		}
+		targetCommit = head
+	}
+
+	if releaseDir, commit := findReleaseDir(targetCommit); releaseDir != "" {
+		return releaseDir, commit, noop, nil
+	}
+
+	tempDir, err := os.MkdirTemp("", "konta-diff-")
+	if err != nil {
+		return "", "", noop, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(tempDir) }
+
+	checkoutDir := filepath.Join(tempDir, "repo")
+	commit, err := git.CloneAtRevision(&cfg.Repository, checkoutDir, targetCommit)
+	if err != nil {
+		cleanup()
+		return "", "", noop, err
+	}
+
+	return checkoutDir, commit, cleanup, nil
+}
+
+// findReleaseDir looks up a release directory by full or abbreviated commit.
+func findReleaseDir(commit string) (string, string) {
+	entries, err := os.ReadDir(state.GetReleasesDir())
+	if err != nil {
+		return "", ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && len(commit) >= 7 && strings.HasPrefix(entry.Name(), commit) {
+			return filepath.Join(state.GetReleasesDir(), entry.Name()), entry.Name()
+		}
+	}
+	return "", ""
+}
+
+// deployedAppsDir returns the apps dir of the release an app is running from.
+func deployedAppsDir(cfg *types.Config, currentState *types.State, app string) (string, string) {
+	projectState := currentState.Projects[app]
+	commit := strings.TrimSpace(projectState.ActiveCommit)
+	if commit == "" {
+		commit = strings.TrimSpace(projectState.LastCommit)
+	}
+
+	if commit != "" {
+		appsDir := filepath.Join(state.GetReleasesDir(), commit, cfg.Repository.Path)
+		if _, err := os.Stat(appsDir); err == nil {
+			return appsDir, commit
+		}
+		logger.Debug("Release %s for app %s is not on disk, comparing with the current release", shortCommitHash(commit), app)
+	}
+
+	currentCommit, err := state.GetCurrentReleaseCommit()
+	if err != nil {
+		return "", commit
+	}
+	return filepath.Join(state.GetCurrentLink(), cfg.Repository.Path), currentCommit
+}
+
+func diffApp(cfg *types.Config, currentState *types.State, app string, targetAppsDir string, inTarget bool) appDiff {
+	diff := appDiff{App: app}
+
+	deployedDir, deployedCommit := deployedAppsDir(cfg, currentState, app)
+	diff.FromCommit = deployedCommit
+
+	var oldFile, newFile *compose.File
+	if deployedDir != "" {
+		if file, err := compose.Load(filepath.Join(deployedDir, app, compose.FileName)); err == nil {
+			oldFile = file
+		}
+	}
+	if inTarget {
+		file, err := compose.Load(filepath.Join(targetAppsDir, app, compose.FileName))
+		if err != nil {
+			diff.Status = "changed"
+			diff.Strategy = fmt.Sprintf("unknown (cannot parse compose file: %v)", err)
+			return diff
+		}
+		newFile = file
+	}
+
+	switch {
+	case oldFile == nil && newFile == nil:
+		diff.Status = "unchanged"
+		return diff
+	case oldFile == nil:
+		diff.Status = "added"
+	case newFile == nil:
+		diff.Status = "removed"
+	}
+
+	diff.Services = compose.Diff(oldFile, newFile)
+	if oldFile != nil && newFile != nil {
+		diff.ChangedFiles = changedAppFiles(filepath.Join(deployedDir, app), filepath.Join(targetAppsDir, app))
+		if len(diff.Services) == 0 && len(diff.ChangedFiles) == 0 {
+			diff.Status = "unchanged"
+			return diff
+		}
+		diff.Status = "changed"
+	}
+
+	diff.Strategy = compose.DescribeStrategy(oldFile, newFile)
+	return diff
+}
+
+func printAppDiff(diff appDiff) {
+	fmt.Printf("%s (%s)\n", diff.App, diff.Status)
+	if diff.FromCommit != "" && diff.Status != "added" {
+		fmt.Printf("  deployed from: %s\n", shortCommitHash(diff.FromCommit))
+	}
+	fmt.Printf("  update:        %s\n", diff.Strategy)
+	if len(diff.Services) > 0 {
+		fmt.Printf("  services:      %s\n", compose.Summary(diff.Services))
+	}
+
+	for _, service := range diff.Services {
+		marker := map[string]string{"added": "+", "removed": "-", "changed": "~"}[service.Status]
+		fmt.Printf("    %s %s\n", marker, service.Service)
+		for _, change := range service.Changes {
+			fmt.Printf("        %s\n", change)
+		}
+	}
+
+	for _, file := range diff.ChangedFiles {
+		fmt.Printf("    file %s\n", file)
+	}
+	fmt.Println()
+}
+
+// changedAppFiles lists files other than the compose file that differ between
+// two app directories, e.g. mounted configs. Paths are relative to the app dir.
+func changedAppFiles(oldDir string, newDir string) []string {
+	oldFiles := hashAppFiles(oldDir)
+	newFiles := hashAppFiles(newDir)
+
+	changed := make([]string, 0)
+	for path, hash := range newFiles {
+		if oldHash, ok := oldFiles[path]; !ok {
+			changed = append(changed, path+" (added)")
+		} else if oldHash != hash {
+			changed = append(changed, path+" (changed)")
+		}
+	}
+	for path := range oldFiles {
+		if _, ok := newFiles[path]; !ok {
+			changed = append(changed, path+" (removed)")
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func hashAppFiles(dir string) map[string]string {
+	hashes := make(map[string]string)
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		rel, relErr := filepath.Rel(dir, path)
+		if relErr != nil || rel == compose.FileName {
+			return nil
+		}
+
+		file, openErr := os.Open(path)
+		if openErr != nil {
+			return nil
+		}
+		defer file.Close()
+
+		hasher := sha256.New()
+		if _, copyErr := io.Copy(hasher, file); copyErr == nil {
+			hashes[rel] = hex.EncodeToString(hasher.Sum(nil))
+		}
+		return nil
+	})
+	return hashes
+}
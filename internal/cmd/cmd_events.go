@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/talyguryn/konta/internal/dockerutil"
+	"github.com/talyguryn/konta/internal/events"
+	"github.com/talyguryn/konta/internal/lock"
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/reconcile"
+	"github.com/talyguryn/konta/internal/state"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+var (
+	// cycleMu serializes reconcile cycles and event-triggered heals inside the
+	// daemon; the file lock only guards against other processes.
+	cycleMu sync.Mutex
+
+	// eventWatcher follows Docker events in watch mode, nil otherwise.
+	eventWatcher *events.Watcher
+
+	// lastPolledHealthCheck is when the polling loop last ran a full health check.
+	lastPolledHealthCheck time.Time
+)
+
+// startEventWatcher follows Docker events in the background when
+// deploy.self_heal.events is enabled.
+func startEventWatcher(cfg *types.Config, stop <-chan struct{}) {
+	eventWatcher = nil
+	if !cfg.Deploy.SelfHeal.Enable || cfg.Deploy.SelfHeal.Events == nil || !*cfg.Deploy.SelfHeal.Events {
+		logger.Info("Event-driven self-heal is disabled, relying on polled health checks")
+		return
+	}
+
+	eventWatcher = events.New(
+		dockerutil.NewClient(),
+		time.Duration(cfg.Deploy.SelfHeal.EventDebounceSeconds)*time.Second,
+		time.Duration(cfg.Deploy.SelfHeal.EventCooldownSeconds)*time.Second,
+		healFromEvents,
+	)
+	go eventWatcher.Run(stop)
+}
+
+// polledHealthCheckDue tells whether the polling loop should run a full health
+// check. While the events stream is connected it only runs every
+// safety_net_interval_seconds, to catch what events miss.
+func polledHealthCheckDue(cfg *types.Config) bool {
+	if eventWatcher == nil || !eventWatcher.Connected() {
+		return true
+	}
+	return time.Since(lastPolledHealthCheck) >= time.Duration(cfg.Deploy.SelfHeal.SafetyNetIntervalSeconds)*time.Second
+}
+
+// healFromEvents records container events and runs the health check for the
+// affected apps. Like the polled health check it honours self-heal limits,
+// apps stopped with `konta app stop` and konta.stopped labels.
+func healFromEvents(containerEvents []types.ContainerEvent) error {
+	cycleMu.Lock()
+	defer cycleMu.Unlock()
+
+	logger.SetCycleID(newCycleID())
+	defer logger.SetCycleID("")
+
+	l, err := lock.Acquire()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = l.Release() }()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := state.RecordContainerEvents(containerEvents); err != nil {
+		logger.Warn("Failed to record container events: %v", err)
+	}
+
+	commit, err := state.GetCurrentReleaseCommit()
+	if err != nil {
+		logger.Warn("Skipping event-triggered health check: no current release: %v", err)
+		return nil
+	}
+
+	apps := make([]string, 0)
+	for _, event := range containerEvents {
+		if !contains(apps, event.App) {
+			apps = append(apps, event.App)
+		}
+	}
+	logger.Info("Checking health of %v after container events", apps)
+
+	reconciler := reconcile.New(cfg, filepath.Join(state.GetReleasesDir(), commit), false, commit)
+	if _, err := reconciler.HealthCheckApps(apps); err != nil {
+		logger.Warn("Event-triggered health check encountered issues: %v", err)
+	}
+	return nil
+}
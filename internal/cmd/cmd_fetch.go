@@ -29,6 +29,7 @@ func reconcileOnceFetch(dryRun bool, version string) error {
 	if err != nil {
 		return err
 	}
+	cfg = authorizeRepository(cfg)
 
 	if err := state.Init(); err != nil {
 		return err
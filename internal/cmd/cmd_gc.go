@@ -3,7 +3,6 @@ package cmd
 import (
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io/fs"
 	"os"
@@ -112,35 +111,25 @@ func stateCommitsToKeep() []string {
 func mountedReleaseDirsInUse(releasesDir string) (map[string]bool, error) {
 	kept := make(map[string]bool)
 
-	listCmd := dockerutil.Command("ps", "-aq", "--filter", "label=konta.managed=true")
-	listOutput, err := listCmd.Output()
+	docker := dockerutil.NewClient()
+	all, err := docker.Containers()
 	if err != nil {
-		return nil, fmt.Errorf("docker ps failed: %w", err)
+		return nil, err
 	}
 
-	containerIDs := strings.Fields(strings.TrimSpace(string(listOutput)))
+	containerIDs := make([]string, 0)
+	for _, container := range all {
+		if container.Managed() {
+			containerIDs = append(containerIDs, container.ID)
+		}
+	}
 	if len(containerIDs) == 0 {
 		return kept, nil
 	}
 
-	type inspectMount struct {
-		Type   string `json:"Type"`
-		Source string `json:"Source"`
-	}
-	type inspectContainer struct {
-		Mounts []inspectMount `json:"Mounts"`
-	}
-
-	inspectArgs := append([]string{"inspect"}, containerIDs...)
-	inspectCmd := dockerutil.Command(inspectArgs...)
-	inspectOutput, err := inspectCmd.Output()
+	containers, err := docker.Inspect(containerIDs...)
 	if err != nil {
-		return nil, fmt.Errorf("docker inspect failed: %w", err)
-	}
-
-	containers := make([]inspectContainer, 0)
-	if err := json.Unmarshal(inspectOutput, &containers); err != nil {
-		return nil, fmt.Errorf("failed to parse docker inspect output: %w", err)
+		return nil, err
 	}
 
 	cleanReleasesDir := filepath.Clean(releasesDir)
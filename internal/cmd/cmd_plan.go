@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/talyguryn/konta/internal/config"
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/reconcile"
+	"github.com/talyguryn/konta/internal/state"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// Plan prints the plan the next reconcile cycle would apply, without
+// changing containers, state or the current release.
+func Plan(jsonOutput bool) error {
+	if jsonOutput {
+		// Keep stdout to the JSON document, so it can be piped to jq.
+		logger.UseStderr()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	cfg = authorizeRepository(cfg)
+
+	currentState, err := state.Load()
+	if err != nil || currentState == nil {
+		currentState = &types.State{}
+	}
+
+	releaseDir, newCommit, cleanup, err := checkoutCommit(cfg, "")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	plan, err := buildCyclePlan(cfg, currentState, releaseDir, newCommit)
+	if err != nil {
+		return err
+	}
+	plan.PreviousCommit = currentState.LastCommit
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+
+	printPlan(plan)
+	if strings.TrimSpace(currentState.LastAttemptedCommit) == newCommit && currentState.LastAttemptStatus == "failure" {
+		fmt.Printf("\nNote: commit %s failed before; the daemon skips it until a new commit or `konta deploy`.\n", shortCommitHash(newCommit))
+	}
+	return nil
+}
+
+// buildCyclePlan makes the same decision as reconcileOnce: a health check when
+// the commit is already deployed, orphan cleanup when no app changed, and a
+// deploy plan otherwise.
+func buildCyclePlan(cfg *types.Config, currentState *types.State, releaseDir string, newCommit string) (*types.Plan, error) {
+	reconciler := reconcile.New(cfg, releaseDir, true, newCommit)
+
+	if newCommit == currentState.LastCommit {
+		reconciler.SetChangedProjects(nil)
+		return reconciler.BuildHealthPlan()
+	}
+
+	changedProjects := detectChangedProjects(cfg, releaseDir, currentState.LastCommit, newCommit)
+	if changedProjects != nil && len(changedProjects) == 0 {
+		return reconciler.BuildCleanupPlan()
+	}
+
+	reconciler.SetChangedProjects(addRecreateProjects(cfg, releaseDir, changedProjects))
+	return reconciler.BuildPlan()
+}
+
+func printPlan(plan *types.Plan) {
+	fmt.Printf("Plan:     %s\n", plan.Kind)
+	fmt.Printf("Commit:   %s\n", orDash(shortCommitHash(plan.Commit)))
+	fmt.Printf("Deployed: %s\n\n", orDash(shortCommitHash(plan.PreviousCommit)))
+
+	if len(plan.Actions) == 0 {
+		fmt.Println("No apps found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APP\tACTION\tSTRATEGY\tSTACK\tCOMMIT\tREASON")
+	for _, action := range plan.Actions {
+		actionType := action.Type
+		if action.Destructive {
+			actionType += " (!)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			action.App,
+			actionType,
+			orDash(action.Strategy),
+			orDash(action.Stack),
+			orDash(shortCommitHash(action.Commit)),
+			action.Reason,
+		)
+	}
+	_ = w.Flush()
+
+	fmt.Printf("\n%s.\n", reconcile.PlanSummary(plan))
+	for _, action := range plan.Actions {
+		if action.Destructive {
+			fmt.Println("(!) stops or removes running containers.")
+			break
+		}
+	}
+}
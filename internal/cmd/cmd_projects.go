@@ -4,10 +4,66 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
+
+	"github.com/talyguryn/konta/internal/compose"
+	"github.com/talyguryn/konta/internal/git"
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/state"
+	"github.com/talyguryn/konta/internal/types"
 )
 
+// detectChangedProjects returns the apps changed between two commits using git
+// diff, falling back to comparing the current release with the new one.
+// nil means the changes could not be detected and all apps are reconciled.
+func detectChangedProjects(cfg *types.Config, releaseDir string, lastCommit string, newCommit string) []string {
+	changedProjects, err := git.GetChangedProjects(releaseDir, cfg.Repository.Path, lastCommit, newCommit)
+	if err == nil {
+		return changedProjects
+	}
+	logger.Warn("Failed to detect changed projects via git diff: %v", err)
+
+	currentReleaseDir, currentReleaseErr := filepath.EvalSymlinks(state.GetCurrentLink())
+	if currentReleaseErr != nil {
+		logger.Warn("Snapshot diff fallback unavailable (cannot resolve current release): %v (will reconcile all)", currentReleaseErr)
+		return nil
+	}
+
+	snapshotChangedProjects, snapshotErr := detectChangedProjectsBySnapshot(currentReleaseDir, releaseDir, cfg.Repository.Path)
+	if snapshotErr != nil {
+		logger.Warn("Snapshot diff fallback failed: %v (will reconcile all)", snapshotErr)
+		return nil
+	}
+
+	logger.Info("Snapshot diff fallback detected %d changed project(s): %v", len(snapshotChangedProjects), snapshotChangedProjects)
+	return snapshotChangedProjects
+}
+
+// addRecreateProjects ensures projects marked with konta.recreate=true are always reconciled.
+// This is a manual override for projects that need guaranteed cleanup on each cycle.
+func addRecreateProjects(cfg *types.Config, releaseDir string, changedProjects []string) []string {
+	if changedProjects == nil {
+		return nil
+	}
+
+	recreateProjects, err := findProjectsMarkedForRecreate(filepath.Join(releaseDir, cfg.Repository.Path))
+	if err != nil {
+		logger.Debug("Failed to find konta.recreate projects: %v", err)
+		return changedProjects
+	}
+	if len(recreateProjects) == 0 {
+		return changedProjects
+	}
+
+	for _, project := range recreateProjects {
+		if !contains(changedProjects, project) {
+			changedProjects = append(changedProjects, project)
+		}
+	}
+	logger.Debug("Added %d konta.recreate project(s) to reconcile list: %v", len(recreateProjects), recreateProjects)
+	return uniqueSortedProjects(changedProjects)
+}
+
 func listDesiredProjectsForStatePrune(appsDir string) ([]string, error) {
 	entries, err := os.ReadDir(appsDir)
 	if err != nil {
@@ -45,12 +101,12 @@ func findProjectsMarkedForRecreate(appsDir string) ([]string, error) {
 		projectName := entry.Name()
 		composePath := filepath.Join(appsDir, projectName, "docker-compose.yml")
 
-		data, err := os.ReadFile(composePath)
+		file, err := compose.Load(composePath)
 		if err != nil {
-			continue // No compose file, skip
+			continue // No or unreadable compose file, skip
 		}
 
-		if composeHasRecreateLabel(data) {
+		if file.HasLabel("konta.recreate", "true") {
 			recreateProjects = append(recreateProjects, projectName)
 		}
 	}
@@ -59,16 +115,6 @@ func findProjectsMarkedForRecreate(appsDir string) ([]string, error) {
 	return recreateProjects, nil
 }
 
-func composeHasRecreateLabel(data []byte) bool {
-	// Match only explicit YAML label entries, not comments or arbitrary text.
-	// Examples matched:
-	//   - konta.recreate=true
-	//   - "konta.recreate=true"
-	//   - 'konta.recreate=true'
-	pattern := regexp.MustCompile(`(?im)^\s*-\s*["']?konta\.recreate\s*=\s*true["']?\s*$`)
-	return pattern.Match(data)
-}
-
 func contains(slice []string, item string) bool {
 	for _, v := range slice {
 		if v == item {
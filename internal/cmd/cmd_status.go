@@ -1,30 +1,94 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/talyguryn/konta/internal/config"
 	"github.com/talyguryn/konta/internal/logger"
+	platformservice "github.com/talyguryn/konta/internal/platform/service"
+	"github.com/talyguryn/konta/internal/reconcile"
 	"github.com/talyguryn/konta/internal/state"
 	"github.com/talyguryn/konta/internal/types"
 )
 
-// Status shows the last deployment status.
-func Status(version string) error {
+// statusReport is the `konta status --json` document.
+type statusReport struct {
+	Version             string                 `json:"version"`
+	DaemonRunning       bool                   `json:"daemon_running"`
+	LastCommit          string                 `json:"last_commit,omitempty"`
+	LastDeployTime      string                 `json:"last_deploy_time,omitempty"`
+	LastAttemptedCommit string                 `json:"last_attempted_commit,omitempty"`
+	LastAttemptStatus   string                 `json:"last_attempt_status,omitempty"`
+	LastAttemptTime     string                 `json:"last_attempt_time,omitempty"`
+	LastSelfUpdate      *types.SelfUpdate      `json:"last_self_update,omitempty"`
+	Apps                []reconcile.AppStatus  `json:"apps"`
+	ContainerEvents     []types.ContainerEvent `json:"container_events"`
+	LiveError           string                 `json:"live_status_error,omitempty"`
+}
+
+// Status shows the daemon state, the last deployment and a live per-app
+// view of managed containers. appFilter limits the live view to one app.
+func Status(version string, jsonOutput bool, appFilter string) error {
+	if jsonOutput {
+		logger.UseStderr()
+	}
+
+	manager := daemonManager(false)
+	daemonRunning := manager.IsRunning()
+
+	currentState, err := state.Load()
+	if err != nil || currentState == nil {
+		logger.Debug("Failed to load state: %v", err)
+		currentState = &types.State{}
+	}
+
+	apps, liveErr := liveAppStatuses(currentState, appFilter)
+
+	if jsonOutput {
+		report := statusReport{
+			Version:             version,
+			DaemonRunning:       daemonRunning,
+			LastCommit:          currentState.LastCommit,
+			LastDeployTime:      currentState.LastDeployTime,
+			LastAttemptedCommit: currentState.LastAttemptedCommit,
+			LastAttemptStatus:   currentState.LastAttemptStatus,
+			LastAttemptTime:     currentState.LastAttemptTime,
+			LastSelfUpdate:      lastSelfUpdate(currentState),
+			Apps:                apps,
+			ContainerEvents:     containerEventsFor(currentState, appFilter),
+		}
+		if report.Apps == nil {
+			report.Apps = []reconcile.AppStatus{}
+		}
+		if liveErr != nil {
+			report.LiveError = liveErr.Error()
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
 	fmt.Printf("Konta version: %s\n\n", version)
 
-	manager := daemonManager()
-	if !manager.IsRunning() {
+	if !daemonRunning {
 		fmt.Printf("✗ Konta daemon is not running\n")
 	} else {
 		fmt.Printf("✓ Konta daemon is running\n")
 
 		if runtime.GOOS == "linux" {
-			uptimeCmd := exec.Command("systemctl", "show", manager.Name(), "--property=ActiveEnterTimestamp")
+			showArgs := []string{"show", manager.Name(), "--property=ActiveEnterTimestamp"}
+			if manager.FilePath() == platformservice.UserServiceFile() {
+				showArgs = append([]string{"--user"}, showArgs...)
+			}
+			uptimeCmd := exec.Command("systemctl", showArgs...)
 			if uptimeOutput, err := uptimeCmd.Output(); err == nil {
 				uptimeStr := strings.TrimSpace(string(uptimeOutput))
 				if strings.HasPrefix(uptimeStr, "ActiveEnterTimestamp=") {
@@ -38,18 +102,21 @@ func Status(version string) error {
 		}
 	}
 
-	fmt.Println()
-
-	currentState, err := state.Load()
-	if err != nil {
-		logger.Debug("Failed to load state: %v", err)
+	if update := lastSelfUpdate(currentState); update != nil {
+		fmt.Printf("  Last update: v%s → v%s (%s", update.FromVersion, update.ToVersion, strings.ReplaceAll(update.Status, "_", " "))
+		if update.Reason != "" {
+			fmt.Printf(": %s", update.Reason)
+		}
+		fmt.Printf(")\n")
 	}
 
+	fmt.Println()
+
 	if currentState.LastCommit == "" {
 		fmt.Println("Last deployment: (none yet)")
 	} else {
 		fmt.Println("Last deployment:")
-		fmt.Printf("  Commit:    %s\n", currentState.LastCommit[:8])
+		fmt.Printf("  Commit:    %s\n", shortCommitHash(currentState.LastCommit))
 		fmt.Printf("  Timestamp: %s\n", currentState.LastDeployTime)
 		if strings.TrimSpace(currentState.LastAttemptedCommit) != "" {
 			fmt.Printf("  Attempt:   %s (%s", shortCommitHash(currentState.LastAttemptedCommit), strings.TrimSpace(currentState.LastAttemptStatus))
@@ -60,11 +127,136 @@ func Status(version string) error {
 		}
 	}
 
-	printApplicationsByCommit(currentState)
+	if appFilter == "" {
+		printApplicationsByCommit(currentState)
+	}
 
+	if liveErr != nil {
+		fmt.Println()
+		fmt.Printf("Live status unavailable: %v\n", liveErr)
+	} else {
+		printAppStatuses(apps)
+	}
+	printContainerEvents(containerEventsFor(currentState, appFilter))
 	return nil
 }
 
+func lastSelfUpdate(currentState *types.State) *types.SelfUpdate {
+	if len(currentState.SelfUpdates) == 0 {
+		return nil
+	}
+	return &currentState.SelfUpdates[len(currentState.SelfUpdates)-1]
+}
+
+// containerEventsFor returns the recorded Docker events, of one app when
+// appFilter is set.
+func containerEventsFor(currentState *types.State, appFilter string) []types.ContainerEvent {
+	containerEvents := make([]types.ContainerEvent, 0, len(currentState.ContainerEvents))
+	for _, event := range currentState.ContainerEvents {
+		if appFilter == "" || event.App == appFilter {
+			containerEvents = append(containerEvents, event)
+		}
+	}
+	return containerEvents
+}
+
+// printContainerEvents prints the newest recorded container events.
+func printContainerEvents(containerEvents []types.ContainerEvent) {
+	const shown = 5
+	if len(containerEvents) == 0 {
+		return
+	}
+	if len(containerEvents) > shown {
+		containerEvents = containerEvents[len(containerEvents)-shown:]
+	}
+
+	fmt.Println()
+	fmt.Println("Recent container events:")
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for index := len(containerEvents) - 1; index >= 0; index-- {
+		event := containerEvents[index]
+		action := event.Action
+		if event.ExitCode != "" {
+			action = fmt.Sprintf("%s (exit %s)", action, event.ExitCode)
+		}
+		fmt.Fprintf(writer, "  %s\t%s\t%s\t%s\n", event.Time, event.App, orDash(event.Service), action)
+	}
+	_ = writer.Flush()
+}
+
+// liveAppStatuses queries Docker for managed containers and compares them
+// with the deployed release, the same way the health check does.
+func liveAppStatuses(currentState *types.State, appFilter string) ([]reconcile.AppStatus, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	reconciler := currentReleaseReconciler(cfg)
+
+	var filter []string
+	if appFilter != "" {
+		filter = []string{appFilter}
+	}
+	return reconciler.Status(filter)
+}
+
+func printAppStatuses(apps []reconcile.AppStatus) {
+	fmt.Println()
+	if len(apps) == 0 {
+		fmt.Println("Applications: (none)")
+		return
+	}
+
+	fmt.Println("Applications:")
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "  APP\tSTACK\tCOMMIT\tSERVICE\tSTATE\tHEALTH\tRESTARTS\tUPTIME\tSELF-HEAL\tDRIFT")
+	for _, app := range apps {
+		drift := app.Drift
+		if app.OperatorStopped {
+			drift = "stopped (konta app stop)"
+		}
+		if drift == "" {
+			drift = "-"
+		}
+		prefix := fmt.Sprintf("  %s\t%s\t%s", app.App, orDash(app.Stack), orDash(shortCommitHash(app.Commit)))
+		suffix := fmt.Sprintf("%d\t%s", app.SelfHealAttempts, drift)
+
+		if len(app.Containers) == 0 {
+			fmt.Fprintf(writer, "%s\t-\t-\t-\t-\t-\t%s\n", prefix, suffix)
+			continue
+		}
+
+		for index, container := range app.Containers {
+			if index > 0 {
+				prefix = "  \t\t"
+				suffix = "\t"
+			}
+			service := orDash(container.Service)
+			if container.Stack != app.Stack {
+				service = fmt.Sprintf("%s (%s)", service, container.Stack)
+			}
+			containerState := container.State
+			if container.Stopped {
+				containerState += " (konta.stopped)"
+			}
+			uptime := "-"
+			if container.UptimeSeconds > 0 {
+				uptime = formatUptime(time.Duration(container.UptimeSeconds) * time.Second)
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", prefix, service, containerState, orDash(container.Health), container.Restarts, uptime, suffix)
+		}
+	}
+	_ = writer.Flush()
+}
+
+func orDash(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "-"
+	}
+	return value
+}
+
 type commitDeploymentGroup struct {
 	Commit     string
 	DeployTime string
@@ -180,4 +372,4 @@ func formatUptime(d time.Duration) string {
 		return fmt.Sprintf("%dh %dm", hours, minutes)
 	}
 	return fmt.Sprintf("%dm", minutes)
-}
\ No newline at end of file
+}
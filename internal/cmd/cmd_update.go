@@ -2,10 +2,13 @@ package cmd
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"runtime"
 	"strings"
@@ -14,36 +17,86 @@ import (
 	"github.com/talyguryn/konta/internal/config"
 	"github.com/talyguryn/konta/internal/hooks"
 	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/notify"
 	"github.com/talyguryn/konta/internal/state"
+	"github.com/talyguryn/konta/internal/types"
+	"github.com/talyguryn/konta/internal/updatepolicy"
 )
 
+// notifiedUpdateVersion remembers the last version announced through
+// notifications so watch mode doesn't repeat the same message every check.
+var notifiedUpdateVersion string
+
+// deferredUpdateVersion remembers the last version whose auto-install was put
+// off until the maintenance window, to log that only once.
+var deferredUpdateVersion string
+
 // CheckForUpdates checks if a new version is available without updating.
-// Used during watch mode to notify user of available updates.
-func CheckForUpdates(currentVersion string, updateBehavior string, releaseChannel string) error {
-	if updateBehavior == "false" || updateBehavior == "" {
+// Used during watch mode to notify user of available updates; with
+// konta_updates.mode auto it installs the update inside the maintenance window.
+func CheckForUpdates(currentVersion string, cfg *types.Config) error {
+	policy := cfg.KontaUpdates
+	if !policy.Enabled() {
+		return nil
+	}
+
+	constraint, err := updatepolicy.ParseConstraint(policy.Constraint)
+	if err != nil {
+		logger.Warn("Update check skipped: konta_updates.constraint: %v", err)
+		return nil
+	}
+	window, err := updatepolicy.ParseWindow(policy.Window)
+	if err != nil {
+		logger.Warn("Update check skipped: konta_updates.window: %v", err)
 		return nil
 	}
 
-	releaseChannel = normalizeReleaseChannel(releaseChannel)
-	channelLabel := releaseChannelScopeLabel(releaseChannel)
+	channelLabel := releaseChannelScopeLabel(policy.Channel)
 
-	release, err := fetchLatestRelease(releaseChannel)
+	release, err := findUpdate(currentVersion, policy, constraint)
 	if err != nil {
 		logger.Debug("Failed to check for updates: %v", err)
 		return nil
 	}
-
-	latestVersion := strings.TrimPrefix(release.TagName, "v")
-	if latestVersion == currentVersion {
+	if release == nil {
 		return nil
 	}
 
-	if updateBehavior == "notify" {
+	latestVersion := strings.TrimPrefix(release.TagName, "v")
+
+	if latestVersion != notifiedUpdateVersion {
+		notifiedUpdateVersion = latestVersion
+		notify.New(cfg).Send(notify.Event{
+			Type:          notify.EventUpdateAvailable,
+			Version:       currentVersion,
+			LatestVersion: latestVersion,
+			Reason:        updatePolicyLabel(policy),
+		})
+		hooks.New(state.GetCurrentLink(), cfg.Hooks).RunEvent(hooks.Event{
+			Type:          hooks.EventUpdateAvailable,
+			Version:       currentVersion,
+			LatestVersion: latestVersion,
+			Reason:        updatePolicyLabel(policy),
+		})
+	}
+
+	if policy.Mode == "notify" {
 		logger.Info("New Konta version available on %s: v%s (current: v%s). Run 'konta update' to install.", channelLabel, latestVersion, currentVersion)
 		return nil
 	}
 
-	if updateBehavior == "auto" {
+	if policy.Mode == "auto" {
+		if rolledBackVersion(latestVersion) {
+			logger.Info("Skipping auto-update to v%s: it was rolled back before. Run 'konta update' to install it anyway.", latestVersion)
+			return nil
+		}
+		if !window.Contains(time.Now()) {
+			if deferredUpdateVersion != latestVersion {
+				deferredUpdateVersion = latestVersion
+				logger.Info("New Konta version available on %s: v%s (current: v%s). It will be installed in the maintenance window %s.", channelLabel, latestVersion, currentVersion, window)
+			}
+			return nil
+		}
 		if err := autoUpdate(currentVersion, release); err != nil {
 			logger.Warn("Auto-update failed: %v", err)
 		}
@@ -53,12 +106,36 @@ func CheckForUpdates(currentVersion string, updateBehavior string, releaseChanne
 	return nil
 }
 
+// updatePolicyLabel describes the update settings for notifications.
+func updatePolicyLabel(policy types.UpdatePolicy) string {
+	parts := []string{
+		fmt.Sprintf("konta_updates: %s", policy.Mode),
+		fmt.Sprintf("channel: %s", releaseChannelScopeLabel(policy.Channel)),
+	}
+	if policy.Constraint != "" {
+		parts = append(parts, fmt.Sprintf("constraint: %s", policy.Constraint))
+	}
+	if policy.Window != "" {
+		parts = append(parts, fmt.Sprintf("window: %s", policy.Window))
+	}
+	if policy.Mirror != "" {
+		parts = append(parts, fmt.Sprintf("mirror: %s", policy.Mirror))
+	}
+	return strings.Join(parts, ", ")
+}
+
+type releaseAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// githubRelease is a release as listed by the GitHub API. Mirror indexes use
+// the same format.
 type githubRelease struct {
-	TagName string `json:"tag_name"`
-	Assets  []struct {
-		Name               string `json:"name"`
-		BrowserDownloadURL string `json:"browser_download_url"`
-	} `json:"assets"`
+	TagName    string         `json:"tag_name"`
+	Prerelease bool           `json:"prerelease"`
+	Draft      bool           `json:"draft"`
+	Assets     []releaseAsset `json:"assets"`
 }
 
 type githubRateLimit struct {
@@ -155,67 +232,60 @@ func buildGitHubErrorMessage(statusCode int, body []byte) string {
 	}
 }
 
-func fetchLatestAnyRelease() (*githubRelease, error) {
-	resp, err := http.Get("https://api.github.com/repos/talyguryn/konta/releases?per_page=30")
+// findUpdate returns the newest release newer than currentVersion that the
+// channel and constraint allow, or nil when there is none. It never picks an
+// older version, so a host running a prerelease is not downgraded to stable.
+func findUpdate(currentVersion string, policy types.UpdatePolicy, constraint updatepolicy.Constraint) (*githubRelease, error) {
+	current, err := updatepolicy.ParseVersion(currentVersion)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to connect to GitHub - %v", err)
+		return nil, fmt.Errorf("current version: %w", err)
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	body, err := io.ReadAll(resp.Body)
+	releases, err := fetchReleases(policy.Mirror)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to read response - %v", err)
+		return nil, err
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf(buildGitHubErrorMessage(resp.StatusCode, body))
-	}
-
-	var releases []struct {
-		TagName    string `json:"tag_name"`
-		Prerelease bool   `json:"prerelease"`
-		Draft      bool   `json:"draft"`
-		Assets     []struct {
-			Name               string `json:"name"`
-			BrowserDownloadURL string `json:"browser_download_url"`
-		} `json:"assets"`
-	}
+	includePrereleases := normalizeReleaseChannel(policy.Channel) == "next"
 
-	if err := json.Unmarshal(body, &releases); err != nil {
-		return nil, fmt.Errorf("Failed to parse release info")
-	}
-
-	for _, rel := range releases {
-		if rel.Draft {
+	var best *githubRelease
+	var bestVersion updatepolicy.Version
+	for index := range releases {
+		release := &releases[index]
+		if release.Draft {
 			continue
 		}
 
-		release := &githubRelease{TagName: rel.TagName}
-		for _, asset := range rel.Assets {
-			release.Assets = append(release.Assets, struct {
-				Name               string `json:"name"`
-				BrowserDownloadURL string `json:"browser_download_url"`
-			}{
-				Name:               asset.Name,
-				BrowserDownloadURL: asset.BrowserDownloadURL,
-			})
+		version, err := updatepolicy.ParseVersion(release.TagName)
+		if err != nil {
+			logger.Debug("Ignoring release %q: %v", release.TagName, err)
+			continue
+		}
+		if (release.Prerelease || version.IsPrerelease()) && !includePrereleases {
+			continue
+		}
+		if !constraint.Matches(version) || version.Compare(current) <= 0 {
+			continue
+		}
+		if best == nil || version.Compare(bestVersion) > 0 {
+			best, bestVersion = release, version
 		}
-		return release, nil
 	}
 
-	return nil, fmt.Errorf("No releases found on GitHub")
+	return best, nil
 }
 
-func fetchLatestRelease(channel string) (*githubRelease, error) {
-	if normalizeReleaseChannel(channel) == "next" {
-		return fetchLatestAnyRelease()
+// fetchReleases lists the releases updates are chosen from: the mirror's
+// index when konta_updates.mirror is set, GitHub otherwise.
+func fetchReleases(mirror string) ([]githubRelease, error) {
+	if strings.TrimSpace(mirror) != "" {
+		return fetchMirrorReleases(strings.TrimSpace(mirror))
 	}
-
-	return fetchLatestStableRelease()
+	return fetchGitHubReleases()
 }
 
-func fetchLatestStableRelease() (*githubRelease, error) {
-	resp, err := http.Get("https://api.github.com/repos/talyguryn/konta/releases/latest")
+func fetchGitHubReleases() ([]githubRelease, error) {
+	resp, err := http.Get("https://api.github.com/repos/talyguryn/konta/releases?per_page=100")
 	if err != nil {
 		return nil, fmt.Errorf("Failed to connect to GitHub - %v", err)
 	}
@@ -230,12 +300,56 @@ func fetchLatestStableRelease() (*githubRelease, error) {
 		return nil, fmt.Errorf(buildGitHubErrorMessage(resp.StatusCode, body))
 	}
 
-	var release githubRelease
-	if err := json.Unmarshal(body, &release); err != nil {
+	var releases []githubRelease
+	if err := json.Unmarshal(body, &releases); err != nil {
 		return nil, fmt.Errorf("Failed to parse release info")
 	}
 
-	return &release, nil
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("No releases found on GitHub")
+	}
+	return releases, nil
+}
+
+// fetchMirrorReleases reads a release index from an internal mirror. The
+// index is a JSON array in the format of GitHub's list releases API; asset
+// URLs may be relative to the index.
+func fetchMirrorReleases(indexURL string) ([]githubRelease, error) {
+	base, err := url.Parse(indexURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("konta_updates.mirror must be an http(s) URL, got %q", indexURL)
+	}
+
+	resp, err := http.Get(indexURL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to release mirror - %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Release mirror %s returned status %d", indexURL, resp.StatusCode)
+	}
+
+	var releases []githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("Failed to parse release index from %s - %v", indexURL, err)
+	}
+
+	for index := range releases {
+		for assetIndex := range releases[index].Assets {
+			asset := &releases[index].Assets[assetIndex]
+			ref, err := url.Parse(asset.BrowserDownloadURL)
+			if err != nil {
+				return nil, fmt.Errorf("Release index has an invalid URL for %s - %v", asset.Name, err)
+			}
+			asset.BrowserDownloadURL = base.ResolveReference(ref).String()
+		}
+	}
+
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("No releases found in %s", indexURL)
+	}
+	return releases, nil
 }
 
 func normalizeReleaseChannel(channel string) string {
@@ -270,59 +384,82 @@ func findDownloadURL(release *githubRelease, binaryName string) string {
 	return ""
 }
 
-func downloadAndInstall(downloadURL string, latestVersion string) error {
+// downloadAndInstall downloads the release binary, checks it against the
+// signed checksums of the release and only then swaps it in. The previous
+// binary is kept at <binary>.backup. It returns the installed binary's path.
+func downloadAndInstall(release *githubRelease, binaryName string, latestVersion string) (string, error) {
+	downloadURL := findDownloadURL(release, binaryName)
+	if downloadURL == "" {
+		return "", fmt.Errorf("no binary found for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+
+	expectedSum, err := fetchVerifiedChecksum(release, binaryName, releasePublicKey)
+	if err != nil {
+		logger.Error("Update verification failed for v%s: %v", latestVersion, err)
+		return "", fmt.Errorf("update verification failed: %w", err)
+	}
+	logger.Info("Verified signature of %s for v%s", releaseChecksumsAsset, latestVersion)
+
 	resp, err := http.Get(downloadURL)
 	if err != nil {
-		return fmt.Errorf("download failed: %v", err)
+		return "", fmt.Errorf("download failed: %v", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("download returned status %d", resp.StatusCode)
+		return "", fmt.Errorf("download returned status %d", resp.StatusCode)
 	}
 
 	exePath, err := os.Executable()
 	if err != nil {
-		return fmt.Errorf("failed to get executable path: %v", err)
+		return "", fmt.Errorf("failed to get executable path: %v", err)
 	}
 
 	tmpFile := exePath + ".new"
 	out, err := os.Create(tmpFile)
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %v", err)
+		return "", fmt.Errorf("failed to create temp file: %v", err)
 	}
 
-	_, err = io.Copy(out, resp.Body)
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), resp.Body)
 	if closeErr := out.Close(); closeErr != nil {
 		_ = os.Remove(tmpFile)
-		return fmt.Errorf("failed to close temp file: %v", closeErr)
+		return "", fmt.Errorf("failed to close temp file: %v", closeErr)
 	}
 	if err != nil {
 		_ = os.Remove(tmpFile)
-		return fmt.Errorf("download failed: %v", err)
+		return "", fmt.Errorf("download failed: %v", err)
+	}
+
+	actualSum := hex.EncodeToString(hash.Sum(nil))
+	if actualSum != expectedSum {
+		_ = os.Remove(tmpFile)
+		logger.Error("Checksum mismatch for %s v%s: expected %s, got %s", binaryName, latestVersion, expectedSum, actualSum)
+		return "", fmt.Errorf("update verification failed: checksum mismatch for %s, refusing to install", binaryName)
 	}
+	logger.Info("Verified SHA256 of %s: %s", binaryName, actualSum)
 
 	if err := os.Chmod(tmpFile, 0755); err != nil {
 		_ = os.Remove(tmpFile)
-		return fmt.Errorf("failed to set permissions: %v", err)
+		return "", fmt.Errorf("failed to set permissions: %v", err)
 	}
 
-	backupPath := exePath + ".backup"
+	backupPath := backupBinaryPath(exePath)
 	if err := os.Rename(exePath, backupPath); err != nil {
 		_ = os.Remove(tmpFile)
-		return fmt.Errorf("failed to backup current binary: %v", err)
+		return "", fmt.Errorf("failed to backup current binary: %v", err)
 	}
 
 	if err := os.Rename(tmpFile, exePath); err != nil {
 		_ = os.Rename(backupPath, exePath)
-		return fmt.Errorf("failed to install new binary: %v", err)
+		return "", fmt.Errorf("failed to install new binary: %v", err)
 	}
 
-	_ = os.Remove(backupPath)
-	return nil
+	return exePath, nil
 }
 
-func runPostUpdateHook() {
+func runPostUpdateHook(previousVersion string, newVersion string) {
 	devNull, err := os.Open(os.DevNull)
 	if err != nil {
 		return
@@ -348,8 +485,11 @@ func runPostUpdateHook() {
 		return
 	}
 
-	hookRunner := hooks.New(repoDir, cfg.Hooks.StartedAbs, cfg.Hooks.PreAbs, cfg.Hooks.SuccessAbs, cfg.Hooks.FailureAbs, cfg.Hooks.PostUpdateAbs)
-	_ = hookRunner.RunPostUpdate()
+	hookRunner := hooks.New(repoDir, cfg.Hooks)
+	if commit, err := state.GetCurrentReleaseCommit(); err == nil {
+		hookRunner.SetContext(hooks.Context{Commit: commit})
+	}
+	_ = hookRunner.RunPostUpdate(previousVersion, newVersion)
 
 	os.Stdout = oldStdout
 	os.Stderr = oldStderr
@@ -362,64 +502,76 @@ func autoUpdate(currentVersion string, release *githubRelease) error {
 	}
 
 	binaryName := getBinaryName()
-	downloadURL := findDownloadURL(release, binaryName)
-	if downloadURL == "" {
-		return fmt.Errorf("no binary found for %s/%s", runtime.GOOS, runtime.GOARCH)
-	}
-
 	logger.Info("Auto-update: downloading %s (v%s)", binaryName, latestVersion)
-	if err := downloadAndInstall(downloadURL, latestVersion); err != nil {
+	binaryPath, err := downloadAndInstall(release, binaryName, latestVersion)
+	if err != nil {
 		return err
 	}
 
-	runPostUpdateHook()
-
-	isDaemonRunning := isDaemonCurrentlyRunning()
-
-	if isDaemonRunning {
-		logger.Info("Auto-update complete: v%s installed. Restarting daemon...", latestVersion)
+	outcome, err := activateUpdate(binaryPath, currentVersion, latestVersion, true)
+	if err != nil {
+		return err
+	}
 
-		if err := restartDaemonForCurrentOS(); err != nil {
-			logger.Warn("Failed to restart daemon after auto-update: %v", err)
-			logger.Info("Please restart manually: sudo konta restart")
-		} else {
-			logger.Info("Daemon restarted successfully with new version")
-		}
-	} else {
+	switch outcome {
+	case updateRestarted:
+		// The daemon stops when the restart's SIGTERM arrives.
+		logger.Info("Auto-update complete: v%s installed, daemon restarting", latestVersion)
+	case updateRestartFailed:
+		logger.Info("Please restart manually: sudo konta restart")
+	default:
 		logger.Info("Auto-update complete: v%s installed. Daemon is not running.", latestVersion)
 	}
 
 	return nil
 }
 
-// Update checks for and installs the latest version from GitHub.
+// Update checks for and installs the latest version allowed by konta_updates
+// from GitHub or the configured mirror. The maintenance window only applies
+// to auto-updates.
 func Update(currentVersion string, forceYes bool, releaseChannelOverride string) error {
 	fmt.Printf("Current version: v%s\n", currentVersion)
 
-	releaseChannel := "stable"
+	policy := types.UpdatePolicy{Channel: "stable"}
 	if cfg, err := config.Load(); err == nil {
-		releaseChannel = normalizeReleaseChannel(cfg.ReleaseChannel)
+		policy = cfg.KontaUpdates
 	}
 	if strings.TrimSpace(releaseChannelOverride) != "" {
-		releaseChannel = normalizeReleaseChannel(releaseChannelOverride)
+		policy.Channel = normalizeReleaseChannel(releaseChannelOverride)
+	}
+	channelLabel := releaseChannelScopeLabel(policy.Channel)
+
+	constraint, err := updatepolicy.ParseConstraint(policy.Constraint)
+	if err != nil {
+		return fmt.Errorf("konta_updates.constraint: %w", err)
 	}
-	channelLabel := releaseChannelScopeLabel(releaseChannel)
 
-	fmt.Printf("Checking for updates from GitHub (channel: %s)...\n", channelLabel)
+	source := "GitHub"
+	if policy.Mirror != "" {
+		source = policy.Mirror
+	}
+	fmt.Printf("Checking for updates from %s (channel: %s)...\n", source, channelLabel)
+	if !constraint.Empty() {
+		fmt.Printf("Version constraint: %s\n", constraint)
+	}
 	fmt.Println()
 
-	release, err := fetchLatestRelease(releaseChannel)
+	release, err := findUpdate(currentVersion, policy, constraint)
 	if err != nil {
 		return err
 	}
 
-	latestVersion := strings.TrimPrefix(release.TagName, "v")
-
-	if latestVersion == currentVersion {
-		fmt.Printf("✓ Already running the latest version on %s!\n", channelLabel)
+	if release == nil {
+		if constraint.Empty() {
+			fmt.Printf("✓ Already running the latest version on %s!\n", channelLabel)
+		} else {
+			fmt.Printf("✓ Already running the latest version on %s allowed by %q!\n", channelLabel, constraint)
+		}
 		return nil
 	}
 
+	latestVersion := strings.TrimPrefix(release.TagName, "v")
+
 	fmt.Printf("🎉 New version available on %s: v%s\n", channelLabel, latestVersion)
 
 	if !forceYes {
@@ -436,40 +588,36 @@ func Update(currentVersion string, forceYes bool, releaseChannelOverride string)
 	}
 
 	binaryName := getBinaryName()
-	downloadURL := findDownloadURL(release, binaryName)
-	if downloadURL == "" {
+	if findDownloadURL(release, binaryName) == "" {
 		return fmt.Errorf("Update failed: no binary found for %s/%s. Try to check updates later again.", runtime.GOOS, runtime.GOARCH)
 	}
 
 	fmt.Printf("\nDownloading %s...\n", binaryName)
-	if err := downloadAndInstall(downloadURL, latestVersion); err != nil {
+	binaryPath, err := downloadAndInstall(release, binaryName, latestVersion)
+	if err != nil {
 		return err
 	}
 
-	fmt.Printf("✓ Updated to v%s successfully!\n", latestVersion)
-
-	runPostUpdateHook()
-
-	isDaemonRunning := isDaemonCurrentlyRunning()
+	outcome, err := activateUpdate(binaryPath, currentVersion, latestVersion, os.Getuid() == 0)
+	if err != nil {
+		return err
+	}
 
-	if isDaemonRunning {
-		fmt.Println("\nDaemon is running. Attempting automatic restart to apply new version...")
-		if os.Getuid() != 0 {
-			fmt.Println("\n⚠  Root privileges required to restart daemon.")
-			fmt.Println("Restart manually with: sudo konta restart")
-			return nil
-		}
+	fmt.Printf("✓ Updated to v%s successfully!\n", latestVersion)
 
-		if err := restartDaemonForCurrentOS(); err != nil {
-			fmt.Printf("⚠  Failed to restart daemon: %v\n", err)
-			fmt.Println("Restart manually with: sudo konta restart")
-			return nil
-		}
-		fmt.Println("✓ Daemon restarted with new version!")
-	} else {
+	switch outcome {
+	case updateRestarted:
+		fmt.Println("✓ Daemon restarting with new version!")
+		fmt.Printf("If v%s does not finish a cycle within %s, Konta rolls back to v%s. Check with: konta status\n", latestVersion, selfUpdateConfirmTimeout, currentVersion)
+	case updateRestartFailed:
+		fmt.Println("Restart manually with: sudo konta restart")
+	case updateRestartSkipped:
+		fmt.Println("\n⚠  Root privileges required to restart daemon.")
+		fmt.Println("Restart manually with: sudo konta restart")
+	default:
 		fmt.Println("\nDaemon is not running. Start it when ready:")
 		fmt.Println("  sudo konta start")
 	}
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/types"
+	"github.com/talyguryn/konta/internal/updatepolicy"
+)
+
+const testReleaseIndex = `[
+	{"tag_name": "v2.0.0", "assets": [{"name": "konta-linux", "browser_download_url": "v2.0.0/konta-linux"}]},
+	{"tag_name": "v1.6.0-rc.1", "prerelease": true},
+	{"tag_name": "v1.5.1"},
+	{"tag_name": "v1.5.2", "draft": true},
+	{"tag_name": "v1.4.9"},
+	{"tag_name": "nightly"}
+]`
+
+func TestFindUpdateFollowsChannelAndConstraint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testReleaseIndex))
+	}))
+	defer server.Close()
+	mirror := server.URL + "/konta/releases.json"
+
+	tests := []struct {
+		current    string
+		channel    string
+		constraint string
+		want       string
+	}{
+		{"1.5.0", "stable", "", "v2.0.0"},
+		{"1.5.0", "stable", "<2", "v1.5.1"},
+		{"1.5.0", "next", "~1.5 || ^1.6.0", "v1.6.0-rc.1"},
+		{"1.6.0-rc.2", "stable", "<2", ""}, // never downgraded to stable
+		{"2.0.0", "stable", "", ""},
+	}
+	for _, tt := range tests {
+		constraint, err := updatepolicy.ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release, err := findUpdate(tt.current, types.UpdatePolicy{Channel: tt.channel, Mirror: mirror}, constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if release != nil {
+			got = release.TagName
+		}
+		if got != tt.want {
+			t.Errorf("update from %s (%s, %q) = %q, want %q", tt.current, tt.channel, tt.constraint, got, tt.want)
+		}
+	}
+
+	release, _ := findUpdate("1.0.0", types.UpdatePolicy{Mirror: mirror}, updatepolicy.Constraint{})
+	if got := release.Assets[0].BrowserDownloadURL; got != server.URL+"/konta/v2.0.0/konta-linux" {
+		t.Errorf("asset URL = %s, want it resolved against the mirror", got)
+	}
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/talyguryn/konta/internal/compose"
+	"github.com/talyguryn/konta/internal/config"
+)
+
+// Validate lints the apps of an infra repository checkout the same way the
+// server reads them. It needs neither Docker, root nor a Konta config, so it
+// can run in CI. With strict, warnings fail the check too.
+func Validate(path string, strict bool) error {
+	if path == "" {
+		path = "."
+	}
+
+	// PATH is a repository base (with apps/), an apps directory or one app.
+	target := path
+	var diagnostics []compose.Diagnostic
+	apps := 1
+	if _, err := os.Stat(filepath.Join(path, compose.FileName)); err == nil {
+		_, diagnostics = compose.ValidateApp(path)
+	} else {
+		if info, err := os.Stat(filepath.Join(path, "apps")); err == nil && info.IsDir() {
+			target = filepath.Join(path, "apps")
+		}
+		diagnostics, apps, err = compose.Validate(target)
+		if err != nil {
+			return err
+		}
+	}
+
+	errors, warnings := 0, 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == compose.SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+		fmt.Println(diagnostic)
+	}
+
+	// The settings file lives next to apps/.
+	settingsPath := filepath.Join(filepath.Dir(target), config.RepoSettingsFile)
+	if data, err := os.ReadFile(settingsPath); err == nil {
+		if _, err := config.ParseRepoSettings(data); err != nil {
+			errors++
+			fmt.Printf("%s: %v\n", settingsPath, err)
+		}
+	}
+
+	fmt.Printf("%d app(s) checked in %s: %d error(s), %d warning(s)\n", apps, target, errors, warnings)
+
+	if errors > 0 || (strict && warnings > 0) {
+		return fmt.Errorf("validation failed")
+	}
+	return nil
+}
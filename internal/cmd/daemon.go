@@ -3,32 +3,62 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"strings"
 
+	"github.com/talyguryn/konta/internal/config"
+	"github.com/talyguryn/konta/internal/dockerutil"
 	"github.com/talyguryn/konta/internal/logger"
 	platformservice "github.com/talyguryn/konta/internal/platform/service"
 )
 
 func isDaemonCurrentlyRunning() bool {
-	return daemonManager().IsRunning()
+	return daemonManager(false).IsRunning()
 }
 
 func restartDaemonForCurrentOS() error {
-	return daemonManager().Restart()
+	return daemonManager(false).Restart()
+}
+
+// requestDaemonRestart restarts the daemon without waiting for it, for
+// callers that may be the daemon itself.
+func requestDaemonRestart() error {
+	return daemonManager(false).RequestRestart()
 }
 
 // daemonManager returns platform-specific daemon manager implementation.
-func daemonManager() platformservice.Manager {
+// A non-root user whose systemd user unit exists gets the user manager even
+// without --user, so status, restart and updates find the rootless daemon.
+func daemonManager(user bool) platformservice.Manager {
 	binaryPath, err := os.Executable()
 	if err != nil || strings.TrimSpace(binaryPath) == "" {
 		binaryPath = "/usr/local/bin/konta"
 	}
-	return platformservice.NewManager(binaryPath)
+
+	if !user && runtime.GOOS == "linux" && os.Geteuid() != 0 {
+		if _, err := os.Stat(platformservice.UserServiceFile()); err == nil {
+			user = true
+		}
+	}
+
+	return platformservice.NewManager(binaryPath, platformservice.Options{
+		User:    user,
+		Runtime: dockerutil.Runtime(),
+	})
 }
 
-// ManageDaemon manages the system daemon (systemd on Linux, launchd on macOS)
-func ManageDaemon(action string) error {
-	manager := daemonManager()
+// ManageDaemon manages the system daemon (systemd on Linux, launchd on macOS).
+// With user set it manages a systemd user unit for rootless setups.
+func ManageDaemon(action string, user bool) error {
+	if user && runtime.GOOS != "linux" {
+		return fmt.Errorf("--user is only supported with systemd on Linux")
+	}
+	if strings.EqualFold(action, "enable") || strings.EqualFold(action, "start") {
+		// The unit depends on the runtime's service; config.Load applies
+		// the configured runtime when there is a config.
+		_, _ = config.Load()
+	}
+	manager := daemonManager(user)
 
 	switch strings.ToLower(action) {
 	case "enable":
@@ -61,6 +91,10 @@ func daemonEnable(manager platformservice.Manager) error {
 		return err
 	}
 	fmt.Printf("✓ Konta daemon enabled and started\n")
+	if manager.FilePath() == platformservice.UserServiceFile() {
+		fmt.Printf("  User unit: %s\n", manager.FilePath())
+		fmt.Printf("  To keep it running after you log out, run: loginctl enable-linger %s\n", os.Getenv("USER"))
+	}
 	return nil
 }
 
@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package cmd
+
+import "os/exec"
+
+// detachProcess is a no-op on Windows, where child processes outlive their
+// parent by default.
+func detachProcess(command *exec.Cmd) {}
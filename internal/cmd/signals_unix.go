@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	// reloadSignals make the daemon reload its config and restart the
+	// components that depend on it.
+	reloadSignals = []os.Signal{syscall.SIGHUP}
+
+	// reconcileSignals start a reconcile cycle right away.
+	reconcileSignals = []os.Signal{syscall.SIGUSR1}
+)
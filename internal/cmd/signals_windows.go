@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package cmd
+
+import "os"
+
+// Windows has no SIGHUP or SIGUSR1; the daemon only handles stop signals.
+var (
+	reloadSignals    []os.Signal
+	reconcileSignals []os.Signal
+)
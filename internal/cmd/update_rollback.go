@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/talyguryn/konta/internal/logger"
+	platformservice "github.com/talyguryn/konta/internal/platform/service"
+	"github.com/talyguryn/konta/internal/state"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// A self-update stays pending until the daemon on the new version finishes a
+// cycle. A watchdog running the previous binary restores it when the new
+// daemon does not start or does not finish a cycle in time.
+const (
+	selfUpdateStartTimeout   = 2 * time.Minute
+	selfUpdateConfirmTimeout = 15 * time.Minute
+	selfUpdatePollInterval   = 5 * time.Second
+	selfUpdateSmokeTimeout   = 10 * time.Second
+)
+
+type updateOutcome int
+
+const (
+	updateDaemonStopped  updateOutcome = iota // daemon not running, confirmed by its first cycle once started
+	updateRestarted                           // daemon restarted on the new binary, watchdog started
+	updateRestartFailed                       // restart failed, confirmed by the daemon's next start
+	updateRestartSkipped                      // no privileges to restart, confirmed by the daemon's next start
+)
+
+func backupBinaryPath(binaryPath string) string {
+	return binaryPath + ".backup"
+}
+
+// activateUpdate runs after the new binary is in place: it checks that the
+// binary runs at all, runs the post_update hook and restarts the daemon
+// under a watchdog. A binary that fails to run is reverted right away.
+func activateUpdate(binaryPath string, previousVersion string, newVersion string, canRestart bool) (updateOutcome, error) {
+	update := types.SelfUpdate{
+		FromVersion: previousVersion,
+		ToVersion:   newVersion,
+		Binary:      binaryPath,
+		Backup:      backupBinaryPath(binaryPath),
+		Status:      state.SelfUpdatePending,
+		StartedAt:   time.Now().Format(time.RFC3339),
+	}
+
+	if err := smokeTestBinary(binaryPath, newVersion); err != nil {
+		logger.Error("New binary v%s does not run, restoring v%s: %v", newVersion, previousVersion, err)
+		update.Status = state.SelfUpdateFailed
+		update.Reason = err.Error()
+		update.FinishedAt = time.Now().Format(time.RFC3339)
+		if restoreErr := os.Rename(update.Backup, binaryPath); restoreErr != nil {
+			update.Reason += fmt.Sprintf("; restoring v%s failed: %v", previousVersion, restoreErr)
+		}
+		if err := state.RecordSelfUpdate(update); err != nil {
+			logger.Warn("Failed to record self-update: %v", err)
+		}
+		return updateDaemonStopped, fmt.Errorf("update to v%s failed and was reverted: %w", newVersion, err)
+	}
+
+	runPostUpdateHook(previousVersion, newVersion)
+
+	outcome := updateDaemonStopped
+	if isDaemonCurrentlyRunning() {
+		outcome = updateRestartSkipped
+		if canRestart {
+			update.Deadline = time.Now().Add(selfUpdateConfirmTimeout).Format(time.RFC3339)
+			outcome = updateRestarted
+		}
+	}
+
+	if err := state.RecordSelfUpdate(update); err != nil {
+		logger.Warn("Failed to record self-update: %v", err)
+	}
+
+	if outcome != updateRestarted {
+		return outcome, nil
+	}
+
+	// The watchdog runs the previous binary: it is known to work and is the
+	// one to restore.
+	if err := startUpdateWatchdog(update.Backup); err != nil {
+		logger.Warn("Failed to start self-update watchdog, v%s will not be rolled back automatically: %v", newVersion, err)
+	}
+
+	// An auto-update runs inside the daemon: waiting for the restart would
+	// keep it from handling the SIGTERM the restart sends.
+	logger.Info("Restarting daemon on v%s...", newVersion)
+	if err := requestDaemonRestart(); err != nil {
+		logger.Warn("Failed to restart daemon after update: %v", err)
+		return updateRestartFailed, nil
+	}
+	return updateRestarted, nil
+}
+
+// smokeTestBinary runs `<binary> version` and checks the reported version.
+func smokeTestBinary(binaryPath string, version string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), selfUpdateSmokeTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, binaryPath, "version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("`%s version` failed: %v", binaryPath, err)
+	}
+	if !strings.Contains(string(output), "v"+version) {
+		return fmt.Errorf("`%s version` reported %q, expected v%s", binaryPath, strings.TrimSpace(string(output)), version)
+	}
+	return nil
+}
+
+// startUpdateWatchdog starts `konta update-watchdog` from the given binary
+// outside the daemon, so restarting the daemon does not stop it. Under
+// systemd it runs as a transient unit; elsewhere in its own session.
+func startUpdateWatchdog(binaryPath string) error {
+	if runtime.GOOS == "linux" {
+		if systemdRun, err := exec.LookPath("systemd-run"); err == nil {
+			args := []string{"--collect", "--quiet", "--description", "Konta self-update watchdog"}
+			if daemonManager(false).FilePath() == platformservice.UserServiceFile() {
+				args = append([]string{"--user"}, args...)
+			}
+			args = append(args, binaryPath, "update-watchdog")
+			if output, err := exec.Command(systemdRun, args...).CombinedOutput(); err != nil {
+				return fmt.Errorf("systemd-run failed: %v: %s", err, strings.TrimSpace(string(output)))
+			}
+			return nil
+		}
+	}
+
+	watchdog := exec.Command(binaryPath, "update-watchdog")
+	detachProcess(watchdog)
+	if err := watchdog.Start(); err != nil {
+		return err
+	}
+	return watchdog.Process.Release()
+}
+
+// WatchSelfUpdate waits for the pending self-update to be confirmed and rolls
+// it back when the new daemon does not start or finish a cycle in time. It is
+// started by activateUpdate as `konta update-watchdog`.
+func WatchSelfUpdate() error {
+	update, err := state.PendingSelfUpdate()
+	if err != nil {
+		return err
+	}
+	if update == nil || update.Deadline == "" {
+		return nil
+	}
+
+	installedAt, err := time.Parse(time.RFC3339, update.StartedAt)
+	if err != nil {
+		return fmt.Errorf("invalid self-update start time %q: %w", update.StartedAt, err)
+	}
+	deadline, err := time.Parse(time.RFC3339, update.Deadline)
+	if err != nil {
+		return fmt.Errorf("invalid self-update deadline %q: %w", update.Deadline, err)
+	}
+
+	logger.Info("Watching update v%s → v%s until %s", update.FromVersion, update.ToVersion, deadline.Format("15:04:05"))
+
+	for {
+		time.Sleep(selfUpdatePollInterval)
+
+		current, err := state.LastSelfUpdate()
+		if err != nil {
+			logger.Warn("Failed to read self-update state: %v", err)
+			continue
+		}
+		if current == nil || current.ToVersion != update.ToVersion || current.StartedAt != update.StartedAt {
+			return nil
+		}
+		if current.Status != state.SelfUpdatePending {
+			logger.Info("Update to v%s finished: %s", update.ToVersion, current.Status)
+			return nil
+		}
+
+		reason := ""
+		switch {
+		case current.RunningAt == "" && time.Since(installedAt) > selfUpdateStartTimeout:
+			reason = fmt.Sprintf("daemon did not start on v%s within %s", update.ToVersion, selfUpdateStartTimeout)
+		case time.Now().After(deadline):
+			reason = fmt.Sprintf("daemon on v%s did not finish a cycle within %s", update.ToVersion, selfUpdateConfirmTimeout)
+		default:
+			continue
+		}
+
+		return rollbackSelfUpdate(current, reason)
+	}
+}
+
+// rollbackSelfUpdate restores the previous binary and restarts the daemon.
+func rollbackSelfUpdate(update *types.SelfUpdate, reason string) error {
+	logger.Error("Rolling back update v%s → v%s: %s", update.FromVersion, update.ToVersion, reason)
+
+	if err := os.Rename(update.Backup, update.Binary); err != nil {
+		reason = fmt.Sprintf("%s; restoring v%s failed: %v", reason, update.FromVersion, err)
+		if _, stateErr := state.FinishSelfUpdate(update.ToVersion, state.SelfUpdateFailed, reason); stateErr != nil {
+			logger.Warn("Failed to record self-update: %v", stateErr)
+		}
+		return fmt.Errorf("failed to restore v%s from %s: %w", update.FromVersion, update.Backup, err)
+	}
+
+	if _, err := state.FinishSelfUpdate(update.ToVersion, state.SelfUpdateRolledBack, reason); err != nil {
+		logger.Warn("Failed to record self-update: %v", err)
+	}
+
+	if err := restartDaemonForCurrentOS(); err != nil {
+		return fmt.Errorf("restored v%s but failed to restart the daemon: %w", update.FromVersion, err)
+	}
+	logger.Info("Restored v%s and restarted the daemon", update.FromVersion)
+	return nil
+}
+
+// confirmSelfUpdate marks a pending update to version as healthy once the
+// daemon on it finished its first cycle.
+func confirmSelfUpdate(version string) {
+	confirmed, err := state.FinishSelfUpdate(version, state.SelfUpdateConfirmed, "")
+	if err != nil {
+		logger.Warn("Failed to confirm self-update: %v", err)
+		return
+	}
+	if confirmed {
+		logger.Info("Update to v%s confirmed: first cycle finished", version)
+	}
+}
+
+// rolledBackVersion reports whether an update to version was rolled back or
+// failed, so auto-update does not install it again.
+func rolledBackVersion(version string) bool {
+	currentState, err := state.Load()
+	if err != nil {
+		return false
+	}
+	for _, update := range currentState.SelfUpdates {
+		if update.ToVersion == version && (update.Status == state.SelfUpdateRolledBack || update.Status == state.SelfUpdateFailed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/talyguryn/konta/internal/state"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+func useTestState(t *testing.T) {
+	t.Helper()
+	state.SetDir(t.TempDir())
+	t.Cleanup(func() { state.SetDir("") })
+}
+
+// writeBinary writes a fake konta that reports version.
+func writeBinary(t *testing.T, path string, version string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("#!/bin/sh\necho \"konta "+version+"\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBrokenUpdateIsRevertedRightAway(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binaries are shell scripts")
+	}
+	useTestState(t)
+	binary := filepath.Join(t.TempDir(), "konta")
+	writeBinary(t, backupBinaryPath(binary), "v1.0.0")
+	// The downloaded binary runs, but is not the version it claims to be.
+	writeBinary(t, binary, "v1.9.0")
+
+	_, err := activateUpdate(binary, "1.0.0", "2.0.0", true)
+	if err == nil || !strings.Contains(err.Error(), "reverted") {
+		t.Fatalf("activateUpdate = %v, want the update reverted", err)
+	}
+	if err := smokeTestBinary(binary, "1.0.0"); err != nil {
+		t.Errorf("previous binary not restored: %v", err)
+	}
+	if _, err := os.Stat(backupBinaryPath(binary)); !os.IsNotExist(err) {
+		t.Errorf("backup left behind: %v", err)
+	}
+
+	last, err := state.LastSelfUpdate()
+	if err != nil || last == nil || last.Status != state.SelfUpdateFailed || !strings.Contains(last.Reason, "expected v2.0.0") {
+		t.Fatalf("recorded update = %+v, %v", last, err)
+	}
+	if !rolledBackVersion("2.0.0") || rolledBackVersion("1.0.0") {
+		t.Error("auto-update would install the reverted version again")
+	}
+}
+
+func TestSelfUpdateIsConfirmedByTheFirstCycle(t *testing.T) {
+	useTestState(t)
+	pending := func(version string) types.SelfUpdate {
+		return types.SelfUpdate{
+			FromVersion: "1.0.0",
+			ToVersion:   version,
+			Binary:      filepath.Join(t.TempDir(), "konta"),
+			Backup:      filepath.Join(t.TempDir(), "missing.backup"),
+			Status:      state.SelfUpdatePending,
+			StartedAt:   time.Now().Format(time.RFC3339),
+		}
+	}
+
+	if err := state.RecordSelfUpdate(pending("2.0.0")); err != nil {
+		t.Fatal(err)
+	}
+	confirmSelfUpdate("1.0.0") // a daemon on another version confirms nothing
+	confirmSelfUpdate("2.0.0")
+	if last, _ := state.LastSelfUpdate(); last.Status != state.SelfUpdateConfirmed {
+		t.Errorf("update = %+v, want confirmed", last)
+	}
+	if update, _ := state.PendingSelfUpdate(); update != nil {
+		t.Errorf("pending update left: %+v", update)
+	}
+
+	// A rollback whose backup is gone fails without restarting anything.
+	update := pending("2.1.0")
+	if err := state.RecordSelfUpdate(update); err != nil {
+		t.Fatal(err)
+	}
+	err := rollbackSelfUpdate(&update, "daemon did not start")
+	if err == nil || !strings.Contains(err.Error(), "failed to restore v1.0.0") {
+		t.Errorf("rollbackSelfUpdate = %v", err)
+	}
+	last, _ := state.LastSelfUpdate()
+	if last.Status != state.SelfUpdateFailed || !strings.HasPrefix(last.Reason, "daemon did not start; restoring v1.0.0 failed") {
+		t.Errorf("update = %+v", last)
+	}
+	if !rolledBackVersion("2.1.0") || rolledBackVersion("2.0.0") {
+		t.Error("rolledBackVersion does not follow the history")
+	}
+}
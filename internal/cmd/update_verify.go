@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Every release publishes checksums.txt (`sha256sum` output for all binaries)
+// and checksums.txt.sig, an Ed25519 signature of it made with the release key.
+const (
+	releaseChecksumsAsset = "checksums.txt"
+	releaseSignatureAsset = "checksums.txt.sig"
+)
+
+// releasePublicKey is the base64 Ed25519 public key of the release signing
+// key. The private key lives in the RELEASE_SIGNING_KEY secret of the release
+// workflow; docs/CONTRIBUTING.md describes how the key is made and rotated.
+const releasePublicKey = "uDUcNAjXAObAastDBVWLbPdHuWktuW/31LkLnmgjJx8="
+
+// maxChecksumsSize caps checksums.txt and its signature; both are tiny.
+const maxChecksumsSize = 1 << 20
+
+// fetchVerifiedChecksum downloads the release's checksums.txt, checks its
+// signature against publicKey, the base64 release key, and returns the
+// SHA256 listed for binaryName.
+func fetchVerifiedChecksum(release *githubRelease, binaryName string, publicKey string) (string, error) {
+	checksumsURL := findDownloadURL(release, releaseChecksumsAsset)
+	signatureURL := findDownloadURL(release, releaseSignatureAsset)
+	if checksumsURL == "" || signatureURL == "" {
+		return "", fmt.Errorf("release %s has no signed %s, refusing to install an unverified binary", release.TagName, releaseChecksumsAsset)
+	}
+
+	checksums, err := fetchReleaseAsset(checksumsURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", releaseChecksumsAsset, err)
+	}
+	signature, err := fetchReleaseAsset(signatureURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", releaseSignatureAsset, err)
+	}
+
+	if err := verifyChecksumsSignature(publicKey, checksums, signature); err != nil {
+		return "", err
+	}
+
+	return checksumFor(checksums, binaryName)
+}
+
+func fetchReleaseAsset(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChecksumsSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxChecksumsSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxChecksumsSize)
+	}
+	return data, nil
+}
+
+// verifyChecksumsSignature checks the signature of checksums.txt against the
+// base64 Ed25519 key. The signature may be raw (64 bytes, as written by
+// `openssl pkeyutl`) or base64.
+func verifyChecksumsSignature(encodedKey string, checksums []byte, signature []byte) error {
+	publicKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("release key is invalid")
+	}
+
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return fmt.Errorf("signature of %s is malformed", releaseChecksumsAsset)
+		}
+		signature = decoded
+	}
+
+	if len(signature) != ed25519.SignatureSize || !ed25519.Verify(publicKey, checksums, signature) {
+		return fmt.Errorf("signature of %s does not match the release key", releaseChecksumsAsset)
+	}
+	return nil
+}
+
+// checksumFor returns the SHA256 of binaryName from `sha256sum` output.
+func checksumFor(checksums []byte, binaryName string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum marks binary mode with a leading '*'.
+		if strings.TrimPrefix(fields[1], "*") != binaryName {
+			continue
+		}
+		sum := strings.ToLower(fields[0])
+		if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != 32 {
+			return "", fmt.Errorf("%s has a malformed checksum for %s", releaseChecksumsAsset, binaryName)
+		}
+		return sum, nil
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", releaseChecksumsAsset, binaryName)
+}
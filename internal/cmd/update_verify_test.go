@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testChecksums lists the assets of a release as `sha256sum konta-*` in the
+// release workflow writes them.
+const testChecksums = `3f9a1c0b2e4d5f6a7b8c9d0e1f2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c  konta-darwin-amd64
+0a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9 *konta-darwin-arm64
+5d6e7f8091a2b3c4d5e6f708192a3b4c3f9a1c0b2e4d5f6a7b8c9d0e1f2a3b4c  konta-linux
+8293a4b5c6d7e8f90a1b2c3d4e5f60710a1b2c3d4e5f60718293a4b5c6d7e8f9  konta-linux-arm64
+c3d4e5f60718293a4b5c6d7e8f90a1b20a1b2c3d4e5f60718293a4b5c6d7e8f9  konta-windows-amd64.exe
+`
+
+// testReleaseKey returns a fresh key pair, the public half base64 encoded
+// like releasePublicKey.
+func testReleaseKey(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(publicKey), privateKey
+}
+
+func TestVerifyChecksumsSignature(t *testing.T) {
+	publicKey, privateKey := testReleaseKey(t)
+	checksums := []byte(testChecksums)
+	signature := ed25519.Sign(privateKey, checksums)
+
+	if err := verifyChecksumsSignature(publicKey, checksums, signature); err != nil {
+		t.Errorf("raw signature rejected: %v", err)
+	}
+	encoded := []byte(base64.StdEncoding.EncodeToString(signature) + "\n")
+	if err := verifyChecksumsSignature(publicKey, checksums, encoded); err != nil {
+		t.Errorf("base64 signature rejected: %v", err)
+	}
+
+	tampered := []byte(strings.Replace(testChecksums, "5d6e", "5d6f", 1))
+	if err := verifyChecksumsSignature(publicKey, tampered, signature); err == nil {
+		t.Error("tampered checksums accepted")
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	if err := verifyChecksumsSignature(publicKey, checksums, ed25519.Sign(otherKey, checksums)); err == nil {
+		t.Error("signature of another key accepted")
+	}
+	if err := verifyChecksumsSignature(publicKey, checksums, []byte("not a signature")); err == nil {
+		t.Error("malformed signature accepted")
+	}
+}
+
+// testChecksumsReleaseSignature is testChecksums signed with the release
+// key by the release workflow's `openssl pkeyutl -sign -rawin`.
+const testChecksumsReleaseSignature = "yAha3kbqsap+jCEr4nGba01m2zarXHd3RUjAKb5EPv9WcrHAH8OckBQ9Wdv8Srxk2tf93dmzHpaey66KkyikBQ=="
+
+func TestReleaseKeyVerifiesReleaseSignatures(t *testing.T) {
+	signature, err := base64.StdEncoding.DecodeString(testChecksumsReleaseSignature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyChecksumsSignature(releasePublicKey, []byte(testChecksums), signature); err != nil {
+		t.Errorf("releasePublicKey does not match the release signing key: %v", err)
+	}
+}
+
+func TestChecksumFor(t *testing.T) {
+	checksums := []byte(testChecksums)
+
+	// linux/amd64 is published as plain konta-linux.
+	sum, err := checksumFor(checksums, "konta-linux")
+	if err != nil || sum != "5d6e7f8091a2b3c4d5e6f708192a3b4c3f9a1c0b2e4d5f6a7b8c9d0e1f2a3b4c" {
+		t.Errorf("konta-linux = %q, %v", sum, err)
+	}
+	if _, err := checksumFor(checksums, "konta-darwin-arm64"); err != nil {
+		t.Errorf("binary mode entry not found: %v", err)
+	}
+	if _, err := checksumFor(checksums, getBinaryName()); err != nil {
+		t.Errorf("no checksum for this platform's asset %s: %v", getBinaryName(), err)
+	}
+	if _, err := checksumFor(checksums, "konta-freebsd-amd64"); err == nil || !strings.Contains(err.Error(), "no checksum") {
+		t.Errorf("missing entry: err = %v", err)
+	}
+	malformed := []byte("not-a-checksum  konta-linux\n")
+	if _, err := checksumFor(malformed, "konta-linux"); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("malformed entry: err = %v", err)
+	}
+}
+
+func TestFetchVerifiedChecksum(t *testing.T) {
+	publicKey, privateKey := testReleaseKey(t)
+	files := map[string][]byte{
+		"/checksums.txt":     []byte(testChecksums),
+		"/checksums.txt.sig": ed25519.Sign(privateKey, []byte(testChecksums)),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(files[r.URL.Path])
+	}))
+	defer server.Close()
+
+	release := &githubRelease{TagName: "v1.0.0", Assets: []releaseAsset{
+		{Name: "checksums.txt", BrowserDownloadURL: server.URL + "/checksums.txt"},
+		{Name: "checksums.txt.sig", BrowserDownloadURL: server.URL + "/checksums.txt.sig"},
+	}}
+	sum, err := fetchVerifiedChecksum(release, "konta-linux", publicKey)
+	if err != nil || !strings.HasPrefix(sum, "5d6e7f80") {
+		t.Errorf("checksum = %q, %v", sum, err)
+	}
+
+	files["/checksums.txt"] = []byte(strings.Replace(testChecksums, "5d6e", "5d6f", 1))
+	if _, err := fetchVerifiedChecksum(release, "konta-linux", publicKey); err == nil {
+		t.Error("tampered checksums.txt accepted")
+	}
+
+	release.Assets = release.Assets[:1]
+	if _, err := fetchVerifiedChecksum(release, "konta-linux", publicKey); err == nil {
+		t.Error("release without a signature accepted")
+	}
+}
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"context"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"syscall"
+	"time"
+
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/metrics"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+const (
+	// maxCycleBackoff caps the delay after consecutive failed cycles. An
+	// interval longer than this is never shortened.
+	maxCycleBackoff = 15 * time.Minute
+
+	// shutdownGracePeriod is how long a stop signal waits for the running
+	// cycle before stopping it between apps; the systemd unit's
+	// TimeoutStopSec leaves room for it.
+	shutdownGracePeriod = 5 * time.Minute
+
+	// updateCheckCycles is how many cycles pass between update checks.
+	updateCheckCycles = 10
+)
+
+var stopSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// daemon is the polling loop of `konta run --watch` and the components that
+// depend on the config: the metrics listener and the Docker events watcher.
+type daemon struct {
+	version string
+	dryRun  bool
+	cfg     *types.Config
+
+	metricsServer *http.Server
+	stopEvents    chan struct{}
+
+	failures     int // consecutive failed cycles
+	updateChecks int // cycles since the last update check
+}
+
+// watchLoop runs the daemon until a stop signal. SIGHUP reloads the config and
+// restarts dependent components, SIGUSR1 starts a cycle right away. A stop
+// signal lets the running cycle finish, for up to shutdownGracePeriod; a
+// second one stops it once the app being deployed is done.
+func watchLoop(cfg *types.Config, dryRun bool, version string) error {
+	d := &daemon{version: version, dryRun: dryRun, cfg: cfg}
+
+	signals := make(chan os.Signal, 4)
+	signal.Notify(signals, stopSignals...)
+	signal.Notify(signals, reloadSignals...)
+	signal.Notify(signals, reconcileSignals...)
+	defer signal.Stop(signals)
+
+	// A failed first cycle is logged and retried with backoff.
+	stop, again := d.runCycle(signals, true)
+	if stop {
+		return nil
+	}
+
+	if cfg, err := loadConfig(); err == nil {
+		d.cfg = cfg
+	}
+	d.startComponents()
+	defer d.stopComponents()
+
+	// Check for updates on first run
+	if d.cfg.KontaUpdates.Enabled() {
+		_ = CheckForUpdates(version, d.cfg)
+	}
+
+	logger.Info("Watch mode enabled. Polling every %d seconds (Ctrl+C to stop)", d.cfg.Repository.Interval)
+	timer := time.NewTimer(d.nextDelay())
+	defer timer.Stop()
+
+	for {
+		if !again {
+			select {
+			case <-timer.C:
+				d.reload(false)
+
+			case sig := <-signals:
+				switch {
+				case isSignal(sig, stopSignals):
+					logger.Info("Received %s, stopping", sig)
+					return nil
+				case isSignal(sig, reloadSignals):
+					logger.Info("Received %s, reloading config", sig)
+					d.reload(true)
+					continue
+				case isSignal(sig, reconcileSignals):
+					logger.Info("Received %s, reconciling now", sig)
+					d.reload(false)
+				}
+			}
+		} else {
+			logger.Info("Reconciling again as requested during the last cycle")
+		}
+
+		if stop, again = d.runCycle(signals, false); stop {
+			return nil
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		delay := d.nextDelay()
+		if d.failures > 0 {
+			logger.Info("Next cycle in %s (%d failed cycle(s) in a row)", delay.Round(time.Second), d.failures)
+		} else {
+			logger.Debug("Next cycle in %s", delay.Round(time.Second))
+		}
+		timer.Reset(delay)
+	}
+}
+
+// runCycle runs one reconcile cycle while still handling signals. It reports
+// whether the daemon should stop and whether another cycle was requested.
+// A second stop signal, or a cycle still running after shutdownGracePeriod,
+// interrupts the cycle at its next safe point; runCycle always waits for it,
+// so the daemon never exits in the middle of a deploy.
+func (d *daemon) runCycle(signals <-chan os.Signal, isFirstRun bool) (stop bool, again bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		err := reconcileOnce(ctx, d.dryRun, d.version, isFirstRun, false)
+		// A finished cycle proves a freshly installed binary works, even
+		// when the deployment itself failed.
+		if isFirstRun && !d.dryRun {
+			confirmSelfUpdate(d.version)
+		}
+		done <- err
+	}()
+
+	var grace <-chan time.Time
+	reload := false
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				d.failures++
+				logger.Error("Deployment error: %v", err)
+			} else {
+				d.failures = 0
+			}
+			if stop {
+				logger.Info("Current cycle finished, stopping")
+				return true, false
+			}
+			// After the first cycle the components start with a fresh
+			// config anyway.
+			if !isFirstRun {
+				if reload {
+					d.reload(true)
+				}
+				d.afterCycle()
+			}
+			return false, again
+
+		case sig := <-signals:
+			switch {
+			case isSignal(sig, stopSignals) && ctx.Err() != nil:
+				logger.Warn("Received %s, still waiting for the current app to finish", sig)
+			case isSignal(sig, stopSignals) && stop:
+				logger.Warn("Received %s again, stopping the current cycle after the app being deployed", sig)
+				cancel()
+			case isSignal(sig, stopSignals):
+				logger.Info("Received %s, finishing the current cycle before stopping (send it again to stop sooner)", sig)
+				stop = true
+				grace = time.After(shutdownGracePeriod)
+			case isSignal(sig, reloadSignals):
+				logger.Info("Received %s, reloading config after the current cycle", sig)
+				reload = true
+			case isSignal(sig, reconcileSignals):
+				logger.Info("Received %s, reconciling again after the current cycle", sig)
+				again = true
+			}
+
+		case <-grace:
+			grace = nil
+			logger.Warn("Current cycle still running after %s, stopping it after the app being deployed", shutdownGracePeriod)
+			cancel()
+		}
+	}
+}
+
+// afterCycle checks for updates every updateCheckCycles cycles and frees
+// memory, which matters on small hosts.
+func (d *daemon) afterCycle() {
+	d.updateChecks++
+	if d.updateChecks >= updateCheckCycles && d.cfg.KontaUpdates.Enabled() {
+		d.updateChecks = 0
+		_ = CheckForUpdates(d.version, d.cfg)
+	}
+
+	// Aggressive garbage collection for low-memory environments
+	// Multiple GC passes help release more memory from go-git objects
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	allocBefore := ms.Alloc
+
+	// First GC pass
+	runtime.GC()
+	debug.FreeOSMemory()
+
+	// Second pass if memory is still high
+	runtime.ReadMemStats(&ms)
+	if ms.Alloc > 50*1024*1024 { // If over 50MB
+		runtime.GC()
+		debug.FreeOSMemory()
+		runtime.GC() // Third pass for stubborn memory
+	}
+
+	// Log memory stats for debugging
+	runtime.ReadMemStats(&ms)
+	if allocBefore > 30*1024*1024 {
+		logger.Debug("Memory optimization: %d MB → %d MB", allocBefore/1024/1024, ms.Alloc/1024/1024)
+	}
+}
+
+// reload loads the config and restarts the components whose settings
+// changed, or all of them with force. An invalid config keeps the previous
+// one (see loadConfig).
+func (d *daemon) reload(force bool) {
+	cfg, err := loadConfig()
+	if err != nil {
+		logger.Error("Failed to reload config: %v", err)
+		return
+	}
+	previous := d.cfg
+	d.cfg = cfg
+
+	if cfg.Repository.Interval != previous.Repository.Interval {
+		logger.Info("Config updated: polling interval changed from %d to %d seconds",
+			previous.Repository.Interval, cfg.Repository.Interval)
+	}
+	if force || cfg.Metrics != previous.Metrics {
+		d.restartMetrics()
+	}
+	if force || eventSettingsChanged(previous, cfg) {
+		d.restartEventWatcher()
+	}
+	if force {
+		if err := logger.Reopen(); err != nil {
+			logger.Warn("Failed to reopen log file: %v", err)
+		}
+		logger.Info("Config reloaded")
+	}
+}
+
+// eventSettingsChanged reports whether the events watcher must restart.
+func eventSettingsChanged(previous *types.Config, cfg *types.Config) bool {
+	a, b := previous.Deploy.SelfHeal, cfg.Deploy.SelfHeal
+	return a.Enable != b.Enable ||
+		(a.Events == nil) != (b.Events == nil) ||
+		(a.Events != nil && b.Events != nil && *a.Events != *b.Events) ||
+		a.EventDebounceSeconds != b.EventDebounceSeconds ||
+		a.EventCooldownSeconds != b.EventCooldownSeconds
+}
+
+func (d *daemon) startComponents() {
+	d.restartMetrics()
+	d.restartEventWatcher()
+}
+
+func (d *daemon) stopComponents() {
+	if d.stopEvents != nil {
+		close(d.stopEvents)
+		d.stopEvents = nil
+	}
+	if d.metricsServer != nil {
+		_ = d.metricsServer.Close()
+		d.metricsServer = nil
+	}
+}
+
+func (d *daemon) restartMetrics() {
+	if d.metricsServer != nil {
+		_ = d.metricsServer.Close()
+		d.metricsServer = nil
+	}
+	if !d.cfg.Metrics.Enable {
+		return
+	}
+	server, err := metrics.Start(d.cfg.Metrics.Listen)
+	if err != nil {
+		logger.Warn("Failed to start metrics endpoint: %v", err)
+		return
+	}
+	d.metricsServer = server
+}
+
+func (d *daemon) restartEventWatcher() {
+	if d.stopEvents != nil {
+		close(d.stopEvents)
+	}
+	d.stopEvents = make(chan struct{})
+	startEventWatcher(d.cfg, d.stopEvents)
+}
+
+// nextDelay is the polling interval with up to ±10% jitter, so servers
+// polling one repository spread out, doubled for each failed cycle in a row
+// up to maxCycleBackoff.
+func (d *daemon) nextDelay() time.Duration {
+	interval := time.Duration(d.cfg.Repository.Interval) * time.Second
+	delay := interval
+	for i := 0; i < d.failures && delay < maxCycleBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxCycleBackoff && interval < maxCycleBackoff {
+		delay = maxCycleBackoff
+	}
+
+	if spread := int64(delay / 5); spread > 0 {
+		delay += time.Duration(mathrand.Int63n(spread+1)) - delay/10
+	}
+	return delay
+}
+
+func isSignal(sig os.Signal, set []os.Signal) bool {
+	for _, candidate := range set {
+		if sig == candidate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/talyguryn/konta/internal/config"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// useDaemonConfig points the config loader at a file in a temp dir and
+// forgets the last good config, as a freshly started daemon would.
+func useDaemonConfig(t *testing.T) string {
+	t.Helper()
+	t.Setenv("KONTA_RUNTIME", "")
+	t.Setenv("KONTA_TOKEN", "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config.SetPath(path)
+
+	resetLastGoodConfig := func() {
+		configMu.Lock()
+		lastGoodConfig, rejectedConfig = nil, ""
+		configMu.Unlock()
+	}
+	resetLastGoodConfig()
+	t.Cleanup(func() {
+		config.SetPath("")
+		resetLastGoodConfig()
+	})
+	return path
+}
+
+func writeDaemonConfig(t *testing.T, path string, interval string) {
+	t.Helper()
+	data := "repository:\n  url: https://github.com/acme/infra\n  interval: " + interval + "\ndeploy:\n  self_heal:\n    events: false\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadKeepsTheLastGoodConfig(t *testing.T) {
+	path := useDaemonConfig(t)
+	writeDaemonConfig(t, path, "60")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &daemon{cfg: cfg}
+	defer d.stopComponents()
+
+	writeDaemonConfig(t, path, "30")
+	d.reload(true)
+	if d.cfg.Repository.Interval != 30 {
+		t.Fatalf("interval = %d after a reload, want 30", d.cfg.Repository.Interval)
+	}
+	if d.stopEvents == nil {
+		t.Error("event watcher not restarted by a forced reload")
+	}
+
+	writeDaemonConfig(t, path, "often")
+	d.reload(true)
+	if d.cfg.Repository.Interval != 30 {
+		t.Errorf("interval = %d after an invalid reload, want the previous 30", d.cfg.Repository.Interval)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	d.reload(false)
+	if d.cfg == nil || d.cfg.Repository.Interval != 30 {
+		t.Errorf("config = %+v after the file disappeared", d.cfg)
+	}
+}
+
+func TestEventSettingsChanged(t *testing.T) {
+	enabled, disabled := true, false
+	base := types.SelfHealConf{Enable: true, Events: &enabled, EventDebounceSeconds: 10, EventCooldownSeconds: 60}
+
+	tests := []struct {
+		name   string
+		change func(conf *types.SelfHealConf)
+		want   bool
+	}{
+		{"unchanged", func(*types.SelfHealConf) {}, false},
+		{"same events value", func(conf *types.SelfHealConf) { events := true; conf.Events = &events }, false},
+		{"max retry", func(conf *types.SelfHealConf) { conf.MaxRetry = 3 }, false},
+		{"self-heal disabled", func(conf *types.SelfHealConf) { conf.Enable = false }, true},
+		{"events disabled", func(conf *types.SelfHealConf) { conf.Events = &disabled }, true},
+		{"events unset", func(conf *types.SelfHealConf) { conf.Events = nil }, true},
+		{"debounce", func(conf *types.SelfHealConf) { conf.EventDebounceSeconds = 5 }, true},
+		{"cooldown", func(conf *types.SelfHealConf) { conf.EventCooldownSeconds = 120 }, true},
+	}
+	for _, tt := range tests {
+		previous := &types.Config{Deploy: types.DeployConf{SelfHeal: base}}
+		changed := base
+		tt.change(&changed)
+		cfg := &types.Config{Deploy: types.DeployConf{SelfHeal: changed}}
+		if got := eventSettingsChanged(previous, cfg); got != tt.want {
+			t.Errorf("%s: eventSettingsChanged = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNextDelayBacksOffWithJitter(t *testing.T) {
+	tests := []struct {
+		interval int
+		failures int
+		min, max time.Duration
+	}{
+		{100, 0, 90 * time.Second, 110 * time.Second},
+		{100, 3, 720 * time.Second, 880 * time.Second},
+		{60, 20, maxCycleBackoff * 9 / 10, maxCycleBackoff * 11 / 10},
+		// An interval above the backoff cap is never shortened.
+		{3600, 2, 54 * time.Minute, 66 * time.Minute},
+	}
+	for _, tt := range tests {
+		d := &daemon{cfg: &types.Config{Repository: types.RepositoryConf{Interval: tt.interval}}, failures: tt.failures}
+		for i := 0; i < 50; i++ {
+			if delay := d.nextDelay(); delay < tt.min || delay > tt.max {
+				t.Errorf("interval %ds, %d failures: delay %s outside [%s, %s]", tt.interval, tt.failures, delay, tt.min, tt.max)
+				break
+			}
+		}
+	}
+}
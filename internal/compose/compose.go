@@ -0,0 +1,444 @@
+// Package compose reads docker-compose files the way Konta interprets them.
+// It is shared by the reconciler and the offline commands (diff, validate)
+// so that the server and CI agree on labels, services and networks.
+package compose
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the compose file Konta expects in every app directory.
+const FileName = "docker-compose.yml"
+
+// File is a parsed compose file.
+type File struct {
+	Path     string
+	Services map[string]*Service
+	Networks map[string]*Network
+}
+
+// Service holds the parts of a compose service Konta cares about.
+// Lines records where each key was declared, for diagnostics.
+type Service struct {
+	Name          string
+	Line          int
+	Image         string
+	Build         string
+	ContainerName string
+	Ports         []string
+	Environment   map[string]string
+	EnvFiles      []string
+	Volumes       []string
+	Labels        map[string]string
+	Networks      []string
+	Healthcheck   bool
+	Restart       string
+	Lines         map[string]int // line per key: "image", "labels", "container_name", ...
+}
+
+// Network is a top-level network declaration.
+type Network struct {
+	Name         string // alias used in the compose file
+	Line         int
+	External     bool
+	ExternalName string // explicit name for external networks
+}
+
+// Load reads and parses a compose file.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	file.Path = path
+	return file, nil
+}
+
+// Parse parses compose file content.
+func Parse(data []byte) (*File, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	file := &File{
+		Services: make(map[string]*Service),
+		Networks: make(map[string]*Network),
+	}
+	if len(document.Content) == 0 {
+		return file, nil
+	}
+
+	root := resolveAliases(document.Content[0])
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: compose file must be a mapping", root.Line)
+	}
+
+	if services := mappingValue(root, "services"); services != nil && services.Kind == yaml.MappingNode {
+		for index := 0; index+1 < len(services.Content); index += 2 {
+			name := services.Content[index].Value
+			file.Services[name] = parseService(name, services.Content[index], services.Content[index+1])
+		}
+	}
+
+	if networks := mappingValue(root, "networks"); networks != nil && networks.Kind == yaml.MappingNode {
+		for index := 0; index+1 < len(networks.Content); index += 2 {
+			alias := networks.Content[index].Value
+			file.Networks[alias] = parseNetwork(alias, networks.Content[index], networks.Content[index+1])
+		}
+	}
+
+	return file, nil
+}
+
+// ServiceNames returns service names in sorted order.
+func (f *File) ServiceNames() []string {
+	names := make([]string, 0, len(f.Services))
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasLabel reports whether any service carries the label with the given value
+// (case-insensitive), e.g. HasLabel("konta.rolling", "true").
+func (f *File) HasLabel(key string, value string) bool {
+	for _, service := range f.Services {
+		if service.HasLabel(key, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasHealthcheck reports whether any service defines a healthcheck.
+func (f *File) HasHealthcheck() bool {
+	for _, service := range f.Services {
+		if service.Healthcheck {
+			return true
+		}
+	}
+	return false
+}
+
+// Rolling reports whether the app is deployed with the rolling strategy.
+func (f *File) Rolling() bool {
+	return f.HasLabel("konta.rolling", "true")
+}
+
+// ExternalNetworks returns the Docker names of all external networks.
+func (f *File) ExternalNetworks() []string {
+	names := make([]string, 0)
+	for _, network := range f.Networks {
+		if network.External {
+			names = append(names, network.DockerName())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DockerName returns the network name as Docker sees it.
+func (n *Network) DockerName() string {
+	if n.ExternalName != "" {
+		return n.ExternalName
+	}
+	return n.Name
+}
+
+// HasLabel reports whether the service carries the label with the given value.
+func (s *Service) HasLabel(key string, value string) bool {
+	actual, ok := s.Labels[key]
+	return ok && strings.EqualFold(strings.TrimSpace(actual), value)
+}
+
+func parseService(name string, keyNode *yaml.Node, node *yaml.Node) *Service {
+	service := &Service{
+		Name:        name,
+		Line:        keyNode.Line,
+		Environment: make(map[string]string),
+		Labels:      make(map[string]string),
+		Lines:       make(map[string]int),
+	}
+	if node.Kind != yaml.MappingNode {
+		return service
+	}
+
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		key := node.Content[index].Value
+		value := node.Content[index+1]
+		service.Lines[key] = node.Content[index].Line
+
+		switch key {
+		case "image":
+			service.Image = value.Value
+		case "build":
+			if value.Kind == yaml.ScalarNode {
+				service.Build = value.Value
+			} else if context := mappingValue(value, "context"); context != nil {
+				service.Build = context.Value
+			} else {
+				service.Build = "."
+			}
+		case "container_name":
+			service.ContainerName = value.Value
+		case "restart":
+			service.Restart = value.Value
+		case "healthcheck":
+			service.Healthcheck = !isDisabledHealthcheck(value)
+		case "ports":
+			service.Ports = sequenceStrings(value, portString)
+		case "volumes":
+			service.Volumes = sequenceStrings(value, volumeString)
+		case "env_file":
+			if value.Kind == yaml.ScalarNode {
+				service.EnvFiles = []string{value.Value}
+			} else {
+				service.EnvFiles = sequenceStrings(value, func(item *yaml.Node) string {
+					if path := mappingValue(item, "path"); path != nil {
+						return path.Value
+					}
+					return item.Value
+				})
+			}
+		case "environment":
+			service.Environment = keyValues(value)
+		case "labels":
+			service.Labels = keyValues(value)
+		case "networks":
+			if value.Kind == yaml.MappingNode {
+				for netIndex := 0; netIndex+1 < len(value.Content); netIndex += 2 {
+					service.Networks = append(service.Networks, value.Content[netIndex].Value)
+				}
+			} else {
+				service.Networks = sequenceStrings(value, func(item *yaml.Node) string { return item.Value })
+			}
+			sort.Strings(service.Networks)
+		}
+	}
+
+	return service
+}
+
+func parseNetwork(alias string, keyNode *yaml.Node, node *yaml.Node) *Network {
+	network := &Network{Name: alias, Line: keyNode.Line}
+	if node.Kind != yaml.MappingNode {
+		return network
+	}
+
+	if name := mappingValue(node, "name"); name != nil && name.Kind == yaml.ScalarNode {
+		network.ExternalName = name.Value
+	}
+
+	if external := mappingValue(node, "external"); external != nil {
+		switch external.Kind {
+		case yaml.ScalarNode:
+			// A bare `external:` means true, like Docker Compose.
+			network.External = external.Tag == "!!null" || isTrue(external.Value)
+		case yaml.MappingNode:
+			// Legacy syntax: external: { name: foo }
+			network.External = true
+			if name := mappingValue(external, "name"); name != nil {
+				network.ExternalName = name.Value
+			}
+		}
+	}
+
+	if !network.External {
+		network.ExternalName = ""
+	}
+	return network
+}
+
+func isDisabledHealthcheck(node *yaml.Node) bool {
+	if node.Kind != yaml.MappingNode {
+		return true
+	}
+	if disable := mappingValue(node, "disable"); disable != nil && isTrue(disable.Value) {
+		return true
+	}
+	if test := mappingValue(node, "test"); test != nil {
+		if test.Kind == yaml.SequenceNode && len(test.Content) > 0 && strings.EqualFold(test.Content[0].Value, "NONE") {
+			return true
+		}
+	}
+	return false
+}
+
+// maxAliasDepth bounds nesting while resolving aliases, so an alias that
+// contains itself cannot recurse forever.
+const maxAliasDepth = 64
+
+// resolveAliases returns node with aliases replaced by the anchored nodes
+// and merge keys (<<) expanded, the way Docker Compose reads them: keys of a
+// mapping win over merged ones, and earlier merged mappings over later ones.
+// Line numbers of the anchored nodes are kept for diagnostics.
+func resolveAliases(node *yaml.Node) *yaml.Node {
+	return resolveNode(node, make(map[*yaml.Node]*yaml.Node), 0)
+}
+
+// resolveNode resolves every node once: shared anchors are reused, not
+// copied, so a file full of aliases stays small.
+func resolveNode(node *yaml.Node, resolved map[*yaml.Node]*yaml.Node, depth int) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	if done, ok := resolved[node]; ok {
+		return done
+	}
+	if depth > maxAliasDepth || (node.Kind != yaml.MappingNode && node.Kind != yaml.SequenceNode) {
+		return node
+	}
+
+	result := *node
+	result.Content = make([]*yaml.Node, 0, len(node.Content))
+	resolved[node] = &result
+
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			result.Content = append(result.Content, resolveNode(item, resolved, depth+1))
+		}
+		return &result
+	}
+
+	seen := make(map[string]bool)
+	var merged []*yaml.Node
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		key, value := node.Content[index], resolveNode(node.Content[index+1], resolved, depth+1)
+		if key.Kind == yaml.ScalarNode && key.Tag == "!!merge" {
+			sources := []*yaml.Node{value}
+			if value.Kind == yaml.SequenceNode {
+				sources = value.Content
+			}
+			for _, source := range sources {
+				if source.Kind == yaml.MappingNode {
+					merged = append(merged, source.Content...)
+				}
+			}
+			continue
+		}
+		seen[key.Value] = true
+		result.Content = append(result.Content, key, value)
+	}
+	for index := 0; index+1 < len(merged); index += 2 {
+		if key := merged[index]; !seen[key.Value] {
+			seen[key.Value] = true
+			result.Content = append(result.Content, key, merged[index+1])
+		}
+	}
+	return &result
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		if node.Content[index].Value == key {
+			return node.Content[index+1]
+		}
+	}
+	return nil
+}
+
+// keyValues reads both the list ("KEY=value") and the mapping forms used by
+// environment and labels.
+func keyValues(node *yaml.Node) map[string]string {
+	result := make(map[string]string)
+	switch node.Kind {
+	case yaml.MappingNode:
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			value := node.Content[index+1]
+			if value.Tag == "!!null" {
+				result[node.Content[index].Value] = ""
+				continue
+			}
+			result[node.Content[index].Value] = value.Value
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			key, value, _ := strings.Cut(item.Value, "=")
+			result[strings.TrimSpace(key)] = value
+		}
+	}
+	return result
+}
+
+func sequenceStrings(node *yaml.Node, render func(*yaml.Node) string) []string {
+	if node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	items := make([]string, 0, len(node.Content))
+	for _, item := range node.Content {
+		if value := render(item); value != "" {
+			items = append(items, value)
+		}
+	}
+	return items
+}
+
+// portString renders short and long port syntax the same way.
+func portString(node *yaml.Node) string {
+	if node.Kind != yaml.MappingNode {
+		return node.Value
+	}
+
+	target := scalar(node, "target")
+	published := scalar(node, "published")
+	protocol := scalar(node, "protocol")
+	hostIP := scalar(node, "host_ip")
+
+	port := target
+	if published != "" {
+		port = published + ":" + target
+	}
+	if hostIP != "" {
+		port = hostIP + ":" + port
+	}
+	if protocol != "" && protocol != "tcp" {
+		port += "/" + protocol
+	}
+	return port
+}
+
+// volumeString renders short and long volume syntax the same way.
+func volumeString(node *yaml.Node) string {
+	if node.Kind != yaml.MappingNode {
+		return node.Value
+	}
+
+	source := scalar(node, "source")
+	target := scalar(node, "target")
+	volume := target
+	if source != "" {
+		volume = source + ":" + target
+	}
+	if readOnly := scalar(node, "read_only"); isTrue(readOnly) {
+		volume += ":ro"
+	}
+	return volume
+}
+
+func scalar(node *yaml.Node, key string) string {
+	if value := mappingValue(node, key); value != nil && value.Kind == yaml.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
+
+func isTrue(value string) bool {
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	return err == nil && parsed
+}
@@ -0,0 +1,85 @@
+package compose
+
+import (
+	"reflect"
+	"testing"
+)
+
+const anchoredCompose = `
+x-common: &common
+  restart: unless-stopped
+  labels:
+    konta.rolling: "true"
+  healthcheck:
+    test: ["CMD", "true"]
+  networks: [proxy]
+
+x-logging: &logging
+  restart: always
+  environment:
+    LOG_LEVEL: info
+
+services:
+  web:
+    <<: *common
+    image: nginx
+  api:
+    <<: [*logging, *common]
+    image: api
+    labels:
+      konta.rolling: "false"
+  worker: *common
+
+networks:
+  proxy: &external
+    external: true
+    name: shared-proxy
+  edge: *external
+`
+
+func TestParseResolvesAliasesAndMergeKeys(t *testing.T) {
+	file, err := Parse([]byte(anchoredCompose))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web := file.Services["web"]
+	if web.Image != "nginx" || web.Restart != "unless-stopped" || !web.Healthcheck || !web.HasLabel("konta.rolling", "true") {
+		t.Errorf("web lost merged keys: %+v", web)
+	}
+	if !reflect.DeepEqual(web.Networks, []string{"proxy"}) {
+		t.Errorf("web networks = %v", web.Networks)
+	}
+
+	api := file.Services["api"]
+	if api.Restart != "always" {
+		t.Errorf("api restart = %q, the first merged mapping should win", api.Restart)
+	}
+	if api.Environment["LOG_LEVEL"] != "info" || !api.Healthcheck {
+		t.Errorf("api lost merged keys: %+v", api)
+	}
+	if api.HasLabel("konta.rolling", "true") {
+		t.Error("api labels should override the merged ones")
+	}
+
+	if worker := file.Services["worker"]; worker.Restart != "unless-stopped" || !worker.Healthcheck {
+		t.Errorf("worker alias not resolved: %+v", worker)
+	}
+
+	if !file.Rolling() || !file.HasHealthcheck() {
+		t.Error("file should be rolling and have a healthcheck")
+	}
+	if got := file.ExternalNetworks(); !reflect.DeepEqual(got, []string{"shared-proxy", "shared-proxy"}) {
+		t.Errorf("external networks = %v", got)
+	}
+}
+
+func TestParseStopsOnAliasCycles(t *testing.T) {
+	file, err := Parse([]byte("services:\n  web: &web\n    image: nginx\n    extra: *web\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if web := file.Services["web"]; web.Image != "nginx" {
+		t.Errorf("web image = %q", web.Image)
+	}
+}
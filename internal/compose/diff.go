@@ -0,0 +1,234 @@
+package compose
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change is one difference between two versions of a service.
+type Change struct {
+	Field  string `json:"field"`  // image, ports, environment, volumes, labels, ...
+	Action string `json:"action"` // added, removed, changed
+	Key    string `json:"key,omitempty"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// ServiceDiff lists the changes of one service.
+type ServiceDiff struct {
+	Service string   `json:"service"`
+	Status  string   `json:"status"` // added, removed, changed
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Diff compares two compose files service by service. Environment values
+// are never included, only the keys that changed, since they often hold
+// secrets. Either file may be nil for added or removed apps.
+func Diff(old *File, new *File) []ServiceDiff {
+	oldServices := map[string]*Service{}
+	newServices := map[string]*Service{}
+	if old != nil {
+		oldServices = old.Services
+	}
+	if new != nil {
+		newServices = new.Services
+	}
+
+	names := make([]string, 0, len(oldServices)+len(newServices))
+	for name := range oldServices {
+		names = append(names, name)
+	}
+	for name := range newServices {
+		if _, ok := oldServices[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs := make([]ServiceDiff, 0)
+	for _, name := range names {
+		before, hadBefore := oldServices[name]
+		after, hasAfter := newServices[name]
+		switch {
+		case !hadBefore:
+			diffs = append(diffs, ServiceDiff{Service: name, Status: "added", Changes: serviceChanges(&Service{Name: name}, after)})
+		case !hasAfter:
+			diffs = append(diffs, ServiceDiff{Service: name, Status: "removed"})
+		default:
+			if changes := serviceChanges(before, after); len(changes) > 0 {
+				diffs = append(diffs, ServiceDiff{Service: name, Status: "changed", Changes: changes})
+			}
+		}
+	}
+
+	return diffs
+}
+
+func serviceChanges(before *Service, after *Service) []Change {
+	changes := make([]Change, 0)
+	changes = append(changes, scalarChange("image", before.Image, after.Image)...)
+	changes = append(changes, scalarChange("build", before.Build, after.Build)...)
+	changes = append(changes, scalarChange("container_name", before.ContainerName, after.ContainerName)...)
+	changes = append(changes, scalarChange("restart", before.Restart, after.Restart)...)
+	if before.Healthcheck != after.Healthcheck {
+		changes = append(changes, Change{Field: "healthcheck", Action: "changed", Old: fmt.Sprint(before.Healthcheck), New: fmt.Sprint(after.Healthcheck)})
+	}
+	changes = append(changes, listChanges("ports", before.Ports, after.Ports)...)
+	changes = append(changes, listChanges("volumes", before.Volumes, after.Volumes)...)
+	changes = append(changes, listChanges("env_file", before.EnvFiles, after.EnvFiles)...)
+	changes = append(changes, listChanges("networks", before.Networks, after.Networks)...)
+	changes = append(changes, mapChanges("environment", before.Environment, after.Environment, false)...)
+	changes = append(changes, mapChanges("labels", before.Labels, after.Labels, true)...)
+	return changes
+}
+
+func scalarChange(field string, before string, after string) []Change {
+	switch {
+	case before == after:
+		return nil
+	case before == "":
+		return []Change{{Field: field, Action: "added", New: after}}
+	case after == "":
+		return []Change{{Field: field, Action: "removed", Old: before}}
+	default:
+		return []Change{{Field: field, Action: "changed", Old: before, New: after}}
+	}
+}
+
+func listChanges(field string, before []string, after []string) []Change {
+	beforeSet := make(map[string]bool, len(before))
+	for _, item := range before {
+		beforeSet[item] = true
+	}
+	afterSet := make(map[string]bool, len(after))
+	for _, item := range after {
+		afterSet[item] = true
+	}
+
+	changes := make([]Change, 0)
+	for _, item := range sortedKeys(beforeSet) {
+		if !afterSet[item] {
+			changes = append(changes, Change{Field: field, Action: "removed", Old: item})
+		}
+	}
+	for _, item := range sortedKeys(afterSet) {
+		if !beforeSet[item] {
+			changes = append(changes, Change{Field: field, Action: "added", New: item})
+		}
+	}
+	return changes
+}
+
+func mapChanges(field string, before map[string]string, after map[string]string, showValues bool) []Change {
+	keys := make(map[string]bool, len(before)+len(after))
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+
+	changes := make([]Change, 0)
+	for _, key := range sortedKeys(keys) {
+		oldValue, hadOld := before[key]
+		newValue, hasNew := after[key]
+		change := Change{Field: field, Key: key}
+		switch {
+		case !hadOld:
+			change.Action = "added"
+			if showValues {
+				change.New = newValue
+			}
+		case !hasNew:
+			change.Action = "removed"
+			if showValues {
+				change.Old = oldValue
+			}
+		case oldValue != newValue:
+			change.Action = "changed"
+			if showValues {
+				change.Old = oldValue
+				change.New = newValue
+			}
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// String renders the change as a single human-readable line.
+func (c Change) String() string {
+	subject := c.Field
+	if c.Key != "" {
+		subject = fmt.Sprintf("%s %s", c.Field, c.Key)
+	}
+
+	switch c.Action {
+	case "added":
+		if c.New != "" {
+			return fmt.Sprintf("+ %s: %s", subject, c.New)
+		}
+		return fmt.Sprintf("+ %s", subject)
+	case "removed":
+		if c.Old != "" {
+			return fmt.Sprintf("- %s: %s", subject, c.Old)
+		}
+		return fmt.Sprintf("- %s", subject)
+	default:
+		if c.Old != "" || c.New != "" {
+			return fmt.Sprintf("~ %s: %s -> %s", subject, c.Old, c.New)
+		}
+		return fmt.Sprintf("~ %s (value changed)", subject)
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DescribeStrategy explains how Konta will roll out an app when moving from
+// the old compose file to the new one.
+func DescribeStrategy(old *File, new *File) string {
+	switch {
+	case new == nil:
+		return "remove (stack will be taken down)"
+	case new.Rolling() && old != nil && !old.Rolling():
+		return "restart (migrating to rolling: the stable stack is stopped first)"
+	case !new.Rolling() && old != nil && old.Rolling():
+		return "restart (migrating from rolling: rolling stacks are stopped first)"
+	case new.Rolling() && !new.HasHealthcheck():
+		return "rolling (new stack starts next to the old one; no healthcheck, waits for containers to stay running)"
+	case new.Rolling():
+		return "rolling (new stack starts next to the old one and replaces it once healthy)"
+	case old == nil:
+		return "create (new stack)"
+	default:
+		return "restart (stack is stopped, then started with the new definition)"
+	}
+}
+
+// Summary counts service-level changes, e.g. "2 changed, 1 added".
+func Summary(diffs []ServiceDiff) string {
+	counts := map[string]int{}
+	for _, diff := range diffs {
+		counts[diff.Status]++
+	}
+	parts := make([]string, 0, 3)
+	for _, status := range []string{"added", "changed", "removed"} {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	if len(parts) == 0 {
+		return "no service changes"
+	}
+	return strings.Join(parts, ", ") + " service(s)"
+}
@@ -0,0 +1,119 @@
+package compose
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, data string) *File {
+	t.Helper()
+	file, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestDiffListsChangesWithoutEnvironmentValues(t *testing.T) {
+	old := mustParse(t, `
+services:
+  web:
+    image: nginx:1.25
+    ports: ["80:80"]
+    environment:
+      API_KEY: old-secret
+      MODE: prod
+    labels:
+      tier: front
+  cron:
+    image: busybox
+`)
+	new := mustParse(t, `
+services:
+  web:
+    image: nginx:1.27
+    ports: ["80:80", "443:443"]
+    environment:
+      API_KEY: new-secret
+      DEBUG: "1"
+    labels:
+      tier: edge
+  worker:
+    image: worker
+`)
+
+	diffs := Diff(old, new)
+	statuses := make([]string, 0, len(diffs))
+	for _, diff := range diffs {
+		statuses = append(statuses, diff.Service+" "+diff.Status)
+	}
+	if want := []string{"cron removed", "web changed", "worker added"}; !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("diffs = %v, want %v", statuses, want)
+	}
+
+	lines := make([]string, 0)
+	for _, change := range diffs[1].Changes {
+		lines = append(lines, change.String())
+	}
+	want := []string{
+		"~ image: nginx:1.25 -> nginx:1.27",
+		"+ ports: 443:443",
+		"~ environment API_KEY (value changed)",
+		"+ environment DEBUG",
+		"- environment MODE",
+		"~ labels tier: front -> edge",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("web changes:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "secret") || strings.Contains(line, "prod") {
+			t.Errorf("environment value in %q", line)
+		}
+	}
+
+	if got := Summary(diffs); got != "1 added, 1 changed, 1 removed service(s)" {
+		t.Errorf("Summary = %q", got)
+	}
+	if got := Summary(Diff(old, old)); got != "no service changes" {
+		t.Errorf("Summary without changes = %q", got)
+	}
+}
+
+func TestDiffOfAddedAndRemovedApps(t *testing.T) {
+	file := mustParse(t, "services:\n  web:\n    image: nginx\n")
+
+	added := Diff(nil, file)
+	if len(added) != 1 || added[0].Status != "added" || added[0].Changes[0].String() != "+ image: nginx" {
+		t.Errorf("added app = %+v", added)
+	}
+	removed := Diff(file, nil)
+	if len(removed) != 1 || removed[0].Status != "removed" || len(removed[0].Changes) != 0 {
+		t.Errorf("removed app = %+v", removed)
+	}
+}
+
+func TestDescribeStrategy(t *testing.T) {
+	plain := mustParse(t, "services:\n  web:\n    image: nginx\n")
+	rolling := mustParse(t, "services:\n  web:\n    image: nginx\n    labels:\n      konta.rolling: \"true\"\n")
+	healthy := mustParse(t, "services:\n  web:\n    image: nginx\n    labels: [konta.rolling=true]\n    healthcheck:\n      test: [CMD, \"true\"]\n")
+
+	tests := []struct {
+		old, new *File
+		want     string
+	}{
+		{plain, nil, "remove"},
+		{nil, plain, "create"},
+		{plain, plain, "restart (stack is stopped"},
+		{plain, rolling, "restart (migrating to rolling"},
+		{rolling, plain, "restart (migrating from rolling"},
+		{rolling, rolling, "rolling (new stack starts next to the old one; no healthcheck"},
+		{healthy, healthy, "rolling (new stack starts next to the old one and replaces it once healthy)"},
+	}
+	for index, tt := range tests {
+		if got := DescribeStrategy(tt.old, tt.new); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("case %d: DescribeStrategy = %q, want %q...", index, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package compose
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConfigHashLabel is stamped on every container at deploy time with the hash
+// of its resolved service config, so health checks can tell whether the
+// container still runs what the release describes.
+const ConfigHashLabel = "konta.config-hash"
+
+// ResolvedService is one service from `docker compose config --format json`:
+// variables are substituted, env files are merged and paths are absolute.
+type ResolvedService struct {
+	Image       string             `json:"image,omitempty"`
+	Command     stringList         `json:"command,omitempty"`
+	Entrypoint  stringList         `json:"entrypoint,omitempty"`
+	Environment map[string]*string `json:"environment,omitempty"`
+	Labels      map[string]string  `json:"labels,omitempty"`
+	Ports       []ResolvedPort     `json:"ports,omitempty"`
+	Volumes     []ResolvedVolume   `json:"volumes,omitempty"`
+	Restart     string             `json:"restart,omitempty"`
+}
+
+// ResolvedPort is a port mapping in long syntax.
+type ResolvedPort struct {
+	Target    int         `json:"target"`
+	Published interface{} `json:"published,omitempty"` // string or number depending on the compose version
+	Protocol  string      `json:"protocol,omitempty"`
+	HostIP    string      `json:"host_ip,omitempty"`
+}
+
+// ResolvedVolume is a mount in long syntax.
+type ResolvedVolume struct {
+	Type     string `json:"type"`
+	Source   string `json:"source,omitempty"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// stringList accepts both the list and the string form of command and
+// entrypoint.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = list
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return err
+	}
+	*l = strings.Fields(single)
+	return nil
+}
+
+// ParseResolved parses the output of `docker compose config --format json`.
+func ParseResolved(data []byte) (map[string]ResolvedService, error) {
+	var document struct {
+		Services map[string]ResolvedService `json:"services"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse resolved compose config: %w", err)
+	}
+	if document.Services == nil {
+		document.Services = make(map[string]ResolvedService)
+	}
+	return document.Services, nil
+}
+
+// ConfigHash returns a short hash of the fields Konta compares. The
+// config-hash label itself is left out, so the hash of a release and the
+// label on its containers match.
+func (s ResolvedService) ConfigHash() string {
+	labels := make(map[string]string, len(s.Labels))
+	for key, value := range s.Labels {
+		if key != ConfigHashLabel {
+			labels[key] = value
+		}
+	}
+
+	ports := make([]string, 0, len(s.Ports))
+	for _, port := range s.Ports {
+		ports = append(ports, port.String())
+	}
+	sort.Strings(ports)
+
+	volumes := make([]string, 0, len(s.Volumes))
+	for _, volume := range s.Volumes {
+		volumes = append(volumes, fmt.Sprintf("%s:%s:%s:%t", volume.Type, volume.Source, volume.Target, volume.ReadOnly))
+	}
+	sort.Strings(volumes)
+
+	// encoding/json sorts map keys, which keeps the hash stable.
+	data, _ := json.Marshal(struct {
+		Image       string
+		Command     []string
+		Entrypoint  []string
+		Environment map[string]*string
+		Labels      map[string]string
+		Ports       []string
+		Volumes     []string
+		Restart     string
+	}{s.Image, s.Command, s.Entrypoint, s.Environment, labels, ports, volumes, s.Restart})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// String renders the port as "host_ip:published:target/protocol".
+func (p ResolvedPort) String() string {
+	published := ""
+	if p.Published != nil {
+		published = fmt.Sprint(p.Published)
+	}
+	protocol := p.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	return fmt.Sprintf("%s:%s:%d/%s", p.HostIP, published, p.Target, protocol)
+}
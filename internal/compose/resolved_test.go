@@ -0,0 +1,68 @@
+package compose
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseResolved(t *testing.T) {
+	services, err := ParseResolved([]byte(`{"services":{"web":{
+		"image":"nginx:1.27",
+		"command":"nginx -g daemon-off",
+		"entrypoint":["/docker-entrypoint.sh"],
+		"environment":{"MODE":"prod","UNSET":null},
+		"ports":[{"target":80,"published":"8080"},{"target":443,"published":8443,"protocol":"tcp","host_ip":"127.0.0.1"}],
+		"restart":"always"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := services["web"]
+	if want := []string{"nginx", "-g", "daemon-off"}; !reflect.DeepEqual([]string(web.Command), want) {
+		t.Errorf("command = %q, want %q", web.Command, want)
+	}
+	if web.Environment["UNSET"] != nil || *web.Environment["MODE"] != "prod" {
+		t.Errorf("environment = %v", web.Environment)
+	}
+	if got := web.Ports[0].String(); got != ":8080:80/tcp" {
+		t.Errorf("port = %s", got)
+	}
+	if got := web.Ports[1].String(); got != "127.0.0.1:8443:443/tcp" {
+		t.Errorf("port = %s", got)
+	}
+
+	if services, err := ParseResolved([]byte(`{}`)); err != nil || services == nil {
+		t.Errorf("empty config = %v, %v", services, err)
+	}
+	if _, err := ParseResolved([]byte(`not json`)); err == nil {
+		t.Error("no error for invalid output")
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	service := ResolvedService{
+		Image: "nginx:1.27",
+		Ports: []ResolvedPort{{Target: 80, Published: "8080"}, {Target: 443, Published: "8443"}},
+	}
+	hash := service.ConfigHash()
+	if len(hash) != 16 {
+		t.Errorf("hash = %q, want 16 hex characters", hash)
+	}
+
+	reordered := service
+	reordered.Ports = []ResolvedPort{service.Ports[1], service.Ports[0]}
+	if got := reordered.ConfigHash(); got != hash {
+		t.Errorf("hash changed with the port order: %s, want %s", got, hash)
+	}
+
+	stamped := service
+	stamped.Labels = map[string]string{ConfigHashLabel: hash}
+	if got := stamped.ConfigHash(); got != hash {
+		t.Errorf("hash changed with the config-hash label: %s, want %s", got, hash)
+	}
+
+	republished := service
+	republished.Ports = []ResolvedPort{{Target: 80, Published: "9090"}, service.Ports[1]}
+	if republished.ConfigHash() == hash {
+		t.Error("hash did not change with a published port")
+	}
+}
@@ -0,0 +1,248 @@
+package compose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic severities.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is one problem found in an apps directory.
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// String renders the diagnostic as "file:line: severity: message [rule]".
+func (d Diagnostic) String() string {
+	location := d.File
+	if d.Line > 0 {
+		location = fmt.Sprintf("%s:%d", d.File, d.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", location, d.Severity, d.Message, d.Rule)
+}
+
+// konta labels users set in compose files, all boolean.
+var kontaLabels = map[string]bool{
+	"konta.managed":  true,
+	"konta.rolling":  true,
+	"konta.stopped":  true,
+	"konta.recreate": true,
+}
+
+// yamlErrorLine extracts the line from YAML parser errors ("yaml: line 7: ...").
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+// alternativeFileNames are compose file names Docker accepts but Konta ignores.
+var alternativeFileNames = []string{"docker-compose.yaml", "compose.yml", "compose.yaml"}
+
+// Validate checks every app in appsDir the way the reconciler reads it and
+// returns diagnostics sorted by file and line. It needs neither Docker nor
+// root. It returns the number of apps checked.
+func Validate(appsDir string) ([]Diagnostic, int, error) {
+	entries, err := os.ReadDir(appsDir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read apps directory: %w", err)
+	}
+
+	diagnostics := make([]Diagnostic, 0)
+	containerNames := make(map[string]string) // container_name -> app that declared it first
+	apps := 0
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		appDir := filepath.Join(appsDir, entry.Name())
+		file, appDiagnostics := ValidateApp(appDir)
+		diagnostics = append(diagnostics, appDiagnostics...)
+		if file != nil || len(appDiagnostics) > 0 {
+			apps++
+		}
+		if file == nil {
+			continue
+		}
+
+		for _, name := range file.ServiceNames() {
+			service := file.Services[name]
+			if service.ContainerName == "" {
+				continue
+			}
+			if first, ok := containerNames[service.ContainerName]; ok {
+				diagnostics = append(diagnostics, Diagnostic{
+					File:     file.Path,
+					Line:     service.Lines["container_name"],
+					Severity: SeverityError,
+					Rule:     "duplicate-container-name",
+					Message:  fmt.Sprintf("container_name %q is already used by app %s", service.ContainerName, first),
+				})
+				continue
+			}
+			containerNames[service.ContainerName] = entry.Name()
+		}
+	}
+
+	sortDiagnostics(diagnostics)
+	return diagnostics, apps, nil
+}
+
+func sortDiagnostics(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].File != diagnostics[j].File {
+			return diagnostics[i].File < diagnostics[j].File
+		}
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+}
+
+// ValidateApp checks one app directory. The parsed compose file is nil when
+// the directory has no readable docker-compose.yml.
+func ValidateApp(appDir string) (*File, []Diagnostic) {
+	path := filepath.Join(appDir, FileName)
+	if _, err := os.Stat(path); err != nil {
+		for _, alternative := range alternativeFileNames {
+			if _, err := os.Stat(filepath.Join(appDir, alternative)); err == nil {
+				return nil, []Diagnostic{{
+					File:     filepath.Join(appDir, alternative),
+					Severity: SeverityError,
+					Rule:     "compose-file-name",
+					Message:  fmt.Sprintf("Konta only reads %s; this app is ignored until the file is renamed", FileName),
+				}}
+			}
+		}
+		return nil, nil
+	}
+
+	file, err := Load(path)
+	if err != nil {
+		message := strings.TrimPrefix(err.Error(), path+": ")
+		line := 0
+		if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+			line, _ = strconv.Atoi(match[1])
+		}
+		return nil, []Diagnostic{{
+			File:     path,
+			Line:     line,
+			Severity: SeverityError,
+			Rule:     "compose-parse",
+			Message:  message,
+		}}
+	}
+
+	diagnostics := validateFile(file)
+	sortDiagnostics(diagnostics)
+	return file, diagnostics
+}
+
+// validateFile checks one app's compose file.
+func validateFile(file *File) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	add := func(line int, severity string, rule string, format string, args ...interface{}) {
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     file.Path,
+			Line:     line,
+			Severity: severity,
+			Rule:     rule,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(file.Services) == 0 {
+		add(0, SeverityError, "no-services", "compose file defines no services")
+		return diagnostics
+	}
+
+	managed := 0
+	for _, name := range file.ServiceNames() {
+		if file.Services[name].HasLabel("konta.managed", "true") {
+			managed++
+		}
+	}
+	if managed == 0 {
+		add(0, SeverityError, "managed-label", "no service has the label konta.managed=true, Konta will not manage this app")
+	}
+
+	rolling := file.Rolling()
+	if rolling && !file.HasHealthcheck() {
+		add(0, SeverityWarning, "rolling-healthcheck", "konta.rolling=true without a healthcheck: old stacks are removed once containers stay running, not once they are healthy")
+	}
+
+	for _, name := range file.ServiceNames() {
+		service := file.Services[name]
+
+		if managed > 0 && !service.HasLabel("konta.managed", "true") {
+			add(service.Line, SeverityWarning, "managed-label", "service %q has no konta.managed=true label and is not managed by Konta", name)
+		}
+
+		labelKeys := make([]string, 0, len(service.Labels))
+		for key := range service.Labels {
+			labelKeys = append(labelKeys, key)
+		}
+		sort.Strings(labelKeys)
+		for _, key := range labelKeys {
+			value := service.Labels[key]
+			if !strings.HasPrefix(key, "konta.") {
+				continue
+			}
+			if !kontaLabels[key] {
+				add(service.Lines["labels"], SeverityWarning, "unknown-label", "service %q has unknown label %q", name, key)
+				continue
+			}
+			if _, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+				add(service.Lines["labels"], SeverityError, "label-value", "service %q label %s=%q must be true or false", name, key, value)
+			}
+		}
+
+		if rolling && service.ContainerName != "" {
+			add(service.Lines["container_name"], SeverityError, "rolling-container-name", "service %q sets container_name %q, which conflicts while the old and new rolling stacks run side by side", name, service.ContainerName)
+		}
+
+		if rolling {
+			for _, port := range service.Ports {
+				if hostPort := publishedHostPort(port); hostPort != "" {
+					add(service.Lines["ports"], SeverityError, "rolling-host-port", "service %q publishes host port %s, which conflicts while the old and new rolling stacks run side by side", name, hostPort)
+				}
+			}
+		}
+
+		for _, network := range service.Networks {
+			if network == "default" {
+				continue
+			}
+			if _, ok := file.Networks[network]; !ok {
+				add(service.Lines["networks"], SeverityError, "undeclared-network", "service %q uses network %q, which is not declared under the top-level networks (add it with external: true if it is shared)", name, network)
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+// publishedHostPort returns the fixed host port of a short-syntax port
+// mapping ("8080:80", "127.0.0.1:8080:80/udp"), or "" when Docker picks it.
+func publishedHostPort(port string) string {
+	port, _, _ = strings.Cut(port, "/")
+	if strings.HasPrefix(port, "[") {
+		// IPv6 host address: [::1]:8080:80
+		if _, rest, ok := strings.Cut(port, "]:"); ok {
+			port = rest
+		}
+	}
+	parts := strings.Split(port, ":")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
@@ -0,0 +1,157 @@
+package compose
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeApps creates an apps directory with the given files, keyed by their
+// path relative to it.
+func writeApps(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func rules(diagnostics []Diagnostic) []string {
+	found := make([]string, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		found = append(found, diagnostic.Severity+" "+diagnostic.Rule)
+	}
+	return found
+}
+
+func TestValidateRollingApp(t *testing.T) {
+	dir := writeApps(t, map[string]string{"web/docker-compose.yml": `services:
+  web:
+    image: nginx
+    container_name: web
+    ports:
+      - "8080:80"
+      - "80"
+    networks: [proxy]
+    labels:
+      konta.managed: "true"
+      konta.rolling: "true"
+      konta.stopped: "maybe"
+      konta.rollout: "true"
+  sidecar:
+    image: busybox
+`})
+
+	diagnostics, apps, err := Validate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apps != 1 {
+		t.Errorf("apps = %d, want 1", apps)
+	}
+	want := []string{
+		"warning rolling-healthcheck",
+		"error rolling-container-name",
+		"error rolling-host-port",
+		"error label-value",
+		"warning unknown-label",
+		"error undeclared-network",
+		"warning managed-label",
+	}
+	if got := rules(diagnostics); !sameMultiset(got, want) {
+		t.Errorf("rules = %v, want %v", got, want)
+	}
+	for index := 1; index < len(diagnostics); index++ {
+		if diagnostics[index].Line < diagnostics[index-1].Line {
+			t.Errorf("diagnostics not sorted by line: %v", diagnostics)
+			break
+		}
+	}
+}
+
+func TestValidateFindsProblemsAcrossApps(t *testing.T) {
+	dir := writeApps(t, map[string]string{
+		"web/docker-compose.yml": `services:
+  web:
+    image: nginx
+    container_name: shared
+    labels: [konta.managed=true]
+`,
+		"api/docker-compose.yml": `services:
+  api:
+    image: api
+    container_name: shared
+    labels: [konta.managed=true]
+`,
+		"legacy/compose.yaml":          "services: {}\n",
+		"broken/docker-compose.yml":    "services:\n  web:\n    image: [\n",
+		"empty/docker-compose.yml":     "services: {}\n",
+		"unmanaged/docker-compose.yml": "services:\n  db:\n    image: postgres\n",
+		"notes/README.md":              "not an app\n",
+	})
+
+	diagnostics, apps, err := Validate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apps != 6 {
+		t.Errorf("apps = %d, want 6", apps)
+	}
+	want := []string{
+		"error duplicate-container-name", // web, after api declared it
+		"error compose-parse",
+		"error no-services",
+		"error compose-file-name",
+		"error managed-label",
+	}
+	got := rules(diagnostics)
+	if !sameMultiset(got, want) {
+		t.Errorf("rules = %v, want %v", got, want)
+	}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Rule == "compose-parse" && diagnostic.Line == 0 {
+			t.Errorf("parse error without a line: %s", diagnostic)
+		}
+	}
+}
+
+func sameMultiset(a, b []string) bool {
+	counts := make(map[string]int)
+	for _, item := range a {
+		counts[item]++
+	}
+	for _, item := range b {
+		counts[item]--
+	}
+	for _, count := range counts {
+		if count != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPublishedHostPort(t *testing.T) {
+	ports := map[string]string{
+		"80":                    "",
+		"8080:80":               "8080",
+		"127.0.0.1:8080:80/udp": "8080",
+		"[::1]:8443:443":        "8443",
+		":80":                   "",
+	}
+	got := make(map[string]string, len(ports))
+	for port := range ports {
+		got[port] = publishedHostPort(port)
+	}
+	if !reflect.DeepEqual(got, ports) {
+		t.Errorf("publishedHostPort = %v, want %v", got, ports)
+	}
+}
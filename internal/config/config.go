@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/talyguryn/konta/internal/dockerutil"
 	"github.com/talyguryn/konta/internal/logger"
 	"github.com/talyguryn/konta/internal/types"
 )
@@ -22,6 +24,18 @@ var (
 	}
 )
 
+var defaultConfigPaths = configPaths
+
+// SetPath makes Load read only the config file at path, e.g. to keep tests
+// away from the host config. An empty path restores the default search.
+func SetPath(path string) {
+	if path == "" {
+		configPaths = defaultConfigPaths
+		return
+	}
+	configPaths = []string{path}
+}
+
 // FindConfigPath returns the first existing config path.
 func FindConfigPath() (string, error) {
 	for _, path := range configPaths {
@@ -33,6 +47,7 @@ func FindConfigPath() (string, error) {
 	return "", fmt.Errorf("no configuration file found. Checked: %v", configPaths)
 }
 
+// Load reads and validates the config file found by FindConfigPath.
 func Load() (*types.Config, error) {
 	configPath, err := FindConfigPath()
 	if err != nil {
@@ -46,6 +61,44 @@ func Load() (*types.Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	config, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// A daemon cannot switch runtimes, so a changed runtime rejects the
+	// whole config and the previous one stays in use.
+	if err := dockerutil.SetRuntime(config.Runtime); err != nil {
+		return nil, err
+	}
+
+	// Override token from environment if set
+	if token := os.Getenv("KONTA_TOKEN"); token != "" {
+		config.Repository.Token = token
+	}
+
+	// Validate config and save lock file
+	if err := validateAndLockConfig(config, configPath); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ValidateFile checks a config file without loading it: unknown fields,
+// wrong types and invalid values are all reported in one *ValidationError.
+func ValidateFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	_, err = Parse(data)
+	return err
+}
+
+// Parse decodes a config file, rejects unknown fields and invalid values
+// and fills in defaults.
+func Parse(data []byte) (*types.Config, error) {
 	config := &types.Config{
 		Repository: types.RepositoryConf{
 			Path:     ".",
@@ -61,43 +114,53 @@ func Load() (*types.Config, error) {
 				Enable:   true,
 				MaxRetry: 0,
 			},
-			GitHubDeployments: types.GitHubDeploymentsConf{
-				Enable:      true,
-				Environment: "production",
-			},
 		},
 		Logging: types.LoggingConf{
 			Level: "info",
 		},
+		Metrics: types.MetricsConf{
+			Listen: "127.0.0.1:9469",
+		},
 		ReleaseChannel: "stable",
 	}
 
-	if err := yaml.Unmarshal(data, config); err != nil {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
+	if document.Kind == 0 {
+		return nil, &ValidationError{Problems: []string{"config: file is empty"}}
+	}
+
+	// Fields with the wrong type are left at their defaults by Decode, so
+	// value checks still run and every problem is reported at once.
+	var found problems
+	checkNode(&document, reflect.TypeOf(config), "", &found)
+	if err := document.Decode(config); err != nil && len(found) == 0 {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	checkValues(config, &found)
+	if err := found.err(); err != nil {
+		return nil, err
+	}
 
-	// Validate config
 	if config.Version == "" {
 		config.Version = "v1"
 	}
-	if config.Repository.URL == "" {
-		return nil, fmt.Errorf("repository.url is required")
-	}
 
-	channel := strings.ToLower(strings.TrimSpace(config.ReleaseChannel))
-	switch channel {
-	case "", "stable":
-		config.ReleaseChannel = "stable"
-	case "next":
-		config.ReleaseChannel = "next"
-	default:
-		logger.Warn("Invalid release_channel=%q, using default 'stable'", config.ReleaseChannel)
-		config.ReleaseChannel = "stable"
+	normalizeUpdatePolicy(config)
+	normalizeForgeReporting(config)
+
+	config.Runtime = strings.ToLower(strings.TrimSpace(config.Runtime))
+	if config.Runtime == "" {
+		config.Runtime = "docker"
 	}
 
 	if strings.TrimSpace(config.Deploy.ProjectNameHashMode) == "" {
 		config.Deploy.ProjectNameHashMode = "rolling_only"
 	}
+	config.Deploy.ProjectNameHashMode = strings.ToLower(strings.TrimSpace(config.Deploy.ProjectNameHashMode))
 
 	if config.Deploy.RollingHealthTimeoutSeconds <= 0 {
 		config.Deploy.RollingHealthTimeoutSeconds = 300
@@ -111,20 +174,46 @@ func Load() (*types.Config, error) {
 		config.Deploy.AutoCreateExternalNetworks = boolPtr(true)
 	}
 
-	if config.Deploy.SelfHeal.MaxRetry < 0 {
-		config.Deploy.SelfHeal.MaxRetry = 0
+	config.Logging.Level = strings.ToLower(strings.TrimSpace(config.Logging.Level))
+	config.Logging.Format = strings.ToLower(strings.TrimSpace(config.Logging.Format))
+	if config.Logging.Format == "" {
+		config.Logging.Format = "text"
+	}
+
+	if config.Logging.MaxSizeMB <= 0 {
+		config.Logging.MaxSizeMB = 10
+	}
+
+	if config.Logging.MaxFiles <= 0 {
+		config.Logging.MaxFiles = 5
+	}
+
+	if strings.TrimSpace(config.Metrics.Listen) == "" {
+		config.Metrics.Listen = "127.0.0.1:9469"
 	}
 
 	mode := strings.ToLower(strings.TrimSpace(config.Deploy.SelfHeal.RecoveryMode))
-	switch mode {
-	case "", "state":
-		config.Deploy.SelfHeal.RecoveryMode = "state"
-	case "current_on_missing", "current":
+	if mode == "current_on_missing" || mode == "current" {
 		logger.Warn("deploy.self_heal.recovery_mode=%q is deprecated and ignored; Konta now repairs unchanged applications strictly from project state", mode)
-		config.Deploy.SelfHeal.RecoveryMode = "state"
-	default:
-		logger.Warn("Invalid deploy.self_heal.recovery_mode=%q, using default 'state'", config.Deploy.SelfHeal.RecoveryMode)
-		config.Deploy.SelfHeal.RecoveryMode = "state"
+	}
+	config.Deploy.SelfHeal.RecoveryMode = "state"
+
+	config.Deploy.SelfHeal.ConfigDrift = strings.ToLower(strings.TrimSpace(config.Deploy.SelfHeal.ConfigDrift))
+	if config.Deploy.SelfHeal.ConfigDrift == "" {
+		config.Deploy.SelfHeal.ConfigDrift = "heal"
+	}
+
+	if config.Deploy.SelfHeal.Events == nil {
+		config.Deploy.SelfHeal.Events = boolPtr(true)
+	}
+	if config.Deploy.SelfHeal.EventDebounceSeconds <= 0 {
+		config.Deploy.SelfHeal.EventDebounceSeconds = 10
+	}
+	if config.Deploy.SelfHeal.EventCooldownSeconds <= 0 {
+		config.Deploy.SelfHeal.EventCooldownSeconds = 60
+	}
+	if config.Deploy.SelfHeal.SafetyNetIntervalSeconds <= 0 {
+		config.Deploy.SelfHeal.SafetyNetIntervalSeconds = 600
 	}
 
 	// Normalize repository path - ensure it points to 'apps' directory
@@ -170,14 +259,12 @@ func Load() (*types.Config, error) {
 	config.Hooks.FailureAbs = filepath.Join(hooksBase, config.Hooks.Failure)
 	config.Hooks.PostUpdateAbs = filepath.Join(hooksBase, config.Hooks.PostUpdate)
 
-	// Override token from environment if set
-	if token := os.Getenv("KONTA_TOKEN"); token != "" {
-		config.Repository.Token = token
-	}
-
-	// Validate config and save lock file
-	if err := validateAndLockConfig(config, configPath); err != nil {
-		return nil, err
+	for event, eventConf := range config.Hooks.Events {
+		if strings.TrimSpace(eventConf.Script) == "" {
+			eventConf.Script = event + ".sh"
+		}
+		eventConf.Path = filepath.Join(hooksBase, eventConf.Script)
+		config.Hooks.Events[event] = eventConf
 	}
 
 	return config, nil
@@ -235,9 +322,62 @@ func HasConfigChanged(config *types.Config, configPath string) bool {
 	return true
 }
 
+// normalizeUpdatePolicy fills konta_updates from the legacy release_channel.
+// Values were already checked by checkValues.
+func normalizeUpdatePolicy(config *types.Config) {
+	policy := &config.KontaUpdates
+
+	policy.Mode = strings.ToLower(strings.TrimSpace(policy.Mode))
+
+	if strings.TrimSpace(policy.Channel) == "" {
+		policy.Channel = config.ReleaseChannel
+	}
+	policy.Channel = strings.ToLower(strings.TrimSpace(policy.Channel))
+	if policy.Channel == "" {
+		policy.Channel = "stable"
+	}
+	config.ReleaseChannel = policy.Channel
+}
+
+// normalizeForgeReporting merges the deprecated deploy.github_deployments
+// into deploy.forge_reporting, which takes precedence, and fills in defaults.
+func normalizeForgeReporting(config *types.Config) {
+	config.Repository.Forge = strings.ToLower(strings.TrimSpace(config.Repository.Forge))
+
+	reporting := &config.Deploy.ForgeReporting
+	if legacy := config.Deploy.GitHubDeployments; legacy != nil {
+		logger.Warn("deploy.github_deployments is deprecated; rename it to deploy.forge_reporting")
+		if reporting.Enable == nil {
+			reporting.Enable = legacy.Enable
+		}
+		if strings.TrimSpace(reporting.Environment) == "" {
+			reporting.Environment = legacy.Environment
+		}
+		reporting.PerApp = reporting.PerApp || legacy.PerApp
+		config.Deploy.GitHubDeployments = nil
+	}
+
+	if reporting.Enable == nil {
+		reporting.Enable = boolPtr(true)
+	}
+	reporting.Environment = strings.TrimSpace(reporting.Environment)
+	if reporting.Environment == "" {
+		reporting.Environment = "production"
+	}
+}
+
+// DefaultPath is where Save writes the config: /etc/konta/config.yaml for
+// root, ~/.konta/config.yaml for rootless setups.
+func DefaultPath() string {
+	if os.Geteuid() != 0 {
+		return configPaths[1]
+	}
+	return configPaths[0]
+}
+
 // Save saves the configuration to the default location
 func Save(config *types.Config) error {
-	configPath := "/etc/konta/config.yaml"
+	configPath := DefaultPath()
 
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/dockerutil"
+)
+
+// useConfigFile points Load at a config file in a temp dir and returns
+// its path.
+func useConfigFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	SetPath(path)
+	t.Cleanup(func() { SetPath("") })
+	return path
+}
+
+func writeConfig(t *testing.T, path string, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadRejectsRuntimeChange(t *testing.T) {
+	t.Setenv("KONTA_RUNTIME", "")
+	path := useConfigFile(t)
+	const repository = "repository:\n  url: https://github.com/acme/infra\n"
+
+	writeConfig(t, path, "runtime: docker\n"+repository)
+	if _, err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dockerutil.Runtime(); got != dockerutil.RuntimeDocker {
+		t.Fatalf("Runtime() = %q", got)
+	}
+
+	writeConfig(t, path, "runtime: podman\n"+repository)
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "restart required") {
+		t.Fatalf("Load() after a runtime change = %v, want restart required", err)
+	}
+	if got := dockerutil.Runtime(); got != dockerutil.RuntimeDocker {
+		t.Errorf("Runtime() = %q after a rejected reload", got)
+	}
+}
@@ -0,0 +1,280 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// RepoSettingsFile is the settings file an infra repository keeps next to
+// its apps directory.
+const RepoSettingsFile = "konta.settings.yaml"
+
+// RepoSettingsReport tells where the effective deploy settings came from.
+type RepoSettingsReport struct {
+	Applied []string // settings taken from the repository, e.g. deploy.self_heal.max_retry or apps.web.rolling_health_retries
+	Locked  []string // repository settings ignored because the host config locks them
+}
+
+// deploySetting is one key a repository may set, named like in the file
+// below deploy: or apps.NAME:.
+type deploySetting struct {
+	key   string
+	apply func(conf *types.DeployConf, settings types.DeploySettings) bool
+}
+
+var deploySettings = []deploySetting{
+	{"project_name_hash_mode", func(conf *types.DeployConf, settings types.DeploySettings) bool {
+		if settings.ProjectNameHashMode == nil {
+			return false
+		}
+		conf.ProjectNameHashMode = strings.ToLower(strings.TrimSpace(*settings.ProjectNameHashMode))
+		return true
+	}},
+	{"rolling_health_timeout_second", func(conf *types.DeployConf, settings types.DeploySettings) bool {
+		if settings.RollingHealthTimeoutSeconds == nil {
+			return false
+		}
+		conf.RollingHealthTimeoutSeconds = *settings.RollingHealthTimeoutSeconds
+		return true
+	}},
+	{"rolling_health_retries", func(conf *types.DeployConf, settings types.DeploySettings) bool {
+		if settings.RollingHealthRetries == nil {
+			return false
+		}
+		conf.RollingHealthRetries = *settings.RollingHealthRetries
+		return true
+	}},
+	{"auto_create_external_networks", func(conf *types.DeployConf, settings types.DeploySettings) bool {
+		if settings.AutoCreateExternalNetworks == nil {
+			return false
+		}
+		conf.AutoCreateExternalNetworks = boolPtr(*settings.AutoCreateExternalNetworks)
+		return true
+	}},
+	{"self_heal.enable", func(conf *types.DeployConf, settings types.DeploySettings) bool {
+		if settings.SelfHeal.Enable == nil {
+			return false
+		}
+		conf.SelfHeal.Enable = *settings.SelfHeal.Enable
+		return true
+	}},
+	{"self_heal.max_retry", func(conf *types.DeployConf, settings types.DeploySettings) bool {
+		if settings.SelfHeal.MaxRetry == nil {
+			return false
+		}
+		conf.SelfHeal.MaxRetry = *settings.SelfHeal.MaxRetry
+		return true
+	}},
+	{"self_heal.config_drift", func(conf *types.DeployConf, settings types.DeploySettings) bool {
+		if settings.SelfHeal.ConfigDrift == nil {
+			return false
+		}
+		conf.SelfHeal.ConfigDrift = strings.ToLower(strings.TrimSpace(*settings.SelfHeal.ConfigDrift))
+		return true
+	}},
+}
+
+// RepoSettingsPath returns where the settings file of a checkout is: in the
+// base directory that contains apps/.
+func RepoSettingsPath(repoDir string, appsPath string) string {
+	return filepath.Join(repoDir, filepath.Dir(appsPath), RepoSettingsFile)
+}
+
+// LoadRepoSettings reads the settings file of a checkout. It returns nil
+// without an error when the repository has none.
+func LoadRepoSettings(repoDir string, appsPath string) (*types.RepoSettings, error) {
+	path := RepoSettingsPath(repoDir, appsPath)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", RepoSettingsFile, err)
+	}
+
+	settings, err := ParseRepoSettings(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// ParseRepoSettings decodes a settings file as strictly as the host config.
+func ParseRepoSettings(data []byte) (*types.RepoSettings, error) {
+	settings := &types.RepoSettings{}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse settings: %w", err)
+	}
+	if document.Kind == 0 {
+		return settings, nil
+	}
+
+	var found problems
+	checkNode(&document, reflect.TypeOf(settings), "", &found)
+	if err := document.Decode(settings); err != nil && len(found) == 0 {
+		return nil, fmt.Errorf("failed to parse settings: %w", err)
+	}
+
+	checkDeploySettings(&found, "deploy", settings.Deploy)
+	for _, app := range sortedApps(settings.Apps) {
+		checkDeploySettings(&found, "apps."+app, settings.Apps[app])
+	}
+	if err := found.err(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func checkDeploySettings(found *problems, path string, settings types.DeploySettings) {
+	if settings.ProjectNameHashMode != nil {
+		checkEnum(found, path+".project_name_hash_mode", *settings.ProjectNameHashMode, "rolling_only", "all", "none")
+		if strings.TrimSpace(*settings.ProjectNameHashMode) == "" {
+			found.addf(path+".project_name_hash_mode", "must not be empty")
+		}
+	}
+	if settings.RollingHealthTimeoutSeconds != nil {
+		checkMin(found, path+".rolling_health_timeout_second", *settings.RollingHealthTimeoutSeconds, 1)
+	}
+	if settings.RollingHealthRetries != nil {
+		checkMin(found, path+".rolling_health_retries", *settings.RollingHealthRetries, 1)
+	}
+	if settings.SelfHeal.MaxRetry != nil {
+		checkMin(found, path+".self_heal.max_retry", *settings.SelfHeal.MaxRetry, 0)
+	}
+	if settings.SelfHeal.ConfigDrift != nil {
+		checkEnum(found, path+".self_heal.config_drift", *settings.SelfHeal.ConfigDrift, "heal", "report", "ignore")
+		if strings.TrimSpace(*settings.SelfHeal.ConfigDrift) == "" {
+			found.addf(path+".self_heal.config_drift", "must not be empty")
+		}
+	}
+}
+
+// checkLockedKeys validates repo_settings.locked of the host config.
+func checkLockedKeys(found *problems, locked []string) {
+	known := map[string]reflect.Type{"*": nil, "self_heal": nil}
+	for _, setting := range deploySettings {
+		known[setting.key] = nil
+	}
+	for index, key := range locked {
+		if _, ok := known[key]; ok {
+			continue
+		}
+		message := fmt.Sprintf("unknown setting %q", key)
+		if suggestion := closestName(key, known); suggestion != "" {
+			message += fmt.Sprintf(", did you mean %s?", suggestion)
+		}
+		found.addf(fmt.Sprintf("repo_settings.locked[%d]", index), "%s", message)
+	}
+}
+
+// RepoSettingsEnabled reports whether the host config lets the repository
+// override deploy settings.
+func RepoSettingsEnabled(cfg *types.Config) bool {
+	return cfg.RepoSettings.Enable == nil || *cfg.RepoSettings.Enable
+}
+
+// MergeRepoSettings returns a copy of cfg with the repository settings
+// merged over the deploy section and the per-app overrides in AppDeploy.
+func MergeRepoSettings(cfg *types.Config, settings *types.RepoSettings) (*types.Config, RepoSettingsReport) {
+	merged := *cfg
+	var report RepoSettingsReport
+
+	merged.Deploy = mergeDeploySettings(cfg.Deploy, settings.Deploy, cfg.RepoSettings.Locked, "deploy", &report)
+	merged.AppDeploy = make(map[string]types.DeployConf, len(settings.Apps))
+	for _, app := range sortedApps(settings.Apps) {
+		merged.AppDeploy[app] = mergeDeploySettings(merged.Deploy, settings.Apps[app], cfg.RepoSettings.Locked, "apps."+app, &report)
+	}
+	return &merged, report
+}
+
+func mergeDeploySettings(base types.DeployConf, settings types.DeploySettings, locked []string, path string, report *RepoSettingsReport) types.DeployConf {
+	conf := base
+	for _, setting := range deploySettings {
+		if isLocked(setting.key, locked) {
+			var ignored types.DeployConf
+			if setting.apply(&ignored, settings) {
+				report.Locked = append(report.Locked, path+"."+setting.key)
+			}
+			continue
+		}
+		if setting.apply(&conf, settings) {
+			report.Applied = append(report.Applied, path+"."+setting.key)
+		}
+	}
+	return conf
+}
+
+func isLocked(key string, locked []string) bool {
+	for _, lockedKey := range locked {
+		if lockedKey == "*" || lockedKey == key || strings.HasPrefix(key, lockedKey+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedApps(apps map[string]types.DeploySettings) []string {
+	names := make([]string, 0, len(apps))
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	repoSettingsMu     sync.Mutex
+	repoSettingsNotice string
+)
+
+// ApplyRepoSettings merges the settings file of the checkout in repoDir
+// over cfg. An invalid file is ignored with an error, so the host config
+// stays in effect; problems are logged once until they change.
+func ApplyRepoSettings(cfg *types.Config, repoDir string) *types.Config {
+	if cfg == nil || !RepoSettingsEnabled(cfg) {
+		return cfg
+	}
+
+	settings, err := LoadRepoSettings(repoDir, cfg.Repository.Path)
+	if err != nil {
+		noticeRepoSettings(err.Error(), func() {
+			logger.Error("Ignoring repository settings, using the host config: %v", err)
+		})
+		return cfg
+	}
+	if settings == nil {
+		return cfg
+	}
+
+	merged, report := MergeRepoSettings(cfg, settings)
+	notice := strings.Join(report.Locked, ", ")
+	noticeRepoSettings(notice, func() {
+		if notice != "" {
+			logger.Warn("Repository settings locked by the host config are ignored: %s", notice)
+		}
+	})
+	return merged
+}
+
+func noticeRepoSettings(notice string, log func()) {
+	repoSettingsMu.Lock()
+	defer repoSettingsMu.Unlock()
+	if notice == repoSettingsNotice {
+		return
+	}
+	repoSettingsNotice = notice
+	log()
+}
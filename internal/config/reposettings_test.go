@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRepoSettings = `deploy:
+  rolling_health_retries: 3
+  self_heal:
+    enable: false
+    max_retry: 5
+apps:
+  web:
+    self_heal:
+      config_drift: Report
+  db:
+    project_name_hash_mode: none
+    self_heal:
+      enable: true
+`
+
+func TestMergeRepoSettings(t *testing.T) {
+	settings, err := ParseRepoSettings([]byte(testRepoSettings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := Parse([]byte("repository:\n  url: https://github.com/acme/infra\nrepo_settings:\n  locked: [self_heal.enable]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, report := MergeRepoSettings(host, settings)
+	if merged.Deploy.RollingHealthRetries != 3 || merged.Deploy.SelfHeal.MaxRetry != 5 || !merged.Deploy.SelfHeal.Enable {
+		t.Errorf("deploy = %+v", merged.Deploy)
+	}
+	if host.Deploy.RollingHealthRetries != 1 {
+		t.Error("host config changed by the merge")
+	}
+	// Apps start from the merged deploy section.
+	if web := merged.AppDeploy["web"]; web.SelfHeal.ConfigDrift != "report" || web.RollingHealthRetries != 3 || web.ProjectNameHashMode != "rolling_only" {
+		t.Errorf("web = %+v", web)
+	}
+	if db := merged.AppDeploy["db"]; db.ProjectNameHashMode != "none" || !db.SelfHeal.Enable {
+		t.Errorf("db = %+v", db)
+	}
+
+	wantApplied := []string{
+		"deploy.rolling_health_retries",
+		"deploy.self_heal.max_retry",
+		"apps.db.project_name_hash_mode",
+		"apps.web.self_heal.config_drift",
+	}
+	if !reflect.DeepEqual(report.Applied, wantApplied) {
+		t.Errorf("applied = %v, want %v", report.Applied, wantApplied)
+	}
+	if want := []string{"deploy.self_heal.enable", "apps.db.self_heal.enable"}; !reflect.DeepEqual(report.Locked, want) {
+		t.Errorf("locked = %v, want %v", report.Locked, want)
+	}
+}
+
+func TestLockedKeys(t *testing.T) {
+	tests := []struct {
+		key    string
+		locked []string
+		want   bool
+	}{
+		{"self_heal.max_retry", []string{"self_heal"}, true},
+		{"self_heal.max_retry", []string{"self_heal.enable"}, false},
+		{"rolling_health_retries", []string{"*"}, true},
+		{"rolling_health_retries", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isLocked(tt.key, tt.locked); got != tt.want {
+			t.Errorf("isLocked(%q, %v) = %t", tt.key, tt.locked, got)
+		}
+	}
+
+	_, err := Parse([]byte("repository:\n  url: https://github.com/acme/infra\nrepo_settings:\n  locked: [self_heal.max_retries]\n"))
+	if err == nil || !strings.Contains(err.Error(), `repo_settings.locked[0]: unknown setting "self_heal.max_retries", did you mean self_heal.max_retry?`) {
+		t.Errorf("typo in locked: %v", err)
+	}
+}
+
+func TestParseRepoSettingsIsStrict(t *testing.T) {
+	_, err := ParseRepoSettings([]byte(`deploy:
+  parallel: true
+  rolling_health_retries: 0
+apps:
+  web:
+    self_heal:
+      config_drift: ""
+`))
+	if err == nil {
+		t.Fatal("no error")
+	}
+	for _, problem := range []string{
+		"deploy.parallel: unknown field (line 2)",
+		"deploy.rolling_health_retries: must be >= 1, got 0",
+		"apps.web.self_heal.config_drift: must not be empty",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("%v\nmisses %q", err, problem)
+		}
+	}
+
+	if settings, err := ParseRepoSettings(nil); err != nil || settings == nil {
+		t.Errorf("empty file = %+v, %v", settings, err)
+	}
+}
+
+func TestApplyRepoSettings(t *testing.T) {
+	repoDir := t.TempDir()
+	host, err := Parse([]byte("repository:\n  url: https://github.com/acme/infra\n  path: infra\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ApplyRepoSettings(host, repoDir); got != host {
+		t.Error("config changed without a settings file")
+	}
+
+	// The file sits next to apps/, in repository.path.
+	path := RepoSettingsPath(repoDir, host.Repository.Path)
+	if path != filepath.Join(repoDir, "infra", RepoSettingsFile) {
+		t.Fatalf("settings path = %s", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("deploy:\n  rolling_health_retries: 4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := ApplyRepoSettings(host, repoDir); got.Deploy.RollingHealthRetries != 4 {
+		t.Errorf("retries = %d, want the repository value", got.Deploy.RollingHealthRetries)
+	}
+
+	disabled := *host
+	disabled.RepoSettings.Enable = boolPtr(false)
+	if got := ApplyRepoSettings(&disabled, repoDir); got != &disabled {
+		t.Error("settings applied although repo_settings.enable is false")
+	}
+
+	if err := os.WriteFile(path, []byte("deploy:\n  rolling_health_retries: many\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := ApplyRepoSettings(host, repoDir); got != host {
+		t.Error("invalid settings file applied")
+	}
+}
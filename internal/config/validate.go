@@ -0,0 +1,378 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/talyguryn/konta/internal/hooks"
+	"github.com/talyguryn/konta/internal/notify"
+	"github.com/talyguryn/konta/internal/types"
+	"github.com/talyguryn/konta/internal/updatepolicy"
+)
+
+// ValidationError lists every problem found in a config file, each prefixed
+// with the path of the field, e.g. "deploy.self_heal.max_retry: must be >= 0".
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid config: " + e.Problems[0]
+	}
+	return fmt.Sprintf("invalid config (%d problems):\n  %s", len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
+
+type problems []string
+
+func (p *problems) addf(path string, format string, args ...interface{}) {
+	*p = append(*p, path+": "+fmt.Sprintf(format, args...))
+}
+
+// err drops follow-up problems of a field that already has one, e.g. a
+// range error for a value that was not even a number.
+func (p problems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	var kept []string
+	seen := make(map[string]bool)
+	for _, problem := range p {
+		path := problem[:strings.Index(problem, ": ")]
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		kept = append(kept, problem)
+	}
+	return &ValidationError{Problems: kept}
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// checkNode compares a YAML node with the Go type it decodes into and
+// reports unknown fields and values of the wrong kind, with their line.
+func checkNode(node *yaml.Node, t reflect.Type, path string, found *problems) {
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) > 0 {
+			checkNode(node.Content[0], t, path, found)
+		}
+		return
+	}
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	at := func(format string, args ...interface{}) {
+		found.addf(displayPath(path), "%s (line %d)", fmt.Sprintf(format, args...), node.Line)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		// Types with their own decoding, like konta_updates, accept a short
+		// scalar form; their values are checked after decoding.
+		if node.Kind == yaml.ScalarNode && reflect.PtrTo(t).Implements(unmarshalerType) {
+			return
+		}
+		if node.Kind != yaml.MappingNode {
+			at("must be a mapping")
+			return
+		}
+		fields := yamlFields(t)
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			key, value := node.Content[index], node.Content[index+1]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				message := fmt.Sprintf("unknown field (line %d)", key.Line)
+				if suggestion := closestName(key.Value, fields); suggestion != "" {
+					message += fmt.Sprintf(", did you mean %s?", suggestion)
+				}
+				found.addf(joinPath(path, key.Value), "%s", message)
+				continue
+			}
+			checkNode(value, fieldType, joinPath(path, key.Value), found)
+		}
+
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			at("must be a list")
+			return
+		}
+		for index, item := range node.Content {
+			checkNode(item, t.Elem(), fmt.Sprintf("%s[%d]", path, index), found)
+		}
+
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			at("must be a mapping")
+			return
+		}
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			checkNode(node.Content[index+1], t.Elem(), joinPath(path, node.Content[index].Value), found)
+		}
+
+	case reflect.Int, reflect.Int64:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			at("must be an integer, got %s", describeNode(node))
+		}
+
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			at("must be true or false, got %s", describeNode(node))
+		}
+
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			at("must be a string, got %s", describeNode(node))
+		}
+	}
+}
+
+// yamlFields maps the YAML keys of a struct to their types.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return fmt.Sprintf("%q", node.Value)
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "config"
+	}
+	return path
+}
+
+// closestName suggests the known field nearest to a misspelled one.
+func closestName(name string, fields map[string]reflect.Type) string {
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	best, bestDistance := "", len(name)/3+1
+	if bestDistance < 3 {
+		bestDistance = 3
+	}
+	for _, candidate := range names {
+		if distance := editDistance(name, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
+
+// checkValues validates ranges and enums of a decoded config. Enum values
+// are compared case-insensitively, as the loader normalizes them.
+func checkValues(config *types.Config, found *problems) {
+	if config.Version != "" && config.Version != "v1" {
+		found.addf("version", "must be v1, got %q", config.Version)
+	}
+
+	repo := config.Repository
+	if strings.TrimSpace(repo.URL) == "" {
+		found.addf("repository.url", "is required")
+	}
+	if strings.TrimSpace(repo.Branch) == "" {
+		found.addf("repository.branch", "must not be empty")
+	}
+	if repo.Interval <= 0 {
+		found.addf("repository.interval", "must be > 0 seconds, got %d", repo.Interval)
+	}
+	if apiURL := strings.TrimSpace(repo.APIURL); apiURL != "" {
+		if parsed, err := url.Parse(apiURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			found.addf("repository.api_url", "must be an http(s) URL, got %q", apiURL)
+		}
+	}
+	checkEnum(found, "repository.forge", repo.Forge, "github", "gitlab", "gitea", "forgejo")
+	if app := repo.GitHubApp; app != (types.GitHubAppConf{}) {
+		if forge := strings.ToLower(strings.TrimSpace(repo.Forge)); forge == "gitlab" || forge == "gitea" || forge == "forgejo" {
+			found.addf("repository.github_app", "only works with GitHub, but repository.forge is %q", forge)
+		}
+		if app.AppID <= 0 {
+			found.addf("repository.github_app.app_id", "is required and must be > 0")
+		}
+		if app.InstallationID < 0 {
+			found.addf("repository.github_app.installation_id", "must be >= 0, got %d", app.InstallationID)
+		}
+		if strings.TrimSpace(app.PrivateKey) == "" {
+			found.addf("repository.github_app.private_key", "is required: path to the app's PEM private key")
+		}
+	}
+
+	deploy := config.Deploy
+	checkEnum(found, "deploy.project_name_hash_mode", deploy.ProjectNameHashMode, "rolling_only", "all", "none")
+	checkMin(found, "deploy.rolling_health_timeout_second", deploy.RollingHealthTimeoutSeconds, 0)
+	checkMin(found, "deploy.rolling_health_retries", deploy.RollingHealthRetries, 0)
+
+	selfHeal := deploy.SelfHeal
+	checkMin(found, "deploy.self_heal.max_retry", selfHeal.MaxRetry, 0)
+	checkEnum(found, "deploy.self_heal.recovery_mode", selfHeal.RecoveryMode, "state", "current_on_missing", "current")
+	checkEnum(found, "deploy.self_heal.config_drift", selfHeal.ConfigDrift, "heal", "report", "ignore")
+	checkMin(found, "deploy.self_heal.event_debounce_seconds", selfHeal.EventDebounceSeconds, 0)
+	checkMin(found, "deploy.self_heal.event_cooldown_seconds", selfHeal.EventCooldownSeconds, 0)
+	checkMin(found, "deploy.self_heal.safety_net_interval_seconds", selfHeal.SafetyNetIntervalSeconds, 0)
+
+	logging := config.Logging
+	checkEnum(found, "logging.level", logging.Level, "debug", "info", "warn", "error", "fatal")
+	checkEnum(found, "logging.format", logging.Format, "text", "json")
+	checkMin(found, "logging.max_size_mb", logging.MaxSizeMB, 0)
+	checkMin(found, "logging.max_files", logging.MaxFiles, 0)
+
+	if listen := strings.TrimSpace(config.Metrics.Listen); listen != "" {
+		if _, _, err := net.SplitHostPort(listen); err != nil {
+			found.addf("metrics.listen", "must be host:port, got %q", listen)
+		}
+	}
+
+	for index, notification := range config.Notifications {
+		path := fmt.Sprintf("notifications[%d]", index)
+		if err := notify.Validate(notification); err != nil {
+			found.addf(path, "%v", err)
+		}
+		checkMin(found, path+".retries", notification.Retries, 0)
+		if notification.Port < 0 || notification.Port > 65535 {
+			found.addf(path+".port", "must be between 0 and 65535, got %d", notification.Port)
+		}
+	}
+
+	checkEnum(found, "release_channel", config.ReleaseChannel, "stable", "next")
+	checkEnum(found, "runtime", config.Runtime, "docker", "podman")
+
+	checkMin(found, "hooks.timeout_seconds", config.Hooks.TimeoutSeconds, 0)
+	for _, event := range sortedEvents(config.Hooks.Events) {
+		path := "hooks.events." + event
+		if !hooks.IsEvent(event) {
+			known := make(map[string]reflect.Type, len(hooks.AllEvents))
+			for _, name := range hooks.AllEvents {
+				known[name] = nil
+			}
+			if suggestion := closestName(event, known); suggestion != "" {
+				found.addf(path, "unknown event, did you mean %s?", suggestion)
+			} else {
+				found.addf(path, "unknown event, use %s", strings.Join(hooks.AllEvents, ", "))
+			}
+			continue
+		}
+		if limit := config.Hooks.Events[event].RateLimitSeconds; limit != nil {
+			checkMin(found, path+".rate_limit_seconds", *limit, 0)
+		}
+	}
+
+	checkLockedKeys(found, config.RepoSettings.Locked)
+
+	policy := config.KontaUpdates
+	checkEnum(found, "konta_updates.mode", policy.Mode, "auto", "notify", "false")
+	checkEnum(found, "konta_updates.channel", policy.Channel, "stable", "next")
+	if _, err := updatepolicy.ParseConstraint(policy.Constraint); err != nil {
+		found.addf("konta_updates.constraint", "%v", err)
+	}
+	if _, err := updatepolicy.ParseWindow(policy.Window); err != nil {
+		found.addf("konta_updates.window", "%v", err)
+	}
+	if mirror := strings.TrimSpace(policy.Mirror); mirror != "" {
+		if parsed, err := url.Parse(mirror); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			found.addf("konta_updates.mirror", "must be an http(s) URL, got %q", mirror)
+		}
+	}
+}
+
+func sortedEvents(events map[string]types.HookEventConf) []string {
+	keys := make([]string, 0, len(events))
+	for key := range events {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkEnum accepts an empty value (the default) or one of allowed.
+func checkEnum(found *problems, path string, value string, allowed ...string) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return
+	}
+	for _, candidate := range allowed {
+		if value == candidate {
+			return
+		}
+	}
+	found.addf(path, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func checkMin(found *problems, path string, value int, min int) {
+	if value < min {
+		found.addf(path, "must be >= %d, got %d", min, value)
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+func TestParseReportsEveryProblem(t *testing.T) {
+	_, err := Parse([]byte(`version: v1
+repository:
+  url: https://github.com/acme/infra
+  interval: often
+  brnach: main
+deploy:
+  self_heal:
+    enable: maybe
+    max_retry: -1
+    config_drift: fix
+logging:
+  level: verbose
+notifications:
+  type: slack
+unknown_section: true
+`))
+
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("err = %v, want a *ValidationError", err)
+	}
+	want := []string{
+		`repository.interval: must be an integer, got "often" (line 4)`,
+		`repository.brnach: unknown field (line 5), did you mean branch?`,
+		`deploy.self_heal.enable: must be true or false, got "maybe" (line 8)`,
+		`notifications: must be a list (line 14)`,
+		`unknown_section: unknown field (line 15)`,
+		`deploy.self_heal.max_retry: must be >= 0, got -1`,
+		`deploy.self_heal.config_drift: must be one of heal, report, ignore, got "fix"`,
+		`logging.level: must be one of debug, info, warn, error, fatal, got "verbose"`,
+	}
+	if !reflect.DeepEqual(validation.Problems, want) {
+		t.Errorf("problems:\n%v\nwant:\n%v", validation.Problems, want)
+	}
+}
+
+func TestParseAcceptsShortForms(t *testing.T) {
+	config, err := Parse([]byte(`repository:
+  url: https://github.com/acme/infra
+  interval: &interval 60
+deploy:
+  rolling_health_retries: *interval
+konta_updates: notify
+notifications: ~
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.KontaUpdates.Mode != "notify" || config.Deploy.RollingHealthRetries != 60 {
+		t.Errorf("config = %+v", config)
+	}
+	if config.Repository.Branch != "main" || !config.Deploy.SelfHeal.Enable {
+		t.Errorf("defaults lost: %+v", config)
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	writeConfig(t, path, "")
+	if err := ValidateFile(path); err == nil || err.Error() != "invalid config: config: file is empty" {
+		t.Errorf("empty file: %v", err)
+	}
+	writeConfig(t, path, "repository: [\n")
+	if err := ValidateFile(path); err == nil {
+		t.Error("no error for invalid YAML")
+	}
+	writeConfig(t, path, "repository:\n  url: https://github.com/acme/infra\n")
+	if err := ValidateFile(path); err != nil {
+		t.Errorf("valid file: %v", err)
+	}
+	if err := ValidateFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
+
+func TestClosestName(t *testing.T) {
+	fields := yamlFields(reflect.TypeOf(types.SelfHealConf{}))
+	tests := map[string]string{
+		"max_retries":  "max_retry",
+		"enabled":      "enable",
+		"eventz":       "events",
+		"notification": "",
+	}
+	for name, want := range tests {
+		if got := closestName(name, fields); got != want {
+			t.Errorf("closestName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package dockerutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultSocket is where the system Docker Engine listens.
+const defaultSocket = "/var/run/docker.sock"
+
+const (
+	// requestTimeout bounds a request to the Engine, so a hung daemon fails
+	// the cycle instead of blocking it.
+	requestTimeout = 30 * time.Second
+	// stopTimeout bounds a container stop, which the Engine only answers
+	// after the container's stop grace period.
+	stopTimeout = 5 * time.Minute
+)
+
+// apiClient implements Client with the Docker Engine API over the unix
+// socket. Compose still runs through the CLI, which apiClient inherits from
+// client.
+type apiClient struct {
+	client
+	http        *http.Client
+	timeout     time.Duration
+	stopTimeout time.Duration
+}
+
+// socketPath returns the API socket from DOCKER_HOST (unix:// only) or the
+// first existing socket of the runtime. Other DOCKER_HOST schemes are left to
+// the CLI, which reads DOCKER_HOST itself.
+func socketPath() (string, bool) {
+	host := os.Getenv("DOCKER_HOST")
+	if host != "" {
+		if strings.HasPrefix(host, "unix://") {
+			return strings.TrimPrefix(host, "unix://"), true
+		}
+		return "", false
+	}
+
+	sockets := runtimeSockets(Runtime())
+	for _, socket := range sockets {
+		if _, err := os.Stat(socket); err == nil {
+			return socket, true
+		}
+	}
+	return sockets[0], true
+}
+
+func newAPIClient(socket string) *apiClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+	// No http.Client timeout: it would also cut the Events stream. Each
+	// other request gets its own deadline instead.
+	return &apiClient{
+		http:        &http.Client{Transport: transport},
+		timeout:     requestTimeout,
+		stopTimeout: stopTimeout,
+	}
+}
+
+// ping checks that the Engine answers on the socket.
+func (api *apiClient) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	resp, err := api.do(ctx, http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// do sends a request and turns non-2xx responses into errors carrying the
+// Engine's message.
+func (api *apiClient) do(ctx context.Context, method string, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	target := "http://docker" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := api.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker API %s %s failed: %w", method, path, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return nil, &APIError{StatusCode: resp.StatusCode, Message: apiErr.Message}
+}
+
+// APIError is a non-2xx answer of the Engine API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker API error (%d): %s", e.StatusCode, e.Message)
+}
+
+// getJSON decodes the answer of a GET request into out.
+func (api *apiClient) getJSON(path string, query url.Values, out interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), api.timeout)
+	defer cancel()
+
+	resp, err := api.do(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse docker API response for %s: %w", path, err)
+	}
+	return nil
+}
+
+// send sends a request that must be answered within timeout and discards
+// the answer.
+func (api *apiClient) send(timeout time.Duration, method string, path string, query url.Values, body io.Reader) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resp, err := api.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// Containers lists all containers in any state with a single request.
+func (api *apiClient) Containers() ([]Container, error) {
+	var items []struct {
+		ID     string `json:"Id"`
+		Names  []string
+		Image  string
+		State  string
+		Status string
+		Labels map[string]string
+	}
+	if err := api.getJSON("/containers/json", url.Values{"all": {"1"}}, &items); err != nil {
+		return nil, err
+	}
+
+	containers := make([]Container, 0, len(items))
+	for _, item := range items {
+		c := Container{
+			ID:     item.ID,
+			Image:  item.Image,
+			State:  item.State,
+			Health: healthFromStatus(item.Status),
+			Labels: item.Labels,
+		}
+		if len(item.Names) > 0 {
+			c.Name = strings.TrimPrefix(item.Names[0], "/")
+		}
+		if c.Labels == nil {
+			c.Labels = map[string]string{}
+		}
+		containers = append(containers, c)
+	}
+	return containers, nil
+}
+
+// healthFromStatus reads the health from the list endpoint's status text,
+// e.g. "Up 5 minutes (unhealthy)"; the list has no structured health field.
+func healthFromStatus(status string) string {
+	switch {
+	case strings.Contains(status, "(healthy)"):
+		return "healthy"
+	case strings.Contains(status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.Contains(status, "(health: starting)"):
+		return "starting"
+	default:
+		return ""
+	}
+}
+
+// Inspect returns the details of the given containers, one request each.
+func (api *apiClient) Inspect(ids ...string) ([]ContainerDetails, error) {
+	details := make([]ContainerDetails, 0, len(ids))
+	for _, id := range ids {
+		var item ContainerDetails
+		if err := api.getJSON("/containers/"+url.PathEscape(id)+"/json", nil, &item); err != nil {
+			return nil, fmt.Errorf("docker inspect failed for %s: %w", id, err)
+		}
+		details = append(details, item)
+	}
+	return details, nil
+}
+
+// Start starts the given containers; already running ones are not an error.
+func (api *apiClient) Start(ids ...string) error {
+	for _, id := range ids {
+		if err := api.send(api.timeout, http.MethodPost, "/containers/"+url.PathEscape(id)+"/start", nil, nil); err != nil {
+			return fmt.Errorf("docker start failed for %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Stop stops the given containers; already stopped ones are not an error.
+func (api *apiClient) Stop(ids ...string) error {
+	for _, id := range ids {
+		if err := api.send(api.stopTimeout, http.MethodPost, "/containers/"+url.PathEscape(id)+"/stop", nil, nil); err != nil {
+			return fmt.Errorf("docker stop failed for %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Remove force-removes the given containers.
+func (api *apiClient) Remove(ids ...string) error {
+	for _, id := range ids {
+		if err := api.send(api.timeout, http.MethodDelete, "/containers/"+url.PathEscape(id), url.Values{"force": {"1"}}, nil); err != nil {
+			return fmt.Errorf("docker rm failed for %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+type apiNetwork struct {
+	Name       string
+	Containers map[string]json.RawMessage
+}
+
+// network looks a network up by exact name; the name filter of the API
+// also matches substrings.
+func (api *apiClient) network(name string) (*apiNetwork, error) {
+	filters, _ := json.Marshal(map[string][]string{"name": {name}})
+	var networks []apiNetwork
+	if err := api.getJSON("/networks", url.Values{"filters": {string(filters)}}, &networks); err != nil {
+		return nil, err
+	}
+	for _, network := range networks {
+		if network.Name == name {
+			// The list endpoint leaves Containers empty; inspect has them.
+			var detailed apiNetwork
+			if err := api.getJSON("/networks/"+url.PathEscape(name), nil, &detailed); err != nil {
+				return nil, err
+			}
+			return &detailed, nil
+		}
+	}
+	return nil, nil
+}
+
+// NetworkExists reports whether a network with exactly this name exists.
+func (api *apiClient) NetworkExists(name string) (bool, error) {
+	network, err := api.network(name)
+	if err != nil {
+		return false, err
+	}
+	return network != nil, nil
+}
+
+// NetworkContainerCount returns how many containers are attached to a
+// network and whether the network exists.
+func (api *apiClient) NetworkContainerCount(name string) (int, bool, error) {
+	network, err := api.network(name)
+	if err != nil {
+		return 0, false, fmt.Errorf("docker network inspect failed for %s: %w", name, err)
+	}
+	if network == nil {
+		return 0, false, nil
+	}
+	return len(network.Containers), true, nil
+}
+
+// CreateNetwork creates a bridge network.
+func (api *apiClient) CreateNetwork(name string) error {
+	body, _ := json.Marshal(map[string]interface{}{"Name": name, "CheckDuplicate": true})
+	if err := api.send(api.timeout, http.MethodPost, "/networks/create", nil, strings.NewReader(string(body))); err != nil {
+		return fmt.Errorf("docker network create failed for %s: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveNetwork removes a network. The error mentions "has active endpoints"
+// when containers are still attached.
+func (api *apiClient) RemoveNetwork(name string) error {
+	if err := api.send(api.timeout, http.MethodDelete, "/networks/"+url.PathEscape(name), nil, nil); err != nil {
+		return fmt.Errorf("docker network rm failed for %s: %w", name, err)
+	}
+	return nil
+}
+
+// Events streams container events as JSON objects until the returned reader
+// is closed. Unlike the other requests it has no deadline.
+func (api *apiClient) Events(filters map[string][]string) (io.ReadCloser, error) {
+	encoded, _ := json.Marshal(filters)
+	resp, err := api.do(context.Background(), http.MethodGet, "/events", url.Values{"filters": {string(encoded)}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to follow docker events: %w", err)
+	}
+	return resp.Body, nil
+}
+
+func sortedKeys(values map[string][]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,153 @@
+package dockerutil
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serveSocket serves handler on a unix socket and returns an API client
+// for it.
+func serveSocket(t *testing.T, handler http.Handler) *apiClient {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return newAPIClient(socket)
+}
+
+func TestRequestsTimeOutOnAHungEngine(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	api := serveSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	api.timeout = 50 * time.Millisecond
+	api.stopTimeout = 50 * time.Millisecond
+
+	calls := map[string]func() error{
+		"containers": func() error { _, err := api.Containers(); return err },
+		"inspect":    func() error { _, err := api.Inspect("web"); return err },
+		"start":      func() error { return api.Start("web") },
+		"stop":       func() error { return api.Stop("web") },
+		"network":    func() error { _, err := api.NetworkExists("proxy"); return err },
+	}
+	for name, call := range calls {
+		done := make(chan error, 1)
+		go func() { done <- call() }()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("%s: no error from a hung engine", name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: still waiting for a hung engine", name)
+		}
+	}
+}
+
+func TestEventsOutliveTheRequestTimeout(t *testing.T) {
+	api := serveSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(150 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"status":"die"}` + "\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	api.timeout = 50 * time.Millisecond
+
+	events, err := api.Events(map[string][]string{"type": {"container"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Close()
+	line, err := bufio.NewReader(events).ReadString('\n')
+	if err != nil || line != `{"status":"die"}`+"\n" {
+		t.Fatalf("event = %q, %v; the stream was cut", line, err)
+	}
+}
+
+func TestEngineAPIClient(t *testing.T) {
+	api := serveSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			_, _ = io.WriteString(w, `[
+				{"Id": "c1", "Names": ["/web-web-1"], "Image": "nginx", "State": "running", "Status": "Up 5 minutes (unhealthy)", "Labels": {"konta.managed": "true", "com.docker.compose.project": "web"}},
+				{"Id": "c2", "Names": ["/db"], "State": "exited", "Status": "Exited (1) 2 hours ago"}
+			]`)
+		case "/containers/c1/json":
+			_, _ = io.WriteString(w, `{"Id": "c1", "Name": "/web-web-1", "State": {"Status": "running", "Health": {"Status": "unhealthy"}}, "Config": {"Image": "nginx", "Env": ["MODE=prod"]}}`)
+		case "/networks":
+			// The name filter matches substrings.
+			_, _ = io.WriteString(w, `[{"Name": "proxy-internal"}, {"Name": "proxy"}]`)
+		case "/networks/proxy":
+			_, _ = io.WriteString(w, `{"Name": "proxy", "Containers": {"c1": {}, "c3": {}}}`)
+		case "/containers/c9/start":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"message": "No such container: c9"}`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+
+	containers, err := api.Containers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 2 || containers[0].Name != "web-web-1" || containers[0].Health != "unhealthy" || !containers[0].Managed() || containers[0].Stack() != "web" {
+		t.Errorf("containers[0] = %+v", containers[0])
+	}
+	if containers[1].Health != "" || containers[1].Labels == nil || containers[1].Managed() {
+		t.Errorf("containers[1] = %+v", containers[1])
+	}
+
+	details, err := api.Inspect("c1")
+	if err != nil || len(details) != 1 || details[0].container().Health != "unhealthy" || details[0].Config.Env[0] != "MODE=prod" {
+		t.Errorf("inspect = %+v, %v", details, err)
+	}
+
+	if count, exists, err := api.NetworkContainerCount("proxy"); err != nil || !exists || count != 2 {
+		t.Errorf("proxy network = %d, %t, %v", count, exists, err)
+	}
+	if exists, err := api.NetworkExists("prox"); err != nil || exists {
+		t.Errorf("network matched by substring: %t, %v", exists, err)
+	}
+
+	err = api.Start("c9")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "No such container: c9" {
+		t.Errorf("start of a missing container: %v", err)
+	}
+	if err := api.Remove("c1"); err != nil {
+		t.Errorf("remove: %v", err)
+	}
+}
+
+func TestHealthFromStatus(t *testing.T) {
+	tests := map[string]string{
+		"Up 5 minutes (healthy)":          "healthy",
+		"Up 5 minutes (unhealthy)":        "unhealthy",
+		"Up 3 seconds (health: starting)": "starting",
+		"Up 2 days":                       "",
+		"Exited (0) 1 hour ago":           "",
+	}
+	for status, want := range tests {
+		if got := healthFromStatus(status); got != want {
+			t.Errorf("healthFromStatus(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package dockerutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Container is one entry of the container inventory.
+type Container struct {
+	ID     string
+	Name   string
+	Image  string
+	State  string // created, running, exited, restarting, ...
+	Health string // healthy, unhealthy, starting, or empty without healthcheck
+	Labels map[string]string
+}
+
+// Managed reports whether Konta manages the container (konta.managed=true).
+func (c Container) Managed() bool {
+	return c.Labels["konta.managed"] == "true"
+}
+
+// Stack returns the compose project of the container.
+func (c Container) Stack() string {
+	return c.Labels["com.docker.compose.project"]
+}
+
+// ContainerDetails is the part of a container inspect Konta reads. The CLI
+// (`docker inspect`) and the Engine API return the same document.
+type ContainerDetails struct {
+	ID           string `json:"Id"`
+	Name         string
+	RestartCount int
+	State        ContainerState
+	Config       ContainerConfig
+	Mounts       []ContainerMount
+}
+
+// ContainerState is the runtime state of an inspected container.
+type ContainerState struct {
+	Status    string
+	StartedAt string
+	Health    *struct {
+		Status string
+	}
+}
+
+// ContainerConfig is the configuration a container was created with.
+type ContainerConfig struct {
+	Image      string
+	Env        []string
+	Cmd        []string
+	Entrypoint []string
+	Labels     map[string]string
+}
+
+// ContainerMount is a volume or bind mount of a container.
+type ContainerMount struct {
+	Type   string
+	Source string
+}
+
+// container converts inspect details to an inventory entry.
+func (d ContainerDetails) container() Container {
+	c := Container{
+		ID:     d.ID,
+		Name:   strings.TrimPrefix(d.Name, "/"),
+		Image:  d.Config.Image,
+		State:  d.State.Status,
+		Labels: d.Config.Labels,
+	}
+	if d.State.Health != nil {
+		c.Health = d.State.Health.Status
+	}
+	if c.Labels == nil {
+		c.Labels = map[string]string{}
+	}
+	return c
+}
+
+// The methods below implement Client with the docker CLI. They are the
+// fallback when the Engine API socket is not reachable.
+
+// Containers lists all containers in any state with one `docker ps` and one
+// `docker inspect`.
+func (runner client) Containers() ([]Container, error) {
+	output, err := runner.Command("ps", "-aq", "--no-trunc").Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker ps failed: %w", err)
+	}
+
+	ids := strings.Fields(string(output))
+	details, err := runner.Inspect(ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]Container, 0, len(details))
+	for _, item := range details {
+		containers = append(containers, item.container())
+	}
+	return containers, nil
+}
+
+// Inspect returns the details of the given containers.
+func (runner client) Inspect(ids ...string) ([]ContainerDetails, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	output, err := runner.Command(append([]string{"inspect"}, ids...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker inspect failed: %w", err)
+	}
+
+	var details []ContainerDetails
+	if err := json.Unmarshal(output, &details); err != nil {
+		return nil, fmt.Errorf("failed to parse docker inspect output: %w", err)
+	}
+	return details, nil
+}
+
+// Start starts the given containers.
+func (runner client) Start(ids ...string) error {
+	return runner.run("start", ids...)
+}
+
+// Stop stops the given containers.
+func (runner client) Stop(ids ...string) error {
+	return runner.run("stop", ids...)
+}
+
+// Remove force-removes the given containers.
+func (runner client) Remove(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return runner.run("rm", append([]string{"-f"}, ids...)...)
+}
+
+func (runner client) run(action string, args ...string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	output, err := runner.Command(append([]string{action}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker %s failed: %w (%s)", action, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// NetworkExists reports whether a network with exactly this name exists.
+func (runner client) NetworkExists(name string) (bool, error) {
+	output, err := runner.Command("network", "ls", "--format", "{{.Name}}").Output()
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if strings.TrimSpace(line) == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NetworkContainerCount returns how many containers are attached to a
+// network and whether the network exists.
+func (runner client) NetworkContainerCount(name string) (int, bool, error) {
+	output, err := runner.Command("network", "inspect", name, "--format", "{{len .Containers}}").CombinedOutput()
+	if err != nil {
+		details := strings.ToLower(strings.TrimSpace(string(output)))
+		if strings.Contains(details, "no such network") {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("docker network inspect failed for %s: %w (%s)", name, err, strings.TrimSpace(string(output)))
+	}
+
+	countStr := strings.TrimSpace(string(output))
+	count, err := strconv.Atoi(countStr)
+	if err != nil {
+		return 0, true, fmt.Errorf("failed to parse container count for network %s: %w (raw=%q)", name, err, countStr)
+	}
+	return count, true, nil
+}
+
+// CreateNetwork creates a bridge network.
+func (runner client) CreateNetwork(name string) error {
+	return runner.run("network", "create", name)
+}
+
+// RemoveNetwork removes a network. The error mentions "has active endpoints"
+// when containers are still attached.
+func (runner client) RemoveNetwork(name string) error {
+	return runner.run("network", "rm", name)
+}
+
+// Events streams container events as JSON objects, one per line, until the
+// returned reader is closed. Filters use the `docker events --filter` keys.
+func (runner client) Events(filters map[string][]string) (io.ReadCloser, error) {
+	args := []string{"events", "--format", "{{json .}}"}
+	for _, key := range sortedKeys(filters) {
+		for _, value := range filters[key] {
+			args = append(args, "--filter", key+"="+value)
+		}
+	}
+
+	cmd := runner.Command(args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start docker events: %w", err)
+	}
+	return &commandStream{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// commandStream stops the command when the stream is closed.
+type commandStream struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (s *commandStream) Close() error {
+	_ = s.cmd.Process.Kill()
+	_ = s.ReadCloser.Close()
+	return s.cmd.Wait()
+}
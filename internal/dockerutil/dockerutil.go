@@ -1,15 +1,34 @@
 package dockerutil
 
 import (
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sync"
 )
 
+// Client runs docker. Compose always goes through the CLI; containers,
+// networks and events go through the Engine API when its socket is
+// reachable and through the CLI otherwise.
 type Client interface {
 	Command(args ...string) *exec.Cmd
 	ComposeCommand(args ...string) *exec.Cmd
+
+	// Containers lists all containers in any state.
+	Containers() ([]Container, error)
+	Inspect(ids ...string) ([]ContainerDetails, error)
+	Start(ids ...string) error
+	Stop(ids ...string) error
+	Remove(ids ...string) error
+
+	NetworkExists(name string) (bool, error)
+	NetworkContainerCount(name string) (int, bool, error)
+	CreateNetwork(name string) error
+	RemoveNetwork(name string) error
+
+	// Events streams JSON event objects matching the filters until closed.
+	Events(filters map[string][]string) (io.ReadCloser, error)
 }
 
 type client struct{}
@@ -28,39 +47,18 @@ var (
 	resolveComposeOnce sync.Once
 	resolvedComposeVia composeMode
 	defaultClient      Client = client{}
+	selectedClient     Client
+	selectClientOnce   sync.Once
 )
 
 func resolveDockerPath() {
-	if path, err := exec.LookPath("docker"); err == nil {
+	runtime := Runtime()
+	if path, err := exec.LookPath(runtime); err == nil {
 		resolvedDockerPath = path
 		return
 	}
 
-	candidates := []string{
-		"/usr/local/bin/docker",
-		"/opt/homebrew/bin/docker",
-		"/Applications/Docker.app/Contents/Resources/bin/docker",
-		"/usr/bin/docker",
-		"/bin/docker",
-	}
-
-	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
-		candidates = append(candidates, filepath.Join("/Users", sudoUser, ".docker", "bin", "docker"))
-	}
-
-	if user := os.Getenv("USER"); user != "" {
-		candidates = append(candidates, filepath.Join("/Users", user, ".docker", "bin", "docker"))
-	}
-
-	if home := os.Getenv("HOME"); home != "" {
-		candidates = append(candidates, filepath.Join(home, ".docker", "bin", "docker"))
-	}
-
-	if matches, err := filepath.Glob("/Users/*/.docker/bin/docker"); err == nil {
-		candidates = append(candidates, matches...)
-	}
-
-	for _, candidate := range candidates {
+	for _, candidate := range runtimeBinaryCandidates(runtime) {
 		if fi, err := os.Stat(candidate); err == nil && !fi.IsDir() {
 			resolvedDockerPath = candidate
 			return
@@ -68,30 +66,31 @@ func resolveDockerPath() {
 	}
 
 	// Keep default command name as last resort.
-	resolvedDockerPath = "docker"
+	resolvedDockerPath = runtime
 }
 
 func resolveComposePath() {
 	resolveOnce.Do(resolveDockerPath)
+	standalone := standaloneComposeName(Runtime())
 
-	// Prefer native `docker compose` when supported by the resolved docker CLI.
+	// Prefer native `docker compose` (or `podman compose`) when supported by the resolved CLI.
 	if err := exec.Command(resolvedDockerPath, "compose", "version").Run(); err == nil {
 		resolvedComposeVia = composeViaDocker
 		resolvedComposeBin = resolvedDockerPath
 		return
 	}
 
-	if path, err := exec.LookPath("docker-compose"); err == nil {
+	if path, err := exec.LookPath(standalone); err == nil {
 		resolvedComposeVia = composeViaStandalone
 		resolvedComposeBin = path
 		return
 	}
 
 	candidates := []string{
-		"/usr/local/bin/docker-compose",
-		"/opt/homebrew/bin/docker-compose",
-		"/usr/bin/docker-compose",
-		"/bin/docker-compose",
+		filepath.Join("/usr/local/bin", standalone),
+		filepath.Join("/opt/homebrew/bin", standalone),
+		filepath.Join("/usr/bin", standalone),
+		filepath.Join("/bin", standalone),
 	}
 
 	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
@@ -104,6 +103,7 @@ func resolveComposePath() {
 
 	if home := os.Getenv("HOME"); home != "" {
 		candidates = append(candidates, filepath.Join(home, ".docker", "cli-plugins", "docker-compose"))
+		candidates = append(candidates, filepath.Join(home, ".local", "bin", standalone))
 	}
 
 	for _, candidate := range candidates {
@@ -119,14 +119,41 @@ func resolveComposePath() {
 	resolvedComposeBin = resolvedDockerPath
 }
 
-// Command creates an exec.Cmd for docker using a resolved absolute path when possible.
+// Command creates an exec.Cmd for the runtime CLI (docker or podman) using a
+// resolved absolute path when possible.
 func Command(args ...string) *exec.Cmd {
 	return defaultClient.Command(args...)
 }
 
-// NewClient returns a docker client implementation that resolves docker binary path once.
+// NewClient returns the docker client. It talks to the Engine API of the
+// runtime when its socket answers a ping and falls back to the CLI otherwise,
+// or always when KONTA_DOCKER_API=off. The choice is made once per process.
 func NewClient() Client {
-	return client{}
+	selectClientOnce.Do(selectClient)
+	return selectedClient
+}
+
+func selectClient() {
+	selectedClient = client{}
+
+	if os.Getenv("KONTA_DOCKER_API") == "off" {
+		return
+	}
+	socket, ok := socketPath()
+	if !ok {
+		return
+	}
+	api := newAPIClient(socket)
+	if err := api.ping(); err != nil {
+		return
+	}
+	selectedClient = api
+}
+
+// UsesAPI reports whether the client talks to the Engine API.
+func UsesAPI(docker Client) bool {
+	_, ok := docker.(*apiClient)
+	return ok
 }
 
 // ComposeCommand creates an exec.Cmd for `docker compose` using a resolved absolute docker path.
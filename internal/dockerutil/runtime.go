@@ -0,0 +1,134 @@
+package dockerutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Container runtimes Konta can drive. Podman is used through its docker
+// compatible CLI and API.
+const (
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+)
+
+var (
+	runtimeMu      sync.Mutex
+	configuredName string
+	resolvedName   string // runtime in use once the first command ran
+)
+
+// SetRuntime selects the container runtime from the config. KONTA_RUNTIME
+// overrides it. The runtime is fixed once the first docker command ran;
+// changing it later is rejected and needs a restart.
+func SetRuntime(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name != "" && name != RuntimeDocker && name != RuntimePodman {
+		return fmt.Errorf("unknown runtime %q (use docker or podman)", name)
+	}
+
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+	previous := configuredName
+	configuredName = name
+	if resolvedName != "" && resolvedName != effectiveRuntime() {
+		configuredName = previous
+		return fmt.Errorf("runtime changed to %q: restart required, Konta keeps using %s until then", name, resolvedName)
+	}
+	return nil
+}
+
+// Runtime returns the selected runtime, docker by default.
+func Runtime() string {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+	if resolvedName == "" {
+		resolvedName = effectiveRuntime()
+	}
+	return resolvedName
+}
+
+func effectiveRuntime() string {
+	if env := strings.ToLower(strings.TrimSpace(os.Getenv("KONTA_RUNTIME"))); env == RuntimeDocker || env == RuntimePodman {
+		return env
+	}
+	if configuredName != "" {
+		return configuredName
+	}
+	return RuntimeDocker
+}
+
+// runtimeBinaryCandidates lists where the runtime CLI is usually installed
+// when it is not on PATH, e.g. under systemd or sudo.
+func runtimeBinaryCandidates(runtime string) []string {
+	if runtime == RuntimePodman {
+		return []string{
+			"/usr/bin/podman",
+			"/usr/local/bin/podman",
+			"/opt/homebrew/bin/podman",
+			"/opt/podman/bin/podman",
+		}
+	}
+
+	candidates := []string{
+		"/usr/local/bin/docker",
+		"/opt/homebrew/bin/docker",
+		"/Applications/Docker.app/Contents/Resources/bin/docker",
+		"/usr/bin/docker",
+		"/bin/docker",
+	}
+
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		candidates = append(candidates, filepath.Join("/Users", sudoUser, ".docker", "bin", "docker"))
+	}
+
+	if user := os.Getenv("USER"); user != "" {
+		candidates = append(candidates, filepath.Join("/Users", user, ".docker", "bin", "docker"))
+	}
+
+	if home := os.Getenv("HOME"); home != "" {
+		candidates = append(candidates, filepath.Join(home, ".docker", "bin", "docker"))
+		// Rootless Docker installed with the get.docker.com script.
+		candidates = append(candidates, filepath.Join(home, "bin", "docker"))
+	}
+
+	if matches, err := filepath.Glob("/Users/*/.docker/bin/docker"); err == nil {
+		candidates = append(candidates, matches...)
+	}
+
+	return candidates
+}
+
+// standaloneComposeName is the standalone compose binary of the runtime.
+func standaloneComposeName(runtime string) string {
+	if runtime == RuntimePodman {
+		return "podman-compose"
+	}
+	return "docker-compose"
+}
+
+// runtimeSockets lists the API sockets of the runtime in the order they are
+// tried: the system socket for root, the per-user socket otherwise.
+func runtimeSockets(runtime string) []string {
+	userDir := os.Getenv("XDG_RUNTIME_DIR")
+	if userDir == "" {
+		userDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+
+	if runtime == RuntimePodman {
+		if os.Geteuid() == 0 {
+			return []string{"/run/podman/podman.sock"}
+		}
+		return []string{filepath.Join(userDir, "podman", "podman.sock")}
+	}
+
+	if os.Geteuid() == 0 {
+		return []string{defaultSocket}
+	}
+	// Rootless Docker listens in the user's runtime dir; a user in the docker
+	// group talks to the system daemon.
+	return []string{filepath.Join(userDir, "docker.sock"), defaultSocket}
+}
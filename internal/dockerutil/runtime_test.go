@@ -0,0 +1,111 @@
+package dockerutil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// resetRuntime forgets the selected runtime, as a fresh process would.
+func resetRuntime(t *testing.T) {
+	t.Helper()
+	t.Setenv("KONTA_RUNTIME", "")
+	runtimeMu.Lock()
+	configuredName, resolvedName = "", ""
+	runtimeMu.Unlock()
+	t.Cleanup(func() {
+		runtimeMu.Lock()
+		configuredName, resolvedName = "", ""
+		runtimeMu.Unlock()
+	})
+}
+
+func TestRuntimeChangeNeedsRestart(t *testing.T) {
+	resetRuntime(t)
+
+	if err := SetRuntime("podman"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRuntime("docker"); err != nil {
+		t.Fatalf("runtime not used yet, change rejected: %v", err)
+	}
+	if got := Runtime(); got != RuntimeDocker {
+		t.Fatalf("Runtime() = %q", got)
+	}
+
+	err := SetRuntime("podman")
+	if err == nil || !strings.Contains(err.Error(), "restart required") {
+		t.Fatalf("SetRuntime after first use = %v, want restart required", err)
+	}
+	if got := Runtime(); got != RuntimeDocker {
+		t.Errorf("Runtime() = %q after a rejected change", got)
+	}
+	if err := SetRuntime(" Docker "); err != nil {
+		t.Errorf("unchanged runtime rejected: %v", err)
+	}
+}
+
+func TestRuntimeEnvironmentOverridesConfig(t *testing.T) {
+	resetRuntime(t)
+	t.Setenv("KONTA_RUNTIME", "podman")
+
+	if err := SetRuntime("docker"); err != nil {
+		t.Fatal(err)
+	}
+	if got := Runtime(); got != RuntimePodman {
+		t.Fatalf("Runtime() = %q, want KONTA_RUNTIME", got)
+	}
+	// The config cannot change the runtime KONTA_RUNTIME picked.
+	if err := SetRuntime("podman"); err != nil {
+		t.Errorf("SetRuntime = %v", err)
+	}
+}
+
+func TestRuntimeSockets(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+
+	docker := runtimeSockets(RuntimeDocker)
+	podman := runtimeSockets(RuntimePodman)
+	if os.Geteuid() == 0 {
+		if !reflect.DeepEqual(docker, []string{defaultSocket}) || !reflect.DeepEqual(podman, []string{"/run/podman/podman.sock"}) {
+			t.Errorf("root sockets = %v, %v", docker, podman)
+		}
+		return
+	}
+	if want := []string{"/run/user/1000/docker.sock", defaultSocket}; !reflect.DeepEqual(docker, want) {
+		t.Errorf("rootless docker sockets = %v, want %v", docker, want)
+	}
+	if want := []string{"/run/user/1000/podman/podman.sock"}; !reflect.DeepEqual(podman, want) {
+		t.Errorf("rootless podman sockets = %v, want %v", podman, want)
+	}
+}
+
+func TestRuntimeBinaries(t *testing.T) {
+	t.Setenv("HOME", "/home/deploy")
+
+	if got := standaloneComposeName(RuntimePodman); got != "podman-compose" {
+		t.Errorf("podman compose = %q", got)
+	}
+	if got := standaloneComposeName(RuntimeDocker); got != "docker-compose" {
+		t.Errorf("docker compose = %q", got)
+	}
+	for _, candidate := range runtimeBinaryCandidates(RuntimePodman) {
+		if filepath.Base(candidate) != "podman" {
+			t.Errorf("podman candidate %s", candidate)
+		}
+	}
+	if candidates := runtimeBinaryCandidates(RuntimeDocker); !contains(candidates, "/home/deploy/bin/docker") {
+		t.Errorf("docker candidates %v miss the rootless install", candidates)
+	}
+}
+
+func contains(list []string, item string) bool {
+	for _, candidate := range list {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,291 @@
+// Package events follows the Docker events stream of Konta-managed
+// containers, so the daemon heals an app shortly after its container dies
+// instead of at the next poll.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/talyguryn/konta/internal/dockerutil"
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/metrics"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// maxBackoff caps the wait before reconnecting to a failed stream.
+const maxBackoff = 5 * time.Minute
+
+// HealFunc checks and heals the apps of the given events. An error means the
+// heal could not run, e.g. a reconcile cycle holds the lock; the events are
+// then retried after the debounce.
+type HealFunc func(events []types.ContainerEvent) error
+
+// Watcher collects container events per app and calls the heal function once
+// an app has been quiet for the debounce time, at most once per cooldown.
+type Watcher struct {
+	docker   dockerutil.Client
+	debounce time.Duration
+	cooldown time.Duration
+	heal     HealFunc
+
+	mu        sync.Mutex
+	pending   map[string][]types.ContainerEvent
+	lastEvent map[string]time.Time
+	lastHeal  map[string]time.Time
+	connected bool
+}
+
+// New creates a watcher.
+func New(docker dockerutil.Client, debounce time.Duration, cooldown time.Duration, heal HealFunc) *Watcher {
+	return &Watcher{
+		docker:    docker,
+		debounce:  debounce,
+		cooldown:  cooldown,
+		heal:      heal,
+		pending:   make(map[string][]types.ContainerEvent),
+		lastEvent: make(map[string]time.Time),
+		lastHeal:  make(map[string]time.Time),
+	}
+}
+
+// Connected reports whether the events stream is currently followed.
+func (w *Watcher) Connected() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.connected
+}
+
+func (w *Watcher) setConnected(connected bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.connected = connected
+}
+
+// Run follows the events stream until stop is closed, reconnecting with
+// exponential backoff when the stream ends.
+func (w *Watcher) Run(stop <-chan struct{}) {
+	go w.dispatch(stop)
+
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := w.follow(stop)
+		w.setConnected(false)
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		// A stream that ran for a while was healthy; start over with a short wait.
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		logger.Warn("Docker events stream ended: %v (reconnecting in %s, polling health checks continue)", err, backoff)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// follow reads the events stream until it ends.
+func (w *Watcher) follow(stop <-chan struct{}) error {
+	stream, err := w.docker.Events(map[string][]string{
+		"type":  {"container"},
+		"label": {"konta.managed=true"},
+		"event": {"die", "oom", "health_status"},
+	})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			_ = stream.Close()
+		case <-done:
+		}
+	}()
+
+	w.setConnected(true)
+	logger.Info("Following Docker events of managed containers")
+
+	decoder := json.NewDecoder(stream)
+	for {
+		var msg message
+		if err := decoder.Decode(&msg); err != nil {
+			_ = stream.Close()
+			if err == io.EOF {
+				return fmt.Errorf("stream closed")
+			}
+			return err
+		}
+
+		event, ok := parseEvent(msg)
+		if !ok {
+			continue
+		}
+		w.add(event)
+	}
+}
+
+// message is the part of an event object Konta reads. The Engine API and
+// `docker events --format '{{json .}}'` emit the same object.
+type message struct {
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// parseEvent converts one event. Healthy and starting health statuses and
+// containers labeled konta.stopped=true are ignored.
+func parseEvent(msg message) (types.ContainerEvent, bool) {
+	attributes := msg.Actor.Attributes
+	if attributes["konta.stopped"] == "true" {
+		return types.ContainerEvent{}, false
+	}
+
+	action := msg.Action
+	switch {
+	case action == "die", action == "oom":
+	case strings.HasPrefix(action, "health_status") && strings.HasSuffix(action, "unhealthy"):
+		action = "unhealthy"
+	default:
+		return types.ContainerEvent{}, false
+	}
+
+	app := attributes["konta.app"]
+	if app == "" {
+		app = attributes["com.docker.compose.project"]
+	}
+	if app == "" {
+		return types.ContainerEvent{}, false
+	}
+
+	eventTime := time.Now()
+	if msg.TimeNano > 0 {
+		eventTime = time.Unix(0, msg.TimeNano)
+	}
+
+	event := types.ContainerEvent{
+		Time:      eventTime.Format(time.RFC3339),
+		App:       app,
+		Stack:     attributes["com.docker.compose.project"],
+		Service:   attributes["com.docker.compose.service"],
+		Container: attributes["name"],
+		Action:    action,
+	}
+	if action == "die" {
+		event.ExitCode = attributes["exitCode"]
+	}
+	return event, true
+}
+
+func (w *Watcher) add(event types.ContainerEvent) {
+	metrics.ObserveContainerEvent(event.Action)
+	logger.With(logger.Fields{"app": event.App, "service": event.Service, "container": event.Container}).Info("Container event: %s%s", event.Action, exitCodeSuffix(event))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[event.App] = append(w.pending[event.App], event)
+	w.lastEvent[event.App] = time.Now()
+}
+
+func exitCodeSuffix(event types.ContainerEvent) string {
+	if event.ExitCode == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (exit code %s)", event.ExitCode)
+}
+
+// dispatch hands debounced events to the heal function.
+func (w *Watcher) dispatch(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		events := w.due(time.Now())
+		if len(events) == 0 {
+			continue
+		}
+
+		if err := w.heal(events); err != nil {
+			logger.Debug("Event-triggered health check postponed: %v", err)
+			w.requeue(events)
+			continue
+		}
+
+		w.mu.Lock()
+		now := time.Now()
+		for _, event := range events {
+			w.lastHeal[event.App] = now
+		}
+		w.mu.Unlock()
+	}
+}
+
+// due takes the events of apps that were quiet for the debounce time and are
+// out of their cooldown.
+func (w *Watcher) due(now time.Time) []types.ContainerEvent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	apps := make([]string, 0, len(w.pending))
+	for app := range w.pending {
+		if now.Sub(w.lastEvent[app]) < w.debounce {
+			continue
+		}
+		if last, ok := w.lastHeal[app]; ok && now.Sub(last) < w.cooldown {
+			continue
+		}
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	events := make([]types.ContainerEvent, 0)
+	for _, app := range apps {
+		events = append(events, w.pending[app]...)
+		delete(w.pending, app)
+	}
+	return events
+}
+
+// requeue puts events back; they become due again after the debounce.
+func (w *Watcher) requeue(events []types.ContainerEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	requeued := make(map[string][]types.ContainerEvent)
+	for _, event := range events {
+		requeued[event.App] = append(requeued[event.App], event)
+	}
+	now := time.Now()
+	for app, appEvents := range requeued {
+		w.pending[app] = append(appEvents, w.pending[app]...)
+		w.lastEvent[app] = now
+	}
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+func eventMessage(action string, attributes map[string]string) message {
+	var msg message
+	msg.Action = action
+	msg.Actor.Attributes = attributes
+	msg.TimeNano = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).UnixNano()
+	return msg
+}
+
+func TestParseEvent(t *testing.T) {
+	attributes := map[string]string{
+		"konta.app":                  "web",
+		"com.docker.compose.project": "web-0123abcd",
+		"com.docker.compose.service": "app",
+		"name":                       "web-0123abcd-app-1",
+		"exitCode":                   "137",
+	}
+
+	event, ok := parseEvent(eventMessage("die", attributes))
+	want := types.ContainerEvent{
+		Time:      time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).Local().Format(time.RFC3339),
+		App:       "web",
+		Stack:     "web-0123abcd",
+		Service:   "app",
+		Container: "web-0123abcd-app-1",
+		Action:    "die",
+		ExitCode:  "137",
+	}
+	if !ok || event != want {
+		t.Errorf("die = %+v, %t, want %+v", event, ok, want)
+	}
+
+	if event, ok := parseEvent(eventMessage("health_status: unhealthy", attributes)); !ok || event.Action != "unhealthy" || event.ExitCode != "" {
+		t.Errorf("unhealthy = %+v, %t", event, ok)
+	}
+
+	// Stacks deployed before the konta.app label count as their project.
+	legacy := map[string]string{"com.docker.compose.project": "api"}
+	if event, ok := parseEvent(eventMessage("oom", legacy)); !ok || event.App != "api" {
+		t.Errorf("oom without konta.app = %+v, %t", event, ok)
+	}
+
+	ignored := []message{
+		eventMessage("health_status: healthy", attributes),
+		eventMessage("start", attributes),
+		eventMessage("die", map[string]string{"konta.app": "web", "konta.stopped": "true"}),
+		eventMessage("die", map[string]string{"name": "unmanaged"}),
+	}
+	for _, msg := range ignored {
+		if event, ok := parseEvent(msg); ok {
+			t.Errorf("%s %v parsed as %+v", msg.Action, msg.Actor.Attributes, event)
+		}
+	}
+}
+
+func TestDueWaitsForTheDebounceAndCooldown(t *testing.T) {
+	w := New(nil, 10*time.Second, time.Minute, nil)
+	w.add(types.ContainerEvent{App: "web", Action: "die"})
+	w.add(types.ContainerEvent{App: "web", Action: "die"})
+	w.add(types.ContainerEvent{App: "api", Action: "oom"})
+	now := time.Now()
+
+	if events := w.due(now); len(events) != 0 {
+		t.Errorf("due before the debounce = %+v", events)
+	}
+
+	// The heal sees every event of an app at once, grouped by app.
+	events := w.due(now.Add(11 * time.Second))
+	if len(events) != 3 || events[0].App != "api" || events[1].App != "web" || events[2].App != "web" {
+		t.Fatalf("due after the debounce = %+v", events)
+	}
+	if events := w.due(now.Add(11 * time.Second)); len(events) != 0 {
+		t.Errorf("events handed out twice: %+v", events)
+	}
+
+	w.lastHeal["web"] = now.Add(11 * time.Second)
+	w.add(types.ContainerEvent{App: "web", Action: "die"})
+	if events := w.due(now.Add(30 * time.Second)); len(events) != 0 {
+		t.Errorf("due within the cooldown = %+v", events)
+	}
+	if events := w.due(now.Add(80 * time.Second)); len(events) != 1 {
+		t.Errorf("due after the cooldown = %+v", events)
+	}
+}
+
+func TestRequeueRestartsTheDebounce(t *testing.T) {
+	w := New(nil, 10*time.Second, 0, nil)
+	w.add(types.ContainerEvent{App: "web", Action: "die", ExitCode: "1"})
+	events := w.due(time.Now().Add(11 * time.Second))
+
+	w.add(types.ContainerEvent{App: "web", Action: "die", ExitCode: "2"})
+	w.requeue(events)
+	if events := w.due(time.Now().Add(5 * time.Second)); len(events) != 0 {
+		t.Errorf("requeued events due before the debounce: %+v", events)
+	}
+	requeued := w.due(time.Now().Add(11 * time.Second))
+	if len(requeued) != 2 || requeued[0].ExitCode != "1" || requeued[1].ExitCode != "2" {
+		t.Errorf("requeued events = %+v, want the old one first", requeued)
+	}
+}
+
+func TestDispatchRequeuesWhenTheHealCannotRun(t *testing.T) {
+	calls := make(chan []types.ContainerEvent, 2)
+	failing := true
+	w := New(nil, 0, 0, func(events []types.ContainerEvent) error {
+		calls <- events
+		if failing {
+			failing = false
+			return errors.New("lock held")
+		}
+		return nil
+	})
+	w.add(types.ContainerEvent{App: "web", Action: "die"})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go w.dispatch(stop)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		select {
+		case events := <-calls:
+			if len(events) != 1 || events[0].App != "web" {
+				t.Fatalf("attempt %d: events = %+v", attempt, events)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("attempt %d: heal not called", attempt)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Package forge reports deploys to the forge that hosts the repository:
+// GitHub, GitLab or Gitea and Forgejo, on their public instances or self-hosted.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/talyguryn/konta/internal/githubdeploy"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// Forges, as set in repository.forge. Forgejo is a fork of Gitea with the
+// same API and is reported as Gitea.
+const (
+	GitHub  = "github"
+	GitLab  = "gitlab"
+	Gitea   = "gitea"
+	Forgejo = "forgejo"
+)
+
+// DefaultStatusContext names the commit status of a whole deploy cycle.
+const DefaultStatusContext = "konta/deploy"
+
+// Reporter reports a deploy as commit statuses, a deployment and a commit
+// comment. States use GitHub's names (pending, in_progress, success,
+// failure); the other forges map them to their own.
+type Reporter interface {
+	// CreateDeploymentAndMarkInProgress creates a deployment of ref in
+	// environment and marks it in progress. It returns 0 when the forge has
+	// no deployments.
+	CreateDeploymentAndMarkInProgress(ctx context.Context, ref, environment string) (int64, error)
+	CreateDeploymentStatus(ctx context.Context, deploymentID int64, state, description string) error
+	// CreateCommitStatus reports a commit status under statusContext, e.g.
+	// konta/deploy or konta/<host>/<app>, so it does not replace the others.
+	CreateCommitStatus(ctx context.Context, sha, statusContext, state, description, targetURL string) error
+	CreateCommitComment(ctx context.Context, sha, body string) error
+	CompareURL(base, head string) string
+	CommitURL(sha string) string
+}
+
+var _ Reporter = (*githubdeploy.Client)(nil)
+
+// New creates a reporter for the forge of the repository, authorized with
+// repository.token.
+func New(conf types.RepositoryConf) (Reporter, error) {
+	switch Detect(conf) {
+	case "":
+		ref, err := parseRepoURL(conf.URL)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("cannot tell which forge hosts %s: set repository.forge to github, gitlab, gitea or forgejo", ref.host)
+	case GitLab:
+		client, err := newGitLab(conf)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case Gitea:
+		client, err := newGitea(conf)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	client, err := githubdeploy.New(conf)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Detect returns the forge of the repository: repository.forge when set,
+// otherwise a guess from the host of its URL. It returns "" for hosts that
+// name no forge: a self-hosted instance needs repository.forge, as GitHub
+// Enterprise Server is not told apart from the others by its host.
+func Detect(conf types.RepositoryConf) string {
+	switch forge := strings.ToLower(strings.TrimSpace(conf.Forge)); forge {
+	case GitHub, GitLab, Gitea:
+		return forge
+	case Forgejo:
+		return Gitea
+	}
+	if conf.GitHubApp != (types.GitHubAppConf{}) {
+		return GitHub
+	}
+
+	ref, err := parseRepoURL(conf.URL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(ref.host)
+	switch {
+	case host == "github.com":
+		return GitHub
+	case strings.Contains(host, "gitlab"):
+		return GitLab
+	case host == "codeberg.org", strings.Contains(host, "gitea"), strings.Contains(host, "forgejo"):
+		return Gitea
+	}
+	return ""
+}
+
+// CompareURL builds a compare link for the repository without requiring a
+// token. It returns an empty string when the URL is not of a known forge
+// layout.
+func CompareURL(conf types.RepositoryConf, base, head string) string {
+	switch Detect(conf) {
+	case GitLab:
+		ref, err := parseRepoURL(conf.URL)
+		if err != nil {
+			return ""
+		}
+		return compareURL(ref.webURL()+"/-", base, head)
+	case Gitea:
+		ref, err := parseRepoURL(conf.URL)
+		if err != nil || len(strings.Split(ref.path, "/")) != 2 {
+			return ""
+		}
+		return compareURL(ref.webURL(), base, head)
+	case GitHub:
+		return githubdeploy.RepoCompareURL(conf.URL, base, head)
+	}
+	return ""
+}
+
+func compareURL(webURL, base, head string) string {
+	base = strings.TrimSpace(base)
+	head = strings.TrimSpace(head)
+	if base == "" || head == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/compare/%s...%s", webURL, base, head)
+}
+
+func commitURL(webURL, sha string) string {
+	sha = strings.TrimSpace(sha)
+	if sha == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/commit/%s", webURL, sha)
+}
+
+// repoRef is a repository on any forge. Its path has two segments on GitHub
+// and Gitea, and may have more on GitLab, whose groups nest.
+type repoRef struct {
+	scheme string
+	host   string
+	path   string
+}
+
+func (r repoRef) webURL() string {
+	return fmt.Sprintf("%s://%s/%s", r.scheme, r.host, r.path)
+}
+
+// apiURL returns the API of the repository's forge: override when set,
+// otherwise the web address of the host followed by defaultPath.
+func (r repoRef) apiURL(override string, defaultPath string) string {
+	if override = strings.TrimRight(strings.TrimSpace(override), "/"); override != "" {
+		return override
+	}
+	return fmt.Sprintf("%s://%s%s", r.scheme, r.host, defaultPath)
+}
+
+// parseRepoURL accepts https URLs and the SSH forms git@host:path and
+// ssh://git@host/path.
+func parseRepoURL(repoURL string) (repoRef, error) {
+	repoURL = strings.TrimSpace(repoURL)
+	if repoURL == "" {
+		return repoRef{}, fmt.Errorf("repository url is empty")
+	}
+
+	ref := repoRef{scheme: "https"}
+	var path string
+	if at := strings.Index(repoURL, "@"); at >= 0 && !strings.Contains(repoURL, "://") {
+		hostAndPath := repoURL[at+1:]
+		colon := strings.Index(hostAndPath, ":")
+		if colon < 0 {
+			return repoRef{}, fmt.Errorf("invalid repository url: %s", repoURL)
+		}
+		ref.host, path = hostAndPath[:colon], hostAndPath[colon+1:]
+	} else {
+		parsed, err := url.Parse(repoURL)
+		if err != nil {
+			return repoRef{}, fmt.Errorf("failed to parse repository url: %w", err)
+		}
+		switch parsed.Scheme {
+		case "http", "https":
+			ref.scheme = parsed.Scheme
+		case "ssh":
+		default:
+			return repoRef{}, fmt.Errorf("forge reporting needs an http(s) or ssh repository url, got %s", repoURL)
+		}
+		ref.host, path = parsed.Hostname(), parsed.Path
+		if parsed.Scheme != "ssh" && parsed.Port() != "" {
+			ref.host = parsed.Host
+		}
+	}
+
+	ref.path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if ref.host == "" || !strings.Contains(ref.path, "/") || strings.Contains(ref.path, "//") {
+		return repoRef{}, fmt.Errorf("invalid repository url: %s", repoURL)
+	}
+	return ref, nil
+}
+
+// apiClient sends JSON requests to the API of a forge other than GitHub.
+type apiClient struct {
+	forge         string // used in errors, e.g. gitlab
+	authorization string // value of the Authorization header
+	http          *http.Client
+}
+
+// doJSON sends a request; a nil payload sends no body.
+func (c apiClient) doJSON(ctx context.Context, method, endpoint string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		bodyBytes, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s request body: %w", c.forge, err)
+		}
+		body = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", c.forge, err)
+	}
+	req.Header.Set("Authorization", c.authorization)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s api request failed: %w", c.forge, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		msg := strings.TrimSpace(string(respBody))
+		if msg == "" {
+			msg = resp.Status
+		}
+		return &APIError{Forge: c.forge, StatusCode: resp.StatusCode, Message: msg, RetryAt: rateLimitReset(resp, time.Now())}
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", c.forge, err)
+		}
+	}
+	return nil
+}
+
+// APIError is an error response of the GitLab or Gitea API.
+type APIError struct {
+	Forge      string
+	StatusCode int
+	Message    string
+	RetryAt    time.Time // when a rate limit allows the next request; zero if not rate limited
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s api error (%d): %s", e.Forge, e.StatusCode, e.Message)
+}
+
+// rateLimitReset reads when a rate-limited request may be retried, from
+// Retry-After or the reset time GitLab sends as RateLimit-Reset and Gitea
+// as X-RateLimit-Reset.
+func rateLimitReset(resp *http.Response, now time.Time) time.Time {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	for _, prefix := range []string{"RateLimit-", "X-RateLimit-"} {
+		if resp.Header.Get(prefix+"Remaining") != "0" {
+			continue
+		}
+		if reset, err := strconv.ParseInt(resp.Header.Get(prefix+"Reset"), 10, 64); err == nil {
+			return time.Unix(reset, 0)
+		}
+	}
+	return time.Time{}
+}
+
+func trimDescription(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) <= 140 {
+		return value
+	}
+	return value[:137] + "..."
+}
@@ -0,0 +1,78 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		conf types.RepositoryConf
+		want string
+	}{
+		{"github.com", types.RepositoryConf{URL: "https://github.com/acme/infra"}, GitHub},
+		{"github.com over ssh", types.RepositoryConf{URL: "git@github.com:acme/infra.git"}, GitHub},
+		{"gitlab.com", types.RepositoryConf{URL: "https://gitlab.com/acme/infra"}, GitLab},
+		{"self-hosted gitlab", types.RepositoryConf{URL: "https://gitlab.example.com/acme/infra"}, GitLab},
+		{"codeberg", types.RepositoryConf{URL: "https://codeberg.org/acme/infra"}, Gitea},
+		{"self-hosted forgejo", types.RepositoryConf{URL: "ssh://git@forgejo.example.com/acme/infra.git"}, Gitea},
+		{"unknown host", types.RepositoryConf{URL: "https://git.example.com/acme/infra"}, ""},
+		{"enterprise server is not guessed", types.RepositoryConf{URL: "https://ghe.example.com/acme/infra"}, ""},
+		{"forge set", types.RepositoryConf{URL: "https://ghe.example.com/acme/infra", Forge: " GitHub "}, GitHub},
+		{"forgejo reported as gitea", types.RepositoryConf{URL: "https://git.example.com/acme/infra", Forge: "forgejo"}, Gitea},
+		{"forge overrides the host", types.RepositoryConf{URL: "https://gitlab.example.com/acme/infra", Forge: "gitea"}, Gitea},
+		{"github app implies github", types.RepositoryConf{URL: "https://git.example.com/acme/infra", GitHubApp: types.GitHubAppConf{AppID: 1}}, GitHub},
+		{"malformed url", types.RepositoryConf{URL: "not a url"}, ""},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.conf); got != tt.want {
+			t.Errorf("%s: Detect(%q) = %q, want %q", tt.name, tt.conf.URL, got, tt.want)
+		}
+	}
+}
+
+func TestNewRequiresForgeForUnknownHosts(t *testing.T) {
+	conf := types.RepositoryConf{URL: "https://git.example.com/acme/infra", Token: "secret"}
+	if _, err := New(conf); err == nil || !strings.Contains(err.Error(), "repository.forge") {
+		t.Fatalf("New() error = %v, want a hint to set repository.forge", err)
+	}
+	if got := CompareURL(conf, "aaa", "bbb"); got != "" {
+		t.Errorf("CompareURL() = %q for an unknown forge, want none", got)
+	}
+
+	conf.Forge = GitHub
+	reporter, err := New(conf)
+	if err != nil {
+		t.Fatalf("New() with repository.forge: %v", err)
+	}
+	if got := reporter.CompareURL("aaa", "bbb"); got != "https://git.example.com/acme/infra/compare/aaa...bbb" {
+		t.Errorf("CompareURL() = %q", got)
+	}
+}
+
+func TestAPIErrorsCarryTheRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Remaining", "0")
+		w.Header().Set("RateLimit-Reset", "1893456000")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	reporter, err := New(types.RepositoryConf{URL: "https://gitlab.com/acme/infra", Token: "glpat", APIURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reporter.CreateCommitStatus(context.Background(), "abc123", "konta/deploy", "success", "", "")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || !apiErr.RetryAt.Equal(time.Unix(1893456000, 0)) {
+		t.Errorf("err = %#v", err)
+	}
+}
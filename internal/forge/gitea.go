@@ -0,0 +1,93 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// giteaClient reports to Gitea and Forgejo, including Codeberg. Their API
+// has commit statuses, but no deployments and no commit comments, so those
+// are skipped.
+type giteaClient struct {
+	api    apiClient
+	apiURL string
+	webURL string
+	owner  string
+	repo   string
+}
+
+func newGitea(conf types.RepositoryConf) (*giteaClient, error) {
+	ref, err := parseRepoURL(conf.URL)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(ref.path, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid gitea repository url: %s", conf.URL)
+	}
+	if strings.TrimSpace(conf.Token) == "" {
+		return nil, fmt.Errorf("gitea token is empty")
+	}
+
+	return &giteaClient{
+		api: apiClient{
+			forge:         Gitea,
+			authorization: "token " + conf.Token,
+			http:          &http.Client{Timeout: 15 * time.Second},
+		},
+		apiURL: ref.apiURL(conf.APIURL, "/api/v1"),
+		webURL: ref.webURL(),
+		owner:  parts[0],
+		repo:   parts[1],
+	}, nil
+}
+
+// giteaState maps a commit status state; Gitea has no in_progress.
+func giteaState(state string) string {
+	if state == "in_progress" {
+		return "pending"
+	}
+	return state
+}
+
+func (c *giteaClient) CreateDeploymentAndMarkInProgress(ctx context.Context, ref, environment string) (int64, error) {
+	return 0, nil
+}
+
+func (c *giteaClient) CreateDeploymentStatus(ctx context.Context, deploymentID int64, state, description string) error {
+	return nil
+}
+
+func (c *giteaClient) CreateCommitStatus(ctx context.Context, sha, statusContext, state, description, targetURL string) error {
+	type request struct {
+		State       string `json:"state"`
+		Context     string `json:"context"`
+		Description string `json:"description,omitempty"`
+		TargetURL   string `json:"target_url,omitempty"`
+	}
+
+	body := request{
+		State:       giteaState(state),
+		Context:     statusContext,
+		Description: trimDescription(description),
+		TargetURL:   strings.TrimSpace(targetURL),
+	}
+	return c.api.doJSON(ctx, http.MethodPost, fmt.Sprintf("%s/repos/%s/%s/statuses/%s", c.apiURL, c.owner, c.repo, sha), body, nil)
+}
+
+func (c *giteaClient) CreateCommitComment(ctx context.Context, sha, body string) error {
+	return nil
+}
+
+func (c *giteaClient) CompareURL(base, head string) string {
+	return compareURL(c.webURL, base, head)
+}
+
+func (c *giteaClient) CommitURL(sha string) string {
+	return commitURL(c.webURL, sha)
+}
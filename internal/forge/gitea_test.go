@@ -0,0 +1,39 @@
+package forge
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+func TestGiteaClient(t *testing.T) {
+	server, requests := recordingServer(t, `{}`)
+	reporter, err := New(types.RepositoryConf{URL: "https://codeberg.org/acme/infra.git", Token: "gitea-token", APIURL: server.URL + "/api/v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Deployments and comments do not exist on Gitea and are skipped.
+	if id, err := reporter.CreateDeploymentAndMarkInProgress(ctx, "abc123", "production"); err != nil || id != 0 {
+		t.Errorf("deployment = %d, %v", id, err)
+	}
+	if err := reporter.CreateCommitComment(ctx, "abc123", "deployed"); err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 200)
+	if err := reporter.CreateCommitStatus(ctx, "abc123", "konta/deploy", "in_progress", long, "https://example.com/run"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `POST /api/v1/repos/acme/infra/statuses/abc123 token gitea-token {"state":"pending","context":"konta/deploy","description":"` + strings.Repeat("x", 137) + `...","target_url":"https://example.com/run"}`
+	if len(*requests) != 1 || (*requests)[0] != want {
+		t.Errorf("requests = %q\nwant %q", *requests, want)
+	}
+
+	if _, err := New(types.RepositoryConf{URL: "https://codeberg.org/acme/infra"}); err == nil {
+		t.Error("no error without a token")
+	}
+}
@@ -0,0 +1,131 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// gitLabClient reports to gitlab.com or a self-hosted GitLab through its
+// REST API v4.
+type gitLabClient struct {
+	api     apiClient
+	apiURL  string
+	webURL  string
+	project string // URL-encoded path, e.g. group%2Fsubgroup%2Frepo
+	branch  string
+}
+
+func newGitLab(conf types.RepositoryConf) (*gitLabClient, error) {
+	ref, err := parseRepoURL(conf.URL)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(conf.Token) == "" {
+		return nil, fmt.Errorf("gitlab token is empty")
+	}
+
+	return &gitLabClient{
+		api: apiClient{
+			forge:         GitLab,
+			authorization: "Bearer " + conf.Token,
+			http:          &http.Client{Timeout: 15 * time.Second},
+		},
+		apiURL:  ref.apiURL(conf.APIURL, "/api/v4"),
+		webURL:  ref.webURL(),
+		project: url.PathEscape(ref.path),
+		branch:  conf.Branch,
+	}, nil
+}
+
+// gitLabState maps a commit status state. GitLab has no in_progress and
+// calls failures failed.
+func gitLabState(state string) string {
+	switch state {
+	case "in_progress":
+		return "running"
+	case "failure", "error":
+		return "failed"
+	}
+	return state
+}
+
+// CreateDeploymentAndMarkInProgress creates a running deployment. GitLab
+// deployments need the branch along with the commit.
+func (c *gitLabClient) CreateDeploymentAndMarkInProgress(ctx context.Context, ref, environment string) (int64, error) {
+	type request struct {
+		Environment string `json:"environment"`
+		SHA         string `json:"sha"`
+		Ref         string `json:"ref"`
+		Tag         bool   `json:"tag"`
+		Status      string `json:"status"`
+	}
+
+	body := request{
+		Environment: environment,
+		SHA:         ref,
+		Ref:         c.branch,
+		Status:      "running",
+	}
+
+	var out struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.api.doJSON(ctx, http.MethodPost, c.endpoint("/deployments"), body, &out); err != nil {
+		return 0, err
+	}
+	if out.ID == 0 {
+		return 0, fmt.Errorf("gitlab deployment response missing deployment id")
+	}
+	return out.ID, nil
+}
+
+// CreateDeploymentStatus updates the status of a deployment. GitLab keeps
+// no description with it.
+func (c *gitLabClient) CreateDeploymentStatus(ctx context.Context, deploymentID int64, state, description string) error {
+	body := map[string]string{"status": gitLabState(state)}
+	return c.api.doJSON(ctx, http.MethodPut, c.endpoint(fmt.Sprintf("/deployments/%d", deploymentID)), body, nil)
+}
+
+func (c *gitLabClient) CreateCommitStatus(ctx context.Context, sha, statusContext, state, description, targetURL string) error {
+	type request struct {
+		State       string `json:"state"`
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		TargetURL   string `json:"target_url,omitempty"`
+	}
+
+	body := request{
+		State:       gitLabState(state),
+		Name:        statusContext,
+		Description: trimDescription(description),
+		TargetURL:   strings.TrimSpace(targetURL),
+	}
+	return c.api.doJSON(ctx, http.MethodPost, c.endpoint("/statuses/"+sha), body, nil)
+}
+
+func (c *gitLabClient) CreateCommitComment(ctx context.Context, sha, body string) error {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return fmt.Errorf("comment body is empty")
+	}
+	request := map[string]string{"note": body}
+	return c.api.doJSON(ctx, http.MethodPost, c.endpoint(fmt.Sprintf("/repository/commits/%s/comments", sha)), request, nil)
+}
+
+func (c *gitLabClient) CompareURL(base, head string) string {
+	return compareURL(c.webURL+"/-", base, head)
+}
+
+func (c *gitLabClient) CommitURL(sha string) string {
+	return commitURL(c.webURL+"/-", sha)
+}
+
+func (c *gitLabClient) endpoint(path string) string {
+	return fmt.Sprintf("%s/projects/%s%s", c.apiURL, c.project, path)
+}
@@ -0,0 +1,63 @@
+package forge
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// recordingServer answers every request with response and records each as
+// "METHOD escaped-path authorization body".
+func recordingServer(t *testing.T, response string) (*httptest.Server, *[]string) {
+	t.Helper()
+	requests := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, strings.Join([]string{r.Method, r.URL.EscapedPath(), r.Header.Get("Authorization"), strings.TrimSpace(string(body))}, " "))
+		_, _ = io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestGitLabClient(t *testing.T) {
+	server, requests := recordingServer(t, `{"id": 42}`)
+	reporter, err := New(types.RepositoryConf{URL: "git@gitlab.example.com:acme/ops/infra.git", Branch: "main", Token: "glpat", APIURL: server.URL + "/api/v4/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	id, err := reporter.CreateDeploymentAndMarkInProgress(ctx, "abc123", "production")
+	if err != nil || id != 42 {
+		t.Fatalf("deployment = %d, %v", id, err)
+	}
+	if err := reporter.CreateDeploymentStatus(ctx, id, "failure", "ignored"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reporter.CreateCommitStatus(ctx, "abc123", "konta/deploy", "in_progress", " deploying ", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := reporter.CreateCommitComment(ctx, "abc123", "deployed"); err != nil {
+		t.Fatal(err)
+	}
+
+	project := "/api/v4/projects/acme%2Fops%2Finfra"
+	want := []string{
+		`POST ` + project + `/deployments Bearer glpat {"environment":"production","sha":"abc123","ref":"main","tag":false,"status":"running"}`,
+		`PUT ` + project + `/deployments/42 Bearer glpat {"status":"failed"}`,
+		`POST ` + project + `/statuses/abc123 Bearer glpat {"state":"running","name":"konta/deploy","description":"deploying"}`,
+		`POST ` + project + `/repository/commits/abc123/comments Bearer glpat {"note":"deployed"}`,
+	}
+	if strings.Join(*requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(*requests, "\n"), strings.Join(want, "\n"))
+	}
+	if got := reporter.CompareURL("aaa", "bbb"); got != "https://gitlab.example.com/acme/ops/infra/-/compare/aaa...bbb" {
+		t.Errorf("CompareURL() = %q", got)
+	}
+}
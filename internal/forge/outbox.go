@@ -0,0 +1,477 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/talyguryn/konta/internal/githubdeploy"
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// Reports that could not be delivered are retried with backoff from
+// outboxRetryMin, doubling up to outboxRetryMax, until they are
+// outboxMaxAge old. A status that old no longer tells anyone anything.
+const (
+	outboxRetryMin = 30 * time.Second
+	outboxRetryMax = 30 * time.Minute
+	outboxMaxAge   = 24 * time.Hour
+)
+
+// reportTimeout bounds the delivery of one report.
+const reportTimeout = 30 * time.Second
+
+// DeliveryTimeout is how long a one-shot command waits for reports still
+// being delivered in the background before it exits.
+const DeliveryTimeout = time.Minute
+
+const (
+	reportStatus     = "status"
+	reportDeployment = "deployment"
+	reportComment    = "comment"
+)
+
+// outboxItem is a report waiting for delivery. Items with the same key
+// report the same thing, e.g. the konta/deploy status of a commit, so a
+// newer one replaces an older one that is still waiting. Items with the same
+// scope, e.g. the production environment, but another commit are superseded
+// the same way: a report about an older deploy must not land after one about
+// a newer deploy.
+type outboxItem struct {
+	Seq         int64     `json:"seq"`
+	Kind        string    `json:"kind"`
+	Key         string    `json:"key"`
+	Scope       string    `json:"scope,omitempty"`
+	Repository  string    `json:"repository"`
+	SHA         string    `json:"sha"`
+	Context     string    `json:"context,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	State       string    `json:"state,omitempty"`
+	Description string    `json:"description,omitempty"`
+	TargetURL   string    `json:"target_url,omitempty"`
+	Body        string    `json:"body,omitempty"`
+	Created     time.Time `json:"created"`
+	Attempts    int       `json:"attempts,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+func (i outboxItem) String() string {
+	switch i.Kind {
+	case reportStatus:
+		return fmt.Sprintf("%s status %s of %s", i.State, i.Context, shortSHA(i.SHA))
+	case reportDeployment:
+		return fmt.Sprintf("%s deployment status of %s in %s", i.State, shortSHA(i.SHA), i.Environment)
+	}
+	return "comment on " + shortSHA(i.SHA)
+}
+
+// outboxDeployment remembers the forge's id of a deployment, so later
+// statuses of it can be delivered. Forges without deployments have id 0.
+type outboxDeployment struct {
+	ID      int64     `json:"id"`
+	Updated time.Time `json:"updated"`
+}
+
+type outboxFile struct {
+	Seq         int64                       `json:"seq"`
+	PausedUntil time.Time                   `json:"paused_until,omitempty"`
+	Items       []outboxItem                `json:"items,omitempty"`
+	Deployments map[string]outboxDeployment `json:"deployments,omitempty"`
+}
+
+// Outbox persists reports to the forge before delivering them, so a forge
+// that is down or rate limiting during a deploy gets them later instead of
+// leaving the commit pending. Reports are delivered in the background right
+// away, so a slow forge never holds up a deploy, and retried by Flush. All
+// methods are safe to call on a nil Outbox.
+type Outbox struct {
+	path       string
+	reporter   Reporter
+	repository string
+
+	mu      sync.Mutex
+	running bool // a background delivery is running
+	again   bool // reports were added since it started
+}
+
+var (
+	outboxMu  sync.Mutex // guards the outbox file
+	deliverMu sync.Mutex // one delivery at a time, so no report is sent twice
+	inFlight  sync.WaitGroup
+)
+
+// NewOutbox opens the outbox file at path for reports to the forge of the
+// repository.
+func NewOutbox(path string, conf types.RepositoryConf) (*Outbox, error) {
+	reporter, err := New(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &Outbox{path: path, reporter: reporter, repository: conf.URL}, nil
+}
+
+// Reporter returns the reporter the outbox delivers with.
+func (o *Outbox) Reporter() Reporter {
+	return o.reporter
+}
+
+// PendingReports returns the number of undelivered reports in the outbox
+// file at path.
+func PendingReports(path string) int {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	return len(loadOutbox(path).Items)
+}
+
+// CommitStatus reports a commit status under statusContext.
+func (o *Outbox) CommitStatus(sha, statusContext, state, description, targetURL string) {
+	o.add(outboxItem{
+		Kind:        reportStatus,
+		Key:         fmt.Sprintf("%s|%s|%s", reportStatus, sha, statusContext),
+		Scope:       fmt.Sprintf("%s|%s", reportStatus, statusContext),
+		SHA:         sha,
+		Context:     statusContext,
+		State:       state,
+		Description: description,
+		TargetURL:   targetURL,
+	})
+}
+
+// Deployment reports the state of the deployment of sha in environment,
+// creating the deployment with its first report.
+func (o *Outbox) Deployment(sha, environment, state, description string) {
+	o.add(outboxItem{
+		Kind:        reportDeployment,
+		Key:         fmt.Sprintf("%s|%s|%s", reportDeployment, sha, environment),
+		Scope:       fmt.Sprintf("%s|%s", reportDeployment, environment),
+		SHA:         sha,
+		Environment: environment,
+		State:       state,
+		Description: description,
+	})
+}
+
+// CommitComment comments on a commit. Comments never replace each other.
+func (o *Outbox) CommitComment(sha, body string) {
+	o.add(outboxItem{
+		Kind: reportComment,
+		SHA:  sha,
+		Body: body,
+	})
+}
+
+// Flush delivers the reports that are due. The outbox file is not locked
+// while they are sent: reports added meanwhile are kept for the next pass.
+func (o *Outbox) Flush() {
+	if o == nil {
+		return
+	}
+	deliverMu.Lock()
+	defer deliverMu.Unlock()
+
+	outboxMu.Lock()
+	file := loadOutbox(o.path)
+	outboxMu.Unlock()
+	if len(file.Items) == 0 {
+		return
+	}
+
+	attempted := make(map[int64]bool, len(file.Items))
+	for _, item := range file.Items {
+		attempted[item.Seq] = true
+	}
+	o.deliver(file)
+	waiting := make(map[int64]outboxItem, len(file.Items))
+	for _, item := range file.Items {
+		waiting[item.Seq] = item
+	}
+
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	current := loadOutbox(o.path)
+	items := make([]outboxItem, 0, len(current.Items))
+	for _, item := range current.Items {
+		if retry, ok := waiting[item.Seq]; ok {
+			items = append(items, retry)
+		} else if !attempted[item.Seq] {
+			items = append(items, item)
+		}
+	}
+	current.Items = items
+	current.PausedUntil = file.PausedUntil
+	current.Deployments = file.Deployments
+	o.save(current)
+}
+
+// Wait waits up to timeout for reports still being delivered in the
+// background and reports whether they all finished. Reports not delivered
+// by then stay in the outbox for the next cycle.
+func Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		logger.Warn("Gave up waiting for forge reports after %s", timeout)
+		return false
+	}
+}
+
+// add persists a report and starts delivering it in the background.
+func (o *Outbox) add(item outboxItem) {
+	if o == nil {
+		return
+	}
+	o.persist(item)
+	o.deliverInBackground()
+}
+
+// deliverInBackground flushes the outbox in a goroutine, once more when
+// reports were added while it ran.
+func (o *Outbox) deliverInBackground() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.running {
+		o.again = true
+		return
+	}
+	o.running = true
+
+	inFlight.Add(1)
+	go func() {
+		defer inFlight.Done()
+		for {
+			o.Flush()
+			o.mu.Lock()
+			if !o.again {
+				o.running = false
+				o.mu.Unlock()
+				return
+			}
+			o.again = false
+			o.mu.Unlock()
+		}
+	}()
+}
+
+func (o *Outbox) persist(item outboxItem) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	file := loadOutbox(o.path)
+	file.Seq++
+	item.Seq = file.Seq
+	item.Repository = o.repository
+	item.Created = time.Now()
+	if item.Key == "" {
+		item.Key = fmt.Sprintf("%s|%d", item.Kind, item.Seq)
+	}
+	item.Key = o.repository + "|" + item.Key
+	if item.Scope != "" {
+		item.Scope = o.repository + "|" + item.Scope
+	}
+
+	items := make([]outboxItem, 0, len(file.Items)+1)
+	for _, queued := range file.Items {
+		if queued.Key == item.Key {
+			logger.Debug("Replacing undelivered %s with %s", queued, item)
+			continue
+		}
+		if item.Scope != "" && queued.Scope == item.Scope && queued.SHA != item.SHA {
+			logger.Info("Dropping undelivered %s, superseded by %s", queued, item)
+			continue
+		}
+		items = append(items, queued)
+	}
+	file.Items = append(items, item)
+	o.save(file)
+}
+
+// deliver sends the due reports in the order they were made and keeps the
+// ones that failed for a retry. After a rate limit nothing is sent until it
+// resets; after a network error the rest waits for the next attempt.
+func (o *Outbox) deliver(file *outboxFile) {
+	now := time.Now()
+	paused := now.Before(file.PausedUntil)
+	if paused {
+		logger.Debug("Forge reports paused by a rate limit until %s", file.PausedUntil.Format(time.RFC3339))
+	}
+
+	remaining := make([]outboxItem, 0, len(file.Items))
+	for _, item := range file.Items {
+		switch {
+		case item.Repository != o.repository:
+			logger.Warn("Dropping %s: %s is no longer the configured repository", item, item.Repository)
+			continue
+		case now.Sub(item.Created) > outboxMaxAge:
+			logger.Warn("Dropping %s after %d failed attempts: %s", item, item.Attempts, item.LastError)
+			continue
+		case paused || now.Before(item.NextAttempt):
+			remaining = append(remaining, item)
+			continue
+		}
+
+		err := o.send(file, item, now)
+		if err == nil {
+			if item.Attempts > 0 {
+				logger.Info("Delivered %s after %d failed attempts", item, item.Attempts)
+			}
+			continue
+		}
+
+		var statusCode int
+		var retryAt time.Time
+		var githubErr *githubdeploy.APIError
+		var forgeErr *APIError
+		switch {
+		case errors.As(err, &githubErr):
+			statusCode, retryAt = githubErr.StatusCode, githubErr.RetryAt
+		case errors.As(err, &forgeErr):
+			statusCode, retryAt = forgeErr.StatusCode, forgeErr.RetryAt
+		default:
+			paused = true
+		}
+		if retryAt.IsZero() && isPermanent(statusCode) {
+			logger.Warn("Dropping %s, the forge rejected it: %v", item, err)
+			continue
+		}
+
+		item.Attempts++
+		item.LastError = err.Error()
+		delay := outboxBackoff(item.Attempts)
+		if retryAt.After(now) {
+			delay = retryAt.Sub(now)
+			file.PausedUntil = retryAt
+			paused = true
+		}
+		item.NextAttempt = now.Add(delay)
+		logger.Warn("Failed to deliver %s (attempt %d), retrying in %s: %v", item, item.Attempts, delay.Round(time.Second), err)
+		remaining = append(remaining, item)
+	}
+	file.Items = remaining
+
+	for key, deployment := range file.Deployments {
+		if now.Sub(deployment.Updated) > outboxMaxAge {
+			delete(file.Deployments, key)
+		}
+	}
+}
+
+func (o *Outbox) send(file *outboxFile, item outboxItem, now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+
+	switch item.Kind {
+	case reportStatus:
+		return o.reporter.CreateCommitStatus(ctx, item.SHA, item.Context, item.State, item.Description, item.TargetURL)
+	case reportComment:
+		return o.reporter.CreateCommitComment(ctx, item.SHA, item.Body)
+	}
+
+	deployment, created := file.Deployments[item.Key]
+	if !created {
+		id, err := o.reporter.CreateDeploymentAndMarkInProgress(ctx, item.SHA, item.Environment)
+		if id == 0 && err != nil {
+			return err
+		}
+		if file.Deployments == nil {
+			file.Deployments = make(map[string]outboxDeployment)
+		}
+		deployment = outboxDeployment{ID: id, Updated: now}
+		file.Deployments[item.Key] = deployment
+		if id != 0 {
+			logger.Info("Deployment started (id=%d, environment=%s)", id, item.Environment)
+		}
+		if err != nil || item.State == "in_progress" {
+			return err
+		}
+	}
+	if deployment.ID == 0 {
+		return nil
+	}
+	if err := o.reporter.CreateDeploymentStatus(ctx, deployment.ID, item.State, item.Description); err != nil {
+		return err
+	}
+	deployment.Updated = now
+	file.Deployments[item.Key] = deployment
+	return nil
+}
+
+// isPermanent reports whether a request failed in a way a retry does not
+// fix, e.g. an unknown commit. Auth errors are retried: a rotated token or
+// a GitHub App token renewed by the next cycle fixes them.
+func isPermanent(statusCode int) bool {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return statusCode >= 400 && statusCode < 500
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxRetryMin
+	for i := 1; i < attempts && delay < outboxRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > outboxRetryMax {
+		delay = outboxRetryMax
+	}
+	return delay
+}
+
+func loadOutbox(path string) *outboxFile {
+	file := &outboxFile{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("Failed to read forge outbox: %v", err)
+		}
+		return file
+	}
+	if err := json.Unmarshal(data, file); err != nil {
+		logger.Warn("Failed to parse forge outbox, starting a new one: %v", err)
+		return &outboxFile{}
+	}
+	return file
+}
+
+// save writes the outbox through a temporary file, so a crash never leaves
+// it half written.
+func (o *Outbox) save(file *outboxFile) {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		logger.Warn("Failed to marshal forge outbox: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(o.path), 0755); err != nil {
+		logger.Warn("Failed to save forge outbox: %v", err)
+		return
+	}
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		logger.Warn("Failed to save forge outbox: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		logger.Warn("Failed to save forge outbox: %v", err)
+	}
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
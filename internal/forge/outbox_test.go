@@ -0,0 +1,225 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeReporter records the reports it receives. fail decides the error of
+// each call; nil means every call succeeds.
+type fakeReporter struct {
+	mu    sync.Mutex
+	calls []string
+	fail  func(call string) error
+}
+
+func (f *fakeReporter) record(call string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	if f.fail != nil {
+		return f.fail(call)
+	}
+	return nil
+}
+
+func (f *fakeReporter) CreateDeploymentAndMarkInProgress(ctx context.Context, ref, environment string) (int64, error) {
+	if err := f.record(fmt.Sprintf("create %s %s", ref, environment)); err != nil {
+		return 0, err
+	}
+	return 5, nil
+}
+
+func (f *fakeReporter) CreateDeploymentStatus(ctx context.Context, deploymentID int64, state, description string) error {
+	return f.record(fmt.Sprintf("deployment %d %s", deploymentID, state))
+}
+
+func (f *fakeReporter) CreateCommitStatus(ctx context.Context, sha, statusContext, state, description, targetURL string) error {
+	return f.record(fmt.Sprintf("status %s %s %s", sha, statusContext, state))
+}
+
+func (f *fakeReporter) CreateCommitComment(ctx context.Context, sha, body string) error {
+	return f.record("comment " + sha)
+}
+
+func (f *fakeReporter) CompareURL(base, head string) string { return "" }
+func (f *fakeReporter) CommitURL(sha string) string         { return "" }
+
+func (f *fakeReporter) callList() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func newTestOutbox(path string, reporter Reporter) *Outbox {
+	return &Outbox{path: path, reporter: reporter, repository: "https://example.com/acme/site.git"}
+}
+
+// makeDue clears the backoff of every waiting report, as if it had passed.
+func makeDue(path string) {
+	file := loadOutbox(path)
+	file.PausedUntil = time.Time{}
+	for index := range file.Items {
+		file.Items[index].NextAttempt = time.Time{}
+	}
+	(&Outbox{path: path}).save(file)
+}
+
+// waitForDelivery waits for the deliveries add started in the background.
+func waitForDelivery(t *testing.T) {
+	t.Helper()
+	if !Wait(5 * time.Second) {
+		t.Fatal("background delivery did not finish")
+	}
+}
+
+func equalCalls(got, want []string) bool {
+	return fmt.Sprint(got) == fmt.Sprint(want)
+}
+
+func TestNewerCommitSupersedesOlderReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	down := true
+	reporter := &fakeReporter{fail: func(call string) error {
+		if down {
+			return &APIError{Forge: "test", StatusCode: http.StatusBadGateway, Message: "bad gateway"}
+		}
+		return nil
+	}}
+	outbox := newTestOutbox(path, reporter)
+
+	outbox.CommitStatus("aaa", DefaultStatusContext, "failure", "", "")
+	outbox.Deployment("aaa", "production", "failure", "")
+	outbox.CommitStatus("aaa", "konta/other", "success", "", "")
+	waitForDelivery(t)
+	if pending := PendingReports(path); pending != 3 {
+		t.Fatalf("pending = %d, want 3", pending)
+	}
+
+	down = false
+	outbox.CommitStatus("bbb", DefaultStatusContext, "pending", "", "")
+	outbox.Deployment("bbb", "production", "in_progress", "")
+	waitForDelivery(t)
+	makeDue(path)
+	outbox.Flush()
+
+	if pending := PendingReports(path); pending != 0 {
+		t.Errorf("pending = %d, want 0", pending)
+	}
+	calls := reporter.callList()
+	want := []string{
+		"status aaa konta/deploy failure",
+		"create aaa production",
+		"status aaa konta/other success",
+		"status bbb konta/deploy pending",
+		"create bbb production",
+		"status aaa konta/other success",
+	}
+	if !equalCalls(calls, want) {
+		t.Errorf("calls = %v\nwant    %v", calls, want)
+	}
+}
+
+func TestRateLimitPausesAllReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	resetAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	limited := true
+	reporter := &fakeReporter{fail: func(call string) error {
+		if limited {
+			return &APIError{Forge: "test", StatusCode: http.StatusForbidden, Message: "rate limited", RetryAt: resetAt}
+		}
+		return nil
+	}}
+	outbox := newTestOutbox(path, reporter)
+
+	outbox.CommitStatus("aaa", DefaultStatusContext, "success", "", "")
+	outbox.CommitComment("aaa", "deployed")
+	waitForDelivery(t)
+	outbox.Flush()
+
+	if calls := reporter.callList(); len(calls) != 1 {
+		t.Errorf("calls during the rate limit = %v, want only the first", calls)
+	}
+	if paused := loadOutbox(path).PausedUntil; !paused.Equal(resetAt) {
+		t.Errorf("paused until %s, want %s", paused, resetAt)
+	}
+	if pending := PendingReports(path); pending != 2 {
+		t.Errorf("pending = %d, want 2", pending)
+	}
+
+	limited = false
+	makeDue(path)
+	outbox.Flush()
+	if pending := PendingReports(path); pending != 0 {
+		t.Errorf("pending after the reset = %d, want 0", pending)
+	}
+}
+
+func TestReportsSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+
+	first := &fakeReporter{}
+	newTestOutbox(path, first).Deployment("aaa", "production", "in_progress", "")
+	waitForDelivery(t)
+
+	first.fail = func(call string) error { return errors.New("connection refused") }
+	newTestOutbox(path, first).CommitStatus("aaa", DefaultStatusContext, "success", "", "")
+	waitForDelivery(t)
+	if pending := PendingReports(path); pending != 1 {
+		t.Fatalf("pending = %d, want 1", pending)
+	}
+
+	// A new process delivers the waiting status and reuses the deployment
+	// the previous one created.
+	makeDue(path)
+	second := &fakeReporter{}
+	restarted := newTestOutbox(path, second)
+	restarted.Flush()
+	restarted.Deployment("aaa", "production", "success", "")
+	waitForDelivery(t)
+
+	want := []string{"status aaa konta/deploy success", "deployment 5 success"}
+	if calls := second.callList(); !equalCalls(calls, want) {
+		t.Errorf("calls after restart = %v, want %v", calls, want)
+	}
+	if pending := PendingReports(path); pending != 0 {
+		t.Errorf("pending = %d, want 0", pending)
+	}
+}
+
+func TestAddDoesNotWaitForTheForge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	release := make(chan struct{})
+	reporter := &fakeReporter{fail: func(call string) error {
+		<-release
+		return nil
+	}}
+	outbox := newTestOutbox(path, reporter)
+
+	start := time.Now()
+	outbox.CommitStatus("aaa", DefaultStatusContext, "pending", "", "")
+	outbox.CommitStatus("aaa", DefaultStatusContext, "success", "", "")
+	outbox.CommitComment("aaa", "deployed")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("adding reports to a hung forge took %s", elapsed)
+	}
+	if pending := PendingReports(path); pending == 0 {
+		t.Error("reports not persisted before delivery")
+	}
+
+	close(release)
+	waitForDelivery(t)
+	if pending := PendingReports(path); pending != 0 {
+		t.Errorf("pending = %d after delivery, want 0", pending)
+	}
+	calls := reporter.callList()
+	if last := calls[len(calls)-1]; last != "comment aaa" {
+		t.Errorf("calls = %v, want the comment last", calls)
+	}
+}
@@ -280,3 +280,43 @@ func ResolveLatestCommit(config *types.RepositoryConf) (string, error) {
 	return line, nil
 }
 
+// CloneAtRevision clones the configured branch with full history and checks
+// out the given revision (full or abbreviated commit hash). Used by commands
+// that inspect a commit other than the branch head.
+func CloneAtRevision(config *types.RepositoryConf, targetDir string, revision string) (string, error) {
+	logger.Debug("Cloning repository from %s (branch: %s) at %s", config.URL, config.Branch, revision)
+
+	var auth *http.BasicAuth
+	if config.Token != "" {
+		auth = &http.BasicAuth{
+			Username: "git",
+			Password: config.Token,
+		}
+	}
+
+	repo, err := gogit.PlainClone(targetDir, false, &gogit.CloneOptions{
+		URL:           config.URL,
+		ReferenceName: plumbing.NewBranchReferenceName(config.Branch),
+		SingleBranch:  true,
+		Auth:          auth,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return "", fmt.Errorf("commit %s not found on branch %s: %w", revision, config.Branch, err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	if err := wt.Checkout(&gogit.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+		return "", fmt.Errorf("failed to checkout %s: %w", revision, err)
+	}
+
+	return hash.String(), nil
+}
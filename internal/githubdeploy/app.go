@@ -0,0 +1,146 @@
+package githubdeploy
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// tokenRefreshMargin renews an installation token this long before it
+// expires, so a token never runs out in the middle of a cycle. GitHub issues
+// them for an hour.
+const tokenRefreshMargin = 10 * time.Minute
+
+type installationToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+var (
+	tokensMu sync.Mutex
+	tokens   = make(map[string]installationToken)
+)
+
+// InstallationToken returns a token of the GitHub App installation configured
+// in repository.github_app, for git fetches and the API. Tokens are cached
+// and renewed shortly before they expire.
+func InstallationToken(ctx context.Context, conf types.RepositoryConf) (string, error) {
+	app := conf.GitHubApp
+	if !app.Enabled() {
+		return "", fmt.Errorf("github app is not configured")
+	}
+	ref, err := parseGitHubRepo(conf.URL)
+	if err != nil {
+		return "", err
+	}
+	apiURL := apiBaseURL(ref, conf.APIURL)
+
+	key := fmt.Sprintf("%s|%d|%d|%s/%s", apiURL, app.AppID, app.InstallationID, ref.owner, ref.repo)
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	if cached, ok := tokens[key]; ok && time.Until(cached.expiresAt) > tokenRefreshMargin {
+		return cached.token, nil
+	}
+
+	privateKey, err := loadPrivateKey(app.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	jwt, err := appJWT(app.AppID, privateKey, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	installationID := app.InstallationID
+	if installationID == 0 {
+		var installation struct {
+			ID int64 `json:"id"`
+		}
+		endpoint := fmt.Sprintf("%s/repos/%s/%s/installation", apiURL, ref.owner, ref.repo)
+		if err := doJSON(ctx, client, jwt, http.MethodGet, endpoint, nil, &installation); err != nil {
+			return "", fmt.Errorf("failed to find the github app installation of %s/%s: %w", ref.owner, ref.repo, err)
+		}
+		if installation.ID == 0 {
+			return "", fmt.Errorf("github app installation response missing id")
+		}
+		installationID = installation.ID
+	}
+
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	endpoint := fmt.Sprintf("%s/app/installations/%d/access_tokens", apiURL, installationID)
+	if err := doJSON(ctx, client, jwt, http.MethodPost, endpoint, struct{}{}, &out); err != nil {
+		return "", fmt.Errorf("failed to create github app installation token: %w", err)
+	}
+	if out.Token == "" {
+		return "", fmt.Errorf("github app token response missing token")
+	}
+	if out.ExpiresAt.IsZero() {
+		out.ExpiresAt = time.Now().Add(time.Hour)
+	}
+
+	tokens[key] = installationToken{token: out.Token, expiresAt: out.ExpiresAt}
+	return out.Token, nil
+}
+
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read github app private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("github app private key %s is not PEM encoded", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse github app private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("github app private key must be an RSA key")
+	}
+	return key, nil
+}
+
+// appJWT signs the token that authenticates as the app itself. It is valid
+// for ten minutes at most; the issue time is set back a minute for clock
+// drift, as GitHub recommends.
+func appJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(appID, 10),
+	})
+
+	encoding := base64.RawURLEncoding
+	unsigned := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign github app jwt: %w", err)
+	}
+	return unsigned + "." + encoding.EncodeToString(signature), nil
+}
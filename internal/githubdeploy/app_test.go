@@ -0,0 +1,182 @@
+package githubdeploy
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// fakeGitHubApp serves the installation lookup and token endpoints and
+// checks that requests carry a JWT signed with the app key.
+type fakeGitHubApp struct {
+	t        *testing.T
+	key      *rsa.PrivateKey
+	mu       sync.Mutex
+	requests []string
+	issued   int
+}
+
+func (f *fakeGitHubApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	f.checkJWT(r.Header.Get("Authorization"))
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/acme/site/installation":
+		fmt.Fprint(w, `{"id": 77}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/app/installations/77/access_tokens":
+		f.issued++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      fmt.Sprintf("token-%d", f.issued),
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeGitHubApp) checkJWT(header string) {
+	parts := strings.Split(strings.TrimPrefix(header, "Bearer "), ".")
+	if len(parts) != 3 {
+		f.t.Errorf("authorization %q is not a bearer JWT", header)
+		return
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&f.key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		f.t.Errorf("JWT signature does not verify: %v", err)
+	}
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var parsed struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(claims, &parsed); err != nil || parsed.Issuer != "42" {
+		f.t.Errorf("JWT claims = %s, want iss 42", claims)
+	}
+}
+
+func (f *fakeGitHubApp) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+func writeAppKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "app.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key, path
+}
+
+func TestInstallationTokenIsIssuedCachedAndRefreshed(t *testing.T) {
+	key, keyPath := writeAppKey(t)
+	fake := &fakeGitHubApp{t: t, key: key}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	tokensMu.Lock()
+	tokens = make(map[string]installationToken)
+	tokensMu.Unlock()
+
+	conf := types.RepositoryConf{
+		URL:       "https://github.com/acme/site.git",
+		APIURL:    server.URL,
+		GitHubApp: types.GitHubAppConf{AppID: 42, PrivateKey: keyPath},
+	}
+	ctx := context.Background()
+
+	token, err := InstallationToken(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token-1" {
+		t.Errorf("token = %q, want token-1", token)
+	}
+	want := []string{"GET /repos/acme/site/installation", "POST /app/installations/77/access_tokens"}
+	if strings.Join(fake.requests, ",") != strings.Join(want, ",") {
+		t.Errorf("requests = %v, want %v", fake.requests, want)
+	}
+
+	token, err = InstallationToken(ctx, conf)
+	if err != nil || token != "token-1" {
+		t.Errorf("second call = %q, %v; want the cached token-1", token, err)
+	}
+	if count := fake.requestCount(); count != 2 {
+		t.Errorf("cached token made %d requests, want 2", count)
+	}
+
+	// A token close to expiry is renewed before it runs out.
+	tokensMu.Lock()
+	for cacheKey, cached := range tokens {
+		cached.expiresAt = time.Now().Add(tokenRefreshMargin / 2)
+		tokens[cacheKey] = cached
+	}
+	tokensMu.Unlock()
+
+	token, err = InstallationToken(ctx, conf)
+	if err != nil || token != "token-2" {
+		t.Errorf("call near expiry = %q, %v; want a fresh token-2", token, err)
+	}
+}
+
+func TestInstallationTokenWithConfiguredInstallation(t *testing.T) {
+	key, keyPath := writeAppKey(t)
+	fake := &fakeGitHubApp{t: t, key: key}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	token, err := InstallationToken(context.Background(), types.RepositoryConf{
+		URL:       "git@github.com:acme/site.git",
+		APIURL:    server.URL + "/",
+		GitHubApp: types.GitHubAppConf{AppID: 42, InstallationID: 77, PrivateKey: keyPath},
+	})
+	if err != nil || token != "token-1" {
+		t.Fatalf("token = %q, %v", token, err)
+	}
+	if len(fake.requests) != 1 || fake.requests[0] != "POST /app/installations/77/access_tokens" {
+		t.Errorf("requests = %v, want only the token request", fake.requests)
+	}
+}
+
+func TestAPIBaseURL(t *testing.T) {
+	for _, test := range []struct {
+		url, override, want string
+	}{
+		{"https://github.com/acme/site.git", "", "https://api.github.com"},
+		{"git@github.com:acme/site.git", "", "https://api.github.com"},
+		{"https://ghe.example.com/acme/site.git", "", "https://ghe.example.com/api/v3"},
+		{"git@ghe.example.com:acme/site.git", "", "https://ghe.example.com/api/v3"},
+		{"ssh://git@ghe.example.com:2222/acme/site.git", "", "https://ghe.example.com/api/v3"},
+		{"https://ghe.example.com/acme/site.git", "https://api.ghe.example.com/", "https://api.ghe.example.com"},
+	} {
+		got, err := APIBaseURL(types.RepositoryConf{URL: test.url, APIURL: test.override})
+		if err != nil || got != test.want {
+			t.Errorf("APIBaseURL(%s, %q) = %q, %v; want %q", test.url, test.override, got, err, test.want)
+		}
+	}
+}
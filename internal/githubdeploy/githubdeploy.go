@@ -8,41 +8,72 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/talyguryn/konta/internal/types"
 )
 
 const (
-	apiBaseURL = "https://api.github.com"
+	githubHost       = "github.com"
+	githubAPIBaseURL = "https://api.github.com"
 )
 
 type Client struct {
-	owner string
-	repo  string
-	token string
-	http  *http.Client
+	owner  string
+	repo   string
+	token  string
+	apiURL string
+	webURL string
+	http   *http.Client
 }
 
-func New(repoURL, token string) (*Client, error) {
-	owner, repo, err := parseGitHubRepo(repoURL)
+// New creates a client for the repository of the config. It works with
+// github.com and GitHub Enterprise Server; see APIBaseURL.
+func New(conf types.RepositoryConf) (*Client, error) {
+	ref, err := parseGitHubRepo(conf.URL)
 	if err != nil {
 		return nil, err
 	}
 
-	if strings.TrimSpace(token) == "" {
+	if strings.TrimSpace(conf.Token) == "" {
 		return nil, fmt.Errorf("github token is empty")
 	}
 
 	return &Client{
-		owner: owner,
-		repo:  repo,
-		token: token,
+		owner:  ref.owner,
+		repo:   ref.repo,
+		token:  conf.Token,
+		apiURL: apiBaseURL(ref, conf.APIURL),
+		webURL: ref.webURL(),
 		http: &http.Client{
 			Timeout: 15 * time.Second,
 		},
 	}, nil
 }
 
+// APIBaseURL returns the REST API of the repository's GitHub: repository.api_url
+// when set, api.github.com for github.com and https://<host>/api/v3 for
+// GitHub Enterprise Server.
+func APIBaseURL(conf types.RepositoryConf) (string, error) {
+	ref, err := parseGitHubRepo(conf.URL)
+	if err != nil {
+		return "", err
+	}
+	return apiBaseURL(ref, conf.APIURL), nil
+}
+
+func apiBaseURL(ref repoRef, override string) string {
+	if override = strings.TrimRight(strings.TrimSpace(override), "/"); override != "" {
+		return override
+	}
+	if strings.EqualFold(ref.host, githubHost) {
+		return githubAPIBaseURL
+	}
+	return fmt.Sprintf("https://%s/api/v3", ref.host)
+}
+
 func (c *Client) CreateDeploymentAndMarkInProgress(ctx context.Context, ref, environment string) (int64, error) {
 	deploymentID, err := c.CreateDeployment(ctx, ref, environment)
 	if err != nil {
@@ -103,7 +134,9 @@ func (c *Client) CreateDeploymentStatus(ctx context.Context, deploymentID int64,
 	return c.doJSON(ctx, http.MethodPost, c.endpoint(fmt.Sprintf("/deployments/%d/statuses", deploymentID)), body, nil)
 }
 
-func (c *Client) CreateCommitStatus(ctx context.Context, sha, state, description, targetURL string) error {
+// CreateCommitStatus reports a commit status under its own context, e.g.
+// konta/<host>/<app>, so it does not replace the others.
+func (c *Client) CreateCommitStatus(ctx context.Context, sha, statusContext, state, description, targetURL string) error {
 	type request struct {
 		State       string `json:"state"`
 		Context     string `json:"context"`
@@ -113,7 +146,7 @@ func (c *Client) CreateCommitStatus(ctx context.Context, sha, state, description
 
 	body := request{
 		State:       state,
-		Context:     "konta/deploy",
+		Context:     statusContext,
 		Description: trimDescription(description),
 		TargetURL:   strings.TrimSpace(targetURL),
 	}
@@ -135,12 +168,26 @@ func (c *Client) CreateCommitComment(ctx context.Context, sha, body string) erro
 }
 
 func (c *Client) CompareURL(base, head string) string {
+	return compareURL(c.webURL, base, head)
+}
+
+// RepoCompareURL builds a compare link for a GitHub repository URL without requiring a token.
+// It returns an empty string for URLs that are not of a GitHub repository.
+func RepoCompareURL(repoURL, base, head string) string {
+	ref, err := parseGitHubRepo(repoURL)
+	if err != nil {
+		return ""
+	}
+	return compareURL(ref.webURL(), base, head)
+}
+
+func compareURL(webURL, base, head string) string {
 	base = strings.TrimSpace(base)
 	head = strings.TrimSpace(head)
 	if base == "" || head == "" {
 		return ""
 	}
-	return fmt.Sprintf("https://github.com/%s/%s/compare/%s...%s", c.owner, c.repo, base, head)
+	return fmt.Sprintf("%s/compare/%s...%s", webURL, base, head)
 }
 
 func (c *Client) CommitURL(sha string) string {
@@ -148,30 +195,41 @@ func (c *Client) CommitURL(sha string) string {
 	if sha == "" {
 		return ""
 	}
-	return fmt.Sprintf("https://github.com/%s/%s/commit/%s", c.owner, c.repo, sha)
+	return fmt.Sprintf("%s/commit/%s", c.webURL, sha)
 }
 
 func (c *Client) endpoint(path string) string {
-	return fmt.Sprintf("%s/repos/%s/%s%s", apiBaseURL, c.owner, c.repo, path)
+	return fmt.Sprintf("%s/repos/%s/%s%s", c.apiURL, c.owner, c.repo, path)
 }
 
 func (c *Client) doJSON(ctx context.Context, method, endpoint string, payload interface{}, out interface{}) error {
-	bodyBytes, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to encode github request body: %w", err)
+	return doJSON(ctx, c.http, c.token, method, endpoint, payload, out)
+}
+
+// doJSON sends a GitHub API request authorized with token, which is a
+// personal access token, an installation token or an app JWT. A nil payload
+// sends no body.
+func doJSON(ctx context.Context, client *http.Client, token string, method, endpoint string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		bodyBytes, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode github request body: %w", err)
+		}
+		body = bytes.NewReader(bodyBytes)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
 	if err != nil {
 		return fmt.Errorf("failed to create github request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/vnd.github+json")
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.http.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("github api request failed: %w", err)
 	}
@@ -183,7 +241,7 @@ func (c *Client) doJSON(ctx context.Context, method, endpoint string, payload in
 		if msg == "" {
 			msg = resp.Status
 		}
-		return fmt.Errorf("github api error (%d): %s", resp.StatusCode, msg)
+		return &APIError{StatusCode: resp.StatusCode, Message: msg, RetryAt: rateLimitReset(resp, time.Now())}
 	}
 
 	if out != nil {
@@ -195,39 +253,89 @@ func (c *Client) doJSON(ctx context.Context, method, endpoint string, payload in
 	return nil
 }
 
-func parseGitHubRepo(repoURL string) (string, string, error) {
-	repoURL = strings.TrimSpace(repoURL)
-	if repoURL == "" {
-		return "", "", fmt.Errorf("repository url is empty")
-	}
+// APIError is an error response of the GitHub API.
+type APIError struct {
+	StatusCode int
+	Message    string
+	RetryAt    time.Time // when a rate limit allows the next request; zero if not rate limited
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github api error (%d): %s", e.StatusCode, e.Message)
+}
 
-	if strings.HasPrefix(repoURL, "git@github.com:") {
-		path := strings.TrimPrefix(repoURL, "git@github.com:")
-		path = strings.TrimSuffix(path, ".git")
-		parts := strings.Split(path, "/")
-		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
-			return "", "", fmt.Errorf("invalid github repository url: %s", repoURL)
+// rateLimitReset reads when a rate-limited request may be retried: after
+// Retry-After for secondary rate limits, at X-RateLimit-Reset when the
+// primary limit is used up.
+func rateLimitReset(resp *http.Response, now time.Time) time.Time {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Unix(reset, 0)
 		}
-		return parts[0], parts[1], nil
 	}
+	return time.Time{}
+}
 
-	parsed, err := url.Parse(repoURL)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to parse repository url: %w", err)
+// repoRef is a repository on github.com or a GitHub Enterprise Server.
+type repoRef struct {
+	scheme string
+	host   string
+	owner  string
+	repo   string
+}
+
+func (r repoRef) webURL() string {
+	return fmt.Sprintf("%s://%s/%s/%s", r.scheme, r.host, r.owner, r.repo)
+}
+
+// parseGitHubRepo accepts https URLs and the SSH forms git@host:owner/repo
+// and ssh://git@host/owner/repo.
+func parseGitHubRepo(repoURL string) (repoRef, error) {
+	repoURL = strings.TrimSpace(repoURL)
+	if repoURL == "" {
+		return repoRef{}, fmt.Errorf("repository url is empty")
 	}
 
-	if !strings.EqualFold(parsed.Host, "github.com") {
-		return "", "", fmt.Errorf("github deployment status supports github.com repositories only")
+	ref := repoRef{scheme: "https"}
+	var path string
+	if at := strings.Index(repoURL, "@"); at >= 0 && !strings.Contains(repoURL, "://") {
+		hostAndPath := repoURL[at+1:]
+		colon := strings.Index(hostAndPath, ":")
+		if colon < 0 {
+			return repoRef{}, fmt.Errorf("invalid github repository url: %s", repoURL)
+		}
+		ref.host, path = hostAndPath[:colon], hostAndPath[colon+1:]
+	} else {
+		parsed, err := url.Parse(repoURL)
+		if err != nil {
+			return repoRef{}, fmt.Errorf("failed to parse repository url: %w", err)
+		}
+		switch parsed.Scheme {
+		case "http", "https":
+			ref.scheme = parsed.Scheme
+		case "ssh":
+		default:
+			return repoRef{}, fmt.Errorf("github reporting needs an http(s) or ssh repository url, got %s", repoURL)
+		}
+		ref.host, path = parsed.Hostname(), parsed.Path
+		if parsed.Scheme != "ssh" && parsed.Port() != "" {
+			ref.host = parsed.Host
+		}
 	}
 
-	path := strings.Trim(parsed.Path, "/")
-	path = strings.TrimSuffix(path, ".git")
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
 	parts := strings.Split(path, "/")
-	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
-		return "", "", fmt.Errorf("invalid github repository url: %s", repoURL)
+	if ref.host == "" || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return repoRef{}, fmt.Errorf("invalid github repository url: %s", repoURL)
 	}
-
-	return parts[0], parts[1], nil
+	ref.owner, ref.repo = parts[0], parts[1]
+	return ref, nil
 }
 
 func trimDescription(value string) string {
@@ -0,0 +1,143 @@
+package hooks
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// Event hooks are opt-in: each runs only when hooks.events lists it.
+const (
+	EventRollbackStarted   = "rollback_started"
+	EventRollbackCompleted = "rollback_completed"
+	EventSelfHeal          = "self_heal"
+	EventDriftDetected     = "drift_detected"
+	EventUpdateAvailable   = "update_available"
+	EventAppFailed         = "app_failed"
+)
+
+// AllEvents lists every event hook in the order they are documented.
+var AllEvents = []string{
+	EventRollbackStarted,
+	EventRollbackCompleted,
+	EventSelfHeal,
+	EventDriftDetected,
+	EventUpdateAvailable,
+	EventAppFailed,
+}
+
+// defaultRateLimits keep events that can repeat every cycle from flooding
+// their hooks. A rollback is rare and an update is reported once per version.
+var defaultRateLimits = map[string]time.Duration{
+	EventSelfHeal:      5 * time.Minute,
+	EventDriftDetected: time.Hour,
+	EventAppFailed:     5 * time.Minute,
+}
+
+// IsEvent reports whether name is a known event hook.
+func IsEvent(name string) bool {
+	for _, event := range AllEvents {
+		if event == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the JSON payload an event hook reads from stdin.
+type Event struct {
+	Type           string   `json:"event"`
+	Host           string   `json:"host"`
+	Time           string   `json:"time"`
+	App            string   `json:"app,omitempty"`
+	Apps           []string `json:"apps,omitempty"`
+	Commit         string   `json:"commit,omitempty"`
+	PreviousCommit string   `json:"previous_commit,omitempty"`
+	Stack          string   `json:"stack,omitempty"`
+	Reason         string   `json:"reason,omitempty"`
+	Status         string   `json:"status,omitempty"` // rollback_completed: completed, failed; self_heal: success, failure
+	Error          string   `json:"error,omitempty"`
+	Version        string   `json:"version,omitempty"`
+	LatestVersion  string   `json:"latest_version,omitempty"`
+}
+
+var (
+	rateMu  sync.Mutex
+	lastRun = make(map[string]time.Time)
+)
+
+func rateLimits(conf types.HooksConf) map[string]time.Duration {
+	limits := make(map[string]time.Duration)
+	for event, limit := range defaultRateLimits {
+		limits[event] = limit
+	}
+	for event, eventConf := range conf.Events {
+		if eventConf.RateLimitSeconds != nil {
+			limits[event] = time.Duration(*eventConf.RateLimitSeconds) * time.Second
+		}
+	}
+	return limits
+}
+
+// allow reports whether an event may run its hook now and records the run.
+// Events are limited per app, so one crashing app does not hide another.
+func (r *Runner) allow(event Event) bool {
+	limit := r.rateLimits[event.Type]
+	if limit <= 0 {
+		return true
+	}
+
+	key := event.Type + "/" + event.App
+	now := time.Now()
+
+	rateMu.Lock()
+	defer rateMu.Unlock()
+	if last, ok := lastRun[key]; ok && now.Sub(last) < limit {
+		return false
+	}
+	lastRun[key] = now
+	return true
+}
+
+// RunEvent runs the hook of an event with the event as JSON on stdin. It does
+// nothing when the event is not enabled or was run within its rate limit.
+// Like notifications, event hooks never affect the outcome of a cycle, so
+// failures are only logged.
+func (r *Runner) RunEvent(event Event) {
+	if r == nil || r.hookPaths[event.Type] == "" {
+		return
+	}
+	if !r.allow(event) {
+		logger.Debug("Skipping %s hook for %q: rate limited", event.Type, event.App)
+		return
+	}
+
+	if event.Host == "" {
+		event.Host, _ = os.Hostname()
+	}
+	if event.Time == "" {
+		event.Time = time.Now().Format(time.RFC3339)
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Warn("Failed to marshal %s hook payload: %v", event.Type, err)
+		return
+	}
+
+	eventRunner := *r
+	eventRunner.context = Context{
+		App:            event.App,
+		Commit:         event.Commit,
+		PreviousCommit: event.PreviousCommit,
+		Stack:          event.Stack,
+		ReleaseDir:     r.context.ReleaseDir,
+	}
+	env := []string{"KONTA_STATUS=" + event.Status, "KONTA_REASON=" + event.Reason, "KONTA_ERROR=" + event.Error}
+	if err := eventRunner.runWithInput(event.Type, env, payload); err != nil {
+		logger.Warn("%v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package hooks
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// eventHook enables an event hook that appends its payload, app and status
+// to a file, one run per line, and returns the runner and the file.
+func eventHook(t *testing.T, events map[string]types.HookEventConf) (*Runner, string) {
+	t.Helper()
+	rateMu.Lock()
+	lastRun = make(map[string]time.Time)
+	rateMu.Unlock()
+
+	repoDir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "runs")
+	writeHook(t, filepath.Join(repoDir, "hooks", "event.sh"), `printf '%s|%s|%s\n' "$(cat)" "$KONTA_APP" "$KONTA_STATUS" >> `+out+"\n", 0644)
+	for event, conf := range events {
+		conf.Path = "hooks/event.sh"
+		events[event] = conf
+	}
+	return New(repoDir, types.HooksConf{Events: events}), out
+}
+
+func runs(t *testing.T, out string) []string {
+	t.Helper()
+	data, err := os.ReadFile(out)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestRunEventPassesThePayload(t *testing.T) {
+	runner, out := eventHook(t, map[string]types.HookEventConf{EventRollbackCompleted: {}})
+
+	runner.RunEvent(Event{
+		Type:           EventRollbackCompleted,
+		Apps:           []string{"web", "api"},
+		Commit:         "abc123",
+		PreviousCommit: "def456",
+		Status:         "failed",
+		Error:          "compose up failed",
+	})
+	lines := runs(t, out)
+	if len(lines) != 1 {
+		t.Fatalf("runs = %q", lines)
+	}
+	fields := strings.Split(lines[0], "|")
+	if fields[1] != "" || fields[2] != "failed" {
+		t.Errorf("KONTA_APP, KONTA_STATUS = %q, %q", fields[1], fields[2])
+	}
+
+	var event Event
+	if err := json.Unmarshal([]byte(fields[0]), &event); err != nil {
+		t.Fatalf("payload %q: %v", fields[0], err)
+	}
+	if event.Type != EventRollbackCompleted || event.Host == "" || event.Time == "" || len(event.Apps) != 2 || event.Error != "compose up failed" {
+		t.Errorf("payload = %+v", event)
+	}
+
+	// Events that are not enabled, and runners of dry runs, do nothing.
+	runner.RunEvent(Event{Type: EventSelfHeal, App: "web"})
+	var dryRun *Runner
+	dryRun.RunEvent(Event{Type: EventRollbackCompleted})
+	if got := runs(t, out); len(got) != 1 {
+		t.Errorf("runs = %q, want only the enabled event", got)
+	}
+}
+
+func TestRunEventRateLimitsPerApp(t *testing.T) {
+	noLimit := 0
+	runner, out := eventHook(t, map[string]types.HookEventConf{
+		EventSelfHeal:        {},
+		EventAppFailed:       {RateLimitSeconds: &noLimit},
+		EventRollbackStarted: {},
+	})
+
+	for i := 0; i < 3; i++ {
+		runner.RunEvent(Event{Type: EventSelfHeal, App: "web", Status: "failure"})
+	}
+	runner.RunEvent(Event{Type: EventSelfHeal, App: "api", Status: "success"})
+	for i := 0; i < 2; i++ {
+		runner.RunEvent(Event{Type: EventAppFailed, App: "web"})
+		runner.RunEvent(Event{Type: EventRollbackStarted})
+	}
+
+	apps := make([]string, 0)
+	for _, line := range runs(t, out) {
+		var event Event
+		if err := json.Unmarshal([]byte(strings.Split(line, "|")[0]), &event); err != nil {
+			t.Fatal(err)
+		}
+		apps = append(apps, event.Type+"/"+event.App)
+	}
+	want := []string{
+		"self_heal/web", // the repeats within 5 minutes are skipped
+		"self_heal/api",
+		"app_failed/web", "rollback_started/",
+		"app_failed/web", "rollback_started/",
+	}
+	if strings.Join(apps, " ") != strings.Join(want, " ") {
+		t.Errorf("runs = %v, want %v", apps, want)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	hour := 3600
+	limits := rateLimits(types.HooksConf{Events: map[string]types.HookEventConf{EventSelfHeal: {RateLimitSeconds: &hour}}})
+	if limits[EventSelfHeal] != time.Hour || limits[EventDriftDetected] != time.Hour || limits[EventAppFailed] != 5*time.Minute {
+		t.Errorf("limits = %v", limits)
+	}
+	if limits[EventRollbackStarted] != 0 || limits[EventUpdateAvailable] != 0 {
+		t.Errorf("rollbacks and updates limited: %v", limits)
+	}
+	if !IsEvent(EventDriftDetected) || IsEvent("pre") {
+		t.Error("IsEvent")
+	}
+}
@@ -1,45 +1,131 @@
 package hooks
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/talyguryn/konta/internal/logger"
 	"github.com/talyguryn/konta/internal/types"
 )
 
+// DefaultTimeout applies when hooks.timeout_seconds is not set.
+const DefaultTimeout = 300 * time.Second
+
+// AppHooksDir is the directory of an app that holds its own hooks, e.g.
+// apps/web/.konta/pre.sh.
+const AppHooksDir = ".konta"
+
+// Context describes the deployment a hook runs for. It is passed to every
+// hook as KONTA_* environment variables.
+type Context struct {
+	App            string // KONTA_APP, empty for global hooks
+	Commit         string // KONTA_COMMIT
+	PreviousCommit string // KONTA_PREVIOUS_COMMIT
+	Stack          string // KONTA_STACK, the compose project of the app
+	ReleaseDir     string // KONTA_RELEASE_DIR
+}
+
 // Runner manages hook execution
 type Runner struct {
-	hookPaths map[string]string
-	repoDir   string
+	hookPaths  map[string]string
+	repoDir    string
+	timeout    time.Duration
+	rateLimits map[string]time.Duration
+	context    Context
 }
 
-// New creates a new hook runner
-func New(repoDir string, startedPath, prePath, successPath, failurePath, postUpdatePath string) *Runner {
+// New creates a runner for the global hooks of a release in repoDir,
+// including the event hooks enabled in conf.
+func New(repoDir string, conf types.HooksConf) *Runner {
+	hookPaths := map[string]string{
+		"started":     conf.StartedAbs,
+		"pre":         conf.PreAbs,
+		"success":     conf.SuccessAbs,
+		"failure":     conf.FailureAbs,
+		"post_update": conf.PostUpdateAbs,
+	}
+	for event, eventConf := range conf.Events {
+		if IsEvent(event) {
+			hookPaths[event] = eventConf.Path
+		}
+	}
+
+	return &Runner{
+		hookPaths:  hookPaths,
+		repoDir:    repoDir,
+		timeout:    timeout(conf),
+		rateLimits: rateLimits(conf),
+		context:    Context{ReleaseDir: repoDir},
+	}
+}
+
+// ForApp creates a runner for the hooks in the .konta directory of an app:
+// pre runs before the app is deployed and post after it. Hooks are found by
+// name with any extension, e.g. pre.sh or pre.py.
+func ForApp(appDir string, conf types.HooksConf) *Runner {
 	return &Runner{
 		hookPaths: map[string]string{
-			"started":     startedPath,
-			"pre":         prePath,
-			"success":     successPath,
-			"failure":     failurePath,
-			"post_update": postUpdatePath,
+			"app_pre":  findAppHook(appDir, "pre"),
+			"app_post": findAppHook(appDir, "post"),
 		},
-		repoDir: repoDir,
+		repoDir: appDir,
+		timeout: timeout(conf),
+	}
+}
+
+func timeout(conf types.HooksConf) time.Duration {
+	if conf.TimeoutSeconds > 0 {
+		return time.Duration(conf.TimeoutSeconds) * time.Second
 	}
+	return DefaultTimeout
+}
+
+func findAppHook(appDir string, name string) string {
+	dir := filepath.Join(appDir, AppHooksDir)
+	if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+		return filepath.Join(dir, name)
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, name+".*"))
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			return match
+		}
+	}
+	return ""
+}
+
+// SetContext sets the deployment passed to hooks in the environment. An
+// empty ReleaseDir keeps the directory the runner was created with.
+func (r *Runner) SetContext(hookContext Context) {
+	if hookContext.ReleaseDir == "" {
+		hookContext.ReleaseDir = r.context.ReleaseDir
+	}
+	r.context = hookContext
+}
+
+// HasAppHooks reports whether an app runner found any hook.
+func (r *Runner) HasAppHooks() bool {
+	return r.hookPaths["app_pre"] != "" || r.hookPaths["app_post"] != ""
 }
 
 // RunStarted runs the started hook (when konta daemon starts)
 func (r *Runner) RunStarted() error {
-	return r.run("started")
+	return r.run("started", nil)
 }
 
 // RunPre runs the pre-deploy hook
 func (r *Runner) RunPre() error {
-	return r.run("pre")
+	return r.run("pre", nil)
 }
 
 // RunSuccess runs the success hook
@@ -49,11 +135,11 @@ func (r *Runner) RunSuccess(result *types.ReconcileResult) error {
 	jsonData, err := json.Marshal(result)
 	if err != nil {
 		logger.Warn("Failed to marshal reconcile result: %v", err)
-		return r.run("success")
+		return r.run("success", nil)
 	}
 
 	payload := normalizeSuccessHookPayload(string(jsonData))
-	return r.run("success", payload)
+	return r.run("success", []string{"KONTA_RESULT=" + payload}, payload)
 }
 
 func normalizeSuccessHookPayload(payload string) string {
@@ -78,15 +164,37 @@ func normalizeSuccessHookPayload(payload string) string {
 // RunFailure runs the failure hook
 // errorMessage: the error message that caused the failure
 func (r *Runner) RunFailure(errorMessage string) error {
-	return r.run("failure", errorMessage)
+	return r.run("failure", []string{"KONTA_ERROR=" + errorMessage}, errorMessage)
 }
 
 // RunPostUpdate runs the post-update hook (executed after konta binary update)
-func (r *Runner) RunPostUpdate() error {
-	return r.run("post_update")
+// previousVersion and newVersion: the versions before and after the update
+func (r *Runner) RunPostUpdate(previousVersion string, newVersion string) error {
+	env := []string{"KONTA_PREVIOUS_VERSION=" + previousVersion, "KONTA_VERSION=" + newVersion}
+	return r.run("post_update", env, previousVersion, newVersion)
+}
+
+// RunAppPre runs the pre hook of an app. A failure aborts the app's deploy.
+func (r *Runner) RunAppPre() error {
+	return r.run("app_pre", nil)
+}
+
+// RunAppPost runs the post hook of an app with KONTA_STATUS set to success
+// or failure, and KONTA_ERROR to the deploy error.
+func (r *Runner) RunAppPost(deployErr error) error {
+	env := []string{"KONTA_STATUS=success"}
+	if deployErr != nil {
+		env = []string{"KONTA_STATUS=failure", "KONTA_ERROR=" + deployErr.Error()}
+	}
+	return r.run("app_post", env)
 }
 
-func (r *Runner) run(hookType string, args ...string) error {
+func (r *Runner) run(hookType string, env []string, args ...string) error {
+	return r.runWithInput(hookType, env, nil, args...)
+}
+
+// runWithInput runs a hook with input on its stdin, if any.
+func (r *Runner) runWithInput(hookType string, env []string, input []byte, args ...string) error {
 	hookPath := r.hookPaths[hookType]
 	if hookPath == "" {
 		logger.Debug("No %s hook configured", hookType)
@@ -99,31 +207,110 @@ func (r *Runner) run(hookType string, args ...string) error {
 	}
 
 	// Check if hook file exists
-	if _, err := os.Stat(hookPath); err != nil {
+	info, err := os.Stat(hookPath)
+	if err != nil {
 		logger.Warn("Hook file not found: %s", hookPath)
 		return nil
 	}
 
-	logger.Debug("Running %s hook: %s", hookType, hookPath)
+	fields := logger.Fields{"hook": hookType}
+	if r.context.App != "" {
+		fields["app"] = r.context.App
+	}
+	log := logger.With(fields)
+	log.Debug("Running hook: %s", hookPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
 
-	// Prepare command arguments: bash hook_script.sh [arg1] [arg2] ...
-	cmdArgs := append([]string{hookPath}, args...)
-	cmd := exec.Command("bash", cmdArgs...)
+	// Executable hooks run directly, with their own interpreter; others
+	// are shell scripts run with bash, as before.
+	var cmd *exec.Cmd
+	if info.Mode()&0111 != 0 {
+		cmd = exec.CommandContext(ctx, hookPath, args...)
+	} else {
+		cmd = exec.CommandContext(ctx, "bash", append([]string{hookPath}, args...)...)
+	}
 	cmd.Dir = r.repoDir
+	cmd.Env = append(append(os.Environ(), r.environment(hookType)...), env...)
+	killProcessGroup(cmd)
+	// A hook that leaves children holding its output open still returns.
+	cmd.WaitDelay = 5 * time.Second
 
-	// Suppress output for post_update hook, show output for other hooks
-	if hookType == "post_update" {
-		cmd.Stdout = nil
-		cmd.Stderr = nil
-	} else {
-		cmd.Stdout = os.Stderr
-		cmd.Stderr = os.Stderr
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
 	}
+	output := newLineLogger(log)
+	cmd.Stdout = output
+	cmd.Stderr = output
 
-	if err := cmd.Run(); err != nil {
+	err = cmd.Run()
+	output.Flush()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s hook timed out after %s", hookType, r.timeout)
+	}
+	if err != nil {
 		return fmt.Errorf("%s hook failed: %w", hookType, err)
 	}
 
-	logger.Debug("%s hook executed successfully", hookType)
+	log.Debug("Hook executed successfully")
 	return nil
 }
+
+func (r *Runner) environment(hookType string) []string {
+	return []string{
+		"KONTA_EVENT=" + hookType,
+		"KONTA_APP=" + r.context.App,
+		"KONTA_COMMIT=" + r.context.Commit,
+		"KONTA_PREVIOUS_COMMIT=" + r.context.PreviousCommit,
+		"KONTA_STACK=" + r.context.Stack,
+		"KONTA_RELEASE_DIR=" + r.context.ReleaseDir,
+	}
+}
+
+// lineLogger writes hook output to the log, one entry per line.
+type lineLogger struct {
+	mu      sync.Mutex
+	log     *logger.Entry
+	pending []byte
+}
+
+var _ io.Writer = (*lineLogger)(nil)
+
+func newLineLogger(log *logger.Entry) *lineLogger {
+	return &lineLogger{log: log}
+}
+
+func (l *lineLogger) Write(data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.pending = append(l.pending, data...)
+	for {
+		index := bytes.IndexByte(l.pending, '\n')
+		if index < 0 {
+			break
+		}
+		l.emit(string(l.pending[:index]))
+		l.pending = l.pending[index+1:]
+	}
+	return len(data), nil
+}
+
+// Flush logs output that did not end with a newline.
+func (l *lineLogger) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) > 0 {
+		l.emit(string(l.pending))
+		l.pending = nil
+	}
+}
+
+func (l *lineLogger) emit(line string) {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	l.log.Info("%s", line)
+}
@@ -0,0 +1,159 @@
+package hooks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// writeHook writes a shell hook and returns its path.
+func writeHook(t *testing.T, path string, script string, mode os.FileMode) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are shell scripts")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(script), mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readEnv returns the KONTA_* variables a hook dumped to path.
+func readEnv(t *testing.T, path string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		env[key] = value
+	}
+	return env
+}
+
+func TestAppHooksGetTheDeploymentEnvironment(t *testing.T) {
+	appDir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "env")
+	// pre is executable and runs directly, post.sh is run with bash.
+	writeHook(t, filepath.Join(appDir, AppHooksDir, "pre"), "#!/bin/sh\npwd > "+out+"\n", 0755)
+	writeHook(t, filepath.Join(appDir, AppHooksDir, "post.sh"), "env | grep ^KONTA_ | sort > "+out+"\n", 0644)
+
+	runner := ForApp(appDir, types.HooksConf{})
+	if !runner.HasAppHooks() {
+		t.Fatal("app hooks not found")
+	}
+	runner.SetContext(Context{App: "web", Commit: "abc123", PreviousCommit: "def456", Stack: "web-abc123"})
+
+	if err := runner.RunAppPre(); err != nil {
+		t.Fatal(err)
+	}
+	if dir, _ := os.ReadFile(out); strings.TrimSpace(string(dir)) != appDir {
+		if resolved, _ := filepath.EvalSymlinks(appDir); strings.TrimSpace(string(dir)) != resolved {
+			t.Errorf("pre ran in %s, want the app dir", dir)
+		}
+	}
+
+	if err := runner.RunAppPost(errors.New("compose up failed")); err != nil {
+		t.Fatal(err)
+	}
+	env := readEnv(t, out)
+	want := map[string]string{
+		"KONTA_EVENT":           "app_post",
+		"KONTA_APP":             "web",
+		"KONTA_COMMIT":          "abc123",
+		"KONTA_PREVIOUS_COMMIT": "def456",
+		"KONTA_STACK":           "web-abc123",
+		"KONTA_RELEASE_DIR":     "",
+		"KONTA_STATUS":          "failure",
+		"KONTA_ERROR":           "compose up failed",
+	}
+	for key, value := range want {
+		if env[key] != value {
+			t.Errorf("%s = %q, want %q", key, env[key], value)
+		}
+	}
+
+	if err := runner.RunAppPost(nil); err != nil {
+		t.Fatal(err)
+	}
+	if env := readEnv(t, out); env["KONTA_STATUS"] != "success" || env["KONTA_ERROR"] != "" {
+		t.Errorf("env after a successful deploy = %v", env)
+	}
+}
+
+func TestAppHooksWithoutHooks(t *testing.T) {
+	appDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(appDir, AppHooksDir, "pre.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	runner := ForApp(appDir, types.HooksConf{})
+	if runner.HasAppHooks() {
+		t.Error("a directory was taken for a hook")
+	}
+	if err := runner.RunAppPre(); err != nil {
+		t.Errorf("RunAppPre without a hook = %v", err)
+	}
+}
+
+func TestFailingAndSlowHooks(t *testing.T) {
+	appDir := t.TempDir()
+	pre := writeHook(t, filepath.Join(appDir, AppHooksDir, "pre.sh"), "echo checking\nexit 3\n", 0644)
+
+	runner := ForApp(appDir, types.HooksConf{TimeoutSeconds: 1})
+	if err := runner.RunAppPre(); err == nil || !strings.Contains(err.Error(), "app_pre hook failed") {
+		t.Errorf("failing hook: err = %v", err)
+	}
+
+	// The child keeps the output open; the whole process group is killed.
+	writeHook(t, pre, "sleep 30 &\nsleep 30\n", 0644)
+	start := time.Now()
+	err := runner.RunAppPre()
+	if err == nil || err.Error() != "app_pre hook timed out after 1s" {
+		t.Errorf("slow hook: err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("slow hook returned after %s", elapsed)
+	}
+}
+
+func TestGlobalHooksResolvePathsInTheRepository(t *testing.T) {
+	repoDir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "args")
+	writeHook(t, filepath.Join(repoDir, "hooks", "post_update.sh"), "echo \"$1 $2 $KONTA_PREVIOUS_VERSION $KONTA_VERSION\" > "+out+"\n", 0644)
+
+	runner := New(repoDir, types.HooksConf{PostUpdateAbs: "hooks/post_update.sh", PreAbs: "hooks/missing.sh"})
+	if err := runner.RunPostUpdate("1.4.0", "1.5.0"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(out); strings.TrimSpace(string(data)) != "1.4.0 1.5.0 1.4.0 1.5.0" {
+		t.Errorf("post_update got %q", data)
+	}
+	if err := runner.RunPre(); err != nil {
+		t.Errorf("missing hook file: err = %v", err)
+	}
+}
+
+func TestNormalizeSuccessHookPayload(t *testing.T) {
+	tests := map[string]string{
+		`{"updated":["web"]}`: `{"updated":["web"]}`,
+		` {"updated":[]}}} `:  `{"updated":[]}`,
+		`{"updated":["web"]`:  `{"updated":["web"]`,
+		`not json at all`:     `not json at all`,
+	}
+	for payload, want := range tests {
+		if got := normalizeSuccessHookPayload(payload); got != want {
+			t.Errorf("normalizeSuccessHookPayload(%q) = %q, want %q", payload, got, want)
+		}
+	}
+}
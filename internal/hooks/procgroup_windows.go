@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package hooks
+
+import "os/exec"
+
+// killProcessGroup is a no-op on Windows: a timeout kills the hook process
+// only.
+func killProcessGroup(command *exec.Cmd) {}
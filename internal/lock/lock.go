@@ -11,22 +11,48 @@ import (
 var lockPath string
 
 func init() {
-	lockPath = "/var/run/konta.lock"
-	// Fallback to temp directory if /var/run is not writable
-	if f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_WRONLY, 0644); err != nil {
-		homeDir, _ := os.UserHomeDir()
-		if homeDir == "" {
-			homeDir = "/tmp"
-		}
-		lockPath = filepath.Join(homeDir, ".konta", "konta.lock")
-	} else {
-		_ = f.Close()
-		_ = os.Remove(lockPath)
+	lockPath = defaultLockPath()
+}
+
+// defaultLockPath returns /var/run/konta.lock for root. Rootless setups lock
+// in the user's runtime dir, or in ~/.konta when it is not set or /var/run is
+// not writable.
+func defaultLockPath() string {
+	if os.Geteuid() == 0 && dirWritable("/var/run") {
+		return "/var/run/konta.lock"
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" && dirWritable(runtimeDir) {
+		return filepath.Join(runtimeDir, "konta.lock")
+	}
+
+	homeDir, _ := os.UserHomeDir()
+	if homeDir == "" {
+		homeDir = "/tmp"
 	}
+	return filepath.Join(homeDir, ".konta", "konta.lock")
+}
+
+// dirWritable probes a directory with a temp file. It never touches the lock
+// file itself: removing it while another instance holds the lock would let
+// two instances lock different files.
+func dirWritable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".konta-probe-*")
+	if err != nil {
+		return false
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	return true
+}
+
+// Path returns the lock file path.
+func Path() string {
+	return lockPath
 }
 
 type FileLock struct {
-	file *os.File
+	file  *os.File
+	quiet bool // no debug log on release, for short-lived locks
 }
 
 // Acquire acquires the file lock
@@ -52,6 +78,21 @@ func Acquire() (*FileLock, error) {
 	return &FileLock{file: file}, nil
 }
 
+// Wait blocks until it holds an exclusive lock on the file at path. It is
+// for short critical sections shared between processes, like updating a
+// state file.
+func Wait(path string) (*FileLock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := waitLock(file.Fd()); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &FileLock{file: file, quiet: true}, nil
+}
+
 // Release releases the file lock
 func (fl *FileLock) Release() error {
 	if fl.file == nil {
@@ -66,6 +107,8 @@ func (fl *FileLock) Release() error {
 		return fmt.Errorf("failed to close lock file: %w", err)
 	}
 
-	logger.Debug("Lock released")
+	if !fl.quiet {
+		logger.Debug("Lock released")
+	}
 	return nil
 }
@@ -14,6 +14,13 @@ func acquireLock(fd uintptr) error {
 	return nil
 }
 
+func waitLock(fd uintptr) error {
+	if err := syscall.Flock(int(fd), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	return nil
+}
+
 func releaseLock(fd uintptr) error {
 	if err := syscall.Flock(int(fd), syscall.LOCK_UN); err != nil {
 		return fmt.Errorf("failed to release lock: %w", err)
@@ -9,6 +9,11 @@ func acquireLock(fd uintptr) error {
 	return nil
 }
 
+func waitLock(fd uintptr) error {
+	// No-op on Windows, like acquireLock
+	return nil
+}
+
 func releaseLock(fd uintptr) error {
 	// No-op on Windows
 	return nil
@@ -1,20 +1,45 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+const (
+	defaultMaxSizeMB = 10
+	defaultMaxFiles  = 5
 )
 
 var (
-	logFile     *os.File
-	logDir      string
-	logFilePath string
+	mu           sync.Mutex
+	logFile      *os.File
+	logFileSize  int64
+	logDir       string
+	logFilePath  string
 	currentLevel = "info"
+	jsonFormat   bool
+	maxFileSize  int64 = defaultMaxSizeMB * 1024 * 1024
+	maxFiles           = defaultMaxFiles
+	cycleID      string
+	console      = os.Stdout // where log lines are echoed, see UseStderr
 )
 
+// Fields are structured key/value pairs attached to a log line.
+type Fields map[string]interface{}
+
+// Entry is a logger bound to a set of fields.
+type Entry struct {
+	fields Fields
+}
+
 var levelPriority = map[string]int{
 	"debug": 0,
 	"info":  1,
@@ -23,11 +48,21 @@ var levelPriority = map[string]int{
 	"fatal": 4,
 }
 
+// UseStderr echoes log lines to stderr instead of stdout, for commands whose
+// stdout is machine-readable, e.g. `konta plan --json`.
+func UseStderr() {
+	mu.Lock()
+	console = os.Stderr
+	mu.Unlock()
+}
+
 // SetLevel configures the minimal log level that should be emitted.
 func SetLevel(level string) {
 	normalized := normalizeLevel(level)
 	if _, ok := levelPriority[normalized]; ok {
+		mu.Lock()
 		currentLevel = normalized
+		mu.Unlock()
 	}
 }
 
@@ -40,6 +75,7 @@ func normalizeLevel(level string) string {
 	}
 }
 
+// shouldLog reports whether a message of level is emitted. Callers hold mu.
 func shouldLog(level string) bool {
 	msgLevel, ok := levelPriority[strings.ToLower(level)]
 	if !ok {
@@ -54,6 +90,9 @@ func shouldLog(level string) bool {
 
 // Init initializes the logger
 func Init(customLogPath string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	if customLogPath != "" {
 		logFilePath = customLogPath
 		logDir = filepath.Dir(logFilePath)
@@ -63,13 +102,7 @@ func Init(customLogPath string) error {
 			return fmt.Errorf("failed to create log directory: %w", err)
 		}
 
-		var err error
-		logFile, err = os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to open log file: %w", err)
-		}
-
-		return nil
+		return openLogFile(logFilePath)
 	}
 
 	homeDir, err := os.UserHomeDir()
@@ -89,14 +122,10 @@ func Init(customLogPath string) error {
 			continue
 		}
 
-		logFile, err = os.OpenFile(candidate, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
+		if err := openLogFile(candidate); err != nil {
 			lastErr = err
 			continue
 		}
-
-		logFilePath = candidate
-		logDir = filepath.Dir(candidate)
 		return nil
 	}
 
@@ -107,36 +136,149 @@ func Init(customLogPath string) error {
 	return fmt.Errorf("failed to open log file: %w", lastErr)
 }
 
+func openLogFile(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	if logFile != nil {
+		_ = logFile.Close()
+	}
+	logFile = file
+	logFileSize = size
+	logFilePath = path
+	logDir = filepath.Dir(path)
+	return nil
+}
+
+// Configure applies the logging section of the config: level, output format,
+// log file and rotation limits. The log file is reopened only when its path
+// changes, so it is safe to call on every config reload.
+func Configure(conf types.LoggingConf) error {
+	SetLevel(conf.Level)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	jsonFormat = strings.EqualFold(strings.TrimSpace(conf.Format), "json")
+
+	maxSizeMB := conf.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultMaxSizeMB
+	}
+	maxFileSize = int64(maxSizeMB) * 1024 * 1024
+
+	maxFiles = conf.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = defaultMaxFiles
+	}
+
+	path := strings.TrimSpace(conf.File)
+	if path == "" || path == logFilePath {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	return openLogFile(path)
+}
+
+// Reopen reopens the log file at its path, e.g. after an external tool
+// rotated it away.
+func Reopen() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if logFilePath == "" {
+		return nil
+	}
+	return openLogFile(logFilePath)
+}
+
+// SetCycleID tags every following log line with the given reconcile cycle ID.
+// Pass an empty string to clear it.
+func SetCycleID(id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	cycleID = id
+}
+
 // Close closes the log file
 func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
 	if logFile != nil {
 		return logFile.Close()
 	}
 	return nil
 }
 
+// With returns an entry that attaches the given fields to every message.
+func With(fields Fields) *Entry {
+	return &Entry{fields: fields}
+}
+
+// With returns a copy of the entry extended with more fields.
+func (e *Entry) With(fields Fields) *Entry {
+	merged := make(Fields, len(e.fields)+len(fields))
+	for key, value := range e.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &Entry{fields: merged}
+}
+
+// Info logs an info message with the entry fields
+func (e *Entry) Info(format string, v ...interface{}) {
+	logMessage("INFO", fmt.Sprintf(format, v...), e.fields)
+}
+
+// Warn logs a warning message with the entry fields
+func (e *Entry) Warn(format string, v ...interface{}) {
+	logMessage("WARN", fmt.Sprintf(format, v...), e.fields)
+}
+
+// Error logs an error message with the entry fields
+func (e *Entry) Error(format string, v ...interface{}) {
+	logMessage("ERROR", fmt.Sprintf(format, v...), e.fields)
+}
+
+// Debug logs a debug message with the entry fields
+func (e *Entry) Debug(format string, v ...interface{}) {
+	logMessage("DEBUG", fmt.Sprintf(format, v...), e.fields)
+}
+
 // Info logs an info message
 func Info(format string, v ...interface{}) {
 	msg := fmt.Sprintf(format, v...)
-	logMessage("INFO", msg)
+	logMessage("INFO", msg, nil)
 }
 
 // Warn logs a warning message
 func Warn(format string, v ...interface{}) {
 	msg := fmt.Sprintf(format, v...)
-	logMessage("WARN", msg)
+	logMessage("WARN", msg, nil)
 }
 
 // Error logs an error message
 func Error(format string, v ...interface{}) {
 	msg := fmt.Sprintf(format, v...)
-	logMessage("ERROR", msg)
+	logMessage("ERROR", msg, nil)
 }
 
 // Fatal logs an error message and exits
 func Fatal(format string, v ...interface{}) {
 	msg := fmt.Sprintf(format, v...)
-	logMessage("FATAL", msg)
+	logMessage("FATAL", msg, nil)
 	_ = Close()
 	os.Exit(1)
 }
@@ -144,30 +286,131 @@ func Fatal(format string, v ...interface{}) {
 // Debug logs a debug message
 func Debug(format string, v ...interface{}) {
 	msg := fmt.Sprintf(format, v...)
-	logMessage("DEBUG", msg)
+	logMessage("DEBUG", msg, nil)
 }
 
-func logMessage(level, message string) {
+func logMessage(level, message string, fields Fields) {
+	mu.Lock()
+	defer mu.Unlock()
+
 	if !shouldLog(level) {
 		return
 	}
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	formattedMsg := fmt.Sprintf("[%s] [%s] %s", timestamp, level, message)
-	stdoutIsTTY := isStdoutTerminal()
+	now := time.Now()
+	if cycleID != "" {
+		if _, ok := fields["cycle"]; !ok {
+			withCycle := make(Fields, len(fields)+1)
+			for key, value := range fields {
+				withCycle[key] = value
+			}
+			withCycle["cycle"] = cycleID
+			fields = withCycle
+		}
+	}
+
+	var formattedMsg string
+	if jsonFormat {
+		formattedMsg = formatJSON(now, level, message, fields)
+	} else {
+		formattedMsg = formatText(now, level, message, fields)
+	}
+	consoleIsTTY := isTerminal(console)
 
 	// Avoid duplicate lines when daemon stdout is redirected to the same file.
-	if stdoutIsTTY || logFile == nil {
-		fmt.Println(formattedMsg)
+	if consoleIsTTY || logFile == nil {
+		fmt.Fprintln(console, formattedMsg)
 	}
 
 	if logFile != nil {
-		_, _ = logFile.WriteString(formattedMsg + "\n")
+		writeToFile(formattedMsg + "\n")
+	}
+}
+
+func formatText(now time.Time, level, message string, fields Fields) string {
+	line := fmt.Sprintf("[%s] [%s] %s", now.Format("2006-01-02 15:04:05"), level, message)
+	for _, key := range sortedKeys(fields) {
+		value := fmt.Sprint(fields[key])
+		if value == "" || strings.ContainsAny(value, " \t\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		line += fmt.Sprintf(" %s=%s", key, value)
+	}
+	return line
+}
+
+func formatJSON(now time.Time, level, message string, fields Fields) string {
+	record := make(map[string]interface{}, len(fields)+3)
+	for key, value := range fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		record[key] = value
+	}
+	record["time"] = now.Format(time.RFC3339Nano)
+	record["level"] = strings.ToLower(level)
+	record["msg"] = message
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Sprintf(`{"time":%q,"level":%q,"msg":%q}`, now.Format(time.RFC3339Nano), strings.ToLower(level), message)
+	}
+	return string(data)
+}
+
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeToFile appends a line to the log file, rotating it first when the
+// line would exceed the configured size. Callers must hold mu.
+func writeToFile(line string) {
+	if maxFileSize > 0 && logFileSize > 0 && logFileSize+int64(len(line)) > maxFileSize {
+		if err := rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate log file %s: %v\n", logFilePath, err)
+		}
+		if logFile == nil {
+			return
+		}
+	}
+
+	n, _ := logFile.WriteString(line)
+	logFileSize += int64(n)
+}
+
+// rotate shifts konta.log -> konta.log.1 -> ... -> konta.log.<maxFiles> and
+// reopens an empty konta.log. Callers must hold mu.
+func rotate() error {
+	if err := logFile.Close(); err != nil {
+		return err
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", logFilePath, maxFiles))
+	for index := maxFiles - 1; index >= 1; index-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", logFilePath, index), fmt.Sprintf("%s.%d", logFilePath, index+1))
+	}
+	renameErr := os.Rename(logFilePath, logFilePath+".1")
+
+	file, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logFile = nil
+		return err
+	}
+	logFile = file
+	logFileSize = 0
+	if info, err := file.Stat(); err == nil {
+		logFileSize = info.Size()
 	}
+	return renameErr
 }
 
-func isStdoutTerminal() bool {
-	fi, err := os.Stdout.Stat()
+func isTerminal(file *os.File) bool {
+	fi, err := file.Stat()
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentLevelChanges runs under -race: the metrics, events and hook
+// goroutines log while a config reload changes the level.
+func TestConcurrentLevelChanges(t *testing.T) {
+	if err := Init(filepath.Join(t.TempDir(), "konta.log")); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetLevel("debug")
+				SetLevel("warn")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				Debug("debug %d", j)
+				With(Fields{"app": "web"}).Info("info %d", j)
+			}
+		}()
+	}
+	wg.Wait()
+	SetLevel("info")
+}
+
+func TestUseStderrKeepsStdoutClean(t *testing.T) {
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a log file every line goes to the console.
+	previousStderr, previousConsole, previousFile := os.Stderr, console, logFile
+	os.Stderr, console, logFile = stderr, stdout, nil
+	defer func() { os.Stderr, console, logFile = previousStderr, previousConsole, previousFile }()
+
+	UseStderr()
+	Info("checking out release")
+
+	if data, _ := os.ReadFile(stdout.Name()); len(data) != 0 {
+		t.Errorf("stdout = %q, want nothing", data)
+	}
+	if data, _ := os.ReadFile(stderr.Name()); !strings.Contains(string(data), "checking out release") {
+		t.Errorf("stderr = %q, want the log line", data)
+	}
+}
@@ -0,0 +1,322 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/state"
+)
+
+// Metrics are rendered in the Prometheus text exposition format by hand.
+// Konta targets small VPS hosts, so we avoid pulling in the full client library
+// for the handful of series we expose.
+
+var (
+	defaultBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+	gitBuckets     = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+	mu                  sync.Mutex
+	version             string
+	cyclesTotal         = map[string]float64{}
+	cycleDuration       = newHistogram(defaultBuckets)
+	lastSuccessfulCycle time.Time
+	rollbacksTotal      = map[string]float64{}
+	selfHealTotal       = map[string]float64{}
+	containerEvents     = map[string]float64{}
+	gitResolveDuration  = newHistogram(gitBuckets)
+	gitResolveErrors    float64
+
+	releasesCacheTTL  = 60 * time.Second
+	releasesCachedAt  time.Time
+	releasesCount     int
+	releasesDiskUsage int64
+)
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// SetVersion records the running Konta version for konta_build_info.
+func SetVersion(v string) {
+	mu.Lock()
+	defer mu.Unlock()
+	version = v
+}
+
+// ObserveCycle records a finished reconciliation cycle.
+// outcome is one of: success, no_changes, skipped, interrupted, failure.
+func ObserveCycle(outcome string, duration time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	cyclesTotal[outcome]++
+	cycleDuration.observe(duration.Seconds())
+	if outcome == "success" || outcome == "no_changes" {
+		lastSuccessfulCycle = time.Now()
+	}
+}
+
+// ObserveRollback records an automatic rollback attempt.
+// result is one of: success, failure, skipped.
+func ObserveRollback(result string) {
+	mu.Lock()
+	defer mu.Unlock()
+	rollbacksTotal[result]++
+}
+
+// ObserveSelfHeal records a self-heal action taken for an app.
+func ObserveSelfHeal(app string) {
+	mu.Lock()
+	defer mu.Unlock()
+	selfHealTotal[app]++
+}
+
+// ObserveContainerEvent records a Docker event of a managed container.
+// action is one of: die, oom, unhealthy.
+func ObserveContainerEvent(action string) {
+	mu.Lock()
+	defer mu.Unlock()
+	containerEvents[action]++
+}
+
+// ObserveGitResolve records latency and outcome of resolving the branch head.
+func ObserveGitResolve(duration time.Duration, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	gitResolveDuration.observe(duration.Seconds())
+	if err != nil {
+		gitResolveErrors++
+	}
+}
+
+// Start serves /metrics on the given address in the background. It fails
+// right away when the address cannot be bound, e.g. when the port is taken.
+func Start(listen string) (*http.Server, error) {
+	listen = strings.TrimSpace(listen)
+	if listen == "" {
+		return nil, fmt.Errorf("metrics listen address is empty")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", Handler)
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listen, err)
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error("Metrics listener on %s stopped: %v", listen, err)
+		}
+	}()
+
+	logger.Info("Metrics endpoint listening on http://%s/metrics", listen)
+	return server, nil
+}
+
+// Handler writes all metrics in Prometheus text format.
+func Handler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Write(w)
+}
+
+// Write renders all metrics in Prometheus text format.
+func Write(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	writeHeader(w, "konta_build_info", "gauge", "Konta build information.")
+	fmt.Fprintf(w, "konta_build_info{version=%s} 1\n", quote(version))
+
+	writeHeader(w, "konta_cycles_total", "counter", "Reconciliation cycles by outcome.")
+	for _, outcome := range sortedKeys(cyclesTotal) {
+		fmt.Fprintf(w, "konta_cycles_total{outcome=%s} %s\n", quote(outcome), formatFloat(cyclesTotal[outcome]))
+	}
+
+	writeHistogram(w, "konta_cycle_duration_seconds", "Duration of reconciliation cycles.", cycleDuration)
+
+	writeHeader(w, "konta_last_successful_cycle_timestamp_seconds", "gauge", "Unix time of the last cycle that deployed or found no changes.")
+	fmt.Fprintf(w, "konta_last_successful_cycle_timestamp_seconds %s\n", formatTimestamp(lastSuccessfulCycle))
+
+	writeHeader(w, "konta_rollbacks_total", "counter", "Automatic rollbacks by result.")
+	for _, result := range sortedKeys(rollbacksTotal) {
+		fmt.Fprintf(w, "konta_rollbacks_total{result=%s} %s\n", quote(result), formatFloat(rollbacksTotal[result]))
+	}
+
+	writeHeader(w, "konta_self_heal_actions_total", "counter", "Self-heal actions performed by this process, per app.")
+	for _, app := range sortedKeys(selfHealTotal) {
+		fmt.Fprintf(w, "konta_self_heal_actions_total{app=%s} %s\n", quote(app), formatFloat(selfHealTotal[app]))
+	}
+
+	writeHeader(w, "konta_container_events_total", "counter", "Docker events of managed containers seen by this process, by action.")
+	for _, action := range sortedKeys(containerEvents) {
+		fmt.Fprintf(w, "konta_container_events_total{action=%s} %s\n", quote(action), formatFloat(containerEvents[action]))
+	}
+
+	writeHistogram(w, "konta_git_resolve_duration_seconds", "Latency of resolving the latest branch commit.", gitResolveDuration)
+
+	writeHeader(w, "konta_git_resolve_errors_total", "counter", "Failed attempts to resolve the latest branch commit.")
+	fmt.Fprintf(w, "konta_git_resolve_errors_total %s\n", formatFloat(gitResolveErrors))
+
+	writeStateMetrics(w)
+	writeReleaseMetrics(w)
+}
+
+func writeStateMetrics(w io.Writer) {
+	currentState, err := state.Load()
+	if err != nil {
+		logger.Debug("Metrics: failed to load state: %v", err)
+		return
+	}
+
+	lastDeploy := time.Time{}
+	if parsed, err := time.ParseInLocation("2006-01-02 15:04:05", strings.TrimSpace(currentState.LastDeployTime), time.Local); err == nil {
+		lastDeploy = parsed
+	}
+	writeHeader(w, "konta_last_successful_deploy_timestamp_seconds", "gauge", "Unix time of the last successful deployment recorded in state.")
+	fmt.Fprintf(w, "konta_last_successful_deploy_timestamp_seconds %s\n", formatTimestamp(lastDeploy))
+
+	apps := make([]string, 0, len(currentState.Projects))
+	for app := range currentState.Projects {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	writeHeader(w, "konta_app_deployed_info", "gauge", "Commit and stack currently deployed for each app.")
+	for _, app := range apps {
+		projectState := currentState.Projects[app]
+		commit := strings.TrimSpace(projectState.ActiveCommit)
+		if commit == "" {
+			commit = strings.TrimSpace(projectState.LastCommit)
+		}
+		fmt.Fprintf(w, "konta_app_deployed_info{app=%s,commit=%s,stack=%s} 1\n", quote(app), quote(commit), quote(projectState.ActiveStack))
+	}
+
+	writeHeader(w, "konta_app_self_heal_attempts", "gauge", "Self-heal attempts in the current rollout lifecycle, per app.")
+	for _, app := range apps {
+		fmt.Fprintf(w, "konta_app_self_heal_attempts{app=%s} %d\n", quote(app), currentState.Projects[app].SelfHealAttempts)
+	}
+}
+
+func writeReleaseMetrics(w io.Writer) {
+	if time.Since(releasesCachedAt) > releasesCacheTTL {
+		count, usage, err := scanReleases(state.GetReleasesDir())
+		if err != nil {
+			logger.Debug("Metrics: failed to scan releases: %v", err)
+		}
+		releasesCount = count
+		releasesDiskUsage = usage
+		releasesCachedAt = time.Now()
+	}
+
+	writeHeader(w, "konta_releases", "gauge", "Number of release directories on disk.")
+	fmt.Fprintf(w, "konta_releases %d\n", releasesCount)
+
+	writeHeader(w, "konta_releases_disk_usage_bytes", "gauge", "Disk space used by release directories.")
+	fmt.Fprintf(w, "konta_releases_disk_usage_bytes %d\n", releasesDiskUsage)
+}
+
+func scanReleases(releasesDir string) (int, int64, error) {
+	entries, err := os.ReadDir(releasesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			count++
+		}
+	}
+
+	var usage int64
+	err = filepath.WalkDir(releasesDir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				usage += info.Size()
+			}
+		}
+		return nil
+	})
+
+	return count, usage, err
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	writeHeader(w, name, "histogram", help)
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=%s} %d\n", name, quote(formatFloat(bound)), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func quote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStartFailsWhenPortIsTaken(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	if server, err := Start(taken.Addr().String()); err == nil {
+		server.Close()
+		t.Fatalf("Start on a taken port returned no error")
+	}
+
+	server, err := Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Start on a free port: %v", err)
+	}
+	server.Close()
+}
+
+func TestOnlySuccessfulCyclesCount(t *testing.T) {
+	mu.Lock()
+	lastSuccessfulCycle = time.Time{}
+	mu.Unlock()
+
+	for _, outcome := range []string{"failure", "skipped"} {
+		ObserveCycle(outcome, time.Second)
+		if !lastSuccessfulCycle.IsZero() {
+			t.Fatalf("a %s cycle updated the last successful cycle", outcome)
+		}
+	}
+	for _, outcome := range []string{"success", "no_changes"} {
+		mu.Lock()
+		lastSuccessfulCycle = time.Time{}
+		mu.Unlock()
+		ObserveCycle(outcome, time.Second)
+		if lastSuccessfulCycle.IsZero() {
+			t.Fatalf("a %s cycle did not update the last successful cycle", outcome)
+		}
+	}
+}
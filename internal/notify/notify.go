@@ -0,0 +1,386 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// Event types that notification providers can subscribe to.
+const (
+	EventDeploySuccess   = "deploy_success"
+	EventDeployFailure   = "deploy_failure"
+	EventRollback        = "rollback"
+	EventSelfHeal        = "self_heal"
+	EventUpdateAvailable = "update_available"
+)
+
+// AllEvents lists every event type in the order they are documented.
+var AllEvents = []string{
+	EventDeploySuccess,
+	EventDeployFailure,
+	EventRollback,
+	EventSelfHeal,
+	EventUpdateAvailable,
+}
+
+const (
+	defaultRetries = 3
+	sendTimeout    = 15 * time.Second
+)
+
+// DeliveryTimeout caps the time spent on one event per provider, retries
+// and backoff included.
+const DeliveryTimeout = 30 * time.Second
+
+// inFlight tracks deliveries still running in the background, so a
+// one-shot command can wait for them before it exits.
+var inFlight sync.WaitGroup
+
+// Event is the payload delivered to every provider.
+type Event struct {
+	Type           string   `json:"event"`
+	Host           string   `json:"host"`
+	Time           string   `json:"time"`
+	Commit         string   `json:"commit,omitempty"`
+	PreviousCommit string   `json:"previous_commit,omitempty"`
+	CompareURL     string   `json:"compare_url,omitempty"`
+	Apps           []string `json:"apps,omitempty"`
+	Reason         string   `json:"reason,omitempty"`
+	Status         string   `json:"status,omitempty"` // rollback: completed, failed, skipped
+	Version        string   `json:"version,omitempty"`
+	LatestVersion  string   `json:"latest_version,omitempty"`
+}
+
+type provider interface {
+	name() string
+	send(ctx context.Context, event Event) error
+}
+
+type subscription struct {
+	provider provider
+	events   map[string]bool
+	retries  int
+	secrets  []string // redacted from the provider's errors
+}
+
+// Dispatcher fans events out to configured notification providers.
+type Dispatcher struct {
+	subscriptions []subscription
+	host          string
+}
+
+// New builds a dispatcher from the notifications section of the config.
+// Invalid provider entries are logged and skipped.
+func New(cfg *types.Config) *Dispatcher {
+	host, _ := os.Hostname()
+	d := &Dispatcher{host: host}
+	if cfg == nil {
+		return d
+	}
+
+	for index, conf := range cfg.Notifications {
+		p, err := newProvider(conf)
+		if err != nil {
+			logger.Warn("Skipping notifications[%d]: %v", index, err)
+			continue
+		}
+
+		events := make(map[string]bool)
+		for _, event := range conf.Events {
+			events[strings.ToLower(strings.TrimSpace(event))] = true
+		}
+		if len(events) == 0 {
+			for _, event := range AllEvents {
+				events[event] = true
+			}
+		}
+
+		retries := conf.Retries
+		if retries <= 0 {
+			retries = defaultRetries
+		}
+
+		d.subscriptions = append(d.subscriptions, subscription{provider: p, events: events, retries: retries, secrets: Secrets(conf)})
+	}
+
+	return d
+}
+
+// Validate checks a notifications entry the way New does and also rejects
+// unknown event types.
+func Validate(conf types.NotificationConf) error {
+	if _, err := newProvider(conf); err != nil {
+		return err
+	}
+	for _, event := range conf.Events {
+		if !contains(AllEvents, strings.ToLower(strings.TrimSpace(event))) {
+			return fmt.Errorf("unknown event %q (use %s)", event, strings.Join(AllEvents, ", "))
+		}
+	}
+	return nil
+}
+
+func newProvider(conf types.NotificationConf) (provider, error) {
+	label := strings.TrimSpace(conf.Name)
+	kind := strings.ToLower(strings.TrimSpace(conf.Type))
+	if label == "" {
+		label = kind
+	}
+
+	switch kind {
+	case "slack":
+		return newSlack(label, conf)
+	case "discord":
+		return newDiscord(label, conf)
+	case "telegram":
+		return newTelegram(label, conf)
+	case "webhook":
+		return newWebhook(label, conf)
+	case "smtp", "email":
+		return newSMTP(label, conf)
+	case "":
+		return nil, fmt.Errorf("type is required (slack, telegram, discord, webhook, smtp)")
+	default:
+		return nil, fmt.Errorf("unknown type %q (use slack, telegram, discord, webhook, smtp)", conf.Type)
+	}
+}
+
+// Enabled reports whether at least one provider is subscribed to the event type.
+func (d *Dispatcher) Enabled(eventType string) bool {
+	if d == nil {
+		return false
+	}
+	for _, sub := range d.subscriptions {
+		if sub.events[eventType] {
+			return true
+		}
+	}
+	return false
+}
+
+// Send delivers the event to every subscribed provider in the background,
+// retrying failed deliveries with exponential backoff for up to
+// DeliveryTimeout. It never blocks the caller, and failures are only logged:
+// notifications must not affect the deployment outcome.
+func (d *Dispatcher) Send(event Event) {
+	if d == nil || !d.Enabled(event.Type) {
+		return
+	}
+
+	if event.Host == "" {
+		event.Host = d.host
+	}
+	if event.Time == "" {
+		event.Time = time.Now().Format(time.RFC3339)
+	}
+
+	for _, sub := range d.subscriptions {
+		if !sub.events[event.Type] {
+			continue
+		}
+
+		inFlight.Add(1)
+		go func(sub subscription) {
+			defer inFlight.Done()
+			deliver(sub, event, DeliveryTimeout)
+		}(sub)
+	}
+}
+
+// Wait waits up to timeout for deliveries still in the background and
+// reports whether they all finished.
+func Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		logger.Warn("Gave up waiting for notifications after %s", timeout)
+		return false
+	}
+}
+
+func deliver(sub subscription, event Event, budget time.Duration) {
+	deadline, cancelAll := context.WithTimeout(context.Background(), budget)
+	defer cancelAll()
+
+	backoff := time.Second
+	var lastErr error
+	attempt := 1
+	for ; attempt <= sub.retries; attempt++ {
+		ctx, cancel := context.WithTimeout(deadline, sendTimeout)
+		lastErr = redact(sub.provider.send(ctx, event), sub.secrets)
+		cancel()
+		if lastErr == nil {
+			logger.Debug("Notification %s delivered via %s", event.Type, sub.provider.name())
+			return
+		}
+		if attempt == sub.retries {
+			break
+		}
+
+		logger.Debug("Notification %s via %s failed (attempt %d/%d): %v", event.Type, sub.provider.name(), attempt, sub.retries, lastErr)
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+			continue
+		case <-deadline.Done():
+		}
+		break
+	}
+
+	logger.Warn("Failed to deliver %s notification via %s after %d attempt(s): %v", event.Type, sub.provider.name(), attempt, lastErr)
+}
+
+// redact replaces secrets in err, so they never reach the log or a failure
+// notification.
+func redact(err error, secrets []string) error {
+	if err == nil {
+		return err
+	}
+	message := err.Error()
+	redacted := message
+	for _, secret := range secrets {
+		if secret != "" {
+			redacted = strings.ReplaceAll(redacted, secret, "REDACTED")
+		}
+	}
+	if redacted == message {
+		return err
+	}
+	return errors.New(redacted)
+}
+
+// credentials calls visit with each field of a notifications entry that
+// holds a credential: the bot token, the SMTP password, header values and
+// the URL of webhooks, which carries their token. The Telegram URL is an API
+// base and is left alone.
+func credentials(conf *types.NotificationConf, visit func(value *string, isURL bool)) {
+	switch strings.ToLower(strings.TrimSpace(conf.Type)) {
+	case "slack", "discord", "webhook":
+		visit(&conf.URL, true)
+	}
+	visit(&conf.BotToken, false)
+	visit(&conf.Password, false)
+	for key, value := range conf.Headers {
+		visit(&value, false)
+		conf.Headers[key] = value
+	}
+}
+
+// Secrets returns the credentials of a notifications entry, and the parts
+// of its webhook URL that identify it, for redaction from errors.
+func Secrets(conf types.NotificationConf) []string {
+	var secrets []string
+	conf.Headers = copyHeaders(conf.Headers)
+	credentials(&conf, func(value *string, isURL bool) {
+		secret := strings.TrimSpace(*value)
+		switch {
+		case secret == "":
+		case isURL:
+			secrets = append(secrets, urlSecrets(secret)...)
+		default:
+			secrets = append(secrets, secret)
+		}
+	})
+	return secrets
+}
+
+// Redacted returns a copy of a notifications entry with its credentials
+// replaced by ***, for display.
+func Redacted(conf types.NotificationConf) types.NotificationConf {
+	conf.Headers = copyHeaders(conf.Headers)
+	credentials(&conf, func(value *string, _ bool) {
+		if *value != "" {
+			*value = "***"
+		}
+	})
+	return conf
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(headers))
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
+
+// Title returns a one-line summary of the event.
+func Title(event Event) string {
+	commit := shortCommit(event.Commit)
+	switch event.Type {
+	case EventDeploySuccess:
+		return fmt.Sprintf("✅ Konta deployed %s on %s", commit, event.Host)
+	case EventDeployFailure:
+		return fmt.Sprintf("❌ Konta deployment of %s failed on %s", commit, event.Host)
+	case EventRollback:
+		return fmt.Sprintf("↩️ Konta rollback %s on %s", orDefault(event.Status, "performed"), event.Host)
+	case EventSelfHeal:
+		return fmt.Sprintf("🩹 Konta self-healed %s on %s", strings.Join(event.Apps, ", "), event.Host)
+	case EventUpdateAvailable:
+		return fmt.Sprintf("⬆️ Konta v%s is available on %s (current: v%s)", event.LatestVersion, event.Host, event.Version)
+	default:
+		return fmt.Sprintf("Konta %s on %s", event.Type, event.Host)
+	}
+}
+
+// Text renders the event as a plain-text message body.
+func Text(event Event) string {
+	lines := []string{Title(event)}
+	if event.Commit != "" {
+		lines = append(lines, fmt.Sprintf("Commit: %s", shortCommit(event.Commit)))
+	}
+	if event.PreviousCommit != "" {
+		lines = append(lines, fmt.Sprintf("Previous: %s", shortCommit(event.PreviousCommit)))
+	}
+	if len(event.Apps) > 0 {
+		lines = append(lines, fmt.Sprintf("Apps: %s", strings.Join(event.Apps, ", ")))
+	}
+	if event.Reason != "" {
+		lines = append(lines, fmt.Sprintf("Reason: %s", event.Reason))
+	}
+	if event.CompareURL != "" {
+		lines = append(lines, fmt.Sprintf("Compare: %s", event.CompareURL))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func shortCommit(commit string) string {
+	commit = strings.TrimSpace(commit)
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+func orDefault(value, fallback string) string {
+	if strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	return value
+}
+
+func contains(items []string, item string) bool {
+	for _, candidate := range items {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,288 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+func newRecorder(t *testing.T) (*httptest.Server, chan map[string]interface{}) {
+	t.Helper()
+	received := make(chan map[string]interface{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid JSON body: %v", err)
+		}
+		body["_path"] = r.URL.Path
+		body["_header"] = r.Header.Get("X-Token")
+		received <- body
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func receive(t *testing.T, received chan map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	select {
+	case body := <-received:
+		return body
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request received")
+		return nil
+	}
+}
+
+func TestSendDeliversToHTTPProviders(t *testing.T) {
+	server, received := newRecorder(t)
+	dispatcher := New(&types.Config{Notifications: []types.NotificationConf{
+		{Type: "slack", URL: server.URL + "/slack"},
+		{Type: "webhook", URL: server.URL + "/webhook", Headers: map[string]string{"X-Token": "secret"}, Events: []string{EventDeployFailure}},
+		{Type: "telegram", URL: server.URL, BotToken: "123:abc", ChatID: "42"},
+	}})
+
+	dispatcher.Send(Event{Type: EventDeploySuccess, Commit: "0123456789abcdef"})
+	if !Wait(5 * time.Second) {
+		t.Fatal("deliveries did not finish")
+	}
+
+	paths := map[string]map[string]interface{}{}
+	for i := 0; i < 2; i++ {
+		body := receive(t, received)
+		paths[body["_path"].(string)] = body
+	}
+	if text, _ := paths["/slack"]["text"].(string); !strings.Contains(text, "01234567") {
+		t.Errorf("slack text = %q, want the short commit", text)
+	}
+	if chat := paths["/bot123:abc/sendMessage"]["chat_id"]; chat != "42" {
+		t.Errorf("telegram chat_id = %v, want 42", chat)
+	}
+
+	dispatcher.Send(Event{Type: EventDeployFailure, Reason: "boom"})
+	Wait(5 * time.Second)
+	for i := 0; i < 3; i++ {
+		body := receive(t, received)
+		if body["_path"] == "/webhook" {
+			if body["event"] != EventDeployFailure || body["reason"] != "boom" || body["_header"] != "secret" {
+				t.Errorf("webhook body = %v", body)
+			}
+		}
+	}
+}
+
+func TestDiscordTruncatesByRunes(t *testing.T) {
+	server, received := newRecorder(t)
+	p, err := newDiscord("discord", types.NotificationConf{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := Event{Type: EventDeployFailure, Reason: strings.Repeat("é", 3000)}
+	if err := p.send(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	content := receive(t, received)["content"].(string)
+	if !utf8.ValidString(content) {
+		t.Fatal("content is not valid UTF-8")
+	}
+	if count := utf8.RuneCountInString(content); count != 2000 || !strings.HasSuffix(content, "...") {
+		t.Errorf("content has %d runes, want 2000 ending in ...", count)
+	}
+}
+
+func TestProviderSecretsAreRedacted(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + listener.Addr().String()
+	listener.Close() // nothing listens: the request fails with a network error
+
+	// echo rejects every request and repeats its URL and headers, like an
+	// endpoint that echoes the request in its error.
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, r.URL.String()+" "+r.Header.Get("Authorization"), http.StatusBadRequest)
+	}))
+	defer echo.Close()
+
+	for _, base := range []string{closed, echo.URL} {
+		for _, conf := range []types.NotificationConf{
+			{Type: "slack", URL: base + "/services/slack-secret"},
+			{Type: "discord", URL: base + "/api/webhooks/discord-secret"},
+			{Type: "telegram", URL: base, BotToken: "123:telegram-secret", ChatID: "42"},
+			{Type: "webhook", URL: base + "/hook?token=webhook-secret", Headers: map[string]string{"Authorization": "Bearer header-secret"}},
+		} {
+			p, err := newProvider(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sendErr := redact(p.send(context.Background(), Event{Type: EventDeploySuccess}), Secrets(conf))
+			if sendErr == nil {
+				t.Fatalf("%s: expected an error", conf.Type)
+			}
+			if strings.Contains(sendErr.Error(), "secret") {
+				t.Errorf("%s: secret in error: %v", conf.Type, sendErr)
+			}
+		}
+	}
+}
+
+func TestSendDoesNotBlockAndDeliveryIsCapped(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	dispatcher := New(&types.Config{Notifications: []types.NotificationConf{{Type: "slack", URL: server.URL}}})
+	start := time.Now()
+	dispatcher.Send(Event{Type: EventDeploySuccess})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Send blocked for %s", elapsed)
+	}
+
+	start = time.Now()
+	deliver(dispatcher.subscriptions[0], Event{Type: EventDeploySuccess}, 300*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("delivery took %s, want it capped near 300ms", elapsed)
+	}
+}
+
+// fakeSMTP accepts one message without TLS or auth and returns its data.
+func fakeSMTP(t *testing.T) (string, chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan string, 1)
+	var once sync.Once
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+		reply("220 fake ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 fake")
+			case strings.HasPrefix(command, "DATA"):
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					dataLine, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				once.Do(func() { messages <- data.String() })
+				reply("250 queued")
+			case strings.HasPrefix(command, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return listener.Addr().String(), messages
+}
+
+func TestSMTPMessageHeaders(t *testing.T) {
+	address, messages := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(address)
+	portNumber := 0
+	for _, digit := range port {
+		portNumber = portNumber*10 + int(digit-'0')
+	}
+
+	p, err := newSMTP("mail", types.NotificationConf{Host: host, Port: portNumber, From: "konta@example.com", To: []string{"ops@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.send(ctx, Event{Type: EventDeploySuccess, Host: "vps0", Commit: "0123456789"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var message string
+	select {
+	case message = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	headers := message[:strings.Index(message, "\r\n\r\n")]
+	if !strings.Contains(headers, "Subject: =?utf-8?q?") {
+		t.Errorf("subject is not RFC 2047 encoded:\n%s", headers)
+	}
+	for _, header := range []string{"Date: ", "Message-ID: <", "@example.com>"} {
+		if !strings.Contains(headers, header) {
+			t.Errorf("headers lack %q:\n%s", header, headers)
+		}
+	}
+	if !strings.Contains(message, "Commit: 01234567") {
+		t.Errorf("body lacks the commit:\n%s", message)
+	}
+}
+
+func TestRedactedMasksEveryCredential(t *testing.T) {
+	conf := types.NotificationConf{
+		Type:     "webhook",
+		URL:      "https://hooks.example.com/hook?token=webhook-secret",
+		Headers:  map[string]string{"Authorization": "Bearer header-secret"},
+		BotToken: "123:telegram-secret",
+		Username: "alerts",
+		Password: "smtp-secret",
+		ChatID:   "42",
+	}
+	redacted := Redacted(conf)
+	if got := fmt.Sprintf("%+v", redacted); strings.Contains(got, "secret") {
+		t.Errorf("secret left in %s", got)
+	}
+	if redacted.Username != "alerts" || redacted.ChatID != "42" {
+		t.Errorf("non-secret fields changed: %+v", redacted)
+	}
+	if conf.Headers["Authorization"] != "Bearer header-secret" {
+		t.Error("Redacted changed the headers of the original entry")
+	}
+
+	// The Telegram URL is an API base, not a credential.
+	telegram := Redacted(types.NotificationConf{Type: "telegram", URL: "https://api.telegram.org"})
+	if telegram.URL != "https://api.telegram.org" {
+		t.Errorf("telegram url = %q", telegram.URL)
+	}
+	if secrets := Secrets(conf); len(secrets) == 0 {
+		t.Error("no secrets for a webhook")
+	}
+}
@@ -0,0 +1,265 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+var httpClient = &http.Client{}
+
+type slackProvider struct {
+	label string
+	url   string
+}
+
+func newSlack(label string, conf types.NotificationConf) (provider, error) {
+	if strings.TrimSpace(conf.URL) == "" {
+		return nil, fmt.Errorf("slack: url (incoming webhook) is required")
+	}
+	return &slackProvider{label: label, url: strings.TrimSpace(conf.URL)}, nil
+}
+
+func (p *slackProvider) name() string { return p.label }
+
+func (p *slackProvider) send(ctx context.Context, event Event) error {
+	return postJSON(ctx, p.url, nil, map[string]string{"text": Text(event)})
+}
+
+type discordProvider struct {
+	label string
+	url   string
+}
+
+func newDiscord(label string, conf types.NotificationConf) (provider, error) {
+	if strings.TrimSpace(conf.URL) == "" {
+		return nil, fmt.Errorf("discord: url (webhook) is required")
+	}
+	return &discordProvider{label: label, url: strings.TrimSpace(conf.URL)}, nil
+}
+
+func (p *discordProvider) name() string { return p.label }
+
+func (p *discordProvider) send(ctx context.Context, event Event) error {
+	// Discord counts the limit in characters, so cut at a rune boundary.
+	content := []rune(Text(event))
+	if len(content) > 2000 {
+		content = append(content[:1997], []rune("...")...)
+	}
+	return postJSON(ctx, p.url, nil, map[string]string{"content": string(content)})
+}
+
+type telegramProvider struct {
+	label    string
+	apiURL   string
+	botToken string
+	chatID   string
+}
+
+func newTelegram(label string, conf types.NotificationConf) (provider, error) {
+	if strings.TrimSpace(conf.BotToken) == "" || strings.TrimSpace(conf.ChatID) == "" {
+		return nil, fmt.Errorf("telegram: bot_token and chat_id are required")
+	}
+	apiURL := strings.TrimRight(strings.TrimSpace(conf.URL), "/")
+	if apiURL == "" {
+		apiURL = "https://api.telegram.org"
+	}
+	return &telegramProvider{
+		label:    label,
+		apiURL:   apiURL,
+		botToken: strings.TrimSpace(conf.BotToken),
+		chatID:   strings.TrimSpace(conf.ChatID),
+	}, nil
+}
+
+func (p *telegramProvider) name() string { return p.label }
+
+func (p *telegramProvider) send(ctx context.Context, event Event) error {
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", p.apiURL, p.botToken)
+	body := map[string]interface{}{
+		"chat_id":                  p.chatID,
+		"text":                     Text(event),
+		"disable_web_page_preview": true,
+	}
+	return postJSON(ctx, endpoint, nil, body)
+}
+
+type webhookProvider struct {
+	label   string
+	url     string
+	headers map[string]string
+}
+
+func newWebhook(label string, conf types.NotificationConf) (provider, error) {
+	if strings.TrimSpace(conf.URL) == "" {
+		return nil, fmt.Errorf("webhook: url is required")
+	}
+	return &webhookProvider{label: label, url: strings.TrimSpace(conf.URL), headers: conf.Headers}, nil
+}
+
+func (p *webhookProvider) name() string { return p.label }
+
+func (p *webhookProvider) send(ctx context.Context, event Event) error {
+	payload := struct {
+		Event
+		Title string `json:"title"`
+		Text  string `json:"text"`
+	}{Event: event, Title: Title(event), Text: Text(event)}
+	return postJSON(ctx, p.url, p.headers, payload)
+}
+
+type smtpProvider struct {
+	label    string
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func newSMTP(label string, conf types.NotificationConf) (provider, error) {
+	if strings.TrimSpace(conf.Host) == "" {
+		return nil, fmt.Errorf("smtp: host is required")
+	}
+	if strings.TrimSpace(conf.From) == "" || len(conf.To) == 0 {
+		return nil, fmt.Errorf("smtp: from and to are required")
+	}
+	port := conf.Port
+	if port == 0 {
+		port = 587
+	}
+	return &smtpProvider{
+		label:    label,
+		host:     strings.TrimSpace(conf.Host),
+		port:     port,
+		username: conf.Username,
+		password: conf.Password,
+		from:     strings.TrimSpace(conf.From),
+		to:       conf.To,
+	}, nil
+}
+
+func (p *smtpProvider) name() string { return p.label }
+
+func (p *smtpProvider) send(ctx context.Context, event Event) error {
+	var auth smtp.Auth
+	if p.username != "" {
+		auth = smtp.PlainAuth("", p.username, p.password, p.host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + p.from,
+		"To: " + strings.Join(p.to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", Title(event)),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + messageID(p.from),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+		"",
+		Text(event),
+		"",
+	}, "\r\n")
+
+	addr := net.JoinHostPort(p.host, strconv.Itoa(p.port))
+	done := make(chan error, 1)
+	go func() {
+		// smtp.SendMail upgrades to STARTTLS automatically when the server offers it.
+		done <- smtp.SendMail(addr, auth, p.from, p.to, []byte(message))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("smtp send failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("smtp send timed out: %w", ctx.Err())
+	}
+}
+
+// messageID builds a unique Message-ID in the domain of the sender.
+func messageID(from string) string {
+	domain := "konta.localhost"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(address.Address, "@"); at >= 0 && at < len(address.Address)-1 {
+			domain = address.Address[at+1:]
+		}
+	}
+	random := make([]byte, 8)
+	_, _ = rand.Read(random)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(random), domain)
+}
+
+// urlSecrets returns a webhook URL and its parts that identify it: the path
+// and query, which an endpoint may echo in an error, and any credentials.
+func urlSecrets(raw string) []string {
+	secrets := []string{raw}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return secrets
+	}
+	if requestURI := parsed.RequestURI(); requestURI != "/" {
+		secrets = append(secrets, requestURI)
+	}
+	if parsed.User != nil {
+		secrets = append(secrets, parsed.User.String())
+	}
+	return secrets
+}
+
+func postJSON(ctx context.Context, endpoint string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// The URL of a webhook is a credential: keep it out of the error.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("notification request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		msg := strings.TrimSpace(string(respBody))
+		if msg == "" {
+			msg = resp.Status
+		}
+		return fmt.Errorf("notification endpoint returned %d: %s", resp.StatusCode, msg)
+	}
+
+	return nil
+}
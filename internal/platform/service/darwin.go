@@ -120,6 +120,20 @@ func (m *darwinManager) Restart() error {
 	return nil
 }
 
+// RequestRestart does not wait for launchctl, which returns only after the
+// daemon calling it was stopped.
+func (m *darwinManager) RequestRestart() error {
+	if err := requireRoot("restart"); err != nil {
+		return err
+	}
+	command := exec.Command("launchctl", "kickstart", "-k", "system/"+m.serviceName)
+	if err := command.Start(); err != nil {
+		return fmt.Errorf("failed to restart service: %w", err)
+	}
+	go func() { _ = command.Wait() }()
+	return nil
+}
+
 func (m *darwinManager) IsRunning() bool {
 	return exec.Command("launchctl", "print", "system/"+m.serviceName).Run() == nil
 }
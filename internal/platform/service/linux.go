@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
@@ -11,6 +12,24 @@ type linuxManager struct {
 	serviceName string
 	serviceFile string
 	binaryPath  string
+	user        bool   // systemd user unit (`systemctl --user`) for rootless setups
+	runtime     string // docker or podman
+}
+
+// systemctl runs systemctl for the system or, in user mode, the user manager.
+func (m *linuxManager) systemctl(args ...string) *exec.Cmd {
+	if m.user {
+		args = append([]string{"--user"}, args...)
+	}
+	return exec.Command("systemctl", args...)
+}
+
+// requireRoot is only needed for the system unit.
+func (m *linuxManager) requireRoot(action string) error {
+	if m.user {
+		return nil
+	}
+	return requireRoot(action)
 }
 
 func (m *linuxManager) Name() string {
@@ -22,14 +41,44 @@ func (m *linuxManager) FilePath() string {
 }
 
 func (m *linuxManager) Enable() error {
-	if err := requireRoot("enable"); err != nil {
+	if err := m.requireRoot("enable"); err != nil {
 		return err
 	}
 
-	serviceContent := fmt.Sprintf(`[Unit]
+	serviceContent := m.unitContent()
+	if err := os.MkdirAll(filepath.Dir(m.serviceFile), 0755); err != nil {
+		return fmt.Errorf("failed to create service directory: %w", err)
+	}
+	if err := os.WriteFile(m.serviceFile, []byte(serviceContent), 0644); err != nil {
+		return fmt.Errorf("failed to write service file: %w", err)
+	}
+	if err := m.systemctl("daemon-reload").Run(); err != nil {
+		return fmt.Errorf("failed to reload systemd: %w", err)
+	}
+	if err := m.systemctl("enable", m.serviceName).Run(); err != nil {
+		return fmt.Errorf("failed to enable service: %w", err)
+	}
+	if err := m.systemctl("start", m.serviceName).Run(); err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+
+	return nil
+}
+
+// unitContent renders the unit. The system unit runs as root next to the
+// runtime's system service. The user unit runs in the user's session
+// manager; it carries DOCKER_HOST and KONTA_RUNTIME from the shell that
+// enabled it, so the daemon reaches the same rootless Docker or Podman socket.
+func (m *linuxManager) unitContent() string {
+	dependency := "After=network.target docker.service\nRequires=docker.service"
+	if m.runtime == "podman" {
+		dependency = "After=network.target podman.socket\nWants=podman.socket"
+	}
+
+	if !m.user {
+		return fmt.Sprintf(`[Unit]
 Description=Konta GitOps for Docker Compose
-After=network.target docker.service
-Requires=docker.service
+%s
 
 [Service]
 Type=simple
@@ -39,43 +88,55 @@ Restart=on-failure
 RestartSec=5
 StandardOutput=journal
 StandardError=journal
+ExecReload=/bin/kill -HUP $MAINPID
 KillMode=mixed
 KillSignal=SIGTERM
-TimeoutStopSec=30
+TimeoutStopSec=330
 
 [Install]
 WantedBy=multi-user.target
-`, m.binaryPath)
-
-	if err := os.WriteFile(m.serviceFile, []byte(serviceContent), 0644); err != nil {
-		return fmt.Errorf("failed to write service file: %w", err)
-	}
-	if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
-		return fmt.Errorf("failed to reload systemd: %w", err)
+`, dependency, m.binaryPath)
 	}
-	if err := exec.Command("systemctl", "enable", m.serviceName).Run(); err != nil {
-		return fmt.Errorf("failed to enable service: %w", err)
-	}
-	if err := exec.Command("systemctl", "start", m.serviceName).Run(); err != nil {
-		return fmt.Errorf("failed to start service: %w", err)
+
+	environment := ""
+	for _, key := range []string{"DOCKER_HOST", "KONTA_RUNTIME"} {
+		if value := os.Getenv(key); value != "" {
+			environment += fmt.Sprintf("Environment=%s=%s\n", key, value)
+		}
 	}
 
-	return nil
+	return fmt.Sprintf(`[Unit]
+Description=Konta GitOps for Docker Compose (rootless)
+%s
+
+[Service]
+Type=simple
+%sExecStart=%s run --watch
+Restart=on-failure
+RestartSec=5
+ExecReload=/bin/kill -HUP $MAINPID
+KillMode=mixed
+KillSignal=SIGTERM
+TimeoutStopSec=330
+
+[Install]
+WantedBy=default.target
+`, dependency, environment, m.binaryPath)
 }
 
 func (m *linuxManager) Disable() error {
-	if err := requireRoot("disable"); err != nil {
+	if err := m.requireRoot("disable"); err != nil {
 		return err
 	}
 
-	_ = exec.Command("systemctl", "stop", m.serviceName).Run()
-	if err := exec.Command("systemctl", "disable", m.serviceName).Run(); err != nil {
+	_ = m.systemctl("stop", m.serviceName).Run()
+	if err := m.systemctl("disable", m.serviceName).Run(); err != nil {
 		return fmt.Errorf("failed to disable service: %w", err)
 	}
 	if err := os.Remove(m.serviceFile); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove service file: %w", err)
 	}
-	if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
+	if err := m.systemctl("daemon-reload").Run(); err != nil {
 		return fmt.Errorf("failed to reload systemd: %w", err)
 	}
 
@@ -83,41 +144,53 @@ func (m *linuxManager) Disable() error {
 }
 
 func (m *linuxManager) Start() error {
-	if err := requireRoot("start"); err != nil {
+	if err := m.requireRoot("start"); err != nil {
 		return err
 	}
-	if err := exec.Command("systemctl", "start", m.serviceName).Run(); err != nil {
+	if err := m.systemctl("start", m.serviceName).Run(); err != nil {
 		return fmt.Errorf("failed to start service: %w", err)
 	}
 	return nil
 }
 
 func (m *linuxManager) Stop() error {
-	if err := requireRoot("stop"); err != nil {
+	if err := m.requireRoot("stop"); err != nil {
 		return err
 	}
-	if err := exec.Command("systemctl", "stop", m.serviceName).Run(); err != nil {
+	if err := m.systemctl("stop", m.serviceName).Run(); err != nil {
 		return fmt.Errorf("failed to stop service: %w", err)
 	}
 	return nil
 }
 
 func (m *linuxManager) Restart() error {
-	if err := requireRoot("restart"); err != nil {
+	if err := m.requireRoot("restart"); err != nil {
 		return err
 	}
-	if err := exec.Command("systemctl", "restart", m.serviceName).Run(); err != nil {
+	if err := m.systemctl("restart", m.serviceName).Run(); err != nil {
 		return fmt.Errorf("failed to restart service: %w", err)
 	}
 	return nil
 }
 
+// RequestRestart uses --no-block: a plain restart from inside the daemon
+// waits for the daemon to stop, which it cannot do while it waits.
+func (m *linuxManager) RequestRestart() error {
+	if err := m.requireRoot("restart"); err != nil {
+		return err
+	}
+	if output, err := m.systemctl("--no-block", "restart", m.serviceName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restart service: %w (output: %s)", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
 func (m *linuxManager) IsRunning() bool {
-	output, err := exec.Command("systemctl", "is-active", m.serviceName).Output()
+	output, err := m.systemctl("is-active", m.serviceName).Output()
 	return err == nil && strings.TrimSpace(string(output)) == "active"
 }
 
 func (m *linuxManager) StatusOutput() (string, error) {
-	output, err := exec.Command("systemctl", "status", m.serviceName, "--no-pager").CombinedOutput()
+	output, err := m.systemctl("status", m.serviceName, "--no-pager").CombinedOutput()
 	return strings.TrimSpace(string(output)), err
 }
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSystemctl puts a systemctl on PATH that records its arguments and,
+// like the real one restarting the unit it runs in, hangs unless --no-block
+// is given.
+func fakeSystemctl(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$@\" >> " + calls + "\ncase \" $* \" in *\" --no-block \"*) ;; *) sleep 30 ;; esac\n"
+	if err := os.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+func TestRequestRestartDoesNotWait(t *testing.T) {
+	calls := fakeSystemctl(t)
+	manager := &linuxManager{serviceName: "konta", user: true}
+
+	start := time.Now()
+	if err := manager.RequestRestart(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("RequestRestart waited %s for the restart", elapsed)
+	}
+
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "--user --no-block restart konta" {
+		t.Errorf("systemctl called with %q", got)
+	}
+}
+
+func TestUnitContent(t *testing.T) {
+	system := (&linuxManager{binaryPath: "/usr/local/bin/konta", runtime: "docker"}).unitContent()
+	for _, line := range []string{"Requires=docker.service", "User=root", "ExecStart=/usr/local/bin/konta run --watch", "WantedBy=multi-user.target"} {
+		if !strings.Contains(system, line+"\n") {
+			t.Errorf("system unit misses %q:\n%s", line, system)
+		}
+	}
+
+	t.Setenv("DOCKER_HOST", "unix:///run/user/1000/podman/podman.sock")
+	t.Setenv("KONTA_RUNTIME", "podman")
+	user := (&linuxManager{binaryPath: "/home/deploy/bin/konta", user: true, runtime: "podman"}).unitContent()
+	for _, line := range []string{
+		"Wants=podman.socket",
+		"Environment=DOCKER_HOST=unix:///run/user/1000/podman/podman.sock",
+		"Environment=KONTA_RUNTIME=podman",
+		"ExecStart=/home/deploy/bin/konta run --watch",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(user, line+"\n") {
+			t.Errorf("user unit misses %q:\n%s", line, user)
+		}
+	}
+	for _, line := range []string{"User=root", "docker.service"} {
+		if strings.Contains(user, line) {
+			t.Errorf("user unit has %q:\n%s", line, user)
+		}
+	}
+}
+
+func TestUserServiceFile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/home/deploy/.config")
+	if got := UserServiceFile(); got != "/home/deploy/.config/systemd/user/konta.service" {
+		t.Errorf("UserServiceFile() = %s", got)
+	}
+	if runtime.GOOS != "linux" {
+		return
+	}
+	if manager := NewManager("/usr/local/bin/konta", Options{User: true}); manager.FilePath() != UserServiceFile() {
+		t.Errorf("user manager writes %s", manager.FilePath())
+	}
+	if manager := NewManager("/usr/local/bin/konta", Options{}); manager.FilePath() != defaultLinuxServiceFile {
+		t.Errorf("system manager writes %s", manager.FilePath())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 )
@@ -23,11 +24,30 @@ type Manager interface {
 	Start() error
 	Stop() error
 	Restart() error
+	// RequestRestart queues a restart without waiting for it, so the
+	// daemon can restart itself and still handle the stop signal.
+	RequestRestart() error
 	IsRunning() bool
 	StatusOutput() (string, error)
 }
 
-func NewManager(binaryPath string) Manager {
+// Options select the flavour of the daemon.
+type Options struct {
+	User    bool   // systemd user unit for rootless setups (Linux only)
+	Runtime string // docker (default) or podman
+}
+
+// UserServiceFile is the path of the systemd user unit.
+func UserServiceFile() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		homeDir, _ := os.UserHomeDir()
+		configDir = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configDir, "systemd", "user", defaultLinuxServiceName+".service")
+}
+
+func NewManager(binaryPath string, opts Options) Manager {
 	if runtime.GOOS == "darwin" {
 		return &darwinManager{
 			serviceName: defaultDarwinServiceName,
@@ -36,10 +56,21 @@ func NewManager(binaryPath string) Manager {
 		}
 	}
 
+	if opts.User {
+		return &linuxManager{
+			serviceName: defaultLinuxServiceName,
+			serviceFile: UserServiceFile(),
+			binaryPath:  binaryPath,
+			user:        true,
+			runtime:     opts.Runtime,
+		}
+	}
+
 	return &linuxManager{
 		serviceName: defaultLinuxServiceName,
 		serviceFile: defaultLinuxServiceFile,
 		binaryPath:  binaryPath,
+		runtime:     opts.Runtime,
 	}
 }
 
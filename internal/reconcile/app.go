@@ -0,0 +1,108 @@
+package reconcile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/state"
+)
+
+// Manual app lifecycle actions for `konta app`. Unlike raw docker compose
+// commands they keep ProjectState in sync, so the health check does not fight
+// an operator's decision and does not count it as a self-heal attempt.
+
+// StopApp stops the containers of an app's active stack and marks the app as
+// stopped, so health checks and deploys leave it down until StartApp.
+func (r *Reconciler) StopApp(app string) error {
+	target, err := r.ComposeTarget(app)
+	if err != nil {
+		return err
+	}
+	log := projectLog(app).With(logger.Fields{"stack": target.Stack, "commit": shortCommitFrom(target.Commit)})
+
+	cmd := r.ComposeCommandFor(target, "stop")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to stop app %s: %w", app, err)
+	}
+
+	if err := state.SetProjectStopped(app, true); err != nil {
+		return fmt.Errorf("app %s stopped, but failed to record it in state (the health check may start it again): %w", app, err)
+	}
+	log.Info("App stopped by operator")
+	return nil
+}
+
+// StartApp starts an app's active stack at the commit it was deployed from
+// and clears the stopped mark and the self-heal counter.
+func (r *Reconciler) StartApp(app string) error {
+	target, err := r.ComposeTarget(app)
+	if err != nil {
+		return err
+	}
+
+	if err := r.startProjectWithContext(app, target.Commit, r.appsDirForCommit(target.Commit)); err != nil {
+		return err
+	}
+
+	r.clearOperatorMarks(app)
+	projectLog(app).Info("App started by operator")
+	return nil
+}
+
+// RestartApp restarts the containers of an app's active stack, or only the
+// given services. A restart is not a self-heal attempt and leaves the counter
+// alone.
+func (r *Reconciler) RestartApp(app string, services ...string) error {
+	if stoppedByOperator(app) {
+		return fmt.Errorf("app %s is stopped, start it with konta app start %s", app, app)
+	}
+
+	target, err := r.ComposeTarget(app)
+	if err != nil {
+		return err
+	}
+	log := projectLog(app).With(logger.Fields{"stack": target.Stack, "commit": shortCommitFrom(target.Commit)})
+
+	cmd := r.ComposeCommandFor(target, append([]string{"restart"}, services...)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to restart app %s: %w", app, err)
+	}
+
+	log.Info("App restarted by operator")
+	return nil
+}
+
+// RedeployApp deploys an app from the reconciler's release the same way a
+// deploy cycle does, records the commit as the app's deployed commit and
+// resets the self-heal counter. It also starts an app that was stopped.
+func (r *Reconciler) RedeployApp(app string) error {
+	if _, err := os.Stat(filepath.Join(r.appsDir, app, "docker-compose.yml")); err != nil {
+		return fmt.Errorf("app %s is not in release %s", app, r.shortDeployCommit())
+	}
+
+	if err := r.reconcileProjectWithContext(app, r.deployCommit, r.appsDir); err != nil {
+		return fmt.Errorf("failed to redeploy app %s: %w", app, err)
+	}
+
+	if err := state.SetProjectLastCommit(app, r.deployCommit); err != nil {
+		projectLog(app).Warn("Failed to record deployed commit: %v", err)
+	}
+	r.clearOperatorMarks(app)
+	projectLog(app).With(logger.Fields{"commit": r.shortDeployCommit()}).Info("App redeployed by operator")
+	return nil
+}
+
+// clearOperatorMarks hands the app back to the health check: it is no longer
+// stopped and starts with a fresh self-heal budget.
+func (r *Reconciler) clearOperatorMarks(app string) {
+	if err := state.SetProjectStopped(app, false); err != nil {
+		projectLog(app).Warn("Failed to clear stopped mark: %v", err)
+	}
+	r.resetSelfHealAttemptsAfterSuccess(app)
+}
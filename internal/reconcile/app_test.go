@@ -0,0 +1,84 @@
+package reconcile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/dockerutil"
+	"github.com/talyguryn/konta/internal/state"
+)
+
+func composeCalled(docker *fakeDocker, command string) bool {
+	for _, args := range docker.compose {
+		if strings.Contains(" "+strings.Join(args, " ")+" ", " "+command+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStoppedAppIsLeftAloneUntilStarted(t *testing.T) {
+	docker := &fakeDocker{
+		containers: []dockerutil.ContainerDetails{testContainer("c1", "web", "web", "web")},
+		services:   "web",
+	}
+	r := newTestReconciler(t, map[string]string{"web": webCompose}, docker)
+	if _, err := state.IncrementProjectSelfHealAttempts("web"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.StopApp("web"); err != nil {
+		t.Fatal(err)
+	}
+	if !composeCalled(docker, "stop") {
+		t.Errorf("compose calls = %v, want stop", docker.compose)
+	}
+	if stopped, _ := state.IsProjectStopped("web"); !stopped {
+		t.Fatal("stopped mark not recorded")
+	}
+
+	if err := r.RestartApp("web"); err == nil || !strings.Contains(err.Error(), "konta app start web") {
+		t.Errorf("restart of a stopped app: err = %v", err)
+	}
+
+	r.SetChangedProjects([]string{"web"})
+	plan, err := r.BuildPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 1 || plan.Actions[0].Type != ActionNone || !strings.HasPrefix(plan.Actions[0].Reason, reasonStoppedByOperator) {
+		t.Errorf("deploy plan = %+v, want the stopped app skipped", plan.Actions)
+	}
+	if action, _ := r.planHealthAction("web"); action.Type != ActionNone || action.Reason != reasonStoppedByOperator {
+		t.Errorf("health action = %+v, want none", action)
+	}
+	if statuses, err := r.Status([]string{"web"}); err != nil || !statuses[0].OperatorStopped || statuses[0].Drift != "" {
+		t.Errorf("status = %+v, %v", statuses, err)
+	}
+
+	if err := r.StartApp("web"); err != nil {
+		t.Fatal(err)
+	}
+	if stopped, _ := state.IsProjectStopped("web"); stopped {
+		t.Error("stopped mark left after start")
+	}
+	if attempts, _ := state.GetProjectSelfHealAttempts("web"); attempts != 0 {
+		t.Errorf("self-heal attempts = %d after start, want a fresh budget", attempts)
+	}
+}
+
+func TestRestartAppRestartsGivenServices(t *testing.T) {
+	docker := &fakeDocker{}
+	r := newTestReconciler(t, map[string]string{"web": webCompose}, docker)
+
+	if err := r.RestartApp("web", "web"); err != nil {
+		t.Fatal(err)
+	}
+	last := docker.compose[len(docker.compose)-1]
+	if got := strings.Join(last[len(last)-2:], " "); got != "restart web" {
+		t.Errorf("compose args = %v, want restart web", last)
+	}
+	if err := r.RedeployApp("missing"); err == nil || !strings.Contains(err.Error(), "not in release") {
+		t.Errorf("redeploy of an unknown app: err = %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package reconcile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/talyguryn/konta/internal/compose"
+	"github.com/talyguryn/konta/internal/dockerutil"
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/state"
+	"gopkg.in/yaml.v3"
+)
+
+// Config drift policies (deploy.self_heal.config_drift).
+const (
+	ConfigDriftHeal   = "heal"   // redeploy the app from its release
+	ConfigDriftReport = "report" // log and show the drift, change nothing
+	ConfigDriftIgnore = "ignore" // do not compare container configs
+)
+
+// resolvedServices returns the services of a stack as docker compose
+// resolves them from the release.
+func (r *Reconciler) resolvedServices(stack string, composePath string) (map[string]compose.ResolvedService, error) {
+	cmd := r.docker.ComposeCommand("-p", stack, "-f", composePath, "config", "--format", "json")
+	cmd.Dir = filepath.Dir(composePath)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve compose config for stack %s: %w", stack, err)
+	}
+	return compose.ParseResolved(output)
+}
+
+// configHashOverridePath is where the override that labels a stack's
+// containers with their config hash is kept. It lives in the state dir so the
+// release dirs stay identical to the commit.
+func configHashOverridePath(stack string) string {
+	return filepath.Join(state.GetStateDir(), "overrides", stack+".yml")
+}
+
+// writeConfigHashOverride writes the compose override that stamps each
+// service of the stack with the hash of its resolved config. It returns the
+// extra compose arguments, or none when the config cannot be resolved: the
+// stack is then deployed without the label and checked field by field.
+func (r *Reconciler) writeConfigHashOverride(project string, stack string, composePath string) []string {
+	log := projectLog(project).With(logger.Fields{"stack": stack})
+	services, err := r.resolvedServices(stack, composePath)
+	if err != nil {
+		log.Warn("Deploying without %s labels: %v", compose.ConfigHashLabel, err)
+		return nil
+	}
+
+	override := map[string]map[string]interface{}{"services": {}}
+	for name, service := range services {
+		override["services"][name] = map[string]interface{}{
+			"labels": map[string]string{compose.ConfigHashLabel: service.ConfigHash()},
+		}
+	}
+	data, err := yaml.Marshal(override)
+	if err != nil {
+		log.Warn("Deploying without %s labels: %v", compose.ConfigHashLabel, err)
+		return nil
+	}
+
+	path := configHashOverridePath(stack)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Warn("Deploying without %s labels: %v", compose.ConfigHashLabel, err)
+		return nil
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Warn("Deploying without %s labels: %v", compose.ConfigHashLabel, err)
+		return nil
+	}
+	return []string{"-f", path}
+}
+
+// composeFileArgs returns the -f arguments for a stack: its compose file and,
+// when the stack was deployed with one, its config hash override. Compose
+// commands on a deployed stack pass both, or compose would see a changed
+// config and recreate the containers without the label.
+func composeFileArgs(stack string, composePath string) []string {
+	args := []string{"-f", composePath}
+	if _, err := os.Stat(configHashOverridePath(stack)); err == nil {
+		args = append(args, "-f", configHashOverridePath(stack))
+	}
+	return args
+}
+
+// removeConfigHashOverride deletes the override of a stack that was taken down.
+func removeConfigHashOverride(stack string) {
+	if err := os.Remove(configHashOverridePath(stack)); err != nil && !os.IsNotExist(err) {
+		logger.Debug("Failed to remove config hash override of stack %s: %v", stack, err)
+	}
+}
+
+// configDriftPolicy returns deploy.self_heal.config_drift of an app,
+// defaulting to heal.
+func (r *Reconciler) configDriftPolicy(project string) string {
+	switch policy := r.deployConf(project).SelfHeal.ConfigDrift; policy {
+	case ConfigDriftReport, ConfigDriftIgnore:
+		return policy
+	default:
+		return ConfigDriftHeal
+	}
+}
+
+// configDrift compares the containers of a stack with the resolved config of
+// its release and returns a field-level reason, or "" without drift.
+// Containers carrying the config-hash label are compared by hash first;
+// containers without it, e.g. deployed by an older Konta or replaced with
+// `docker run`, are compared field by field only.
+func (r *Reconciler) configDrift(stack string, composePath string) (string, error) {
+	services, err := r.resolvedServices(stack, composePath)
+	if err != nil {
+		return "", err
+	}
+
+	containers, err := r.inspectStackConfigs(stack)
+	if err != nil {
+		return "", err
+	}
+
+	reasons := make([]string, 0)
+	for _, container := range containers {
+		labels := container.Config.Labels
+		if labels["konta.stopped"] == "true" {
+			continue
+		}
+		serviceName := labels["com.docker.compose.service"]
+		service, ok := services[serviceName]
+		if !ok {
+			// Unknown services are reported by the service set check.
+			continue
+		}
+
+		fields := containerConfigDiff(service, container.Config)
+		stamped := labels[compose.ConfigHashLabel]
+		if len(fields) == 0 && (stamped == "" || stamped == service.ConfigHash()) {
+			continue
+		}
+		if len(fields) == 0 {
+			fields = []string{"config hash (ports, volumes or restart policy)"}
+		}
+		reasons = append(reasons, fmt.Sprintf("service %s: %s", serviceName, strings.Join(fields, ", ")))
+	}
+
+	sort.Strings(reasons)
+	return strings.Join(reasons, "; "), nil
+}
+
+// inspectStackConfigs returns the inspect details of every managed container
+// of a stack.
+func (r *Reconciler) inspectStackConfigs(stack string) ([]dockerutil.ContainerDetails, error) {
+	containers, err := r.managedContainers(inStack(stack))
+	if err != nil {
+		return nil, err
+	}
+	return r.docker.Inspect(containerIDs(containers)...)
+}
+
+// containerConfigDiff lists the fields where a container differs from its
+// service. Only what the compose file sets is compared: the image adds its own
+// env vars, command and labels. Env values are never printed.
+func containerConfigDiff(service compose.ResolvedService, actual dockerutil.ContainerConfig) []string {
+	fields := make([]string, 0)
+
+	if service.Image != "" && service.Image != actual.Image {
+		fields = append(fields, fmt.Sprintf("image (%s, expected %s)", actual.Image, service.Image))
+	}
+
+	env := make(map[string]string, len(actual.Env))
+	for _, item := range actual.Env {
+		key, value, _ := strings.Cut(item, "=")
+		env[key] = value
+	}
+	changedEnv := make([]string, 0)
+	for key, value := range service.Environment {
+		if value == nil {
+			continue
+		}
+		if actualValue, ok := env[key]; !ok || actualValue != *value {
+			changedEnv = append(changedEnv, key)
+		}
+	}
+	if len(changedEnv) > 0 {
+		sort.Strings(changedEnv)
+		fields = append(fields, fmt.Sprintf("environment (%s)", strings.Join(changedEnv, ", ")))
+	}
+
+	if len(service.Command) > 0 && !sameStringList(service.Command, actual.Cmd) {
+		fields = append(fields, "command")
+	}
+	if len(service.Entrypoint) > 0 && !sameStringList(service.Entrypoint, actual.Entrypoint) {
+		fields = append(fields, "entrypoint")
+	}
+
+	changedLabels := make([]string, 0)
+	for key, value := range service.Labels {
+		if key == compose.ConfigHashLabel {
+			continue
+		}
+		if actualValue, ok := actual.Labels[key]; !ok || actualValue != value {
+			changedLabels = append(changedLabels, key)
+		}
+	}
+	if len(changedLabels) > 0 {
+		sort.Strings(changedLabels)
+		fields = append(fields, fmt.Sprintf("labels (%s)", strings.Join(changedLabels, ", ")))
+	}
+
+	return fields
+}
+
+func sameStringList(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
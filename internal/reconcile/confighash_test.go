@@ -0,0 +1,129 @@
+package reconcile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/compose"
+	"github.com/talyguryn/konta/internal/dockerutil"
+)
+
+const webResolved = `{"services":{"web":{"image":"nginx:1.27","environment":{"MODE":"prod"},"ports":[{"target":80,"published":"8080"}]}}}`
+
+// stampedContainer returns the web container as deployed from webResolved.
+func stampedContainer(t *testing.T) dockerutil.ContainerDetails {
+	t.Helper()
+	services, err := compose.ParseResolved([]byte(webResolved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := testContainer("c1", "web", "web", "web")
+	container.Config.Env = []string{"MODE=prod", "PATH=/usr/bin"}
+	container.Config.Labels[compose.ConfigHashLabel] = services["web"].ConfigHash()
+	return container
+}
+
+func TestConfigHashOverride(t *testing.T) {
+	docker := &fakeDocker{resolved: webResolved}
+	r := newTestReconciler(t, map[string]string{"web": webCompose}, docker)
+	composePath := filepath.Join(r.appsDir, "web", "docker-compose.yml")
+
+	if args := composeFileArgs("web", composePath); len(args) != 2 {
+		t.Errorf("args without an override = %v", args)
+	}
+
+	args := r.writeConfigHashOverride("web", "web", composePath)
+	if len(args) != 2 || args[1] != configHashOverridePath("web") {
+		t.Fatalf("override args = %v", args)
+	}
+	data, err := os.ReadFile(args[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := stampedContainer(t).Config.Labels[compose.ConfigHashLabel]
+	if !strings.Contains(string(data), compose.ConfigHashLabel+": "+hash) {
+		t.Errorf("override =\n%s\nwant the label %s", data, hash)
+	}
+	if got := composeFileArgs("web", composePath); len(got) != 4 || got[3] != args[1] {
+		t.Errorf("args with an override = %v", got)
+	}
+
+	removeConfigHashOverride("web")
+	if len(composeFileArgs("web", composePath)) != 2 {
+		t.Error("override left after removal")
+	}
+
+	docker.resolved = "not json"
+	if args := r.writeConfigHashOverride("web", "web", composePath); args != nil {
+		t.Errorf("args for an unresolvable config = %v, want none", args)
+	}
+}
+
+func TestConfigDrift(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(container *dockerutil.ContainerDetails)
+		want   string
+	}{
+		{"matching", func(*dockerutil.ContainerDetails) {}, ""},
+		{"unstamped", func(container *dockerutil.ContainerDetails) {
+			delete(container.Config.Labels, compose.ConfigHashLabel)
+		}, ""},
+		{"stamped with another hash", func(container *dockerutil.ContainerDetails) {
+			container.Config.Labels[compose.ConfigHashLabel] = "0000000000000000"
+		}, "service web: config hash (ports, volumes or restart policy)"},
+		{"changed env and image", func(container *dockerutil.ContainerDetails) {
+			container.Config.Env = []string{"MODE=debug"}
+			container.Config.Image = "nginx:1.25"
+		}, "service web: image (nginx:1.25, expected nginx:1.27), environment (MODE)"},
+		{"stopped by konta", func(container *dockerutil.ContainerDetails) {
+			container.Config.Image = "nginx:1.25"
+			container.Config.Labels["konta.stopped"] = "true"
+		}, ""},
+	}
+	for _, tt := range tests {
+		container := stampedContainer(t)
+		tt.change(&container)
+		docker := &fakeDocker{containers: []dockerutil.ContainerDetails{container}, resolved: webResolved}
+		r := newTestReconciler(t, map[string]string{"web": webCompose}, docker)
+
+		got, err := r.configDrift("web", filepath.Join(r.appsDir, "web", "docker-compose.yml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: drift = %q, want %q", tt.name, got, tt.want)
+		}
+		if strings.Contains(got, "debug") {
+			t.Errorf("%s: env value in %q", tt.name, got)
+		}
+	}
+}
+
+func TestConfigDriftPolicy(t *testing.T) {
+	container := stampedContainer(t)
+	container.Config.Image = "nginx:1.25"
+	docker := &fakeDocker{containers: []dockerutil.ContainerDetails{container}, services: "web", resolved: webResolved}
+	r := newTestReconciler(t, map[string]string{"web": webCompose}, docker)
+
+	reason, action, err := r.healthProblem("web", "web", r.deployCommit, r.appsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != ActionRestore || !strings.HasPrefix(reason, "config drift: service web: image") {
+		t.Errorf("heal: %s %q", action, reason)
+	}
+
+	r.config.Deploy.SelfHeal.ConfigDrift = ConfigDriftReport
+	reason, action, _ = r.healthProblem("web", "web", r.deployCommit, r.appsDir)
+	if action != ActionNone || !strings.HasSuffix(reason, "(reported only, config_drift=report)") {
+		t.Errorf("report: %s %q", action, reason)
+	}
+
+	r.config.Deploy.SelfHeal.ConfigDrift = ConfigDriftIgnore
+	if reason, action, _ = r.healthProblem("web", "web", r.deployCommit, r.appsDir); reason != "" {
+		t.Errorf("ignore: %s %q", action, reason)
+	}
+}
@@ -0,0 +1,118 @@
+package reconcile
+
+import (
+	"github.com/talyguryn/konta/internal/dockerutil"
+	"github.com/talyguryn/konta/internal/logger"
+)
+
+// inventory returns every container Docker knows about. It is listed once and
+// shared by all checks of a cycle; code that changes containers calls
+// invalidateInventory so the next check lists them again.
+func (r *Reconciler) inventory() ([]dockerutil.Container, error) {
+	if r.containers != nil {
+		return r.containers, nil
+	}
+
+	containers, err := r.docker.Containers()
+	if err != nil {
+		return nil, err
+	}
+	if containers == nil {
+		containers = []dockerutil.Container{}
+	}
+	r.containers = containers
+	return containers, nil
+}
+
+// invalidateInventory drops the snapshot after containers were created,
+// started, stopped or removed.
+func (r *Reconciler) invalidateInventory() {
+	r.containers = nil
+}
+
+// managedContainers returns the Konta-managed containers of the snapshot that
+// match all filters.
+func (r *Reconciler) managedContainers(filters ...containerFilter) ([]dockerutil.Container, error) {
+	containers, err := r.inventory()
+	if err != nil {
+		return nil, err
+	}
+	return filterContainers(containers, append([]containerFilter{isManaged}, filters...)...), nil
+}
+
+type containerFilter func(dockerutil.Container) bool
+
+func filterContainers(containers []dockerutil.Container, filters ...containerFilter) []dockerutil.Container {
+	matched := make([]dockerutil.Container, 0)
+	for _, container := range containers {
+		ok := true
+		for _, filter := range filters {
+			if !filter(container) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, container)
+		}
+	}
+	return matched
+}
+
+func isManaged(c dockerutil.Container) bool {
+	return c.Managed()
+}
+
+func inStack(stack string) containerFilter {
+	return func(c dockerutil.Container) bool { return c.Stack() == stack }
+}
+
+func ofApp(app string) containerFilter {
+	return func(c dockerutil.Container) bool { return c.Labels["konta.app"] == app }
+}
+
+func markedStopped(c dockerutil.Container) bool {
+	return c.Labels["konta.stopped"] == "true"
+}
+
+func inState(state string) containerFilter {
+	return func(c dockerutil.Container) bool { return c.State == state }
+}
+
+// appFilter selects an app's containers by konta.app when its stacks carry
+// the label, and by the compose project otherwise.
+func (r *Reconciler) appFilter(project string) containerFilter {
+	if r.appHasLabeledStacks(project) {
+		return ofApp(project)
+	}
+	return inStack(project)
+}
+
+func containerIDs(containers []dockerutil.Container) []string {
+	ids := make([]string, 0, len(containers))
+	for _, container := range containers {
+		ids = append(ids, container.ID)
+	}
+	return ids
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// stopMarkedContainers stops running containers labeled konta.stopped=true.
+func (r *Reconciler) stopMarkedContainers(containers []dockerutil.Container) {
+	for _, container := range filterContainers(containers, markedStopped, inState("running")) {
+		logger.Info("Stopping container marked with konta.stopped=true: %s", shortID(container.ID))
+		if r.dryRun {
+			continue
+		}
+		if err := r.docker.Stop(container.ID); err != nil {
+			logger.Warn("Failed to stop container %s: %v", shortID(container.ID), err)
+		}
+		r.invalidateInventory()
+	}
+}
@@ -0,0 +1,551 @@
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/talyguryn/konta/internal/hooks"
+	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/state"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// ErrInterrupted is returned by Apply when its context was done before all
+// actions ran. The actions that ran are in the result.
+var ErrInterrupted = errors.New("interrupted before the plan was applied")
+
+// Plan kinds.
+const (
+	PlanDeploy      = "deploy"       // apps changed in a new commit
+	PlanHealthCheck = "health_check" // no new commit, converge running stacks
+	PlanCleanup     = "cleanup"      // repository changed outside the apps directory
+)
+
+// Plan action types.
+const (
+	ActionDeploy  = "deploy"  // compose up of the app at the plan commit
+	ActionRestore = "restore" // self-heal with a full reconcile
+	ActionStart   = "start"   // self-heal by starting stopped containers
+	ActionRemove  = "remove"  // take down an orphan stack
+	ActionNone    = "none"    // nothing to do, the reason says why
+)
+
+// reasonStoppedByOperator is the plan reason for apps stopped with
+// `konta app stop`.
+const reasonStoppedByOperator = "stopped by operator"
+
+// reasonHealthy is the plan reason for apps the health check found fine.
+const reasonHealthy = "healthy"
+
+// Deploy strategies reported in plan actions.
+const (
+	StrategyCreate             = "create"
+	StrategyRestart            = "restart"
+	StrategyRolling            = "rolling"
+	StrategyMigrateToRolling   = "migrate_to_rolling"
+	StrategyMigrateFromRolling = "migrate_from_rolling"
+)
+
+// BuildPlan computes the actions of a deploy cycle: orphan stacks to remove,
+// then every desired app in order, deployed when it changed. Docker is only
+// inspected, nothing is changed.
+func (r *Reconciler) BuildPlan() (*types.Plan, error) {
+	desired, err := r.getDesiredProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get desired projects: %w", err)
+	}
+	logger.Info("Found %d desired projects", len(desired))
+
+	running, err := r.getRunningProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get running projects: %w", err)
+	}
+	logger.Info("Found %d running Konta-managed projects", len(running))
+
+	plan := r.newPlan(PlanDeploy)
+	plan.Actions = append(plan.Actions, planOrphanRemovals(desired, running)...)
+
+	for _, project := range desired {
+		// nil changedProjects means reconcile all projects
+		if r.changedProjects != nil && !r.changedProjects[project] {
+			plan.Actions = append(plan.Actions, types.PlanAction{App: project, Type: ActionNone, Reason: "no changes detected"})
+			continue
+		}
+		if stoppedByOperator(project) {
+			plan.Actions = append(plan.Actions, types.PlanAction{App: project, Type: ActionNone, Reason: reasonStoppedByOperator + ", changes are applied on konta app start"})
+			continue
+		}
+
+		reason := "app changed"
+		if r.changedProjects == nil {
+			reason = "full reconcile"
+		}
+
+		action := types.PlanAction{
+			App:    project,
+			Type:   ActionDeploy,
+			Reason: reason,
+			Commit: r.deployCommit,
+			// A running rolling stack (<app>-<8hex>) means the app already exists.
+			New: !isProjectPresentInRunning(project, running),
+		}
+		// Resolution errors are left to the executor, which fails the app
+		// the same way a deploy without a plan would.
+		if stack, _, err := r.resolveTargetProjectName(project, r.deployCommit, r.appsDir); err == nil {
+			action.Stack = stack
+		}
+		action.Strategy, action.Destructive = r.planStrategy(project, r.appsDir)
+
+		plan.Actions = append(plan.Actions, action)
+	}
+
+	return plan, nil
+}
+
+// BuildHealthPlan checks every desired app against the stack and commit it
+// should run and plans the self-heal actions that converge it, followed by
+// orphan removals. Apps that need healing but are blocked by the self-heal
+// config are planned as ActionNone with the reason.
+func (r *Reconciler) BuildHealthPlan() (*types.Plan, error) {
+	desired, err := r.getDesiredProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get desired projects: %w", err)
+	}
+	logger.Debug("Checking health of %d desired projects", len(desired))
+
+	plan := r.newPlan(PlanHealthCheck)
+	plan.Actions = r.planHealthActions(desired)
+
+	// Orphans are cleaned up even when no code changes are detected.
+	running, err := r.getRunningProjects()
+	if err != nil {
+		logger.Warn("Failed to get running projects: %v", err)
+	} else {
+		plan.Actions = append(plan.Actions, planOrphanRemovals(desired, running)...)
+	}
+
+	return plan, nil
+}
+
+// BuildHealthPlanFor checks only the given apps, e.g. those a Docker event was
+// received for. Apps that are not in the repository are left to the next
+// full health check, which also removes orphans.
+func (r *Reconciler) BuildHealthPlanFor(apps []string) (*types.Plan, error) {
+	desired, err := r.getDesiredProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get desired projects: %w", err)
+	}
+
+	selected := make([]string, 0, len(apps))
+	for _, project := range desired {
+		if contains(apps, project) {
+			selected = append(selected, project)
+		}
+	}
+
+	plan := r.newPlan(PlanHealthCheck)
+	plan.Actions = r.planHealthActions(selected)
+	return plan, nil
+}
+
+func (r *Reconciler) planHealthActions(projects []string) []types.PlanAction {
+	actions := make([]types.PlanAction, 0, len(projects))
+	for _, project := range projects {
+		if action, ok := r.planHealthAction(project); ok {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// BuildCleanupPlan plans only the removal of orphan stacks, for commits that
+// change the repository but no app.
+func (r *Reconciler) BuildCleanupPlan() (*types.Plan, error) {
+	desired, err := r.getDesiredProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get desired projects: %w", err)
+	}
+
+	running, err := r.getRunningProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get running projects: %w", err)
+	}
+
+	plan := r.newPlan(PlanCleanup)
+	plan.Actions = planOrphanRemovals(desired, running)
+	return plan, nil
+}
+
+// planHealthAction decides how to heal one app. It returns false when the app
+// could not be checked; the reason is logged.
+func (r *Reconciler) planHealthAction(project string) (types.PlanAction, bool) {
+	log := projectLog(project)
+	if stoppedByOperator(project) {
+		log.Debug("Health check decision: status=stopped reason=%s action=none", reasonStoppedByOperator)
+		return types.PlanAction{App: project, Type: ActionNone, Reason: reasonStoppedByOperator}, true
+	}
+	expectedCommit, targetSource, _, err := r.resolveExpectedCommitForProject(project)
+	if err != nil {
+		log.Warn("Failed to resolve expected commit: %v", err)
+		expectedCommit = r.deployCommit
+		targetSource = "current fallback (resolver error)"
+	}
+
+	projectAppsDir := r.appsDirForCommit(expectedCommit)
+	targetProjectName, _, err := r.resolveTargetProjectName(project, expectedCommit, projectAppsDir)
+	if err != nil {
+		log.Warn("Failed to resolve target stack: %v", err)
+		return types.PlanAction{}, false
+	}
+
+	log = log.With(logger.Fields{"stack": targetProjectName, "commit": shortCommitFrom(expectedCommit)})
+	log.Debug("Health check target: source=%s", targetSource)
+
+	reason, actionType, err := r.healthProblem(project, targetProjectName, expectedCommit, projectAppsDir)
+	if err != nil {
+		log.Warn("%v", err)
+		return types.PlanAction{}, false
+	}
+
+	if reason == "" {
+		log.Debug("Health check decision: status=healthy reason=none action=none source=%s", targetSource)
+		return types.PlanAction{App: project, Type: ActionNone, Reason: reasonHealthy, Stack: targetProjectName, Commit: expectedCommit}, true
+	}
+
+	if actionType == ActionNone {
+		log.Warn("Health check decision: status=drifted reason=%s action=none", reason)
+		return types.PlanAction{App: project, Type: ActionNone, Reason: reason, Stack: targetProjectName, Commit: expectedCommit}, true
+	}
+
+	if !r.allowSelfHealAttempt(project, reason) {
+		log.Debug("Health check decision: status=unhealthy reason=%s action=skip (retry/config gate)", reason)
+		return types.PlanAction{App: project, Type: ActionNone, Reason: reason + " (self-heal skipped)", Stack: targetProjectName, Commit: expectedCommit}, true
+	}
+
+	healCommit, healSource, syncStateAfterHeal, resolveErr := r.resolveRecoveryCommitForProject(project, expectedCommit, targetProjectName)
+	if resolveErr != nil {
+		log.Warn("Failed to resolve recovery commit: %v", resolveErr)
+		healCommit = expectedCommit
+		healSource = "project state fallback (resolver error)"
+		syncStateAfterHeal = false
+	}
+	healAppsDir := r.appsDirForCommit(healCommit)
+	healStackName, _, stackErr := r.resolveTargetProjectName(project, healCommit, healAppsDir)
+	if stackErr != nil {
+		log.Warn("Failed to resolve recovery stack: %v", stackErr)
+		healStackName = targetProjectName
+	}
+	log.Debug("Health check decision: status=unhealthy reason=%s action=%s recovery_stack=%s recovery_commit=%s recovery_source=%s", reason, actionType, healStackName, shortCommitFrom(healCommit), healSource)
+
+	action := types.PlanAction{
+		App:       project,
+		Type:      actionType,
+		Reason:    reason,
+		Stack:     healStackName,
+		Commit:    healCommit,
+		SyncState: syncStateAfterHeal,
+	}
+	if actionType == ActionRestore {
+		action.Strategy, action.Destructive = r.planStrategy(project, healAppsDir)
+	}
+	return action, true
+}
+
+// healthProblem returns what is wrong with the app's expected stack and the
+// action that fixes it, or an empty reason when the stack is healthy.
+func (r *Reconciler) healthProblem(project string, stack string, commit string, appsDir string) (string, string, error) {
+	// Fully missing → full reconcile (handles rolling naming correctly)
+	if !r.hasAnyContainersForStack(stack) {
+		return "containers are missing", ActionRestore, nil
+	}
+
+	hasDrift, driftReason, err := r.hasDeploymentDrift(project, commit, appsDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to check deployment drift: %w", err)
+	}
+	if hasDrift {
+		return fmt.Sprintf("deployment drift: %s", driftReason), ActionRestore, nil
+	}
+
+	if policy := r.configDriftPolicy(project); policy != ConfigDriftIgnore {
+		// A compose without `config --format json` must not stop the
+		// other checks, so the error is only logged.
+		configDrift, err := r.configDrift(stack, filepath.Join(appsDir, project, "docker-compose.yml"))
+		if err != nil {
+			projectLog(project).Warn("Failed to check config drift: %v", err)
+		}
+		if configDrift != "" && policy == ConfigDriftReport {
+			return fmt.Sprintf("config drift: %s (reported only, config_drift=report)", configDrift), ActionNone, nil
+		}
+		if configDrift != "" {
+			return fmt.Sprintf("config drift: %s", configDrift), ActionRestore, nil
+		}
+	}
+
+	hasStoppedContainers, err := r.hasStoppedContainersForStack(stack)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to check containers: %w", err)
+	}
+	if hasStoppedContainers {
+		return "stopped containers", ActionStart, nil
+	}
+
+	hasUnhealthyContainers, err := r.hasUnhealthyContainersForStack(stack)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to check unhealthy containers: %w", err)
+	}
+	if hasUnhealthyContainers {
+		return "unhealthy containers", ActionRestore, nil
+	}
+
+	return "", "", nil
+}
+
+// stoppedByOperator reports whether the app was stopped with `konta app stop`.
+// An unreadable state is treated as not stopped, like the self-heal counters.
+func stoppedByOperator(project string) bool {
+	stopped, err := state.IsProjectStopped(project)
+	if err != nil {
+		projectLog(project).Warn("Failed to read stopped mark: %v", err)
+		return false
+	}
+	return stopped
+}
+
+// planStrategy tells how deploying the app replaces its running stacks and
+// whether running containers are stopped before the new ones are up.
+func (r *Reconciler) planStrategy(project string, appsDir string) (string, bool) {
+	rolling, err := r.composeHasLabel(filepath.Join(appsDir, project, "docker-compose.yml"), "konta.rolling=true")
+	if err != nil {
+		return "", false
+	}
+
+	stacks, err := r.listStacksForApp(project)
+	if err != nil {
+		return "", false
+	}
+
+	hasLegacy := false
+	hasHashed := false
+	for _, stack := range stacks {
+		if stack == project {
+			hasLegacy = true
+		} else {
+			hasHashed = true
+		}
+	}
+
+	switch {
+	case len(stacks) == 0:
+		return StrategyCreate, false
+	case rolling && hasLegacy:
+		return StrategyMigrateToRolling, true
+	case !rolling && hasHashed:
+		return StrategyMigrateFromRolling, true
+	case rolling:
+		return StrategyRolling, false
+	default:
+		return StrategyRestart, true
+	}
+}
+
+// planOrphanRemovals plans the removal of Konta-managed stacks whose app is no
+// longer in the repository. Rolling stacks (<app>-<hash>) that belong to a
+// desired app are not orphans.
+func planOrphanRemovals(desired []string, running []string) []types.PlanAction {
+	actions := make([]types.PlanAction, 0)
+	for _, project := range running {
+		if isDesiredOrRollingStack(project, desired) {
+			continue
+		}
+		actions = append(actions, types.PlanAction{
+			App:         appFromStack(project, desired),
+			Type:        ActionRemove,
+			Reason:      "app is no longer in the repository",
+			Stack:       project,
+			Destructive: true,
+		})
+	}
+	return actions
+}
+
+func (r *Reconciler) newPlan(kind string) *types.Plan {
+	return &types.Plan{
+		Kind:    kind,
+		Commit:  r.deployCommit,
+		Actions: []types.PlanAction{},
+	}
+}
+
+// Apply executes a plan in order and reports what changed. A dry-run
+// reconciler never executes: the result is what the plan would change.
+// A failed deploy stops the plan; failed removals and self-heals are logged
+// and the plan continues. A done context stops it before the next action.
+func (r *Reconciler) Apply(plan *types.Plan) (*types.ReconcileResult, error) {
+	result := &types.ReconcileResult{
+		Updated: []string{},
+		Added:   []string{},
+		Removed: []string{},
+		Started: []string{},
+		Plan:    plan,
+	}
+
+	if !r.dryRun && plan.Kind == PlanDeploy && r.autoCreateExternalNetworksEnabled("") {
+		if err := r.cleanupManagedExternalNetworks(); err != nil {
+			logger.Warn("Failed to cleanup managed external networks: %v", err)
+		}
+	}
+
+	for index, action := range plan.Actions {
+		if r.ctx != nil && r.ctx.Err() != nil {
+			return result, fmt.Errorf("%w: %d action(s) not run", ErrInterrupted, len(plan.Actions)-index)
+		}
+		log := projectLog(action.App).With(actionFields(action))
+
+		switch action.Type {
+		case ActionRemove:
+			if !r.dryRun {
+				log.Info("Removing orphan Konta-managed project")
+				if err := r.downProject(action.Stack); err != nil {
+					log.Error("Failed to remove project: %v", err)
+					continue
+				}
+			}
+			result.Removed = append(result.Removed, action.Stack)
+
+		case ActionDeploy:
+			if !r.dryRun {
+				if err := r.reconcileProject(action.App); err != nil {
+					result.Failed = action.App
+					return result, fmt.Errorf("failed to reconcile project %s: %w", action.App, err)
+				}
+			}
+			if action.New {
+				result.Added = append(result.Added, action.App)
+			} else {
+				result.Updated = append(result.Updated, action.App)
+			}
+
+		case ActionRestore, ActionStart:
+			r.reportDrift(plan, action)
+			if r.dryRun || r.heal(action, log) {
+				result.Started = append(result.Started, action.App)
+			}
+
+		case ActionNone:
+			r.reportDrift(plan, action)
+		}
+	}
+
+	return result, nil
+}
+
+// heal applies a self-heal action and reports whether the app recovered.
+func (r *Reconciler) heal(action types.PlanAction, log *logger.Entry) bool {
+	r.recordSelfHealAttempt(action.App, action.Reason)
+	appsDir := r.appsDirForCommit(action.Commit)
+
+	var err error
+	if action.Type == ActionStart {
+		log.Info("Project has stopped containers, starting them")
+		err = r.startProjectWithContext(action.App, action.Commit, appsDir)
+	} else {
+		log.Warn("Restoring project with a full reconcile")
+		err = r.reconcileProjectWithContext(action.App, action.Commit, appsDir)
+	}
+	event := hooks.Event{
+		Type:   hooks.EventSelfHeal,
+		App:    action.App,
+		Commit: action.Commit,
+		Stack:  action.Stack,
+		Reason: action.Reason,
+		Status: "success",
+	}
+	if err != nil {
+		// Don't return error, just warn - let other projects continue
+		log.Warn("Failed to recover project: %v", err)
+		event.Status, event.Error = "failure", err.Error()
+		r.eventHooks.RunEvent(event)
+		return false
+	}
+
+	r.finalizeSelfHealSuccess(action.App, action.Commit, action.SyncState, action.Reason)
+	r.eventHooks.RunEvent(event)
+	return true
+}
+
+// reportDrift runs the drift_detected event hook for an app the health check
+// found drifted, whether it gets healed, is only reported or is skipped.
+func (r *Reconciler) reportDrift(plan *types.Plan, action types.PlanAction) {
+	if plan.Kind != PlanHealthCheck || action.Reason == reasonHealthy || action.Reason == reasonStoppedByOperator {
+		return
+	}
+	r.eventHooks.RunEvent(hooks.Event{
+		Type:   hooks.EventDriftDetected,
+		App:    action.App,
+		Commit: action.Commit,
+		Stack:  action.Stack,
+		Reason: action.Reason,
+		Status: action.Type,
+	})
+}
+
+// LogPlan writes one line per action that changes something, so the log of
+// every cycle (and of dry-run) shows the plan it executes.
+func (r *Reconciler) LogPlan(plan *types.Plan) {
+	prefix := ""
+	if r.dryRun {
+		prefix = "[DRY-RUN] "
+	}
+
+	changes := 0
+	for _, action := range plan.Actions {
+		log := projectLog(action.App).With(actionFields(action))
+		if action.Type == ActionNone {
+			log.Debug("%sPlan: no action", prefix)
+			continue
+		}
+		changes++
+		log.Info("%sPlan: %s", prefix, action.Type)
+	}
+
+	logger.With(logger.Fields{"commit": shortCommitFrom(plan.Commit)}).Info("%sPlan %s: %d action(s)", prefix, plan.Kind, changes)
+}
+
+func actionFields(action types.PlanAction) logger.Fields {
+	fields := logger.Fields{"reason": action.Reason}
+	if action.Stack != "" {
+		fields["stack"] = action.Stack
+	}
+	if action.Commit != "" {
+		fields["commit"] = shortCommitFrom(action.Commit)
+	}
+	if action.Strategy != "" {
+		fields["strategy"] = action.Strategy
+	}
+	if action.Destructive {
+		fields["destructive"] = true
+	}
+	return fields
+}
+
+// PlanSummary counts the actions of a plan by type, e.g. "2 deploy, 1 remove".
+func PlanSummary(plan *types.Plan) string {
+	counts := map[string]int{}
+	for _, action := range plan.Actions {
+		counts[action.Type]++
+	}
+
+	parts := make([]string, 0)
+	for _, actionType := range []string{ActionDeploy, ActionRestore, ActionStart, ActionRemove} {
+		if counts[actionType] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[actionType], actionType))
+		}
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,77 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/hooks"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+func TestApplyStopsBetweenActionsWhenContextIsDone(t *testing.T) {
+	plan := &types.Plan{Kind: PlanDeploy, Actions: []types.PlanAction{
+		{App: "web", Type: ActionDeploy},
+		{App: "api", Type: ActionDeploy},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Reconciler{config: &types.Config{}, dryRun: true}
+	r.SetContext(ctx)
+	result, err := r.Apply(plan)
+	if err != nil || len(result.Updated) != 2 {
+		t.Fatalf("Apply = %v, %v; want both apps", result.Updated, err)
+	}
+
+	cancel()
+	result, err = r.Apply(plan)
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("Apply error = %v, want ErrInterrupted", err)
+	}
+	if len(result.Updated) != 0 || result.Failed != "" {
+		t.Errorf("interrupted Apply ran %v (failed %q)", result.Updated, result.Failed)
+	}
+}
+
+func TestEventHooksForDriftAndFailedApps(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are shell scripts")
+	}
+	r := newTestReconciler(t, map[string]string{"web": webCompose}, &fakeDocker{})
+	out := filepath.Join(t.TempDir(), "runs")
+	script := filepath.Join(t.TempDir(), "event.sh")
+	if err := os.WriteFile(script, []byte(`echo "$KONTA_EVENT $KONTA_APP $KONTA_STATUS $KONTA_ERROR" >> `+out+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	noLimit := 0
+	r.eventHooks = hooks.New(r.repoDir, types.HooksConf{Events: map[string]types.HookEventConf{
+		hooks.EventDriftDetected: {Path: script, RateLimitSeconds: &noLimit},
+		hooks.EventAppFailed:     {Path: script, RateLimitSeconds: &noLimit},
+	}})
+
+	healthCheck := &types.Plan{Kind: PlanHealthCheck}
+	r.reportDrift(healthCheck, types.PlanAction{App: "web", Type: ActionNone, Reason: reasonHealthy})
+	r.reportDrift(healthCheck, types.PlanAction{App: "web", Type: ActionNone, Reason: reasonStoppedByOperator})
+	r.reportDrift(&types.Plan{Kind: PlanDeploy}, types.PlanAction{App: "web", Type: ActionDeploy, Reason: "changed"})
+	r.reportDrift(healthCheck, types.PlanAction{App: "web", Type: ActionRestore, Reason: "containers are missing"})
+
+	if err := r.reportAppFailure("web", r.deployCommit, r.appsDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	deployErr := errors.New("pull failed")
+	if err := r.reportAppFailure("web", r.deployCommit, r.appsDir, deployErr); err != deployErr {
+		t.Errorf("reportAppFailure = %v, want the deploy error", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "drift_detected web restore \napp_failed web  pull failed\n"
+	if string(data) != want {
+		t.Errorf("hook runs:\n%s\nwant:\n%s", data, want)
+	}
+}
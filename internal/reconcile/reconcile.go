@@ -2,16 +2,21 @@ package reconcile
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/talyguryn/konta/internal/compose"
+	"github.com/talyguryn/konta/internal/config"
 	"github.com/talyguryn/konta/internal/dockerutil"
+	"github.com/talyguryn/konta/internal/hooks"
 	"github.com/talyguryn/konta/internal/logger"
+	"github.com/talyguryn/konta/internal/metrics"
+	"github.com/talyguryn/konta/internal/notify"
 	"github.com/talyguryn/konta/internal/state"
 	"github.com/talyguryn/konta/internal/types"
 )
@@ -25,19 +30,49 @@ type Reconciler struct {
 	deployCommit    string
 	docker          dockerutil.Client
 	changedProjects map[string]bool // Track which projects have changes
+	notifier        *notify.Dispatcher
+	eventHooks      *hooks.Runner          // nil in dry-run
+	containers      []dockerutil.Container // inventory snapshot, nil when stale
+	onPlan          func(plan *types.Plan)
+	ctx             context.Context // stops Apply between actions when done
 }
 
-// New creates a new reconciler
-func New(config *types.Config, repoDir string, dryRun bool, deployCommit string) *Reconciler {
+// New creates a new reconciler. The settings file of the checkout in repoDir
+// is merged over the host deploy settings.
+func New(cfg *types.Config, repoDir string, dryRun bool, deployCommit string) *Reconciler {
+	cfg = config.ApplyRepoSettings(cfg, repoDir)
+
+	var notifier *notify.Dispatcher
+	var eventHooks *hooks.Runner
+	if !dryRun {
+		notifier = notify.New(cfg)
+		eventHooks = hooks.New(repoDir, cfg.Hooks)
+	}
 	return &Reconciler{
-		config:          config,
+		config:          cfg,
 		repoDir:         repoDir,
 		dryRun:          dryRun,
-		appsDir:         filepath.Join(repoDir, config.Repository.Path),
+		appsDir:         filepath.Join(repoDir, cfg.Repository.Path),
 		deployCommit:    strings.TrimSpace(deployCommit),
 		docker:          newDockerClient(),
 		changedProjects: make(map[string]bool),
+		notifier:        notifier,
+		eventHooks:      eventHooks,
+	}
+}
+
+// deployConf returns the deploy settings of an app, including its entry in
+// the repository settings file.
+func (r *Reconciler) deployConf(project string) types.DeployConf {
+	if conf, ok := r.config.AppDeploy[project]; ok {
+		return conf
 	}
+	return r.config.Deploy
+}
+
+// projectLog returns a logger entry tagged with the app name.
+func projectLog(project string) *logger.Entry {
+	return logger.With(logger.Fields{"app": project})
 }
 
 func newDockerClient() dockerutil.Client {
@@ -60,70 +95,35 @@ func (r *Reconciler) SetChangedProjects(projects []string) {
 	logger.Debug("Reconciler configured to process %d specific projects: %v", len(projects), projects)
 }
 
-// Reconcile performs the reconciliation
+// SetPlanCallback sets a function Reconcile calls with the plan before it is
+// applied, e.g. to report the apps about to be deployed.
+func (r *Reconciler) SetPlanCallback(onPlan func(plan *types.Plan)) {
+	r.onPlan = onPlan
+}
+
+// SetContext sets a context that stops Apply once it is done. Apply checks it
+// only between actions, so an app is never left half deployed.
+func (r *Reconciler) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+// Reconcile performs the reconciliation: it builds the deploy plan and applies it.
 // Returns detailed information about what was updated, added, removed, etc.
 func (r *Reconciler) Reconcile() (*types.ReconcileResult, error) {
 	logger.Info("Starting reconciliation")
-	if r.autoCreateExternalNetworksEnabled() {
-		if err := r.cleanupManagedExternalNetworks(); err != nil {
-			logger.Warn("Failed to cleanup managed external networks: %v", err)
-		}
-	}
-
-	result := &types.ReconcileResult{
-		Updated: []string{},
-		Added:   []string{},
-		Removed: []string{},
-		Started: []string{},
-	}
 
-	// Get desired projects from git
-	desired, err := r.getDesiredProjects()
+	plan, err := r.BuildPlan()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get desired projects: %w", err)
+		return nil, err
 	}
-
-	logger.Info("Found %d desired projects", len(desired))
-
-	// Get currently running projects (only Konta-managed ones)
-	running, err := r.getRunningProjects()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get running projects: %w", err)
+	r.LogPlan(plan)
+	if r.onPlan != nil {
+		r.onPlan(plan)
 	}
 
-	logger.Info("Found %d running Konta-managed projects", len(running))
-
-	removedOrphans := r.cleanupOrphanProjects(desired, running)
-	result.Removed = append(result.Removed, removedOrphans...)
-
-	// Track which projects were reconciled
-	reconciledProjects := []string{}
-
-	// Reconcile desired projects
-	for _, project := range desired {
-		// Skip projects that haven't changed (unless changedProjects is nil, meaning reconcile all)
-		if r.changedProjects != nil && !r.changedProjects[project] {
-			logger.Info("Skipping project %s (no changes detected)", project)
-			continue
-		}
-
-		// Check if project is new or existing.
-		// A running rolling stack (<app>-<8hex>) means the app already exists
-		// and should be classified as Updated, not Added.
-		isNew := !isProjectPresentInRunning(project, running)
-
-		if err := r.reconcileProject(project); err != nil {
-			result.Failed = project
-			return result, fmt.Errorf("failed to reconcile project %s: %w", project, err)
-		}
-		reconciledProjects = append(reconciledProjects, project)
-
-		// Categorize the action
-		if isNew {
-			result.Added = append(result.Added, project)
-		} else {
-			result.Updated = append(result.Updated, project)
-		}
+	result, err := r.Apply(plan)
+	if err != nil {
+		return result, err
 	}
 
 	logger.Info("Reconciliation complete")
@@ -137,263 +137,108 @@ func (r *Reconciler) HealthCheck() ([]string, error) {
 		logger.Info("Self-heal is disabled (deploy.self_heal.enable=false): health check will not auto-reconcile drift or restarts")
 	}
 
-	// Get desired projects from git
-	desired, err := r.getDesiredProjects()
+	plan, err := r.BuildHealthPlan()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get desired projects: %w", err)
+		return nil, err
 	}
+	r.LogPlan(plan)
 
-	logger.Debug("Checking health of %d desired projects", len(desired))
-
-	// Track which projects were started
-	startedProjects := []string{}
-
-	// Check if all desired projects have their containers running.
-	// Also recover projects whose containers were fully removed (e.g. a rolling
-	// stack wiped by a previous bug or manual intervention).
-	for _, project := range desired {
-		expectedCommit, targetSource, _, err := r.resolveExpectedCommitForProject(project)
-		if err != nil {
-			logger.Warn("Failed to resolve expected commit for project %s: %v", project, err)
-			expectedCommit = r.deployCommit
-			targetSource = "current fallback (resolver error)"
-		}
-
-		projectAppsDir := r.appsDirForCommit(expectedCommit)
-		targetProjectName, _, err := r.resolveTargetProjectName(project, expectedCommit, projectAppsDir)
-		if err != nil {
-			logger.Warn("Failed to resolve target stack for project %s: %v", project, err)
-			continue
-		}
-
-		logger.Debug("Health check target for project %s: stack=%s commit=%s source=%s", project, targetProjectName, shortCommitFrom(expectedCommit), targetSource)
-
-		// Fully missing → full reconcile (handles rolling naming correctly)
-		if !r.hasAnyContainersForStack(targetProjectName) {
-			if !r.allowSelfHealAttempt(project, "containers are missing") {
-				logger.Debug("Health check decision for project %s: status=unhealthy reason=containers are missing action=skip (retry/config gate)", project)
-				continue
-			}
-			r.recordSelfHealAttempt(project, "containers are missing")
-
-			healCommit, healSource, syncStateAfterHeal, resolveErr := r.resolveRecoveryCommitForProject(project, expectedCommit, targetProjectName)
-			if resolveErr != nil {
-				logger.Warn("Failed to resolve recovery commit for project %s: %v", project, resolveErr)
-				healCommit = expectedCommit
-				healSource = "project state fallback (resolver error)"
-				syncStateAfterHeal = false
-			}
-			healAppsDir := r.appsDirForCommit(healCommit)
-			healStackName, _, stackErr := r.resolveTargetProjectName(project, healCommit, healAppsDir)
-			if stackErr != nil {
-				logger.Warn("Failed to resolve recovery stack for project %s: %v", project, stackErr)
-				healStackName = targetProjectName
-			}
-			logger.Debug("Health check decision for project %s: status=unhealthy reason=containers are missing action=full_reconcile recovery_stack=%s recovery_commit=%s recovery_source=%s", project, healStackName, shortCommitFrom(healCommit), healSource)
-
-			logger.Info("Project %s has no containers, running full reconcile to restore it", project)
-			if err := r.reconcileProjectWithContext(project, healCommit, healAppsDir); err != nil {
-				logger.Warn("Failed to restore project %s: %v", project, err)
-			} else {
-				r.finalizeSelfHealSuccess(project, healCommit, syncStateAfterHeal)
-				startedProjects = append(startedProjects, project)
-			}
-			continue
-		}
-
-		hasDrift, driftReason, err := r.hasDeploymentDrift(project, expectedCommit, projectAppsDir)
-		if err != nil {
-			logger.Warn("Failed to check deployment drift for project %s: %v", project, err)
-			continue
-		}
-
-		if hasDrift {
-			if !r.allowSelfHealAttempt(project, fmt.Sprintf("deployment drift: %s", driftReason)) {
-				logger.Debug("Health check decision for project %s: status=unhealthy reason=deployment drift action=skip (retry/config gate)", project)
-				continue
-			}
-			r.recordSelfHealAttempt(project, fmt.Sprintf("deployment drift: %s", driftReason))
-
-			healCommit, healSource, syncStateAfterHeal, resolveErr := r.resolveRecoveryCommitForProject(project, expectedCommit, targetProjectName)
-			if resolveErr != nil {
-				logger.Warn("Failed to resolve recovery commit for project %s: %v", project, resolveErr)
-				healCommit = expectedCommit
-				healSource = "project state fallback (resolver error)"
-				syncStateAfterHeal = false
-			}
-			healAppsDir := r.appsDirForCommit(healCommit)
-			healStackName, _, stackErr := r.resolveTargetProjectName(project, healCommit, healAppsDir)
-			if stackErr != nil {
-				logger.Warn("Failed to resolve recovery stack for project %s: %v", project, stackErr)
-				healStackName = targetProjectName
-			}
-			logger.Debug("Health check decision for project %s: status=unhealthy reason=deployment drift action=full_reconcile recovery_stack=%s recovery_commit=%s recovery_source=%s", project, healStackName, shortCommitFrom(healCommit), healSource)
-
-			logger.Warn("Project %s has deployment drift (%s), running full reconcile", project, driftReason)
-			if err := r.reconcileProjectWithContext(project, healCommit, healAppsDir); err != nil {
-				logger.Warn("Failed to recover drifted project %s: %v", project, err)
-			} else {
-				r.finalizeSelfHealSuccess(project, healCommit, syncStateAfterHeal)
-				startedProjects = append(startedProjects, project)
-			}
-			continue
-		}
-
-		hasStoppedContainers, err := r.hasStoppedContainersForStack(targetProjectName)
-		if err != nil {
-			logger.Warn("Failed to check containers for project %s: %v", project, err)
-			continue
-		}
-
-		if hasStoppedContainers {
-			if !r.allowSelfHealAttempt(project, "stopped containers") {
-				logger.Debug("Health check decision for project %s: status=unhealthy reason=stopped containers action=skip (retry/config gate)", project)
-				continue
-			}
-			r.recordSelfHealAttempt(project, "stopped containers")
-
-			healCommit, healSource, syncStateAfterHeal, resolveErr := r.resolveRecoveryCommitForProject(project, expectedCommit, targetProjectName)
-			if resolveErr != nil {
-				logger.Warn("Failed to resolve recovery commit for project %s: %v", project, resolveErr)
-				healCommit = expectedCommit
-				healSource = "project state fallback (resolver error)"
-				syncStateAfterHeal = false
-			}
-			healAppsDir := r.appsDirForCommit(healCommit)
-			healStackName, _, stackErr := r.resolveTargetProjectName(project, healCommit, healAppsDir)
-			if stackErr != nil {
-				logger.Warn("Failed to resolve recovery stack for project %s: %v", project, stackErr)
-				healStackName = targetProjectName
-			}
-			logger.Debug("Health check decision for project %s: status=unhealthy reason=stopped containers action=start recovery_stack=%s recovery_commit=%s recovery_source=%s", project, healStackName, shortCommitFrom(healCommit), healSource)
-
-			logger.Info("Project %s has stopped containers, starting them", project)
-			if err := r.startProjectWithContext(project, healCommit, healAppsDir); err != nil {
-				logger.Warn("Failed to start project %s: %v", project, err)
-				// Don't return error, just warn - let other projects continue
-			} else {
-				r.finalizeSelfHealSuccess(project, healCommit, syncStateAfterHeal)
-				startedProjects = append(startedProjects, project)
-			}
-			continue
-		}
-
-		hasUnhealthyContainers, err := r.hasUnhealthyContainersForStack(targetProjectName)
-		if err != nil {
-			logger.Warn("Failed to check unhealthy containers for project %s: %v", project, err)
-			continue
-		}
+	result, err := r.Apply(plan)
+	if err != nil {
+		return nil, err
+	}
 
-		if hasUnhealthyContainers {
-			if !r.allowSelfHealAttempt(project, "unhealthy containers") {
-				logger.Debug("Health check decision for project %s: status=unhealthy reason=unhealthy containers action=skip (retry/config gate)", project)
-				continue
-			}
-			r.recordSelfHealAttempt(project, "unhealthy containers")
-
-			healCommit, healSource, syncStateAfterHeal, resolveErr := r.resolveRecoveryCommitForProject(project, expectedCommit, targetProjectName)
-			if resolveErr != nil {
-				logger.Warn("Failed to resolve recovery commit for project %s: %v", project, resolveErr)
-				healCommit = expectedCommit
-				healSource = "project state fallback (resolver error)"
-				syncStateAfterHeal = false
-			}
-			healAppsDir := r.appsDirForCommit(healCommit)
-			healStackName, _, stackErr := r.resolveTargetProjectName(project, healCommit, healAppsDir)
-			if stackErr != nil {
-				logger.Warn("Failed to resolve recovery stack for project %s: %v", project, stackErr)
-				healStackName = targetProjectName
-			}
-			logger.Debug("Health check decision for project %s: status=unhealthy reason=unhealthy containers action=full_reconcile recovery_stack=%s recovery_commit=%s recovery_source=%s", project, healStackName, shortCommitFrom(healCommit), healSource)
-
-			logger.Warn("Project %s has unhealthy containers, running full reconcile", project)
-			if err := r.reconcileProjectWithContext(project, healCommit, healAppsDir); err != nil {
-				logger.Warn("Failed to recover unhealthy project %s: %v", project, err)
-			} else {
-				r.finalizeSelfHealSuccess(project, healCommit, syncStateAfterHeal)
-				startedProjects = append(startedProjects, project)
-			}
-			continue
-		}
+	logger.Info("Health check complete")
+	return result.Started, nil
+}
 
-		logger.Debug("Health check decision for project %s: status=healthy reason=none action=none expected_stack=%s expected_commit=%s source=%s", project, targetProjectName, shortCommitFrom(expectedCommit), targetSource)
+// HealthCheckApps runs the health check for the given apps only and returns
+// the apps that were started or restored.
+func (r *Reconciler) HealthCheckApps(apps []string) ([]string, error) {
+	plan, err := r.BuildHealthPlanFor(apps)
+	if err != nil {
+		return nil, err
 	}
+	r.LogPlan(plan)
 
-	// Remove orphan projects (only Konta-managed ones with konta.managed=true label)
-	// This ensures orphans are cleaned up even when no code changes are detected.
-	// Rolling stacks (<app>-<hash>) that belong to a desired app are NOT orphans.
-	running, err := r.getRunningProjects()
+	result, err := r.Apply(plan)
 	if err != nil {
-		logger.Warn("Failed to get running projects: %v", err)
-	} else {
-		r.cleanupOrphanProjects(desired, running)
+		return nil, err
 	}
-
-	logger.Info("Health check complete")
-	return startedProjects, nil
+	return result.Started, nil
 }
 
 func (r *Reconciler) allowSelfHealAttempt(project string, reason string) bool {
-	if !r.config.Deploy.SelfHeal.Enable {
-		logger.Warn("Skipping self-heal for project %s (%s): disabled by config", project, reason)
+	selfHeal := r.deployConf(project).SelfHeal
+	if !selfHeal.Enable {
+		projectLog(project).With(logger.Fields{"reason": reason}).Warn("Skipping self-heal: disabled by config")
 		return false
 	}
 
-	maxRetry := r.config.Deploy.SelfHeal.MaxRetry
+	maxRetry := selfHeal.MaxRetry
 	if maxRetry <= 0 {
 		return true
 	}
 
 	attempts, err := state.GetProjectSelfHealAttempts(project)
 	if err != nil {
-		logger.Warn("Failed to read self-heal attempts for project %s: %v", project, err)
+		projectLog(project).Warn("Failed to read self-heal attempts: %v", err)
 		return false
 	}
 
 	if attempts >= maxRetry {
-		logger.Warn("Skipping self-heal for project %s (%s): max retry reached (%d/%d)", project, reason, attempts, maxRetry)
+		projectLog(project).With(logger.Fields{"reason": reason}).Warn("Skipping self-heal: max retry reached (%d/%d)", attempts, maxRetry)
 		return false
 	}
 
-	logger.Debug("Self-heal allowed for project %s (%s): attempt %d of %d", project, reason, attempts+1, maxRetry)
+	projectLog(project).With(logger.Fields{"reason": reason}).Debug("Self-heal allowed: attempt %d of %d", attempts+1, maxRetry)
 
 	return true
 }
 
 func (r *Reconciler) recordSelfHealAttempt(project string, reason string) {
+	metrics.ObserveSelfHeal(project)
+
+	log := projectLog(project).With(logger.Fields{"reason": reason})
 	attempts, err := state.IncrementProjectSelfHealAttempts(project)
 	if err != nil {
-		logger.Warn("Failed to persist self-heal attempt for project %s (%s): %v", project, reason, err)
+		log.Warn("Failed to persist self-heal attempt: %v", err)
 		return
 	}
 
-	maxRetry := r.config.Deploy.SelfHeal.MaxRetry
+	maxRetry := r.deployConf(project).SelfHeal.MaxRetry
 	if maxRetry <= 0 {
-		logger.Info("Self-heal attempt #%d for project %s (%s)", attempts, project, reason)
+		log.Info("Self-heal attempt #%d", attempts)
 		return
 	}
 
-	logger.Info("Self-heal attempt #%d/%d for project %s (%s)", attempts, maxRetry, project, reason)
+	log.Info("Self-heal attempt #%d/%d", attempts, maxRetry)
 }
 
 func (r *Reconciler) resetSelfHealAttemptsAfterSuccess(project string) {
 	if err := state.ResetProjectSelfHealAttempts(project); err != nil {
-		logger.Warn("Failed to reset self-heal attempts for project %s: %v", project, err)
+		projectLog(project).Warn("Failed to reset self-heal attempts: %v", err)
 	}
 }
 
-func (r *Reconciler) finalizeSelfHealSuccess(project string, expectedCommit string, syncState bool) {
+func (r *Reconciler) finalizeSelfHealSuccess(project string, expectedCommit string, syncState bool, reason string) {
 	r.resetSelfHealAttemptsAfterSuccess(project)
+	r.notifier.Send(notify.Event{
+		Type:   notify.EventSelfHeal,
+		Commit: expectedCommit,
+		Apps:   []string{project},
+		Reason: reason,
+	})
 	if !syncState {
 		return
 	}
 
 	if err := state.SetProjectLastCommit(project, expectedCommit); err != nil {
-		logger.Warn("Failed to sync project state after self-heal for %s: %v", project, err)
+		projectLog(project).Warn("Failed to sync project state after self-heal: %v", err)
 		return
 	}
 
-	logger.Info("Updated project state after self-heal: %s -> %s", project, shortCommitFrom(expectedCommit))
+	projectLog(project).With(logger.Fields{"commit": shortCommitFrom(expectedCommit)}).Info("Updated project state after self-heal")
 }
 
 // CleanupOrphans removes Konta-managed containers that are no longer in the apps configuration
@@ -401,51 +246,19 @@ func (r *Reconciler) finalizeSelfHealSuccess(project string, expectedCommit stri
 func (r *Reconciler) CleanupOrphans() error {
 	logger.Info("Starting orphan cleanup")
 
-	// Get desired projects from git
-	desired, err := r.getDesiredProjects()
+	plan, err := r.BuildCleanupPlan()
 	if err != nil {
-		return fmt.Errorf("failed to get desired projects: %w", err)
+		return err
 	}
-
-	// Get Konta-managed running projects
-	running, err := r.getRunningProjects()
-	if err != nil {
-		return fmt.Errorf("failed to get running projects: %w", err)
+	r.LogPlan(plan)
+	if _, err := r.Apply(plan); err != nil {
+		return err
 	}
 
-	// Remove orphan projects (only Konta-managed ones).
-	// Rolling stacks (<app>-<hash>) that belong to a desired app are NOT orphans.
-	r.cleanupOrphanProjects(desired, running)
-
 	logger.Info("Orphan cleanup complete")
 	return nil
 }
 
-func (r *Reconciler) cleanupOrphanProjects(desired []string, running []string) []string {
-	removed := make([]string, 0)
-
-	for _, project := range running {
-		if isDesiredOrRollingStack(project, desired) {
-			continue
-		}
-
-		logger.Info("Removing orphan Konta-managed project: %s", project)
-		if r.dryRun {
-			logger.Info("[DRY-RUN] Would remove project: %s", project)
-			continue
-		}
-
-		if err := r.downProject(project); err != nil {
-			logger.Error("Failed to remove project %s: %v", project, err)
-			continue
-		}
-
-		removed = append(removed, project)
-	}
-
-	return removed
-}
-
 func (r *Reconciler) getDesiredProjects() ([]string, error) {
 	entries, err := os.ReadDir(r.appsDir)
 	if err != nil {
@@ -471,8 +284,7 @@ func (r *Reconciler) getDesiredProjects() ([]string, error) {
 func (r *Reconciler) getRunningProjects() ([]string, error) {
 	// Get all Konta-managed projects (including stopped containers).
 	// For rolling stacks prefer base app label (konta.app) so desired-vs-running comparison remains stable.
-	cmd := r.docker.Command("ps", "-a", "--filter", "label=konta.managed=true", "--format", "{{.Label \"konta.app\"}}|{{.Label \"com.docker.compose.project\"}}")
-	output, err := cmd.Output()
+	containers, err := r.managedContainers()
 	if err != nil {
 		logger.Warn("Failed to get running projects: %v", err)
 		return []string{}, nil
@@ -480,21 +292,9 @@ func (r *Reconciler) getRunningProjects() ([]string, error) {
 
 	projects := []string{}
 	seen := make(map[string]bool)
-	for _, line := range strings.Split(string(output), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		parts := strings.SplitN(line, "|", 2)
-		if len(parts) != 2 {
-			continue
-		}
-
-		appName := strings.TrimSpace(parts[0])
-		composeProject := strings.TrimSpace(parts[1])
-		projectKey := composeProject
-		if appName != "" {
+	for _, container := range containers {
+		projectKey := container.Stack()
+		if appName := container.Labels["konta.app"]; appName != "" {
 			projectKey = appName
 		}
 
@@ -512,7 +312,63 @@ func (r *Reconciler) reconcileProject(project string) error {
 	return r.reconcileProjectWithContext(project, r.deployCommit, r.appsDir)
 }
 
+// reconcileProjectWithContext deploys an app, running the pre and post hooks
+// in its .konta directory around it. A failed pre hook fails the deploy; a
+// failed post hook is only logged.
 func (r *Reconciler) reconcileProjectWithContext(project string, deployCommit string, appsDir string) error {
+	appHooks := hooks.ForApp(filepath.Join(appsDir, project), r.config.Hooks)
+	if !appHooks.HasAppHooks() {
+		return r.reportAppFailure(project, deployCommit, appsDir, r.deployProject(project, deployCommit, appsDir))
+	}
+
+	stack, _, err := r.resolveTargetProjectName(project, deployCommit, appsDir)
+	if err != nil {
+		return r.reportAppFailure(project, deployCommit, appsDir, err)
+	}
+	previousCommit, _ := state.GetProjectLastCommit(project)
+	appHooks.SetContext(hooks.Context{
+		App:            project,
+		Commit:         deployCommit,
+		PreviousCommit: previousCommit,
+		Stack:          stack,
+		ReleaseDir:     r.releaseDirOf(appsDir),
+	})
+
+	if err := appHooks.RunAppPre(); err != nil {
+		return r.reportAppFailure(project, deployCommit, appsDir, fmt.Errorf("app %s: %w", project, err))
+	}
+	err = r.deployProject(project, deployCommit, appsDir)
+	if hookErr := appHooks.RunAppPost(err); hookErr != nil {
+		projectLog(project).Warn("%v", hookErr)
+	}
+	return r.reportAppFailure(project, deployCommit, appsDir, err)
+}
+
+// reportAppFailure runs the app_failed event hook when err is set and
+// returns err.
+func (r *Reconciler) reportAppFailure(project string, deployCommit string, appsDir string, err error) error {
+	if err == nil || r.eventHooks == nil {
+		return err
+	}
+	stack, _, _ := r.resolveTargetProjectName(project, deployCommit, appsDir)
+	previousCommit, _ := state.GetProjectLastCommit(project)
+	r.eventHooks.RunEvent(hooks.Event{
+		Type:           hooks.EventAppFailed,
+		App:            project,
+		Commit:         deployCommit,
+		PreviousCommit: previousCommit,
+		Stack:          stack,
+		Error:          err.Error(),
+	})
+	return err
+}
+
+// releaseDirOf returns the release checkout an apps directory belongs to.
+func (r *Reconciler) releaseDirOf(appsDir string) string {
+	return strings.TrimSuffix(filepath.Clean(appsDir), string(filepath.Separator)+filepath.Clean(r.config.Repository.Path))
+}
+
+func (r *Reconciler) deployProject(project string, deployCommit string, appsDir string) error {
 	composePath := filepath.Join(appsDir, project, "docker-compose.yml")
 	workDir := filepath.Join(appsDir, project)
 	targetProjectName, projectShortCommit, err := r.resolveTargetProjectName(project, deployCommit, appsDir)
@@ -520,7 +376,8 @@ func (r *Reconciler) reconcileProjectWithContext(project string, deployCommit st
 		return err
 	}
 
-	logger.Info("Reconciling project: %s", project)
+	log := projectLog(project).With(logger.Fields{"stack": targetProjectName, "commit": projectShortCommit})
+	log.Info("Reconciling project")
 
 	rollingEnabled, err := r.composeHasLabel(composePath, "konta.rolling=true")
 	if err != nil {
@@ -538,30 +395,20 @@ func (r *Reconciler) reconcileProjectWithContext(project string, deployCommit st
 		}
 
 		if hasLegacyStack {
-			logger.Info("Restarting non-rolling project %s before compose up to free host-bound resources", project)
-			if !r.dryRun {
-				if err := r.downComposeProjectWithContext(project, composePath, workDir, false); err != nil {
-					return fmt.Errorf("failed to restart non-rolling project %s before compose up: %w", project, err)
-				}
+			log.Info("Restarting non-rolling project before compose up to free host-bound resources")
+			if err := r.downComposeProjectWithContext(project, composePath, workDir, false); err != nil {
+				return fmt.Errorf("failed to restart non-rolling project %s before compose up: %w", project, err)
 			}
 		}
 	}
 
-	if r.dryRun {
-		logger.Info("[DRY-RUN] Would run docker compose for %s (target stack: %s)", project, targetProjectName)
-		return nil
-	}
-
 	if err := r.ensureExternalNetworks(composePath, project); err != nil {
 		return fmt.Errorf("failed to prepare external networks for project %s: %w", project, err)
 	}
 
-	cmd := r.docker.ComposeCommand(
-		"-p", targetProjectName,
-		"-f", composePath,
-		"up", "-d",
-		"--remove-orphans",
-	)
+	upArgs := append([]string{"-p", targetProjectName, "-f", composePath}, r.writeConfigHashOverride(project, targetProjectName, composePath)...)
+	upArgs = append(upArgs, "up", "-d", "--remove-orphans")
+	cmd := r.docker.ComposeCommand(upArgs...)
 
 	cmd.Dir = workDir
 	var stderr bytes.Buffer
@@ -570,36 +417,36 @@ func (r *Reconciler) reconcileProjectWithContext(project string, deployCommit st
 	// Add Konta management labels to all containers in this stack
 	cmd.Env = append(os.Environ(), fmt.Sprintf("COMPOSE_PROJECT_LABELS=konta.managed=true,konta.app=%s,konta.commit=%s", project, projectShortCommit))
 
-	if err := cmd.Run(); err != nil {
+	// Compose creates and replaces containers, so later checks list them again.
+	err = cmd.Run()
+	r.invalidateInventory()
+	if err != nil {
 		stderrStr := stderr.String()
 
 		// Check if error is due to container name conflict
 		if strings.Contains(stderrStr, "already in use by container") {
-			logger.Warn("Container name conflict detected, attempting cleanup")
+			log.Warn("Container name conflict detected, attempting cleanup")
 
 			// Try to remove conflicting containers by forcing down with project name
 			// This handles renamed projects (e.g., example-web -> konta-web)
 			if cleanupErr := r.cleanupConflictingContainers(project); cleanupErr != nil {
-				logger.Warn("Cleanup failed: %v", cleanupErr)
+				log.Warn("Cleanup failed: %v", cleanupErr)
 			}
 
 			// Retry docker compose up
-			cmd = r.docker.ComposeCommand(
-				"-p", targetProjectName,
-				"-f", composePath,
-				"up", "-d",
-				"--remove-orphans",
-			)
+			cmd = r.docker.ComposeCommand(upArgs...)
 			cmd.Dir = workDir
 			cmd.Stdout = os.Stderr
 			cmd.Stderr = os.Stderr
 			cmd.Env = append(os.Environ(), fmt.Sprintf("COMPOSE_PROJECT_LABELS=konta.managed=true,konta.app=%s,konta.commit=%s", project, projectShortCommit))
 
-			if retryErr := cmd.Run(); retryErr != nil {
+			retryErr := cmd.Run()
+			r.invalidateInventory()
+			if retryErr != nil {
 				return fmt.Errorf("docker compose failed after cleanup retry: %w (original: %v)", retryErr, stderrStr)
 			}
 
-			logger.Info("Successfully resolved container name conflict")
+			log.Info("Successfully resolved container name conflict")
 		} else {
 			// Not a conflict error, return original error with stderr
 			return fmt.Errorf("docker compose failed: %w\nStderr: %s", err, stderrStr)
@@ -614,13 +461,13 @@ func (r *Reconciler) reconcileProjectWithContext(project string, deployCommit st
 		}
 
 		if !hasHealthcheck {
-			logger.Warn("Rolling deployment for project %s has no healthcheck defined. Verifying containers are stably running before cleanup. Consider adding a healthcheck for safer rolling deployments.", project)
-			if err := r.waitForProjectRunningWithRetries(targetProjectName, r.config.Deploy.RollingHealthTimeoutSeconds, r.config.Deploy.RollingHealthRetries); err != nil {
+			log.Warn("Rolling deployment has no healthcheck defined. Verifying containers are stably running before cleanup. Consider adding a healthcheck for safer rolling deployments.")
+			if err := r.waitForProjectRunningWithRetries(targetProjectName, r.deployConf(project).RollingHealthTimeoutSeconds, r.deployConf(project).RollingHealthRetries); err != nil {
 				_ = r.downComposeProjectWithContext(targetProjectName, composePath, workDir, true)
 				return fmt.Errorf("rolling deployment runtime check failed for project %s: %w", project, err)
 			}
 		} else {
-			if err := r.waitForProjectHealthyWithRetries(targetProjectName, r.config.Deploy.RollingHealthTimeoutSeconds, r.config.Deploy.RollingHealthRetries); err != nil {
+			if err := r.waitForProjectHealthyWithRetries(targetProjectName, r.deployConf(project).RollingHealthTimeoutSeconds, r.deployConf(project).RollingHealthRetries); err != nil {
 				_ = r.downComposeProjectWithContext(targetProjectName, composePath, workDir, true)
 				return fmt.Errorf("rolling deployment healthcheck failed for project %s: %w", project, err)
 			}
@@ -628,16 +475,25 @@ func (r *Reconciler) reconcileProjectWithContext(project string, deployCommit st
 	}
 
 	if err := r.cleanupOldStacksForApp(project, targetProjectName, composePath, workDir); err != nil {
-		logger.Warn("Failed to cleanup old stacks for project %s: %v", project, err)
+		log.Warn("Failed to cleanup old stacks: %v", err)
 	}
 
 	// After successful compose up, immediately stop containers marked with konta.stopped=true
 	r.stopContainersMarkedAsStopped(project)
+	r.recordActiveStack(project, targetProjectName, deployCommit)
 
-	logger.Info("Project %s reconciled successfully (stack: %s)", project, targetProjectName)
+	log.Info("Project reconciled successfully")
 	return nil
 }
 
+// recordActiveStack stores the stack an app now runs as, so commands like
+// `konta compose` can find its project name and release dir.
+func (r *Reconciler) recordActiveStack(project string, stack string, commit string) {
+	if err := state.SetProjectActiveStack(project, stack, commit); err != nil {
+		projectLog(project).Warn("Failed to record active stack: %v", err)
+	}
+}
+
 func (r *Reconciler) cleanupConflictingContainers(project string) error {
 	// Find all containers (including non-managed) that might conflict
 	// This is safe because we only remove containers with names defined in the compose file
@@ -649,46 +505,37 @@ func (r *Reconciler) cleanupConflictingContainers(project string) error {
 		return fmt.Errorf("failed to parse compose file: %w", err)
 	}
 
+	containers, err := r.inventory()
+	if err != nil {
+		return err
+	}
+
 	// Remove each container if it exists
-	for _, containerName := range containerNames {
-		// Check if container exists
-		checkCmd := r.docker.Command("ps", "-aq", "--filter", fmt.Sprintf("name=^%s$", containerName))
-		output, err := checkCmd.Output()
-		if err != nil || len(output) == 0 {
-			continue // Container doesn't exist, skip
+	for _, container := range containers {
+		if !contains(containerNames, container.Name) {
+			continue
 		}
 
-		containerID := strings.TrimSpace(string(output))
-		logger.Info("Removing conflicting container: %s (%s)", containerName, containerID)
-
-		removeCmd := r.docker.Command("rm", "-f", containerID)
-		if err := removeCmd.Run(); err != nil {
-			logger.Warn("Failed to remove container %s: %v", containerName, err)
+		logger.Info("Removing conflicting container: %s (%s)", container.Name, shortID(container.ID))
+		if err := r.docker.Remove(container.ID); err != nil {
+			logger.Warn("Failed to remove container %s: %v", container.Name, err)
 		}
 	}
 
+	r.invalidateInventory()
 	return nil
 }
 
 func (r *Reconciler) getContainerNamesFromCompose(composePath string) ([]string, error) {
-	data, err := os.ReadFile(composePath)
+	file, err := compose.Load(composePath)
 	if err != nil {
 		return nil, err
 	}
 
-	// Simple YAML parsing to find container_name fields
-	// This is a basic implementation - could be improved with proper YAML parsing
 	var names []string
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "container_name:") {
-			parts := strings.SplitN(trimmed, ":", 2)
-			if len(parts) == 2 {
-				name := strings.TrimSpace(parts[1])
-				name = strings.Trim(name, `"'`)
-				names = append(names, name)
-			}
+	for _, name := range file.ServiceNames() {
+		if containerName := file.Services[name].ContainerName; containerName != "" {
+			names = append(names, containerName)
 		}
 	}
 
@@ -709,7 +556,7 @@ func (r *Reconciler) downProject(project string) error {
 	}
 
 	for _, stack := range stacks {
-		logger.Info("Removing orphan stack %s for app %s (full cleanup: containers, networks, volumes, images)", stack, project)
+		projectLog(project).With(logger.Fields{"stack": stack}).Info("Removing orphan stack (full cleanup: containers, networks, volumes, images)")
 		if err := r.downComposeProject(stack, true); err != nil {
 			return err
 		}
@@ -738,20 +585,14 @@ func (r *Reconciler) handleProjectModeMigration(baseProject string, targetProjec
 	}
 
 	if rollingEnabled && hasLegacy && baseProject != targetProjectName {
-		logger.Info("Migrating project %s from non-rolling to rolling mode via restart", baseProject)
-		if r.dryRun {
-			return nil
-		}
+		projectLog(baseProject).With(logger.Fields{"stack": targetProjectName}).Info("Migrating project from non-rolling to rolling mode via restart")
 		if err := r.downComposeProjectWithContext(baseProject, composePath, workDir, false); err != nil {
 			return fmt.Errorf("failed migration down for project %s: %w", baseProject, err)
 		}
 	}
 
 	if !rollingEnabled && hasHashed {
-		logger.Info("Migrating project %s from rolling to non-rolling mode via restart", baseProject)
-		if r.dryRun {
-			return nil
-		}
+		projectLog(baseProject).With(logger.Fields{"stack": targetProjectName}).Info("Migrating project from rolling to non-rolling mode via restart")
 		for _, stack := range stacks {
 			if stack != baseProject {
 				if err := r.downComposeProjectWithContext(stack, composePath, workDir, false); err != nil {
@@ -783,24 +624,16 @@ func (r *Reconciler) cleanupOldStacksForApp(baseProject string, keepStack string
 }
 
 func (r *Reconciler) listStacksForApp(baseProject string) ([]string, error) {
-	cmd := r.docker.Command("ps", "-a", "--filter", "label=konta.managed=true", "--format", "{{.Label \"konta.app\"}}|{{.Label \"com.docker.compose.project\"}}")
-	output, err := cmd.Output()
+	containers, err := r.managedContainers()
 	if err != nil {
 		return nil, err
 	}
 
 	seen := make(map[string]bool)
 	stacks := make([]string, 0)
-	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
-		parts := strings.SplitN(line, "|", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		appName := strings.TrimSpace(parts[0])
-		composeProject := strings.TrimSpace(parts[1])
+	for _, container := range containers {
+		appName := container.Labels["konta.app"]
+		composeProject := container.Stack()
 		if composeProject == "" {
 			continue
 		}
@@ -852,6 +685,7 @@ func (r *Reconciler) downComposeProjectWithContext(projectName string, composePa
 	}
 
 	output, err := cmd.CombinedOutput()
+	r.invalidateInventory()
 	if err != nil {
 		details := strings.TrimSpace(string(output))
 		cmdLine := strings.TrimSpace(strings.Join(cmd.Args, " "))
@@ -867,25 +701,27 @@ func (r *Reconciler) downComposeProjectWithContext(projectName string, composePa
 		return fmt.Errorf("docker compose down failed for %s: %w\nOutput: %s", projectName, err, details)
 	}
 
+	removeConfigHashOverride(projectName)
 	return nil
 }
 
+// composeHasLabel reports whether any service carries the label, given as
+// "key=value" (value compared case-insensitively).
 func (r *Reconciler) composeHasLabel(composePath string, label string) (bool, error) {
-	data, err := os.ReadFile(composePath)
+	file, err := compose.Load(composePath)
 	if err != nil {
 		return false, err
 	}
-	content := strings.ToLower(string(data))
-	return strings.Contains(content, strings.ToLower(label)), nil
+	key, value, _ := strings.Cut(label, "=")
+	return file.HasLabel(key, value), nil
 }
 
 func (r *Reconciler) composeHasHealthcheck(composePath string) (bool, error) {
-	data, err := os.ReadFile(composePath)
+	file, err := compose.Load(composePath)
 	if err != nil {
 		return false, err
 	}
-	content := strings.ToLower(string(data))
-	return strings.Contains(content, "healthcheck:"), nil
+	return file.HasHealthcheck(), nil
 }
 
 func (r *Reconciler) ensureExternalNetworks(composePath string, project string) error {
@@ -897,8 +733,8 @@ func (r *Reconciler) ensureExternalNetworks(composePath string, project string)
 		return nil
 	}
 
-	if !r.autoCreateExternalNetworksEnabled() {
-		logger.Debug("Auto-create external networks disabled for project %s", project)
+	if !r.autoCreateExternalNetworksEnabled(project) {
+		projectLog(project).Debug("Auto-create external networks disabled")
 		return nil
 	}
 
@@ -913,11 +749,8 @@ func (r *Reconciler) ensureExternalNetworks(composePath string, project string)
 			continue
 		}
 
-		logger.Warn("External network %s for project %s not found. Creating it automatically.", networkName, project)
-		createCmd := r.docker.Command("network", "create", networkName)
-		createCmd.Stdout = os.Stderr
-		createCmd.Stderr = os.Stderr
-		if err := createCmd.Run(); err != nil {
+		projectLog(project).With(logger.Fields{"network": networkName}).Warn("External network not found. Creating it automatically.")
+		if err := r.docker.CreateNetwork(networkName); err != nil {
 			return fmt.Errorf("failed to create external network %s: %w", networkName, err)
 		}
 		logger.Info("Created missing external network: %s", networkName)
@@ -933,11 +766,14 @@ func (r *Reconciler) ensureExternalNetworks(composePath string, project string)
 	return nil
 }
 
-func (r *Reconciler) autoCreateExternalNetworksEnabled() bool {
-	if r.config == nil || r.config.Deploy.AutoCreateExternalNetworks == nil {
+// autoCreateExternalNetworksEnabled reports the setting of an app, or the
+// global one for an empty project.
+func (r *Reconciler) autoCreateExternalNetworksEnabled(project string) bool {
+	if r.config == nil {
 		return true
 	}
-	return *r.config.Deploy.AutoCreateExternalNetworks
+	enabled := r.deployConf(project).AutoCreateExternalNetworks
+	return enabled == nil || *enabled
 }
 
 func (r *Reconciler) cleanupManagedExternalNetworks() error {
@@ -963,14 +799,11 @@ func (r *Reconciler) cleanupManagedExternalNetworks() error {
 			continue
 		}
 
-		rmCmd := r.docker.Command("network", "rm", networkName)
-		output, err := rmCmd.CombinedOutput()
-		if err != nil {
-			details := strings.ToLower(strings.TrimSpace(string(output)))
-			if strings.Contains(details, "has active endpoints") {
+		if err := r.docker.RemoveNetwork(networkName); err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "has active endpoints") {
 				continue
 			}
-			return fmt.Errorf("failed to remove unused managed external network %s: %w (%s)", networkName, err, strings.TrimSpace(string(output)))
+			return fmt.Errorf("failed to remove unused managed external network %s: %w", networkName, err)
 		}
 
 		if err := state.RemoveManagedExternalNetwork(networkName); err != nil {
@@ -983,193 +816,19 @@ func (r *Reconciler) cleanupManagedExternalNetworks() error {
 }
 
 func (r *Reconciler) dockerNetworkContainerCount(networkName string) (int, bool, error) {
-	cmd := r.docker.Command("network", "inspect", networkName, "--format", "{{len .Containers}}")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		details := strings.ToLower(strings.TrimSpace(string(output)))
-		if strings.Contains(details, "no such network") {
-			return 0, false, nil
-		}
-		return 0, false, fmt.Errorf("docker network inspect failed for %s: %w (%s)", networkName, err, strings.TrimSpace(string(output)))
-	}
-
-	countStr := strings.TrimSpace(string(output))
-	count, convErr := strconv.Atoi(countStr)
-	if convErr != nil {
-		return 0, true, fmt.Errorf("failed to parse container count for network %s: %w (raw=%q)", networkName, convErr, countStr)
-	}
-
-	return count, true, nil
+	return r.docker.NetworkContainerCount(networkName)
 }
 
 func (r *Reconciler) dockerNetworkExists(networkName string) (bool, error) {
-	cmd := r.docker.Command("network", "ls", "--format", "{{.Name}}")
-	output, err := cmd.Output()
-	if err != nil {
-		return false, err
-	}
-
-	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
-		if strings.TrimSpace(line) == networkName {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return r.docker.NetworkExists(networkName)
 }
 
 func externalNetworkNamesFromCompose(composePath string) ([]string, error) {
-	data, err := os.ReadFile(composePath)
+	file, err := compose.Load(composePath)
 	if err != nil {
 		return nil, err
 	}
-
-	lines := strings.Split(string(data), "\n")
-	networksStart := -1
-	for i, line := range lines {
-		if leadingIndent(line) == 0 && strings.TrimSpace(line) == "networks:" {
-			networksStart = i
-			break
-		}
-	}
-
-	if networksStart == -1 {
-		return nil, nil
-	}
-
-	result := make([]string, 0)
-	seen := make(map[string]bool)
-
-	for i := networksStart + 1; i < len(lines); {
-		line := lines[i]
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" {
-			i++
-			continue
-		}
-
-		indent := leadingIndent(line)
-		if indent == 0 {
-			break
-		}
-
-		if indent != 2 || !strings.HasSuffix(trimmed, ":") {
-			i++
-			continue
-		}
-
-		alias := strings.TrimSuffix(trimmed, ":")
-		alias = parseYAMLValue(alias)
-		if alias == "" {
-			i++
-			continue
-		}
-
-		external := false
-		name := ""
-
-		j := i + 1
-		for ; j < len(lines); j++ {
-			child := lines[j]
-			childTrimmed := strings.TrimSpace(child)
-			if childTrimmed == "" {
-				continue
-			}
-
-			childIndent := leadingIndent(child)
-			if childIndent <= 2 {
-				break
-			}
-
-			if strings.HasPrefix(childTrimmed, "name:") {
-				value := strings.TrimSpace(strings.TrimPrefix(childTrimmed, "name:"))
-				parsed := parseYAMLValue(value)
-				if parsed != "" {
-					name = parsed
-				}
-				continue
-			}
-
-			if strings.HasPrefix(childTrimmed, "external:") {
-				value := strings.TrimSpace(strings.TrimPrefix(childTrimmed, "external:"))
-				parsed := strings.ToLower(parseYAMLValue(value))
-				if parsed == "" || parsed == "true" {
-					external = true
-				}
-
-				if parsed == "" {
-					externalIndent := childIndent
-					for k := j + 1; k < len(lines); k++ {
-						nested := lines[k]
-						nestedTrimmed := strings.TrimSpace(nested)
-						if nestedTrimmed == "" {
-							continue
-						}
-
-						nestedIndent := leadingIndent(nested)
-						if nestedIndent <= externalIndent {
-							break
-						}
-
-						if strings.HasPrefix(nestedTrimmed, "name:") {
-							nestedVal := strings.TrimSpace(strings.TrimPrefix(nestedTrimmed, "name:"))
-							parsedNested := parseYAMLValue(nestedVal)
-							if parsedNested != "" {
-								name = parsedNested
-							}
-						}
-					}
-				}
-			}
-		}
-
-		if external {
-			networkName := alias
-			if name != "" {
-				networkName = name
-			}
-			if networkName != "" && !seen[networkName] {
-				seen[networkName] = true
-				result = append(result, networkName)
-			}
-		}
-
-		i = j
-	}
-
-	sort.Strings(result)
-	return result, nil
-}
-
-func leadingIndent(line string) int {
-	count := 0
-	for _, ch := range line {
-		if ch == ' ' {
-			count++
-			continue
-		}
-		if ch == '\t' {
-			count += 2
-			continue
-		}
-		break
-	}
-	return count
-}
-
-func parseYAMLValue(raw string) string {
-	value := strings.TrimSpace(raw)
-	if value == "" {
-		return ""
-	}
-
-	if idx := strings.Index(value, "#"); idx >= 0 {
-		value = strings.TrimSpace(value[:idx])
-	}
-
-	value = strings.TrimSpace(value)
-	value = strings.Trim(value, `"'`)
-	return strings.TrimSpace(value)
+	return uniqueStrings(file.ExternalNetworks()), nil
 }
 
 func (r *Reconciler) waitForProjectHealthy(projectName string, timeoutSeconds int) error {
@@ -1179,29 +838,17 @@ func (r *Reconciler) waitForProjectHealthy(projectName string, timeoutSeconds in
 
 	deadline := time.Now().Add(time.Duration(timeoutSeconds) * time.Second)
 	for time.Now().Before(deadline) {
-		cmd := r.docker.Command("ps", "-a", "--filter", fmt.Sprintf("label=com.docker.compose.project=%s", projectName), "--format", "{{.State}}|{{.Status}}")
-		output, err := cmd.Output()
+		// Poll Docker directly: the cycle's inventory snapshot would not change.
+		containers, err := r.docker.Containers()
 		if err != nil {
 			return err
 		}
 
-		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
 		allHealthy := true
 		hasContainers := false
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
-			}
+		for _, container := range filterContainers(containers, inStack(projectName)) {
 			hasContainers = true
-			parts := strings.SplitN(line, "|", 2)
-			if len(parts) != 2 {
-				allHealthy = false
-				break
-			}
-			state := strings.TrimSpace(parts[0])
-			status := strings.ToLower(strings.TrimSpace(parts[1]))
-			if state != "running" || !strings.Contains(status, "(healthy)") {
+			if container.State != "running" || container.Health != "healthy" {
 				allHealthy = false
 				break
 			}
@@ -1225,7 +872,7 @@ func (r *Reconciler) waitForProjectHealthyWithRetries(projectName string, timeou
 	var lastErr error
 	for attempt := 1; attempt <= retries; attempt++ {
 		if attempt > 1 {
-			logger.Warn("Retrying health check for stack %s (%d/%d)", projectName, attempt, retries)
+			logger.With(logger.Fields{"stack": projectName}).Warn("Retrying health check (%d/%d)", attempt, retries)
 		}
 
 		if err := r.waitForProjectHealthy(projectName, timeoutSeconds); err != nil {
@@ -1250,22 +897,16 @@ func (r *Reconciler) waitForProjectRunning(projectName string, timeoutSeconds in
 
 	deadline := time.Now().Add(time.Duration(timeoutSeconds) * time.Second)
 	for time.Now().Before(deadline) {
-		cmd := r.docker.Command("ps", "-a", "--filter", fmt.Sprintf("label=com.docker.compose.project=%s", projectName), "--format", "{{.State}}")
-		output, err := cmd.Output()
+		containers, err := r.docker.Containers()
 		if err != nil {
 			return err
 		}
 
-		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
 		allRunning := true
 		hasContainers := false
-		for _, line := range lines {
-			state := strings.TrimSpace(line)
-			if state == "" {
-				continue
-			}
+		for _, container := range filterContainers(containers, inStack(projectName)) {
 			hasContainers = true
-			if state != "running" {
+			if container.State != "running" {
 				allRunning = false
 				break
 			}
@@ -1289,7 +930,7 @@ func (r *Reconciler) waitForProjectRunningWithRetries(projectName string, timeou
 	var lastErr error
 	for attempt := 1; attempt <= retries; attempt++ {
 		if attempt > 1 {
-			logger.Warn("Retrying runtime check for stack %s (%d/%d)", projectName, attempt, retries)
+			logger.With(logger.Fields{"stack": projectName}).Warn("Retrying runtime check (%d/%d)", attempt, retries)
 		}
 
 		if err := r.waitForProjectRunning(projectName, timeoutSeconds); err != nil {
@@ -1370,7 +1011,7 @@ func (r *Reconciler) resolveTargetProjectName(project string, deployCommit strin
 	}
 
 	projectShortCommit := shortCommitFrom(deployCommit)
-	if r.shouldUseHashInProjectName(rollingEnabled) {
+	if r.shouldUseHashInProjectName(project, rollingEnabled) {
 		if projectShortCommit == "" {
 			return "", "", fmt.Errorf("deploy commit is required when hash-based project naming is enabled")
 		}
@@ -1395,9 +1036,10 @@ func (r *Reconciler) expectedStackName(project string, expectedCommit string, us
 
 func (r *Reconciler) disableOutdatedManagedStacks(desired []string) error {
 	for _, project := range desired {
+		log := projectLog(project)
 		expectedCommit, _, _, err := r.resolveExpectedCommitForProject(project)
 		if err != nil {
-			logger.Warn("Failed to resolve expected commit for stale stack cleanup on project %s: %v", project, err)
+			log.Warn("Failed to resolve expected commit for stale stack cleanup: %v", err)
 			continue
 		}
 
@@ -1405,14 +1047,14 @@ func (r *Reconciler) disableOutdatedManagedStacks(desired []string) error {
 		composePath := filepath.Join(appsDir, project, "docker-compose.yml")
 		rollingEnabled, err := r.composeHasLabel(composePath, "konta.rolling=true")
 		if err != nil {
-			logger.Warn("Failed to inspect rolling label for stale stack cleanup on project %s: %v", project, err)
+			log.Warn("Failed to inspect rolling label for stale stack cleanup: %v", err)
 			continue
 		}
 
-		useHashName := r.shouldUseHashInProjectName(rollingEnabled)
+		useHashName := r.shouldUseHashInProjectName(project, rollingEnabled)
 		stacks, err := r.listStacksForApp(project)
 		if err != nil {
-			logger.Warn("Failed to list stacks for stale stack cleanup on project %s: %v", project, err)
+			log.Warn("Failed to list stacks for stale stack cleanup: %v", err)
 			continue
 		}
 
@@ -1426,14 +1068,15 @@ func (r *Reconciler) disableOutdatedManagedStacks(desired []string) error {
 				continue
 			}
 
-			logger.Warn("Disabling outdated managed stack %s for app %s (expected stack: %s)", stack, project, expectedStack)
+			stackLog := log.With(logger.Fields{"stack": stack, "expected_stack": expectedStack})
+			stackLog.Warn("Disabling outdated managed stack")
 			if r.dryRun {
-				logger.Info("[DRY-RUN] Would disable outdated managed stack %s", stack)
+				stackLog.Info("[DRY-RUN] Would disable outdated managed stack")
 				continue
 			}
 
 			if err := r.removeManagedStackContainers(stack); err != nil {
-				logger.Warn("Failed to disable outdated managed stack %s: %v", stack, err)
+				stackLog.Warn("Failed to disable outdated managed stack: %v", err)
 			}
 		}
 	}
@@ -1442,36 +1085,20 @@ func (r *Reconciler) disableOutdatedManagedStacks(desired []string) error {
 }
 
 func (r *Reconciler) removeManagedStackContainers(stackName string) error {
-	listCmd := r.docker.Command(
-		"ps", "-aq",
-		"--filter", "label=konta.managed=true",
-		"--filter", fmt.Sprintf("label=com.docker.compose.project=%s", stackName),
-	)
-
-	output, err := listCmd.Output()
+	containers, err := r.managedContainers(inStack(stackName))
 	if err != nil {
 		return err
 	}
-
-	containerIDs := strings.Fields(strings.TrimSpace(string(output)))
-	if len(containerIDs) == 0 {
+	if len(containers) == 0 {
 		return nil
 	}
 
-	args := append([]string{"rm", "-f"}, containerIDs...)
-	rmCmd := r.docker.Command(args...)
-	rmCmd.Stdout = os.Stderr
-	rmCmd.Stderr = os.Stderr
-
-	if err := rmCmd.Run(); err != nil {
-		return err
-	}
-
-	return nil
+	defer r.invalidateInventory()
+	return r.docker.Remove(containerIDs(containers)...)
 }
 
-func (r *Reconciler) shouldUseHashInProjectName(rollingEnabled bool) bool {
-	mode := strings.ToLower(strings.TrimSpace(r.config.Deploy.ProjectNameHashMode))
+func (r *Reconciler) shouldUseHashInProjectName(project string, rollingEnabled bool) bool {
+	mode := strings.ToLower(strings.TrimSpace(r.deployConf(project).ProjectNameHashMode))
 	switch mode {
 	case "all":
 		return true
@@ -1490,21 +1117,11 @@ func (r *Reconciler) shouldUseHashInProjectName(rollingEnabled bool) bool {
 // "<project>-" are also matched.
 func (r *Reconciler) hasAnyContainersForApp(project string) bool {
 	// Preserved for reconciliation paths that reason about any stack of the app.
-	cmd := r.docker.Command("ps", "-a",
-		"--filter", "label=konta.managed=true",
-		"--filter", fmt.Sprintf("label=konta.app=%s", project),
-		"--format", "{{.ID}}",
-	)
-	if output, err := cmd.Output(); err == nil && strings.TrimSpace(string(output)) != "" {
+	if containers, err := r.managedContainers(ofApp(project)); err == nil && len(containers) > 0 {
 		return true
 	}
 
-	cmd = r.docker.Command("ps", "-a",
-		"--filter", "label=konta.managed=true",
-		"--filter", fmt.Sprintf("label=com.docker.compose.project=%s", project),
-		"--format", "{{.ID}}",
-	)
-	if output, err := cmd.Output(); err == nil && strings.TrimSpace(string(output)) != "" {
+	if containers, err := r.managedContainers(inStack(project)); err == nil && len(containers) > 0 {
 		return true
 	}
 
@@ -1513,14 +1130,8 @@ func (r *Reconciler) hasAnyContainersForApp(project string) bool {
 }
 
 func (r *Reconciler) hasAnyContainersForStack(projectName string) bool {
-	cmd := r.docker.Command("ps", "-a",
-		"--filter", "label=konta.managed=true",
-		"--filter", fmt.Sprintf("label=com.docker.compose.project=%s", projectName),
-		"--format", "{{.ID}}",
-	)
-
-	output, err := cmd.Output()
-	return err == nil && strings.TrimSpace(string(output)) != ""
+	containers, err := r.managedContainers(inStack(projectName))
+	return err == nil && len(containers) > 0
 }
 
 // hasStoppedContainers checks if a project has any stopped containers
@@ -1532,197 +1143,49 @@ func (r *Reconciler) hasStoppedContainers(project string) (bool, error) {
 		return false, err
 	}
 
-	baseFilters := []string{"--filter", "label=konta.managed=true"}
-	if r.appHasLabeledStacks(project) {
-		baseFilters = append(baseFilters, "--filter", fmt.Sprintf("label=konta.app=%s", project))
-	} else {
-		baseFilters = append(baseFilters, "--filter", fmt.Sprintf("label=com.docker.compose.project=%s", project))
-	}
-
-	stopArgs := []string{"ps"}
-	stopArgs = append(stopArgs, baseFilters...)
-	stopArgs = append(stopArgs,
-		"--filter", "label=konta.stopped=true",
-		"--filter", "status=running",
-		"--format", "{{.ID}}",
-	)
-	stopCmd := r.docker.Command(stopArgs...)
-
-	output, err := stopCmd.Output()
-	if err == nil && len(strings.TrimSpace(string(output))) > 0 {
-		containers := strings.Split(strings.TrimSpace(string(output)), "\n")
-		for _, containerID := range containers {
-			if containerID != "" {
-				logger.Info("Stopping container marked with konta.stopped=true: %s", containerID[:12])
-				if !r.dryRun {
-					doStopCmd := r.docker.Command("stop", containerID)
-					if err := doStopCmd.Run(); err != nil {
-						logger.Warn("Failed to stop container %s: %v", containerID[:12], err)
-					}
-				}
-			}
-		}
-	}
-
-	checkArgs := []string{"ps", "-a"}
-	checkArgs = append(checkArgs, baseFilters...)
-	checkArgs = append(checkArgs,
-		"--filter", "status=exited",
-		"--format", "{{.ID}}|{{.Label \"konta.stopped\"}}",
-	)
-	checkCmd := r.docker.Command(checkArgs...)
-
-	output, err = checkCmd.Output()
-	if err != nil {
-		return false, nil
-	}
-
-	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, "|")
-		if len(parts) > 1 && parts[1] != "true" {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return r.hasStoppedContainersMatching(r.appFilter(project)), nil
 }
 
 func (r *Reconciler) hasStoppedContainersForStack(projectName string) (bool, error) {
-	baseFilters := []string{"--filter", "label=konta.managed=true", "--filter", fmt.Sprintf("label=com.docker.compose.project=%s", projectName)}
-
-	stopArgs := []string{"ps"}
-	stopArgs = append(stopArgs, baseFilters...)
-	stopArgs = append(stopArgs,
-		"--filter", "label=konta.stopped=true",
-		"--filter", "status=running",
-		"--format", "{{.ID}}",
-	)
-	stopCmd := r.docker.Command(stopArgs...)
-
-	output, err := stopCmd.Output()
-	if err == nil && len(strings.TrimSpace(string(output))) > 0 {
-		// Found running containers marked to be stopped
-		containers := strings.Split(strings.TrimSpace(string(output)), "\n")
-		for _, containerID := range containers {
-			if containerID != "" {
-				logger.Info("Stopping container marked with konta.stopped=true: %s", containerID[:12])
-				if !r.dryRun {
-					doStopCmd := r.docker.Command("stop", containerID)
-					if err := doStopCmd.Run(); err != nil {
-						logger.Warn("Failed to stop container %s: %v", containerID[:12], err)
-					}
-				}
-			}
-		}
-	}
-
-	// Check for stopped containers that should be running (excluding konta.stopped=true)
-	checkArgs := []string{"ps", "-a"}
-	checkArgs = append(checkArgs, baseFilters...)
-	checkArgs = append(checkArgs,
-		"--filter", "status=exited",
-		"--format", "{{.ID}}|{{.Label \"konta.stopped\"}}",
-	)
-	checkCmd := r.docker.Command(checkArgs...)
+	return r.hasStoppedContainersMatching(inStack(projectName)), nil
+}
 
-	output, err = checkCmd.Output()
+// hasStoppedContainersMatching stops running containers marked with
+// konta.stopped=true and reports whether any other container has exited.
+func (r *Reconciler) hasStoppedContainersMatching(filter containerFilter) bool {
+	containers, err := r.managedContainers(filter)
 	if err != nil {
-		// If command fails, assume no stopped containers
-		return false, nil
+		// If docker cannot be queried, assume no stopped containers
+		return false
 	}
+	r.stopMarkedContainers(containers)
 
-	// Check if any exited containers don't have konta.stopped=true
-	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, "|")
-		if len(parts) > 1 && parts[1] != "true" {
-			// Found a stopped container that should be running
-			return true, nil
+	// Check for stopped containers that should be running (excluding konta.stopped=true)
+	for _, container := range filterContainers(containers, inState("exited")) {
+		if !markedStopped(container) {
+			return true
 		}
 	}
 
-	return false, nil
+	return false
 }
 
 func (r *Reconciler) hasUnhealthyContainers(project string) (bool, error) {
-	baseFilters := []string{"--filter", "label=konta.managed=true"}
-	if r.appHasLabeledStacks(project) {
-		baseFilters = append(baseFilters, "--filter", fmt.Sprintf("label=konta.app=%s", project))
-	} else {
-		baseFilters = append(baseFilters, "--filter", fmt.Sprintf("label=com.docker.compose.project=%s", project))
-	}
-
-	args := []string{"ps", "-a"}
-	args = append(args, baseFilters...)
-	args = append(args, "--format", "{{.Status}}|{{.Label \"konta.stopped\"}}")
-
-	cmd := r.docker.Command(args...)
-	output, err := cmd.Output()
-	if err != nil {
-		return false, err
-	}
-
-	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		parts := strings.SplitN(line, "|", 2)
-		if len(parts) != 2 {
-			continue
-		}
-
-		status := strings.ToLower(strings.TrimSpace(parts[0]))
-		stoppedLabel := strings.TrimSpace(parts[1])
-		if stoppedLabel == "true" {
-			continue
-		}
-
-		if strings.Contains(status, "(unhealthy)") {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return r.hasUnhealthyContainersMatching(r.appFilter(project))
 }
 
 func (r *Reconciler) hasUnhealthyContainersForStack(projectName string) (bool, error) {
-	baseFilters := []string{"--filter", "label=konta.managed=true", "--filter", fmt.Sprintf("label=com.docker.compose.project=%s", projectName)}
-
-	args := []string{"ps", "-a"}
-	args = append(args, baseFilters...)
-	args = append(args, "--format", "{{.Status}}|{{.Label \"konta.stopped\"}}")
+	return r.hasUnhealthyContainersMatching(inStack(projectName))
+}
 
-	cmd := r.docker.Command(args...)
-	output, err := cmd.Output()
+func (r *Reconciler) hasUnhealthyContainersMatching(filter containerFilter) (bool, error) {
+	containers, err := r.managedContainers(filter)
 	if err != nil {
 		return false, err
 	}
 
-	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		parts := strings.SplitN(line, "|", 2)
-		if len(parts) != 2 {
-			continue
-		}
-
-		status := strings.ToLower(strings.TrimSpace(parts[0]))
-		stoppedLabel := strings.TrimSpace(parts[1])
-		if stoppedLabel == "true" {
-			continue
-		}
-
-		if strings.Contains(status, "(unhealthy)") {
+	for _, container := range containers {
+		if !markedStopped(container) && container.Health == "unhealthy" {
 			return true, nil
 		}
 	}
@@ -1745,55 +1208,32 @@ func (r *Reconciler) startProjectWithContext(project string, deployCommit string
 		return fmt.Errorf("failed to inspect rolling label for project %s: %w", project, err)
 	}
 	workDir := filepath.Join(appsDir, project)
+	log := projectLog(project).With(logger.Fields{"stack": targetProjectName, "commit": projectShortCommit})
 
 	if r.hasAnyContainersForStack(targetProjectName) {
-		startCmd := r.docker.Command(
-			"ps",
-			"-a",
-			"--filter", "label=konta.managed=true",
-			"--filter", fmt.Sprintf("label=com.docker.compose.project=%s", targetProjectName),
-			"--filter", "status=exited",
-			"--format", "{{.ID}}",
-		)
-		output, err := startCmd.Output()
-		if err == nil {
-			containerIDs := strings.Fields(string(output))
-			if len(containerIDs) > 0 {
-				if r.dryRun {
-					logger.Info("[DRY-RUN] Would start %d stopped container(s) for project %s", len(containerIDs), project)
-					return nil
-				}
-
-				cmd := r.docker.Command("start")
-				cmd.Args = append(cmd.Args, containerIDs...)
-				cmd.Stdout = os.Stderr
-				cmd.Stderr = os.Stderr
-				if err := cmd.Run(); err == nil {
-					if err := r.finalizeStartedProject(project, targetProjectName, composePath, workDir, rollingEnabled); err != nil {
-						return err
-					}
-					logger.Info("Project %s started successfully", project)
-					return nil
+		exited, err := r.managedContainers(inStack(targetProjectName), inState("exited"))
+		if err == nil && len(exited) > 0 {
+			err := r.docker.Start(containerIDs(exited)...)
+			r.invalidateInventory()
+			if err == nil {
+				if err := r.finalizeStartedProject(project, targetProjectName, composePath, workDir, rollingEnabled); err != nil {
+					return err
 				}
+				r.recordActiveStack(project, targetProjectName, deployCommit)
+				log.Info("Project started successfully")
+				return nil
 			}
+			log.Warn("Failed to start exited containers, falling back to compose up: %v", err)
 		}
 	}
 
-	if r.dryRun {
-		logger.Info("[DRY-RUN] Would start containers for project %s", project)
-		return nil
-	}
-
 	if err := r.ensureExternalNetworks(composePath, project); err != nil {
 		return fmt.Errorf("failed to prepare external networks for project %s: %w", project, err)
 	}
 
-	cmd := r.docker.ComposeCommand(
-		"-p", targetProjectName,
-		"-f", composePath,
-		"up", "-d",
-		"--remove-orphans",
-	)
+	upArgs := append([]string{"-p", targetProjectName, "-f", composePath}, r.writeConfigHashOverride(project, targetProjectName, composePath)...)
+	upArgs = append(upArgs, "up", "-d", "--remove-orphans")
+	cmd := r.docker.ComposeCommand(upArgs...)
 
 	cmd.Dir = workDir
 	cmd.Stdout = os.Stderr
@@ -1801,15 +1241,18 @@ func (r *Reconciler) startProjectWithContext(project string, deployCommit string
 	// Ensure konta management labels are set
 	cmd.Env = append(os.Environ(), fmt.Sprintf("COMPOSE_PROJECT_LABELS=konta.managed=true,konta.app=%s,konta.commit=%s", project, projectShortCommit))
 
-	if err := cmd.Run(); err != nil {
+	err = cmd.Run()
+	r.invalidateInventory()
+	if err != nil {
 		return fmt.Errorf("failed to start project %s: %w", project, err)
 	}
 
 	if err := r.finalizeStartedProject(project, targetProjectName, composePath, workDir, rollingEnabled); err != nil {
 		return err
 	}
+	r.recordActiveStack(project, targetProjectName, deployCommit)
 
-	logger.Info("Project %s started successfully", project)
+	log.Info("Project started successfully")
 	return nil
 }
 
@@ -1824,11 +1267,11 @@ func (r *Reconciler) finalizeStartedProject(project string, targetProjectName st
 	}
 
 	if !hasHealthcheck {
-		if err := r.waitForProjectRunningWithRetries(targetProjectName, r.config.Deploy.RollingHealthTimeoutSeconds, r.config.Deploy.RollingHealthRetries); err != nil {
+		if err := r.waitForProjectRunningWithRetries(targetProjectName, r.deployConf(project).RollingHealthTimeoutSeconds, r.deployConf(project).RollingHealthRetries); err != nil {
 			return fmt.Errorf("rolling runtime check failed for project %s after start: %w", project, err)
 		}
 	} else {
-		if err := r.waitForProjectHealthyWithRetries(targetProjectName, r.config.Deploy.RollingHealthTimeoutSeconds, r.config.Deploy.RollingHealthRetries); err != nil {
+		if err := r.waitForProjectHealthyWithRetries(targetProjectName, r.deployConf(project).RollingHealthTimeoutSeconds, r.deployConf(project).RollingHealthRetries); err != nil {
 			return fmt.Errorf("rolling healthcheck failed for project %s after start: %w", project, err)
 		}
 	}
@@ -1843,78 +1286,33 @@ func (r *Reconciler) finalizeStartedProject(project string, targetProjectName st
 // shouldProjectBeStopped checks if any containers in the project have konta.stopped=true
 func (r *Reconciler) shouldProjectBeStopped(project string) (bool, error) {
 	// Check if any containers are marked with konta.stopped=true
-	cmd := r.docker.Command(
-		"ps",
-		"-a",
-		"--filter", fmt.Sprintf("label=com.docker.compose.project=%s", project),
-		"--filter", "label=konta.managed=true",
-		"--filter", "label=konta.stopped=true",
-		"--format", "{{.ID}}",
-	)
-
-	output, err := cmd.Output()
+	containers, err := r.managedContainers(inStack(project), markedStopped)
 	if err != nil {
 		return false, nil
 	}
 
 	// If we found containers marked to be stopped, project should be stopped
-	return len(strings.TrimSpace(string(output))) > 0, nil
+	return len(containers) > 0, nil
 }
 
 // stopContainersMarkedAsStopped stops any running containers marked with konta.stopped=true
 func (r *Reconciler) stopContainersMarkedAsStopped(project string) {
-	args := []string{"ps", "--filter", "label=konta.managed=true"}
-	if r.appHasLabeledStacks(project) {
-		args = append(args, "--filter", fmt.Sprintf("label=konta.app=%s", project))
-	} else {
-		args = append(args, "--filter", fmt.Sprintf("label=com.docker.compose.project=%s", project))
-	}
-	args = append(args,
-		"--filter", "label=konta.stopped=true",
-		"--filter", "status=running",
-		"--format", "{{.ID}}",
-	)
-
-	stopCmd := r.docker.Command(args...)
-
-	output, err := stopCmd.Output()
-	if err == nil && len(strings.TrimSpace(string(output))) > 0 {
-		// Found running containers marked to be stopped
-		containers := strings.Split(strings.TrimSpace(string(output)), "\n")
-		for _, containerID := range containers {
-			if containerID != "" {
-				logger.Info("Stopping container marked with konta.stopped=true: %s", containerID[:12])
-				if !r.dryRun {
-					doStopCmd := r.docker.Command("stop", containerID)
-					if err := doStopCmd.Run(); err != nil {
-						logger.Warn("Failed to stop container %s: %v", containerID[:12], err)
-					}
-				}
-			}
-		}
+	containers, err := r.managedContainers(r.appFilter(project))
+	if err != nil {
+		return
 	}
+	r.stopMarkedContainers(containers)
 }
 
 func (r *Reconciler) appHasLabeledStacks(project string) bool {
-	cmd := r.docker.Command(
-		"ps", "-a",
-		"--filter", "label=konta.managed=true",
-		"--filter", fmt.Sprintf("label=konta.app=%s", project),
-		"--format", "{{.ID}}",
-	)
-
-	output, err := cmd.Output()
-	if err != nil {
-		return false
-	}
-
-	return strings.TrimSpace(string(output)) != ""
+	containers, err := r.managedContainers(ofApp(project))
+	return err == nil && len(containers) > 0
 }
 
 // stopProject stops all containers for a project
 func (r *Reconciler) stopProject(project string) error {
 	if r.dryRun {
-		logger.Info("[DRY-RUN] Would stop containers for project %s", project)
+		projectLog(project).Info("[DRY-RUN] Would stop containers")
 		return nil
 	}
 
@@ -1926,11 +1324,12 @@ func (r *Reconciler) stopProject(project string) error {
 	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
 
+	defer r.invalidateInventory()
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to stop project %s: %w", project, err)
 	}
 
-	logger.Info("Project %s stopped successfully", project)
+	projectLog(project).Info("Project stopped successfully")
 	return nil
 }
 
@@ -1977,7 +1376,7 @@ func (r *Reconciler) hasDeploymentDrift(project string, expectedCommit string, a
 		return false, "", err
 	}
 
-	useHashName := r.shouldUseHashInProjectName(rollingEnabled)
+	useHashName := r.shouldUseHashInProjectName(project, rollingEnabled)
 	stacks, err := r.listStacksForApp(project)
 	if err != nil {
 		return false, "", err
@@ -2035,19 +1434,15 @@ func (r *Reconciler) getExpectedServicesForStack(stackName string, composePath s
 }
 
 func (r *Reconciler) getRunningManagedServicesForStack(stackName string) ([]string, error) {
-	cmd := r.docker.Command(
-		"ps", "-a",
-		"--filter", "label=konta.managed=true",
-		"--filter", fmt.Sprintf("label=com.docker.compose.project=%s", stackName),
-		"--format", "{{.Label \"com.docker.compose.service\"}}",
-	)
-
-	output, err := cmd.Output()
+	containers, err := r.managedContainers(inStack(stackName))
 	if err != nil {
 		return nil, err
 	}
 
-	services := strings.Split(strings.TrimSpace(string(output)), "\n")
+	services := make([]string, 0, len(containers))
+	for _, container := range containers {
+		services = append(services, container.Labels["com.docker.compose.service"])
+	}
 	return uniqueStrings(services), nil
 }
 
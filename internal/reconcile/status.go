@@ -0,0 +1,245 @@
+package reconcile
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/talyguryn/konta/internal/state"
+)
+
+// ContainerStatus describes one Konta-managed container as reported by Docker.
+type ContainerStatus struct {
+	Name          string `json:"name"`
+	Service       string `json:"service"`
+	Stack         string `json:"stack"`
+	State         string `json:"state"`            // running, exited, restarting, ...
+	Health        string `json:"health,omitempty"` // healthy, unhealthy, starting (empty without healthcheck)
+	Restarts      int    `json:"restarts"`
+	StartedAt     string `json:"started_at,omitempty"`
+	UptimeSeconds int64  `json:"uptime_seconds,omitempty"`
+	Stopped       bool   `json:"konta_stopped,omitempty"` // konta.stopped=true
+}
+
+// AppStatus is the live view of one managed application.
+type AppStatus struct {
+	App              string            `json:"app"`
+	Stack            string            `json:"stack"` // expected stack
+	Commit           string            `json:"commit"`
+	CommitSource     string            `json:"commit_source,omitempty"`
+	Stacks           []string          `json:"running_stacks"`
+	Services         []string          `json:"services"`
+	Containers       []ContainerStatus `json:"containers"`
+	Drift            string            `json:"drift,omitempty"`
+	SelfHealAttempts int               `json:"self_heal_attempts"`
+	InRepository     bool              `json:"in_repository"`
+	OperatorStopped  bool              `json:"operator_stopped,omitempty"` // stopped with `konta app stop`
+}
+
+// Status returns the live state of managed applications without changing
+// anything. When apps is empty, every app from the repository and every app
+// with managed containers is included.
+func (r *Reconciler) Status(apps []string) ([]AppStatus, error) {
+	containers, err := r.inspectManagedContainers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect managed containers: %w", err)
+	}
+
+	// Without a deployed release there is no repository to compare against,
+	// but the containers are still worth showing.
+	desired, err := r.getDesiredProjects()
+	if err != nil {
+		desired = nil
+	}
+
+	byApp := make(map[string][]ContainerStatus)
+	for _, container := range containers {
+		app := container.app
+		if app == "" {
+			app = appFromStack(container.Stack, desired)
+		}
+		byApp[app] = append(byApp[app], container.ContainerStatus)
+	}
+
+	names := apps
+	if len(names) == 0 {
+		names = append([]string{}, desired...)
+		for app := range byApp {
+			names = append(names, app)
+		}
+		names = uniqueStrings(names)
+		sort.Strings(names)
+	}
+
+	statuses := make([]AppStatus, 0, len(names))
+	for _, app := range names {
+		statuses = append(statuses, r.appStatus(app, contains(desired, app), byApp[app]))
+	}
+
+	return statuses, nil
+}
+
+func (r *Reconciler) appStatus(app string, inRepository bool, containers []ContainerStatus) AppStatus {
+	status := AppStatus{
+		App:          app,
+		InRepository: inRepository,
+		Containers:   containers,
+		Stacks:       []string{},
+		Services:     []string{},
+	}
+	if status.Containers == nil {
+		status.Containers = []ContainerStatus{}
+	}
+
+	sort.Slice(status.Containers, func(i, j int) bool {
+		if status.Containers[i].Stack != status.Containers[j].Stack {
+			return status.Containers[i].Stack < status.Containers[j].Stack
+		}
+		return status.Containers[i].Name < status.Containers[j].Name
+	})
+	for _, container := range status.Containers {
+		status.Stacks = append(status.Stacks, container.Stack)
+	}
+	status.Stacks = uniqueStrings(status.Stacks)
+	sort.Strings(status.Stacks)
+
+	if attempts, err := state.GetProjectSelfHealAttempts(app); err == nil {
+		status.SelfHealAttempts = attempts
+	}
+
+	if !inRepository {
+		if len(status.Containers) > 0 {
+			status.Drift = "app is not in the repository (orphan)"
+		} else {
+			status.Drift = "app is not in the repository"
+		}
+		return status
+	}
+
+	commit, source, _, err := r.resolveExpectedCommitForProject(app)
+	if err != nil {
+		status.Drift = fmt.Sprintf("cannot resolve expected commit: %v", err)
+		return status
+	}
+	status.Commit = commit
+	status.CommitSource = source
+
+	appsDir := r.appsDirForCommit(commit)
+	stack, _, err := r.resolveTargetProjectName(app, commit, appsDir)
+	if err != nil {
+		status.Drift = fmt.Sprintf("cannot resolve expected stack: %v", err)
+		return status
+	}
+	status.Stack = stack
+
+	composePath := filepath.Join(appsDir, app, "docker-compose.yml")
+	if services, err := r.getExpectedServicesForStack(stack, composePath); err == nil {
+		status.Services = services
+	}
+
+	// Deliberately stopped apps are expected to have no running containers.
+	if stoppedByOperator(app) {
+		status.OperatorStopped = true
+		return status
+	}
+
+	if len(status.Containers) == 0 {
+		status.Drift = "containers are missing"
+		return status
+	}
+
+	hasDrift, reason, err := r.hasDeploymentDrift(app, commit, appsDir)
+	if err != nil {
+		status.Drift = fmt.Sprintf("cannot check drift: %v", err)
+		return status
+	}
+	if hasDrift {
+		status.Drift = reason
+		return status
+	}
+
+	if r.configDriftPolicy(app) != ConfigDriftIgnore {
+		if configDrift, err := r.configDrift(stack, composePath); err == nil && configDrift != "" {
+			status.Drift = "config drift: " + configDrift
+			return status
+		}
+	}
+
+	for _, container := range status.Containers {
+		if container.Stack != stack || container.Stopped {
+			continue
+		}
+		if container.State != "running" {
+			status.Drift = "stopped containers"
+			return status
+		}
+		if container.Health == "unhealthy" {
+			status.Drift = "unhealthy containers"
+			return status
+		}
+	}
+
+	return status
+}
+
+type managedContainer struct {
+	ContainerStatus
+	app string
+}
+
+// inspectManagedContainers returns every container labeled konta.managed=true
+// with the details `docker inspect` has and the inventory lacks.
+func (r *Reconciler) inspectManagedContainers() ([]managedContainer, error) {
+	managed, err := r.managedContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	inspected, err := r.docker.Inspect(containerIDs(managed)...)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	containers := make([]managedContainer, 0, len(inspected))
+	for _, item := range inspected {
+		labels := item.Config.Labels
+		container := managedContainer{
+			ContainerStatus: ContainerStatus{
+				Name:     strings.TrimPrefix(item.Name, "/"),
+				Service:  labels["com.docker.compose.service"],
+				Stack:    labels["com.docker.compose.project"],
+				State:    item.State.Status,
+				Restarts: item.RestartCount,
+				Stopped:  labels["konta.stopped"] == "true",
+			},
+			app: labels["konta.app"],
+		}
+		if item.State.Health != nil {
+			container.Health = item.State.Health.Status
+		}
+		if item.State.Status == "running" {
+			if startedAt, err := time.Parse(time.RFC3339Nano, item.State.StartedAt); err == nil {
+				container.StartedAt = startedAt.Format(time.RFC3339)
+				container.UptimeSeconds = int64(now.Sub(startedAt).Seconds())
+			}
+		}
+		containers = append(containers, container)
+	}
+
+	return containers, nil
+}
+
+// appFromStack maps a compose project name back to its app for containers
+// deployed before the konta.app label existed.
+func appFromStack(stack string, desired []string) string {
+	if contains(desired, stack) {
+		return stack
+	}
+	if index := strings.LastIndex(stack, "-"); index > 0 && isShortCommitHash(stack[index+1:]) {
+		return stack[:index]
+	}
+	return stack
+}
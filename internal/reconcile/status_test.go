@@ -0,0 +1,201 @@
+package reconcile
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/dockerutil"
+	"github.com/talyguryn/konta/internal/state"
+	"github.com/talyguryn/konta/internal/types"
+)
+
+// fakeDocker serves containers from memory. Compose commands print services
+// for `config --services` and resolved for `config --format json`; every
+// other command succeeds without output.
+type fakeDocker struct {
+	containers []dockerutil.ContainerDetails
+	services   string
+	resolved   string
+	compose    [][]string
+	started    []string
+	stopped    []string
+	removed    []string
+}
+
+func (f *fakeDocker) Command(args ...string) *exec.Cmd {
+	return exec.Command("true")
+}
+
+func (f *fakeDocker) ComposeCommand(args ...string) *exec.Cmd {
+	f.compose = append(f.compose, args)
+	joined := strings.Join(args, " ")
+	switch {
+	case strings.Contains(joined, "config --services"):
+		return exec.Command("echo", f.services)
+	case strings.Contains(joined, "config --format json"):
+		return exec.Command("echo", f.resolved)
+	}
+	return exec.Command("true")
+}
+
+func (f *fakeDocker) Containers() ([]dockerutil.Container, error) {
+	containers := make([]dockerutil.Container, 0, len(f.containers))
+	for _, details := range f.containers {
+		container := dockerutil.Container{
+			ID:     details.ID,
+			Name:   strings.TrimPrefix(details.Name, "/"),
+			Image:  details.Config.Image,
+			State:  details.State.Status,
+			Labels: details.Config.Labels,
+		}
+		if details.State.Health != nil {
+			container.Health = details.State.Health.Status
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+func (f *fakeDocker) Inspect(ids ...string) ([]dockerutil.ContainerDetails, error) {
+	details := make([]dockerutil.ContainerDetails, 0, len(ids))
+	for _, id := range ids {
+		for _, container := range f.containers {
+			if container.ID == id {
+				details = append(details, container)
+			}
+		}
+	}
+	return details, nil
+}
+
+func (f *fakeDocker) Start(ids ...string) error {
+	f.started = append(f.started, ids...)
+	return nil
+}
+
+func (f *fakeDocker) Stop(ids ...string) error {
+	f.stopped = append(f.stopped, ids...)
+	return nil
+}
+
+func (f *fakeDocker) Remove(ids ...string) error {
+	f.removed = append(f.removed, ids...)
+	return nil
+}
+
+func (f *fakeDocker) NetworkExists(name string) (bool, error)              { return true, nil }
+func (f *fakeDocker) NetworkContainerCount(name string) (int, bool, error) { return 0, true, nil }
+func (f *fakeDocker) CreateNetwork(name string) error                      { return nil }
+func (f *fakeDocker) RemoveNetwork(name string) error                      { return nil }
+
+func (f *fakeDocker) Events(filters map[string][]string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+// testContainer returns a running container of a compose service that
+// Konta deployed for app.
+func testContainer(id, app, stack, service string) dockerutil.ContainerDetails {
+	labels := map[string]string{
+		"konta.managed":              "true",
+		"com.docker.compose.project": stack,
+		"com.docker.compose.service": service,
+	}
+	if app != "" {
+		labels["konta.app"] = app
+	}
+	return dockerutil.ContainerDetails{
+		ID:    id,
+		Name:  "/" + stack + "-" + service + "-1",
+		State: dockerutil.ContainerState{Status: "running", StartedAt: "2026-01-02T03:04:05Z"},
+		Config: dockerutil.ContainerConfig{
+			Image:  "nginx:1.27",
+			Labels: labels,
+		},
+	}
+}
+
+// newTestReconciler returns a reconciler of a release with the given compose
+// files by app, a fresh state dir and docker.
+func newTestReconciler(t *testing.T, apps map[string]string, docker *fakeDocker) *Reconciler {
+	t.Helper()
+	state.SetDir(t.TempDir())
+	t.Cleanup(func() { state.SetDir("") })
+
+	appsDir := t.TempDir()
+	for app, composeFile := range apps {
+		if err := os.MkdirAll(filepath.Join(appsDir, app), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(appsDir, app, "docker-compose.yml"), []byte(composeFile), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Reconciler{
+		config:          &types.Config{},
+		repoDir:         appsDir,
+		appsDir:         appsDir,
+		deployCommit:    "0123456789abcdef0123456789abcdef01234567",
+		docker:          docker,
+		changedProjects: make(map[string]bool),
+	}
+}
+
+const webCompose = "services:\n  web:\n    image: nginx:1.27\n"
+
+func TestStatusComparesContainersWithTheRelease(t *testing.T) {
+	docker := &fakeDocker{
+		containers: []dockerutil.ContainerDetails{
+			testContainer("c1", "web", "web", "web"),
+			// Deployed before the konta.app label: found by its rolling stack.
+			testContainer("c2", "", "old-1a2b3c4d", "worker"),
+		},
+		services: "web",
+	}
+	r := newTestReconciler(t, map[string]string{"web": webCompose}, docker)
+	r.config.Deploy.SelfHeal.ConfigDrift = ConfigDriftIgnore
+
+	statuses, err := r.Status(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].App != "old" || statuses[1].App != "web" {
+		t.Fatalf("statuses = %+v, want old and web", statuses)
+	}
+
+	old, web := statuses[0], statuses[1]
+	if old.InRepository || old.Drift != "app is not in the repository (orphan)" {
+		t.Errorf("old = %+v", old)
+	}
+	if !web.InRepository || web.Drift != "" || web.Stack != "web" || web.Commit != r.deployCommit {
+		t.Errorf("web = %+v", web)
+	}
+	if len(web.Containers) != 1 || web.Containers[0].Service != "web" || web.Containers[0].UptimeSeconds <= 0 {
+		t.Errorf("web containers = %+v", web.Containers)
+	}
+
+	docker.containers[0].State.Status = "exited"
+	r.invalidateInventory()
+	statuses, err = r.Status([]string{"web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Drift != "stopped containers" {
+		t.Errorf("web with an exited container = %+v", statuses)
+	}
+}
+
+func TestStatusReportsMissingContainers(t *testing.T) {
+	r := newTestReconciler(t, map[string]string{"web": webCompose}, &fakeDocker{services: "web"})
+
+	statuses, err := r.Status(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Drift != "containers are missing" || len(statuses[0].Containers) != 0 {
+		t.Errorf("statuses = %+v", statuses)
+	}
+}
@@ -0,0 +1,76 @@
+package reconcile
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/talyguryn/konta/internal/state"
+)
+
+// ComposeTarget is where an app's active stack runs from: the compose
+// project name, its compose file and the working dir of its release.
+type ComposeTarget struct {
+	App         string
+	Stack       string
+	Commit      string
+	ComposeFile string
+	WorkDir     string
+	Source      string // project state, or resolved like the health check
+}
+
+// ComposeTarget returns the active stack of an app. The stack and commit
+// recorded in ProjectState are used when present; otherwise they are resolved
+// the way the health check does.
+func (r *Reconciler) ComposeTarget(app string) (*ComposeTarget, error) {
+	currentState, err := state.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	target := &ComposeTarget{App: app, Source: "project state"}
+	if projectState, ok := currentState.Projects[app]; ok {
+		target.Stack = strings.TrimSpace(projectState.ActiveStack)
+		target.Commit = strings.TrimSpace(projectState.ActiveCommit)
+	}
+
+	if target.Stack == "" || target.Commit == "" {
+		commit, source, _, err := r.resolveExpectedCommitForProject(app)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve commit for app %s: %w", app, err)
+		}
+		if _, err := os.Stat(filepath.Join(r.appsDirForCommit(commit), app, "docker-compose.yml")); err != nil {
+			return nil, fmt.Errorf("app %s is not deployed (not in state and not in release %s)", app, shortCommitFrom(commit))
+		}
+		stack, _, err := r.resolveTargetProjectName(app, commit, r.appsDirForCommit(commit))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve stack for app %s: %w", app, err)
+		}
+		target.Stack, target.Commit, target.Source = stack, commit, source
+	}
+
+	target.WorkDir = filepath.Join(r.appsDirForCommit(target.Commit), app)
+	// Resolve the current symlink: stacks were started from releases/<commit>,
+	// and compose derives bind mount paths from the working dir.
+	if resolved, err := filepath.EvalSymlinks(target.WorkDir); err == nil {
+		target.WorkDir = resolved
+	}
+	target.ComposeFile = filepath.Join(target.WorkDir, "docker-compose.yml")
+	if _, err := os.Stat(target.ComposeFile); err != nil {
+		return nil, fmt.Errorf("app %s has no compose file in release %s: %w", app, shortCommitFrom(target.Commit), err)
+	}
+
+	return target, nil
+}
+
+// ComposeCommandFor builds a docker compose command for the target's stack,
+// run from its release dir so relative paths and env files resolve. The
+// config hash override is included so `up` keeps the stack's labels.
+func (r *Reconciler) ComposeCommandFor(target *ComposeTarget, args ...string) *exec.Cmd {
+	composeArgs := append([]string{"-p", target.Stack}, composeFileArgs(target.Stack, target.ComposeFile)...)
+	cmd := r.docker.ComposeCommand(append(composeArgs, args...)...)
+	cmd.Dir = target.WorkDir
+	return cmd
+}
@@ -0,0 +1,65 @@
+package reconcile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/state"
+)
+
+func TestComposeTargetUsesTheActiveStack(t *testing.T) {
+	docker := &fakeDocker{}
+	r := newTestReconciler(t, map[string]string{"web": webCompose}, docker)
+
+	// The app runs a rolling stack from an older release.
+	const activeCommit = "fedcba9876543210fedcba9876543210fedcba98"
+	releaseApp := filepath.Join(state.GetReleasesDir(), activeCommit, "web")
+	if err := os.MkdirAll(releaseApp, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(releaseApp, "docker-compose.yml"), []byte(webCompose), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SetProjectActiveStack("web", "web-fedcba98", activeCommit); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := r.ComposeTarget("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Stack != "web-fedcba98" || target.Commit != activeCommit || target.Source != "project state" {
+		t.Errorf("target = %+v", target)
+	}
+	if resolved, _ := filepath.EvalSymlinks(releaseApp); target.WorkDir != resolved {
+		t.Errorf("work dir = %s, want the release dir %s", target.WorkDir, resolved)
+	}
+
+	cmd := r.ComposeCommandFor(target, "logs", "--follow", "web")
+	if cmd.Dir != target.WorkDir {
+		t.Errorf("command runs in %s", cmd.Dir)
+	}
+	want := []string{"-p", "web-fedcba98", "-f", target.ComposeFile, "logs", "--follow", "web"}
+	if got := docker.compose[len(docker.compose)-1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("compose args = %v, want %v", got, want)
+	}
+}
+
+func TestComposeTargetWithoutProjectState(t *testing.T) {
+	r := newTestReconciler(t, map[string]string{"web": webCompose}, &fakeDocker{})
+
+	target, err := r.ComposeTarget("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Stack != "web" || target.Commit != r.deployCommit || !strings.HasPrefix(target.Source, "current fallback") {
+		t.Errorf("target = %+v", target)
+	}
+
+	if _, err := r.ComposeTarget("missing"); err == nil || !strings.Contains(err.Error(), "not deployed") {
+		t.Errorf("unknown app: err = %v", err)
+	}
+}
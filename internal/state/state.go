@@ -7,14 +7,17 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/talyguryn/konta/internal/lock"
 	"github.com/talyguryn/konta/internal/logger"
 	"github.com/talyguryn/konta/internal/types"
 )
 
 var (
 	stateDir string
+	stateMu  sync.Mutex
 )
 
 // getStateDir returns the state directory, creating fallback path if needed
@@ -23,10 +26,10 @@ func getStateDir() string {
 		return stateDir
 	}
 
-	// Try to use /var/lib/konta first
+	// Try to use /var/lib/konta first; rootless setups keep state in the home dir
 	primaryPath := "/var/lib/konta"
 	primaryParent := "/var/lib"
-	if _, err := os.Stat(primaryParent); err == nil {
+	if _, err := os.Stat(primaryParent); err == nil && os.Geteuid() == 0 {
 		// /var/lib exists, check if we can write to it
 		testFile := filepath.Join(primaryParent, ".konta_test")
 		if f, err := os.Create(testFile); err == nil {
@@ -93,13 +96,36 @@ func Save(state *types.State) error {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	// Written through a temporary file, so a crash never leaves it half
+	// written.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
 		return fmt.Errorf("failed to write state file: %w", err)
 	}
 
 	return nil
 }
 
+// lockState serializes changes to state.json between goroutines and between
+// processes, e.g. the daemon and the self-update watchdog, so neither saves
+// over the other's change. Hold it from Load to Save; it returns the
+// function that releases it.
+func lockState() func() {
+	stateMu.Lock()
+	fileLock, err := lock.Wait(filepath.Join(getStateDir(), "state.lock"))
+	if err != nil {
+		logger.Warn("Failed to lock state: %v", err)
+		return stateMu.Unlock
+	}
+	return func() {
+		_ = fileLock.Release()
+		stateMu.Unlock()
+	}
+}
+
 // Update updates the state after successful deployment
 func Update(commit string) error {
 	return UpdateWithProjects(commit, nil)
@@ -108,6 +134,7 @@ func Update(commit string) error {
 // UpdateWithProjects updates the state after successful deployment with per-project tracking
 func UpdateWithProjects(commit string, reconciledProjects []string) error {
 	// Load existing state to preserve project states
+	defer lockState()()
 	currentState, err := Load()
 	if err != nil {
 		logger.Warn("Failed to load existing state: %v", err)
@@ -147,6 +174,7 @@ func UpdateWithProjects(commit string, reconciledProjects []string) error {
 
 // PruneProjects removes project state entries that are no longer present in desired apps.
 func PruneProjects(desiredProjects []string) error {
+	defer lockState()()
 	currentState, err := Load()
 	if err != nil {
 		return err
@@ -183,6 +211,7 @@ func PruneProjects(desiredProjects []string) error {
 
 // MarkAttempt stores information about the latest deployment attempt.
 func MarkAttempt(commit string, status string) error {
+	defer lockState()()
 	currentState, err := Load()
 	if err != nil {
 		logger.Warn("Failed to load existing state: %v", err)
@@ -226,6 +255,7 @@ func GetProjectSelfHealAttempts(project string) (int, error) {
 
 // IncrementProjectSelfHealAttempts increments self-heal attempt count for project.
 func IncrementProjectSelfHealAttempts(project string) (int, error) {
+	defer lockState()()
 	currentState, err := Load()
 	if err != nil {
 		return 0, err
@@ -276,6 +306,7 @@ func GetProjectLastCommit(project string) (string, error) {
 // ResetProjectSelfHealAttempts clears self-heal attempts counter for a project.
 // The zero value is omitted from state.json due omitempty.
 func ResetProjectSelfHealAttempts(project string) error {
+	defer lockState()()
 	currentState, err := Load()
 	if err != nil {
 		return err
@@ -307,6 +338,7 @@ func SetProjectLastCommit(project string, commit string) error {
 		return nil
 	}
 
+	defer lockState()()
 	currentState, err := Load()
 	if err != nil {
 		return err
@@ -324,6 +356,112 @@ func SetProjectLastCommit(project string, commit string) error {
 	return Save(currentState)
 }
 
+// SetProjectActiveStack records the compose project an app runs as and the
+// commit its release was deployed from.
+func SetProjectActiveStack(project string, stack string, commit string) error {
+	stack = strings.TrimSpace(stack)
+	if project == "" || stack == "" {
+		return nil
+	}
+
+	defer lockState()()
+	currentState, err := Load()
+	if err != nil {
+		return err
+	}
+
+	if currentState.Projects == nil {
+		currentState.Projects = make(map[string]types.ProjectState)
+	}
+
+	projectState := currentState.Projects[project]
+	if projectState.ActiveStack == stack && projectState.ActiveCommit == strings.TrimSpace(commit) {
+		return nil
+	}
+	projectState.ActiveStack = stack
+	projectState.ActiveCommit = strings.TrimSpace(commit)
+	currentState.Projects[project] = projectState
+
+	return Save(currentState)
+}
+
+// SetProjectStopped marks an app as deliberately stopped by an operator, or
+// clears the mark. Stopped apps are neither healed nor deployed.
+func SetProjectStopped(project string, stopped bool) error {
+	if project == "" {
+		return nil
+	}
+
+	defer lockState()()
+	currentState, err := Load()
+	if err != nil {
+		return err
+	}
+
+	if currentState.Projects == nil {
+		currentState.Projects = make(map[string]types.ProjectState)
+	}
+
+	projectState := currentState.Projects[project]
+	if projectState.Stopped == stopped {
+		return nil
+	}
+	projectState.Stopped = stopped
+	currentState.Projects[project] = projectState
+
+	return Save(currentState)
+}
+
+// IsProjectStopped reports whether an app was stopped with `konta app stop`.
+func IsProjectStopped(project string) (bool, error) {
+	currentState, err := Load()
+	if err != nil {
+		return false, err
+	}
+
+	return currentState.Projects[project].Stopped, nil
+}
+
+// maxContainerEvents bounds the event history kept in state.json.
+const maxContainerEvents = 50
+
+// RecordContainerEvents appends Docker events to the history, keeping the
+// newest maxContainerEvents, and stores each app's latest event.
+func RecordContainerEvents(events []types.ContainerEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	defer lockState()()
+	currentState, err := Load()
+	if err != nil {
+		return err
+	}
+
+	currentState.ContainerEvents = append(currentState.ContainerEvents, events...)
+	if len(currentState.ContainerEvents) > maxContainerEvents {
+		currentState.ContainerEvents = currentState.ContainerEvents[len(currentState.ContainerEvents)-maxContainerEvents:]
+	}
+
+	for _, event := range events {
+		projectState, ok := currentState.Projects[event.App]
+		if !ok {
+			continue
+		}
+		event := event
+		projectState.LastEvent = &event
+		currentState.Projects[event.App] = projectState
+	}
+
+	return Save(currentState)
+}
+
+// SetDir overrides the state directory, e.g. to keep tests out of the
+// real one.
+func SetDir(dir string) {
+	stateDir = dir
+}
+
 // GetStateDir returns the state directory
 func GetStateDir() string {
 	return getStateDir()
@@ -339,6 +477,11 @@ func GetCurrentLink() string {
 	return filepath.Join(getStateDir(), "current")
 }
 
+// GetForgeOutboxPath returns the path to the outbox of undelivered forge reports
+func GetForgeOutboxPath() string {
+	return filepath.Join(getStateDir(), "forge-outbox.json")
+}
+
 // GetCurrentReleaseCommit returns the commit hash of the currently active release
 // by resolving the current symlink target under releases/<commit>.
 func GetCurrentReleaseCommit() (string, error) {
@@ -362,6 +505,7 @@ func AddManagedExternalNetworks(networks []string) error {
 		return nil
 	}
 
+	defer lockState()()
 	currentState, err := Load()
 	if err != nil {
 		return err
@@ -381,6 +525,7 @@ func RemoveManagedExternalNetwork(network string) error {
 		return nil
 	}
 
+	defer lockState()()
 	currentState, err := Load()
 	if err != nil {
 		return err
@@ -426,3 +571,105 @@ func uniqueSortedStrings(items []string) []string {
 	sort.Strings(result)
 	return result
 }
+
+// Self-update statuses.
+const (
+	SelfUpdatePending    = "pending"
+	SelfUpdateConfirmed  = "confirmed"
+	SelfUpdateRolledBack = "rolled_back"
+	SelfUpdateFailed     = "failed"
+)
+
+// maxSelfUpdates bounds the self-update history kept in state.json.
+const maxSelfUpdates = 20
+
+// RecordSelfUpdate appends a self-update to the history. A new update
+// replaces a pending one that was never confirmed.
+func RecordSelfUpdate(update types.SelfUpdate) error {
+	defer lockState()()
+	currentState, err := Load()
+	if err != nil {
+		return err
+	}
+
+	if pending := lastPendingSelfUpdate(currentState); pending != nil {
+		pending.Status = SelfUpdateFailed
+		pending.Reason = fmt.Sprintf("superseded by v%s before it was confirmed", update.ToVersion)
+		pending.FinishedAt = time.Now().Format(time.RFC3339)
+	}
+
+	currentState.SelfUpdates = append(currentState.SelfUpdates, update)
+	if len(currentState.SelfUpdates) > maxSelfUpdates {
+		currentState.SelfUpdates = currentState.SelfUpdates[len(currentState.SelfUpdates)-maxSelfUpdates:]
+	}
+
+	return Save(currentState)
+}
+
+// PendingSelfUpdate returns the update waiting for confirmation, or nil.
+func PendingSelfUpdate() (*types.SelfUpdate, error) {
+	currentState, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return lastPendingSelfUpdate(currentState), nil
+}
+
+// LastSelfUpdate returns the newest self-update, or nil.
+func LastSelfUpdate() (*types.SelfUpdate, error) {
+	currentState, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	if len(currentState.SelfUpdates) == 0 {
+		return nil, nil
+	}
+	return &currentState.SelfUpdates[len(currentState.SelfUpdates)-1], nil
+}
+
+// MarkSelfUpdateRunning notes that the daemon started on the pending version.
+func MarkSelfUpdateRunning(version string) error {
+	defer lockState()()
+	currentState, err := Load()
+	if err != nil {
+		return err
+	}
+
+	pending := lastPendingSelfUpdate(currentState)
+	if pending == nil || pending.ToVersion != version || pending.RunningAt != "" {
+		return nil
+	}
+	pending.RunningAt = time.Now().Format(time.RFC3339)
+	return Save(currentState)
+}
+
+// FinishSelfUpdate sets the outcome of the pending update to version. It
+// reports false when there is no such update, e.g. because it was already
+// rolled back.
+func FinishSelfUpdate(version string, status string, reason string) (bool, error) {
+	defer lockState()()
+	currentState, err := Load()
+	if err != nil {
+		return false, err
+	}
+
+	pending := lastPendingSelfUpdate(currentState)
+	if pending == nil || pending.ToVersion != version {
+		return false, nil
+	}
+	pending.Status = status
+	pending.Reason = reason
+	pending.FinishedAt = time.Now().Format(time.RFC3339)
+	return true, Save(currentState)
+}
+
+func lastPendingSelfUpdate(currentState *types.State) *types.SelfUpdate {
+	if len(currentState.SelfUpdates) == 0 {
+		return nil
+	}
+	last := &currentState.SelfUpdates[len(currentState.SelfUpdates)-1]
+	if last.Status != SelfUpdatePending {
+		return nil
+	}
+	return last
+}
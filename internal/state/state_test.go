@@ -0,0 +1,70 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/talyguryn/konta/internal/types"
+)
+
+const helperStateDirEnv = "KONTA_TEST_STATE_DIR"
+
+// TestHelperProcess records self-updates from a second process, like the
+// self-update watchdog does while the daemon keeps writing state.
+func TestHelperProcess(t *testing.T) {
+	dir := os.Getenv(helperStateDirEnv)
+	if dir == "" {
+		return
+	}
+	stateDir = dir
+	for index := 0; index < 30; index++ {
+		update := types.SelfUpdate{ToVersion: fmt.Sprintf("1.0.%d", index), Status: SelfUpdateConfirmed}
+		if err := RecordSelfUpdate(update); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConcurrentChangesAreNotLost(t *testing.T) {
+	stateDir = t.TempDir()
+	defer func() { stateDir = "" }()
+
+	helper := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	helper.Env = append(os.Environ(), helperStateDirEnv+"="+stateDir)
+	if err := helper.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for index := 0; index < 30; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			if err := SetProjectStopped(fmt.Sprintf("app%d", index), true); err != nil {
+				t.Error(err)
+			}
+		}(index)
+	}
+	wg.Wait()
+	if err := helper.Wait(); err != nil {
+		t.Fatalf("helper process failed: %v", err)
+	}
+
+	currentState, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(currentState.Projects) != 30 {
+		t.Errorf("%d of 30 projects saved", len(currentState.Projects))
+	}
+	if len(currentState.SelfUpdates) != maxSelfUpdates {
+		t.Errorf("%d self-updates saved, want %d", len(currentState.SelfUpdates), maxSelfUpdates)
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "state.json.tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary state file left behind: %v", err)
+	}
+}
@@ -1,35 +1,129 @@
 package types
 
+import "gopkg.in/yaml.v3"
+
 // Config represents the konta configuration
 type Config struct {
-	Version        string         `yaml:"version"`
-	Repository     RepositoryConf `yaml:"repository"`
-	Deploy         DeployConf     `yaml:"deploy,omitempty"`
-	Hooks          HooksConf      `yaml:"hooks,omitempty"`
-	Logging        LoggingConf    `yaml:"logging,omitempty"`
-	ReleaseChannel string         `yaml:"release_channel,omitempty"` // stable (default), next
-	KontaUpdates   string         `yaml:"konta_updates,omitempty"`   // auto, notify (default), false
+	Version        string             `yaml:"version"`
+	Repository     RepositoryConf     `yaml:"repository"`
+	Deploy         DeployConf         `yaml:"deploy,omitempty"`
+	Hooks          HooksConf          `yaml:"hooks,omitempty"`
+	Logging        LoggingConf        `yaml:"logging,omitempty"`
+	Metrics        MetricsConf        `yaml:"metrics,omitempty"`
+	Notifications  []NotificationConf `yaml:"notifications,omitempty"`
+	ReleaseChannel string             `yaml:"release_channel,omitempty"` // stable (default), next; konta_updates.channel takes precedence
+	KontaUpdates   UpdatePolicy       `yaml:"konta_updates,omitempty"`
+	Runtime        string             `yaml:"runtime,omitempty"` // docker (default), podman; KONTA_RUNTIME overrides it
+	RepoSettings   RepoSettingsConf   `yaml:"repo_settings,omitempty"`
+	// AppDeploy holds the deploy settings of apps the repository settings
+	// file overrides (set by config.ApplyRepoSettings).
+	AppDeploy map[string]DeployConf `yaml:"-"`
+}
+
+// RepoSettingsConf controls the konta.settings.yaml file of the infra
+// repository.
+type RepoSettingsConf struct {
+	Enable *bool    `yaml:"enable,omitempty"` // default: true
+	Locked []string `yaml:"locked,omitempty"` // keys the repository may not change, e.g. self_heal.enable or self_heal
+}
+
+// RepoSettings is the konta.settings.yaml file an infra repository keeps
+// next to apps/. Its deploy settings are merged over the host config, and
+// an app's entry is merged over those for that app.
+type RepoSettings struct {
+	Deploy DeploySettings            `yaml:"deploy,omitempty"`
+	Apps   map[string]DeploySettings `yaml:"apps,omitempty"`
+}
+
+// DeploySettings is the part of DeployConf a repository may set. Unset
+// fields keep the host value.
+type DeploySettings struct {
+	ProjectNameHashMode         *string          `yaml:"project_name_hash_mode,omitempty"`
+	RollingHealthTimeoutSeconds *int             `yaml:"rolling_health_timeout_second,omitempty"`
+	RollingHealthRetries        *int             `yaml:"rolling_health_retries,omitempty"`
+	AutoCreateExternalNetworks  *bool            `yaml:"auto_create_external_networks,omitempty"`
+	SelfHeal                    SelfHealSettings `yaml:"self_heal,omitempty"`
+}
+
+// SelfHealSettings is the part of SelfHealConf a repository may set.
+type SelfHealSettings struct {
+	Enable      *bool   `yaml:"enable,omitempty"`
+	MaxRetry    *int    `yaml:"max_retry,omitempty"`
+	ConfigDrift *string `yaml:"config_drift,omitempty"`
+}
+
+// UpdatePolicy controls updates of Konta itself. The short form
+// `konta_updates: notify` sets only the mode.
+type UpdatePolicy struct {
+	Mode       string `yaml:"mode,omitempty"`       // auto, notify, false (default: false)
+	Channel    string `yaml:"channel,omitempty"`    // stable (default), next
+	Constraint string `yaml:"constraint,omitempty"` // allowed versions, e.g. ">=1.4 <2"
+	Window     string `yaml:"window,omitempty"`     // when auto mode may install, e.g. "Sat,Sun 02:00-05:00"
+	Mirror     string `yaml:"mirror,omitempty"`     // URL of a release index to use instead of api.github.com
+}
+
+// UnmarshalYAML accepts the short form (a mode) and the full mapping.
+func (p *UpdatePolicy) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*p = UpdatePolicy{Mode: value.Value}
+		return nil
+	}
+
+	type plain UpdatePolicy
+	return value.Decode((*plain)(p))
+}
+
+// MarshalYAML writes the short form when only the mode is set.
+func (p UpdatePolicy) MarshalYAML() (interface{}, error) {
+	if p.Channel == "" && p.Constraint == "" && p.Window == "" && p.Mirror == "" {
+		return p.Mode, nil
+	}
+
+	type plain UpdatePolicy
+	return plain(p), nil
+}
+
+// Enabled reports whether Konta checks for updates at all.
+func (p UpdatePolicy) Enabled() bool {
+	return p.Mode != "" && p.Mode != "false"
 }
 
 // RepositoryConf represents git repository configuration
 type RepositoryConf struct {
-	URL      string `yaml:"url"`
-	Branch   string `yaml:"branch"`
-	Token    string `yaml:"token"`
-	Path     string `yaml:"path"`     // Path to base directory containing 'apps' folder (or just empty/. for repo root)
-	Interval int    `yaml:"interval"` // seconds
+	URL       string        `yaml:"url"`
+	Branch    string        `yaml:"branch"`
+	Token     string        `yaml:"token"`
+	Path      string        `yaml:"path"`                 // Path to base directory containing 'apps' folder (or just empty/. for repo root)
+	Interval  int           `yaml:"interval"`             // seconds
+	Forge     string        `yaml:"forge,omitempty"`      // github, gitlab, gitea or forgejo (default: detected from url)
+	APIURL    string        `yaml:"api_url,omitempty"`    // Forge API base URL (default: derived from url, e.g. https://ghe.example.com/api/v3)
+	GitHubApp GitHubAppConf `yaml:"github_app,omitempty"` // Authenticate as a GitHub App installation instead of with token
+}
+
+// GitHubAppConf configures GitHub App authentication: short-lived
+// installation tokens replace repository.token for fetches and reporting.
+type GitHubAppConf struct {
+	AppID          int64  `yaml:"app_id,omitempty"`
+	InstallationID int64  `yaml:"installation_id,omitempty"` // Default: the installation of the app on the repository
+	PrivateKey     string `yaml:"private_key,omitempty"`     // Path to the app's PEM private key
+}
+
+// Enabled reports whether GitHub App authentication is configured.
+func (c GitHubAppConf) Enabled() bool {
+	return c.AppID != 0
 }
 
 // DeployConf represents deployment configuration
 type DeployConf struct {
-	Parallel                    bool                  `yaml:"parallel,omitempty"`
-	DryRun                      bool                  `yaml:"dry_run,omitempty"`
-	ProjectNameHashMode         string                `yaml:"project_name_hash_mode,omitempty"`        // rolling_only (default), all, none
-	RollingHealthTimeoutSeconds int                   `yaml:"rolling_health_timeout_second,omitempty"` // default: 300
-	RollingHealthRetries        int                   `yaml:"rolling_health_retries,omitempty"`        // default: 1
-	AutoCreateExternalNetworks  *bool                 `yaml:"auto_create_external_networks,omitempty"` // default: true
-	SelfHeal                    SelfHealConf          `yaml:"self_heal,omitempty"`
-	GitHubDeployments           GitHubDeploymentsConf `yaml:"github_deployments,omitempty"`
+	Parallel                    bool                `yaml:"parallel,omitempty"`
+	DryRun                      bool                `yaml:"dry_run,omitempty"`
+	ProjectNameHashMode         string              `yaml:"project_name_hash_mode,omitempty"`        // rolling_only (default), all, none
+	RollingHealthTimeoutSeconds int                 `yaml:"rolling_health_timeout_second,omitempty"` // default: 300
+	RollingHealthRetries        int                 `yaml:"rolling_health_retries,omitempty"`        // default: 1
+	AutoCreateExternalNetworks  *bool               `yaml:"auto_create_external_networks,omitempty"` // default: true
+	SelfHeal                    SelfHealConf        `yaml:"self_heal,omitempty"`
+	ForgeReporting              ForgeReportingConf  `yaml:"forge_reporting,omitempty"`
+	GitHubDeployments           *ForgeReportingConf `yaml:"github_deployments,omitempty"` // deprecated, merged into forge_reporting by the loader
 	// RemoveOrphans is always enabled by default to keep disk space clean
 }
 
@@ -37,32 +131,94 @@ type SelfHealConf struct {
 	Enable       bool   `yaml:"enable,omitempty"`        // default: true
 	MaxRetry     int    `yaml:"max_retry,omitempty"`     // default: 0 (no limit)
 	RecoveryMode string `yaml:"recovery_mode,omitempty"` // deprecated, ignored at runtime; unchanged apps are repaired strictly from project state
+	ConfigDrift  string `yaml:"config_drift,omitempty"`  // heal (default), report or ignore containers that differ from their release config
+	// Events makes the daemon follow `docker events` and heal an app shortly
+	// after its container dies, is OOM-killed or turns unhealthy (default: true).
+	Events                   *bool `yaml:"events,omitempty"`
+	EventDebounceSeconds     int   `yaml:"event_debounce_seconds,omitempty"`      // quiet time after an app's last event before healing (default: 10)
+	EventCooldownSeconds     int   `yaml:"event_cooldown_seconds,omitempty"`      // minimum time between event-triggered heals of one app (default: 60)
+	SafetyNetIntervalSeconds int   `yaml:"safety_net_interval_seconds,omitempty"` // polled health checks while the events stream is connected (default: 600)
+}
+
+// ForgeReportingConf configures reporting deploys to the forge hosting the
+// repository: commit statuses, deployments and commit comments.
+type ForgeReportingConf struct {
+	Enable      *bool  `yaml:"enable,omitempty"`      // default: true
+	Environment string `yaml:"environment,omitempty"` // default: production
+	PerApp      bool   `yaml:"per_app,omitempty"`     // Also report each deployed app: status konta/<host>/<app>, environment <environment>/<app>
 }
 
-type GitHubDeploymentsConf struct {
-	Enable      bool   `yaml:"enable,omitempty"`
-	Environment string `yaml:"environment,omitempty"`
+// Enabled reports whether deploys are reported to the forge.
+func (c ForgeReportingConf) Enabled() bool {
+	return c.Enable == nil || *c.Enable
 }
 
 // HooksConf represents hooks configuration
 type HooksConf struct {
-	Started       string `yaml:"started,omitempty"`     // Just filename: started.sh (found in hooks dir)
-	Pre           string `yaml:"pre,omitempty"`         // Just filename: pre.sh (found in hooks dir)
-	Success       string `yaml:"success,omitempty"`     // Just filename: success.sh (found in hooks dir)
-	Failure       string `yaml:"failure,omitempty"`     // Just filename: failure.sh (found in hooks dir)
-	PostUpdate    string `yaml:"post_update,omitempty"` // Just filename: post_update.sh (found in hooks dir)
-	StartedAbs    string `yaml:"-"`                     // Absolute path to started hook (set by config loader)
-	PreAbs        string `yaml:"-"`                     // Absolute path to pre hook (set by config loader)
-	SuccessAbs    string `yaml:"-"`                     // Absolute path to success hook
-	FailureAbs    string `yaml:"-"`                     // Absolute path to failure hook
-	PostUpdateAbs string `yaml:"-"`                     // Absolute path to post_update hook
+	Started        string                   `yaml:"started,omitempty"`         // Just filename: started.sh (found in hooks dir)
+	Pre            string                   `yaml:"pre,omitempty"`             // Just filename: pre.sh (found in hooks dir)
+	Success        string                   `yaml:"success,omitempty"`         // Just filename: success.sh (found in hooks dir)
+	Failure        string                   `yaml:"failure,omitempty"`         // Just filename: failure.sh (found in hooks dir)
+	PostUpdate     string                   `yaml:"post_update,omitempty"`     // Just filename: post_update.sh (found in hooks dir)
+	TimeoutSeconds int                      `yaml:"timeout_seconds,omitempty"` // Kill a hook running longer than this (default 300)
+	Events         map[string]HookEventConf `yaml:"events,omitempty"`          // Opt-in event hooks by event name, e.g. self_heal
+	StartedAbs     string                   `yaml:"-"`                         // Absolute path to started hook (set by config loader)
+	PreAbs         string                   `yaml:"-"`                         // Absolute path to pre hook (set by config loader)
+	SuccessAbs     string                   `yaml:"-"`                         // Absolute path to success hook
+	FailureAbs     string                   `yaml:"-"`                         // Absolute path to failure hook
+	PostUpdateAbs  string                   `yaml:"-"`                         // Absolute path to post_update hook
+}
+
+// HookEventConf enables the hook of an event such as self_heal or
+// app_failed.
+type HookEventConf struct {
+	Script           string `yaml:"script,omitempty"`             // Just filename (default: <event>.sh in hooks dir)
+	RateLimitSeconds *int   `yaml:"rate_limit_seconds,omitempty"` // Minimum time between runs per app (default depends on the event)
+	Path             string `yaml:"-"`                            // Path to the script relative to the repo root (set by config loader)
+}
+
+// UnmarshalYAML accepts the short form (a script name) and the full mapping.
+func (c *HookEventConf) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*c = HookEventConf{Script: value.Value}
+		return nil
+	}
+
+	type plain HookEventConf
+	return value.Decode((*plain)(c))
 }
 
 // LoggingConf represents logging configuration
 type LoggingConf struct {
-	Level  string `yaml:"level,omitempty"`  // debug, info, warn, error
-	Format string `yaml:"format,omitempty"` // text, json
-	File   string `yaml:"file,omitempty"`
+	Level     string `yaml:"level,omitempty"`       // debug, info, warn, error
+	Format    string `yaml:"format,omitempty"`      // text (default), json
+	File      string `yaml:"file,omitempty"`        // default: /var/log/konta/konta.log
+	MaxSizeMB int    `yaml:"max_size_mb,omitempty"` // Rotate the log file after this size (default: 10, 0 = default)
+	MaxFiles  int    `yaml:"max_files,omitempty"`   // Rotated files to keep (default: 5)
+}
+
+// MetricsConf represents the optional Prometheus metrics listener
+type MetricsConf struct {
+	Enable bool   `yaml:"enable,omitempty"`
+	Listen string `yaml:"listen,omitempty"` // default: 127.0.0.1:9469
+}
+
+// NotificationConf represents a single notification provider
+type NotificationConf struct {
+	Name     string            `yaml:"name,omitempty"`      // Label used in logs (default: type)
+	Type     string            `yaml:"type"`                // slack, telegram, discord, webhook, smtp
+	Events   []string          `yaml:"events,omitempty"`    // deploy_success, deploy_failure, rollback, self_heal, update_available (default: all)
+	Retries  int               `yaml:"retries,omitempty"`   // Delivery attempts (default: 3)
+	URL      string            `yaml:"url,omitempty"`       // Webhook URL for slack, discord, webhook; API base URL for telegram
+	Headers  map[string]string `yaml:"headers,omitempty"`   // Extra HTTP headers for webhook
+	BotToken string            `yaml:"bot_token,omitempty"` // telegram
+	ChatID   string            `yaml:"chat_id,omitempty"`   // telegram
+	Host     string            `yaml:"host,omitempty"`      // smtp
+	Port     int               `yaml:"port,omitempty"`      // smtp (default: 587)
+	Username string            `yaml:"username,omitempty"`  // smtp
+	Password string            `yaml:"password,omitempty"`  // smtp
+	From     string            `yaml:"from,omitempty"`      // smtp
+	To       []string          `yaml:"to,omitempty"`        // smtp
 }
 
 // State represents deployment state
@@ -75,15 +231,48 @@ type State struct {
 	Version             string                  `json:"version"`
 	Projects            map[string]ProjectState `json:"projects,omitempty"` // Per-project state for change detection
 	ManagedExternalNets []string                `json:"managed_external_networks,omitempty"`
+	ContainerEvents     []ContainerEvent        `json:"container_events,omitempty"` // Recent Docker events of managed containers, oldest first
+	SelfUpdates         []SelfUpdate            `json:"self_updates,omitempty"`     // Recent installs of new Konta binaries, oldest first
+}
+
+// SelfUpdate records an install of a new Konta binary and its outcome. The
+// previous binary is kept next to the new one so a failed update can be
+// reverted.
+type SelfUpdate struct {
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+	Binary      string `json:"binary"`
+	Backup      string `json:"backup"`                // Previous binary
+	Status      string `json:"status"`                // pending, confirmed, rolled_back, failed
+	Reason      string `json:"reason,omitempty"`      // Why the update failed or was rolled back
+	StartedAt   string `json:"started_at"`            // When the new binary was installed
+	RunningAt   string `json:"running_at,omitempty"`  // When the daemon first started on the new binary
+	Deadline    string `json:"deadline,omitempty"`    // Rolled back if not confirmed by then; empty when nobody watches
+	FinishedAt  string `json:"finished_at,omitempty"` // When it was confirmed, rolled back or failed
+}
+
+// ContainerEvent is a Docker event of a managed container that can need a
+// self-heal: a container died, was killed for running out of memory, or
+// turned unhealthy.
+type ContainerEvent struct {
+	Time      string `json:"time"`
+	App       string `json:"app"`
+	Stack     string `json:"stack,omitempty"`
+	Service   string `json:"service,omitempty"`
+	Container string `json:"container,omitempty"`
+	Action    string `json:"action"`              // die, oom, unhealthy
+	ExitCode  string `json:"exit_code,omitempty"` // die only
 }
 
 // ProjectState represents the state of an individual project
 type ProjectState struct {
-	LastCommit       string `json:"last_commit"`                  // Last commit that affected this project
-	LastDeployTime   string `json:"last_deploy_time"`             // When this project was last deployed
-	ActiveStack      string `json:"active_stack,omitempty"`       // Active docker compose project name
-	ActiveCommit     string `json:"active_commit,omitempty"`      // Active commit for project stack
-	SelfHealAttempts int    `json:"self_heal_attempts,omitempty"` // Count of self-heal actions for current rollout lifecycle
+	LastCommit       string          `json:"last_commit"`                  // Last commit that affected this project
+	LastDeployTime   string          `json:"last_deploy_time"`             // When this project was last deployed
+	ActiveStack      string          `json:"active_stack,omitempty"`       // Active docker compose project name
+	ActiveCommit     string          `json:"active_commit,omitempty"`      // Active commit for project stack
+	SelfHealAttempts int             `json:"self_heal_attempts,omitempty"` // Count of self-heal actions for current rollout lifecycle
+	Stopped          bool            `json:"stopped,omitempty"`            // Stopped with `konta app stop`: not healed or deployed until started
+	LastEvent        *ContainerEvent `json:"last_event,omitempty"`         // Latest Docker event of the app's containers
 }
 
 // ReconcileResult represents the result of a reconciliation operation
@@ -93,4 +282,28 @@ type ReconcileResult struct {
 	Removed []string `json:"removed"`          // Projects that were removed
 	Started []string `json:"started"`          // Projects that were restarted
 	Failed  string   `json:"failed,omitempty"` // Project that failed during reconcile, if any
+	Plan    *Plan    `json:"plan,omitempty"`   // Plan the result was produced from
+}
+
+// Plan is the ordered list of actions a reconcile cycle applies.
+// It is built without changing anything, so dry-run and `konta plan` show
+// exactly what a real cycle would do.
+type Plan struct {
+	Kind           string       `json:"kind"` // deploy, health_check, cleanup
+	Commit         string       `json:"commit"`
+	PreviousCommit string       `json:"previous_commit,omitempty"`
+	Actions        []PlanAction `json:"actions"`
+}
+
+// PlanAction is one step of a plan for a single app.
+type PlanAction struct {
+	App         string `json:"app"`
+	Type        string `json:"type"` // deploy, restore, start, remove, none
+	Reason      string `json:"reason"`
+	Stack       string `json:"stack,omitempty"`    // Target compose project
+	Commit      string `json:"commit,omitempty"`   // Commit the app is deployed from
+	Strategy    string `json:"strategy,omitempty"` // create, restart, rolling, migrate_to_rolling, migrate_from_rolling
+	Destructive bool   `json:"destructive"`        // Running containers are stopped or removed
+	New         bool   `json:"new,omitempty"`      // App has no running stack yet
+	SyncState   bool   `json:"-"`                  // Record Commit as the app's last commit after a self-heal
 }
@@ -0,0 +1,218 @@
+package updatepolicy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a version range such as ">=1.4 <2" or "~1.4 || ^2.1".
+// Comparators separated by spaces or commas must all match; alternatives
+// separated by "||" are tried in turn. An empty constraint matches every
+// version.
+//
+// Supported comparators: =, !=, >, >=, <, <=, ~ (same minor, or same major
+// when only the major is given) and ^ (same major, or same minor for 0.x).
+// A partial version like "1.4" or "1.4.x" without an operator means any
+// 1.4 release.
+type Constraint struct {
+	text         string
+	alternatives [][]comparator
+}
+
+type comparator struct {
+	op      string
+	version Version
+}
+
+// ParseConstraint parses a constraint; empty text gives one matching
+// everything.
+func ParseConstraint(text string) (Constraint, error) {
+	constraint := Constraint{text: strings.TrimSpace(text)}
+	if constraint.text == "" {
+		return constraint, nil
+	}
+
+	for _, alternative := range strings.Split(constraint.text, "||") {
+		tokens := strings.Fields(strings.ReplaceAll(alternative, ",", " "))
+		if len(tokens) == 0 {
+			return Constraint{}, fmt.Errorf("invalid constraint %q: empty alternative", constraint.text)
+		}
+
+		var comparators []comparator
+		for index := 0; index < len(tokens); index++ {
+			token := tokens[index]
+			// Allow a space between operator and version: ">= 1.4".
+			if isOperator(token) && index+1 < len(tokens) {
+				token += tokens[index+1]
+				index++
+			}
+			parsed, err := parseComparator(token)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("invalid constraint %q: %w", constraint.text, err)
+			}
+			comparators = append(comparators, parsed...)
+		}
+		constraint.alternatives = append(constraint.alternatives, comparators)
+	}
+	return constraint, nil
+}
+
+func (c Constraint) String() string {
+	return c.text
+}
+
+// Empty reports whether the constraint matches every version.
+func (c Constraint) Empty() bool {
+	return len(c.alternatives) == 0
+}
+
+// Matches reports whether version is in the range. Prereleases are compared
+// by their version without the suffix, so "<2" excludes 2.0.0-rc.1.
+func (c Constraint) Matches(version Version) bool {
+	if c.Empty() {
+		return true
+	}
+	version = version.Core()
+
+	for _, comparators := range c.alternatives {
+		matched := true
+		for _, comparator := range comparators {
+			if !comparator.matches(version) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c comparator) matches(version Version) bool {
+	result := version.Compare(c.version)
+	switch c.op {
+	case "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+	return false
+}
+
+var operators = []string{">=", "<=", "!=", "==", ">", "<", "=", "~", "^"}
+
+func isOperator(token string) bool {
+	for _, op := range operators {
+		if token == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parseComparator turns one token into plain comparators; ranges like ~1.4
+// become a lower and an upper bound.
+func parseComparator(token string) ([]comparator, error) {
+	op := ""
+	for _, candidate := range operators {
+		if strings.HasPrefix(token, candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "==" {
+		op = "="
+	}
+
+	parts, given, err := parsePartial(strings.TrimLeft(token, "<>=!~^"))
+	if err != nil {
+		return nil, err
+	}
+	lower := versionOf(parts)
+
+	switch op {
+	case "", "=":
+		if given == 3 {
+			return []comparator{{"=", lower}}, nil
+		}
+		if given == 0 {
+			return nil, nil // "*" or "x" matches everything
+		}
+		return between(lower, bump(parts, given-1)), nil
+	case "~":
+		if given <= 1 {
+			return between(lower, bump(parts, 0)), nil
+		}
+		return between(lower, bump(parts, 1)), nil
+	case "^":
+		// The first non-zero part given is the one that may not change.
+		for index := 0; index < given; index++ {
+			if parts[index] != 0 || index == given-1 {
+				return between(lower, bump(parts, index)), nil
+			}
+		}
+		return nil, nil
+	default:
+		if given == 0 {
+			return nil, fmt.Errorf("%q needs a version", token)
+		}
+		return []comparator{{op, lower}}, nil
+	}
+}
+
+// parsePartial parses "1", "1.4", "1.4.2" or "1.4.x" and returns the parts
+// and how many were given before the first wildcard.
+func parsePartial(text string) ([]int, int, error) {
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "v"), "V")
+	if text == "" {
+		return nil, 0, fmt.Errorf("missing version")
+	}
+
+	parts := []int{0, 0, 0}
+	given := 0
+	wildcard := false
+	for index, part := range strings.Split(text, ".") {
+		if index >= 3 {
+			return nil, 0, fmt.Errorf("invalid version %q", text)
+		}
+		if part == "x" || part == "X" || part == "*" {
+			wildcard = true
+			continue
+		}
+		if wildcard {
+			return nil, 0, fmt.Errorf("invalid version %q", text)
+		}
+		version, err := ParseVersion(part)
+		if err != nil || len(version.Prerelease) > 0 {
+			return nil, 0, fmt.Errorf("invalid version %q", text)
+		}
+		parts[index] = version.Parts[0]
+		given = index + 1
+	}
+	return parts, given, nil
+}
+
+func versionOf(parts []int) Version {
+	return Version{Parts: append([]int(nil), parts...), raw: fmt.Sprintf("%d.%d.%d", parts[0], parts[1], parts[2])}
+}
+
+// bump increments the part at index and zeroes the parts after it.
+func bump(parts []int, index int) Version {
+	bumped := []int{0, 0, 0}
+	copy(bumped, parts[:index])
+	bumped[index] = parts[index] + 1
+	return versionOf(bumped)
+}
+
+func between(lower Version, upper Version) []comparator {
+	return []comparator{{">=", lower}, {"<", upper}}
+}
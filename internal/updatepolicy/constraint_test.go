@@ -0,0 +1,50 @@
+package updatepolicy
+
+import "testing"
+
+func TestConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matching   []string
+		other      []string
+	}{
+		{"", []string{"0.1.0", "9.9.9-rc.1"}, nil},
+		{">=1.4 <2", []string{"1.4.0", "1.9.9"}, []string{"1.3.9", "2.0.0", "2.0.0-rc.1"}},
+		{">= 1.4, < 2", []string{"1.5.0"}, []string{"2.1.0"}},
+		{"1.4", []string{"1.4.0", "1.4.7"}, []string{"1.5.0", "1.3.0"}},
+		{"1.4.x", []string{"1.4.3"}, []string{"1.5.0"}},
+		{"=1.4.2", []string{"1.4.2"}, []string{"1.4.3"}},
+		{"!=1.4.2", []string{"1.4.3"}, []string{"1.4.2"}},
+		{"~1.4", []string{"1.4.0", "1.4.9"}, []string{"1.5.0"}},
+		{"~1", []string{"1.9.0"}, []string{"2.0.0"}},
+		{"^1.4", []string{"1.4.0", "1.99.0"}, []string{"1.3.0", "2.0.0"}},
+		{"^0.4.1", []string{"0.4.1", "0.4.9"}, []string{"0.4.0", "0.5.0"}},
+		{"~1.4 || ^2.1", []string{"1.4.5", "2.3.0"}, []string{"1.5.0", "2.0.0", "3.0.0"}},
+		{"*", []string{"0.0.1", "5.0.0"}, nil},
+	}
+	for _, tt := range tests {
+		constraint, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q): %v", tt.constraint, err)
+			continue
+		}
+		for _, version := range tt.matching {
+			if !constraint.Matches(mustVersion(t, version)) {
+				t.Errorf("%q does not match %s", tt.constraint, version)
+			}
+		}
+		for _, version := range tt.other {
+			if constraint.Matches(mustVersion(t, version)) {
+				t.Errorf("%q matches %s", tt.constraint, version)
+			}
+		}
+	}
+}
+
+func TestParseConstraintRejectsInvalidRanges(t *testing.T) {
+	for _, invalid := range []string{">=", "1.4 ||", "1.2.3.4", "1.x.3", ">=one", "^1.2-rc"} {
+		if _, err := ParseConstraint(invalid); err == nil {
+			t.Errorf("ParseConstraint(%q) did not fail", invalid)
+		}
+	}
+}
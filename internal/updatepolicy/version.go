@@ -0,0 +1,130 @@
+// Package updatepolicy parses the parts of konta_updates that decide which
+// Konta release may be installed and when: versions, version constraints and
+// maintenance windows.
+package updatepolicy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a release version like 1.4.2 or 0.4.0-next.1. Build metadata
+// after '+' is ignored.
+type Version struct {
+	Parts      []int    // major, minor, patch and further numeric parts
+	Prerelease []string // dot-separated identifiers after '-'
+	raw        string
+}
+
+// ParseVersion parses a version with an optional leading "v". Missing minor
+// and patch parts are zero.
+func ParseVersion(text string) (Version, error) {
+	raw := strings.TrimSpace(text)
+	text = strings.TrimPrefix(strings.TrimPrefix(raw, "v"), "V")
+	if index := strings.IndexByte(text, '+'); index >= 0 {
+		text = text[:index]
+	}
+
+	version := Version{raw: raw}
+	core := text
+	if index := strings.IndexByte(text, '-'); index >= 0 {
+		core = text[:index]
+		prerelease := text[index+1:]
+		if prerelease == "" {
+			return Version{}, fmt.Errorf("invalid version %q: empty prerelease", raw)
+		}
+		version.Prerelease = strings.Split(prerelease, ".")
+	}
+
+	if core == "" {
+		return Version{}, fmt.Errorf("invalid version %q", raw)
+	}
+	for _, part := range strings.Split(core, ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", raw)
+		}
+		version.Parts = append(version.Parts, number)
+	}
+	for len(version.Parts) < 3 {
+		version.Parts = append(version.Parts, 0)
+	}
+	return version, nil
+}
+
+func (v Version) String() string {
+	return v.raw
+}
+
+// IsPrerelease reports whether the version has a prerelease suffix.
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Core returns the version without its prerelease suffix.
+func (v Version) Core() Version {
+	return Version{Parts: v.Parts, raw: v.raw}
+}
+
+// Compare returns -1, 0 or 1 like strings.Compare. Numeric parts are compared
+// in order; a prerelease is lower than the release it precedes.
+func (v Version) Compare(other Version) int {
+	for index := 0; index < len(v.Parts) || index < len(other.Parts); index++ {
+		a, b := partAt(v.Parts, index), partAt(other.Parts, index)
+		if a != b {
+			return compareInts(a, b)
+		}
+	}
+
+	switch {
+	case !v.IsPrerelease() && !other.IsPrerelease():
+		return 0
+	case !v.IsPrerelease():
+		return 1
+	case !other.IsPrerelease():
+		return -1
+	}
+
+	for index := 0; index < len(v.Prerelease) && index < len(other.Prerelease); index++ {
+		if result := compareIdentifiers(v.Prerelease[index], other.Prerelease[index]); result != 0 {
+			return result
+		}
+	}
+	return compareInts(len(v.Prerelease), len(other.Prerelease))
+}
+
+// compareIdentifiers orders prerelease identifiers: numbers numerically and
+// below words, words lexically.
+func compareIdentifiers(a string, b string) int {
+	numberA, errA := strconv.Atoi(a)
+	numberB, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(numberA, numberB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func partAt(parts []int, index int) int {
+	if index < len(parts) {
+		return parts[index]
+	}
+	return 0
+}
+
+func compareInts(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,44 @@
+package updatepolicy
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	version, err := ParseVersion("v1.4.2-rc.1+build.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.String() != "v1.4.2-rc.1+build.7" || !version.IsPrerelease() || version.Core().IsPrerelease() {
+		t.Errorf("version = %+v", version)
+	}
+	if short, err := ParseVersion("2"); err != nil || short.Compare(mustVersion(t, "2.0.0")) != 0 {
+		t.Errorf("short version = %+v, %v", short, err)
+	}
+	for _, invalid := range []string{"", "v", "1.x", "1.-2", "1.2-"} {
+		if _, err := ParseVersion(invalid); err == nil {
+			t.Errorf("ParseVersion(%q) did not fail", invalid)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	// Ascending, per semver precedence.
+	ordered := []string{"0.9.9", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.10.0"}
+	for index := 1; index < len(ordered); index++ {
+		lower, higher := mustVersion(t, ordered[index-1]), mustVersion(t, ordered[index])
+		if lower.Compare(higher) != -1 || higher.Compare(lower) != 1 {
+			t.Errorf("%s is not lower than %s", lower, higher)
+		}
+	}
+	if mustVersion(t, "v1.2.3+linux").Compare(mustVersion(t, "1.2.3")) != 0 {
+		t.Error("build metadata changed the order")
+	}
+}
+
+func mustVersion(t *testing.T, text string) Version {
+	t.Helper()
+	version, err := ParseVersion(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
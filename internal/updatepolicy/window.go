@@ -0,0 +1,151 @@
+package updatepolicy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a weekly maintenance window such as "Sat,Sun 02:00-05:00",
+// "Mon-Fri 22:00-02:00 Europe/Berlin" or "03:00-04:00" (every day). Times are
+// in the host's local time unless a time zone is given. A window whose end is
+// not after its start runs past midnight and belongs to the day it starts on.
+// An empty window is always open.
+type Window struct {
+	text     string
+	days     [7]bool
+	start    int // minutes after midnight
+	end      int
+	location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseWindow parses a window; empty text gives one that is always open.
+func ParseWindow(text string) (Window, error) {
+	window := Window{text: strings.TrimSpace(text)}
+	if window.text == "" {
+		return window, nil
+	}
+
+	fields := strings.Fields(window.text)
+	timeIndex := -1
+	for index, field := range fields {
+		if strings.Contains(field, ":") && strings.Contains(field, "-") {
+			timeIndex = index
+			break
+		}
+	}
+	if timeIndex < 0 || timeIndex > 1 || len(fields) > timeIndex+2 {
+		return Window{}, fmt.Errorf("invalid window %q: use [DAYS] HH:MM-HH:MM [TIMEZONE]", window.text)
+	}
+
+	if timeIndex == 1 {
+		if err := window.parseDays(fields[0]); err != nil {
+			return Window{}, fmt.Errorf("invalid window %q: %w", window.text, err)
+		}
+	} else {
+		for day := range window.days {
+			window.days[day] = true
+		}
+	}
+
+	start, end, found := strings.Cut(fields[timeIndex], "-")
+	var err error
+	if !found {
+		return Window{}, fmt.Errorf("invalid window %q: missing end time", window.text)
+	}
+	if window.start, err = parseClock(start); err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %w", window.text, err)
+	}
+	if window.end, err = parseClock(end); err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %w", window.text, err)
+	}
+
+	window.location = time.Local
+	if len(fields) == timeIndex+2 {
+		if window.location, err = time.LoadLocation(fields[timeIndex+1]); err != nil {
+			return Window{}, fmt.Errorf("invalid window %q: unknown time zone %q", window.text, fields[timeIndex+1])
+		}
+	}
+	return window, nil
+}
+
+// parseDays reads "Sat,Sun", "Mon-Fri" or "daily".
+func (w *Window) parseDays(text string) error {
+	for _, item := range strings.Split(strings.ToLower(text), ",") {
+		if item == "daily" || item == "*" {
+			for day := range w.days {
+				w.days[day] = true
+			}
+			continue
+		}
+
+		first, last, isRange := strings.Cut(item, "-")
+		from, ok := weekdays[first]
+		if !ok {
+			return fmt.Errorf("unknown day %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdays[last]; !ok {
+				return fmt.Errorf("unknown day %q", last)
+			}
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			w.days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseClock(text string) (int, error) {
+	clock, err := time.Parse("15:04", text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", text)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+func (w Window) String() string {
+	return w.text
+}
+
+// Empty reports whether the window is always open.
+func (w Window) Empty() bool {
+	return w.text == ""
+}
+
+// Contains reports whether t falls into the window.
+func (w Window) Contains(t time.Time) bool {
+	if w.Empty() {
+		return true
+	}
+
+	t = t.In(w.location)
+	minute := t.Hour()*60 + t.Minute()
+
+	if w.end > w.start {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+	// Past midnight: the part before midnight belongs to today, the part
+	// after it to yesterday's window.
+	if minute >= w.start {
+		return w.days[t.Weekday()]
+	}
+	if minute < w.end {
+		return w.days[(t.Weekday()+6)%7]
+	}
+	return false
+}
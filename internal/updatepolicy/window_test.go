@@ -0,0 +1,62 @@
+package updatepolicy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowContains(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	// 2026-01-03 is a Saturday.
+	at := func(day int, clock string) time.Time {
+		parsed, _ := time.Parse("15:04", clock)
+		return time.Date(2026, 1, day, parsed.Hour(), parsed.Minute(), 0, 0, berlin)
+	}
+
+	tests := []struct {
+		window string
+		open   []time.Time
+		closed []time.Time
+	}{
+		{"", []time.Time{at(5, "12:00")}, nil},
+		{"Sat,Sun 02:00-05:00 Europe/Berlin", []time.Time{at(3, "02:00"), at(4, "04:59")}, []time.Time{at(3, "05:00"), at(5, "03:00")}},
+		// Past midnight: Friday's window runs into Saturday morning.
+		{"Mon-Fri 22:00-02:00 Europe/Berlin", []time.Time{at(2, "23:00"), at(3, "01:00")}, []time.Time{at(3, "23:00"), at(5, "01:00"), at(5, "12:00")}},
+		{"Fri-Mon 03:00-04:00 Europe/Berlin", []time.Time{at(4, "03:30"), at(5, "03:30")}, []time.Time{at(6, "03:30")}},
+		{"daily 03:00-04:00 Europe/Berlin", []time.Time{at(6, "03:30")}, []time.Time{at(6, "04:30")}},
+	}
+	for _, tt := range tests {
+		window, err := ParseWindow(tt.window)
+		if err != nil {
+			t.Errorf("ParseWindow(%q): %v", tt.window, err)
+			continue
+		}
+		for _, moment := range tt.open {
+			if !window.Contains(moment) {
+				t.Errorf("%q closed at %s", tt.window, moment.Format(time.RFC1123))
+			}
+		}
+		for _, moment := range tt.closed {
+			if window.Contains(moment) {
+				t.Errorf("%q open at %s", tt.window, moment.Format(time.RFC1123))
+			}
+		}
+	}
+
+	// The time zone of the window applies, not the one of the time.
+	window, _ := ParseWindow("03:00-04:00 Europe/Berlin")
+	if !window.Contains(time.Date(2026, 1, 6, 2, 30, 0, 0, time.UTC)) {
+		t.Error("window compared in UTC")
+	}
+}
+
+func TestParseWindowRejectsInvalidWindows(t *testing.T) {
+	for _, invalid := range []string{"Sat", "Sat 02:00", "Caturday 02:00-03:00", "02:00-25:00", "Sat 02:00-03:00 Mars/Olympus", "Sat Sun 02:00-03:00"} {
+		if _, err := ParseWindow(invalid); err == nil {
+			t.Errorf("ParseWindow(%q) did not fail", invalid)
+		}
+	}
+}